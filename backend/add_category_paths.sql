@@ -0,0 +1,26 @@
+-- Add materialized paths to product_categories
+-- The path is the slash-separated list of slugs from the root category,
+-- e.g. "furniture/chairs/dining-chairs". It is maintained by the API
+-- whenever a category is created, renamed or reparented.
+
+ALTER TABLE product_categories
+ADD COLUMN IF NOT EXISTS path TEXT;
+
+-- Backfill paths for existing categories
+WITH RECURSIVE category_paths AS (
+  SELECT id, slug::TEXT AS path
+  FROM product_categories
+  WHERE parent_id IS NULL
+  UNION ALL
+  SELECT c.id, cp.path || '/' || c.slug
+  FROM product_categories c
+  JOIN category_paths cp ON c.parent_id = cp.id
+)
+UPDATE product_categories pc
+SET path = category_paths.path
+FROM category_paths
+WHERE pc.id = category_paths.id;
+
+CREATE INDEX IF NOT EXISTS idx_categories_path ON product_categories(path);
+
+COMMENT ON COLUMN product_categories.path IS 'Slash-separated slugs from the root category, maintained by the API';
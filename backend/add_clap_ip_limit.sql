@@ -0,0 +1,56 @@
+-- Per-IP clap cap
+-- The per-reader cap is keyed on an ID the client chooses, so add_claps also caps the
+-- claps coming from one IP address to a post. Addresses are stored as HMACs keyed
+-- with TOKEN_SECRET, so they can't be recovered by hashing every address.
+
+CREATE TABLE IF NOT EXISTS post_clap_ips (
+  post_slug TEXT NOT NULL REFERENCES posts(slug) ON UPDATE CASCADE ON DELETE CASCADE,
+  ip_hash TEXT NOT NULL,
+  claps INTEGER NOT NULL DEFAULT 0 CHECK (claps >= 0),
+  updated_at TIMESTAMPTZ DEFAULT NOW(),
+  PRIMARY KEY (post_slug, ip_hash)
+);
+
+DROP FUNCTION IF EXISTS add_claps(TEXT, TEXT, INTEGER, INTEGER);
+
+CREATE OR REPLACE FUNCTION add_claps(p_slug TEXT, p_reader TEXT, p_ip TEXT, p_count INTEGER, p_max INTEGER, p_ip_max INTEGER)
+RETURNS TABLE (total INTEGER, reader_claps INTEGER, added INTEGER) AS $$
+DECLARE
+  previous INTEGER;
+  ip_previous INTEGER;
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM posts WHERE slug = p_slug) THEN
+    RETURN;
+  END IF;
+
+  INSERT INTO post_claps (post_slug, reader_id) VALUES (p_slug, p_reader)
+  ON CONFLICT (post_slug, reader_id) DO NOTHING;
+  INSERT INTO post_clap_ips (post_slug, ip_hash) VALUES (p_slug, p_ip)
+  ON CONFLICT (post_slug, ip_hash) DO NOTHING;
+
+  SELECT claps INTO previous FROM post_claps
+  WHERE post_slug = p_slug AND reader_id = p_reader
+  FOR UPDATE;
+  SELECT claps INTO ip_previous FROM post_clap_ips
+  WHERE post_slug = p_slug AND ip_hash = p_ip
+  FOR UPDATE;
+
+  added := GREATEST(LEAST(GREATEST(p_count, 0), p_max - previous, p_ip_max - ip_previous), 0);
+  reader_claps := previous + added;
+
+  IF added > 0 THEN
+    UPDATE post_claps SET claps = reader_claps, updated_at = NOW()
+    WHERE post_slug = p_slug AND reader_id = p_reader;
+    UPDATE post_clap_ips SET claps = ip_previous + added, updated_at = NOW()
+    WHERE post_slug = p_slug AND ip_hash = p_ip;
+  END IF;
+
+  UPDATE posts SET claps = COALESCE(claps, 0) + added
+  WHERE slug = p_slug
+  RETURNING claps INTO total;
+
+  RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+COMMENT ON TABLE post_clap_ips IS 'How many times each client IP clapped a post (capped by the API)';
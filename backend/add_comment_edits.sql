@@ -0,0 +1,23 @@
+-- Comment editing and self-deletion
+-- Commenters get a signed edit token when they post. Edits keep the previous body in
+-- comment_revisions for moderators; comments with replies are blanked rather than
+-- removed so the thread stays intact.
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS edited_at TIMESTAMPTZ;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS edited BOOLEAN GENERATED ALWAYS AS (edited_at IS NOT NULL) STORED;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS comment_revisions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  comment_id UUID NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+  body TEXT NOT NULL,
+  status TEXT NOT NULL,
+  action TEXT NOT NULL CHECK (action IN ('edit', 'delete')),
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_revisions_comment ON comment_revisions(comment_id, created_at DESC);
+
+COMMENT ON COLUMN comments.edited IS 'Shown to readers as an "edited" marker';
+COMMENT ON COLUMN comments.deleted_at IS 'Set when the author deleted a comment that has replies; the body is blanked';
+COMMENT ON TABLE comment_revisions IS 'Bodies of comments before each author edit or deletion, kept for moderation';
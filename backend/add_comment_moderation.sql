@@ -0,0 +1,24 @@
+-- Comment moderation
+-- Comments now carry a moderation status. Existing comments are kept as approved;
+-- new ones start as pending until the spam check or an admin approves them.
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS status TEXT DEFAULT 'approved';
+ALTER TABLE comments ALTER COLUMN status SET DEFAULT 'pending';
+UPDATE comments SET status = 'approved' WHERE status IS NULL;
+ALTER TABLE comments ALTER COLUMN status SET NOT NULL;
+
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_status_check;
+ALTER TABLE comments ADD CONSTRAINT comments_status_check
+  CHECK (status IN ('pending', 'approved', 'spam', 'rejected'));
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS spam_score NUMERIC(4,2) DEFAULT 0;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS spam_reasons JSONB DEFAULT '[]'::jsonb;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS author_ip TEXT;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS moderated_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_comments_status ON comments(status, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_comments_post_status ON comments(post_slug, status);
+CREATE INDEX IF NOT EXISTS idx_comments_author_email ON comments(LOWER(author_email));
+
+COMMENT ON COLUMN comments.status IS 'Moderation status: pending, approved, spam or rejected. Only approved comments are public';
+COMMENT ON COLUMN comments.spam_score IS 'Score from the spam checker; 1 or more is treated as spam';
@@ -0,0 +1,27 @@
+-- Threaded comments
+-- Replies point at their parent comment and the root of their thread. Repliers'
+-- parents are emailed unless they unsubscribed from the thread, and post authors
+-- get a digest of comments not yet included in one.
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES comments(id) ON DELETE CASCADE;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS root_id UUID REFERENCES comments(id) ON DELETE CASCADE;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS depth INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS reply_notified_at TIMESTAMPTZ;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS digested_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent ON comments(parent_id);
+CREATE INDEX IF NOT EXISTS idx_comments_root ON comments(root_id);
+CREATE INDEX IF NOT EXISTS idx_comments_digest ON comments(status, digested_at);
+
+-- Optional per-post author address for the comment digest (falls back to BLOG_AUTHOR_EMAIL)
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS author_email TEXT;
+
+CREATE TABLE IF NOT EXISTS comment_thread_unsubscribes (
+  root_comment_id UUID NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+  email TEXT NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT NOW(),
+  PRIMARY KEY (root_comment_id, email)
+);
+
+COMMENT ON COLUMN comments.root_id IS 'Top-level comment of the thread; NULL for top-level comments themselves';
+COMMENT ON TABLE comment_thread_unsubscribes IS 'Commenters who opted out of reply emails for a thread';
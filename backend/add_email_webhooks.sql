@@ -0,0 +1,34 @@
+-- Resend webhook ingestion
+-- Every verified webhook is logged once by its svix id, so Resend's retries are ignored.
+-- Delivery outcomes are stamped on the matching newsletter_deliveries row (by Resend
+-- email id) and rolled up into the campaign's counts. Hard bounces and spam complaints
+-- move the subscriber to the bounced or complained status, which stops further sends.
+
+CREATE TABLE IF NOT EXISTS email_webhook_events (
+  svix_id TEXT PRIMARY KEY,
+  event_type TEXT NOT NULL,
+  email_id TEXT,
+  recipient TEXT,
+  payload JSONB NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_webhook_events_email ON email_webhook_events(email_id);
+
+ALTER TABLE newsletter_deliveries ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMPTZ;
+ALTER TABLE newsletter_deliveries ADD COLUMN IF NOT EXISTS delayed_at TIMESTAMPTZ;
+ALTER TABLE newsletter_deliveries ADD COLUMN IF NOT EXISTS bounced_at TIMESTAMPTZ;
+ALTER TABLE newsletter_deliveries ADD COLUMN IF NOT EXISTS bounce_type TEXT;
+ALTER TABLE newsletter_deliveries ADD COLUMN IF NOT EXISTS complained_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_newsletter_deliveries_provider_message ON newsletter_deliveries(provider_message_id);
+
+ALTER TABLE newsletters ADD COLUMN IF NOT EXISTS delivered_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE newsletters ADD COLUMN IF NOT EXISTS bounce_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE newsletters ADD COLUMN IF NOT EXISTS complaint_count INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE newsletter_subscribers ADD COLUMN IF NOT EXISTS status_reason TEXT;
+
+COMMENT ON TABLE email_webhook_events IS 'Verified Resend webhooks, keyed by svix id to drop retries';
+COMMENT ON COLUMN newsletter_deliveries.bounce_type IS 'Resend bounce type: Permanent, Transient or Undetermined';
+COMMENT ON COLUMN newsletter_subscribers.status_reason IS 'Why the subscriber was moved to bounced or complained';
@@ -0,0 +1,10 @@
+-- Weekly newsletter digest
+-- Digest campaigns generated on the schedule carry the date they were generated for.
+-- The unique index keeps a restart or a second instance from producing the same week's
+-- digest twice; digests created by hand from the admin leave it empty.
+
+ALTER TABLE newsletters ADD COLUMN IF NOT EXISTS digest_date DATE;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_newsletters_digest_date ON newsletters(digest_date) WHERE digest_date IS NOT NULL;
+
+COMMENT ON COLUMN newsletters.digest_date IS 'Set on scheduled weekly digests; null for every other campaign';
@@ -0,0 +1,18 @@
+-- Newsletter double opt-in
+-- Sign-ups start out pending and only become subscribed once the signed link in the
+-- confirmation email is followed. Pending rows that are never confirmed are purged once
+-- the link has expired. Sources configured for single opt-in (e.g. imported lists) are
+-- subscribed straight away.
+
+ALTER TABLE newsletter_subscribers ADD COLUMN IF NOT EXISTS confirmation_sent_at TIMESTAMPTZ;
+ALTER TABLE newsletter_subscribers ADD COLUMN IF NOT EXISTS confirmed_at TIMESTAMPTZ;
+
+-- Everyone subscribed before double opt-in counts as confirmed
+UPDATE newsletter_subscribers SET confirmed_at = subscribed_at
+WHERE confirmed_at IS NULL AND status = 'subscribed';
+
+CREATE INDEX IF NOT EXISTS idx_newsletter_subscribers_pending ON newsletter_subscribers(confirmation_sent_at)
+  WHERE status = 'pending';
+
+COMMENT ON COLUMN newsletter_subscribers.confirmation_sent_at IS 'When the latest confirmation email was sent';
+COMMENT ON COLUMN newsletter_subscribers.confirmed_at IS 'When the subscriber first confirmed; null for single opt-in sign-ups that were never asked';
@@ -0,0 +1,38 @@
+-- Lowercase newsletter subscriber emails
+-- The API stores and looks up subscribers by their lowercased address, so rows saved
+-- before it did with capitals in them were never matched: signing up again created a
+-- second row, and bounces and complaints couldn't suppress the first. This merges each
+-- address's rows into one, lowercases what is left, and keeps it that way with a
+-- unique index.
+
+BEGIN;
+
+-- Keep one row per address. A bounce or complaint wins so the address stays
+-- suppressed, then the row that is subscribed, then the oldest.
+WITH ranked AS (
+  SELECT id, ROW_NUMBER() OVER (
+    PARTITION BY LOWER(TRIM(email))
+    ORDER BY
+      CASE status
+        WHEN 'complained' THEN 0
+        WHEN 'bounced' THEN 1
+        WHEN 'subscribed' THEN 2
+        WHEN 'pending' THEN 3
+        ELSE 4
+      END,
+      subscribed_at NULLS LAST,
+      id
+  ) AS position
+  FROM newsletter_subscribers
+)
+DELETE FROM newsletter_subscribers s
+USING ranked r
+WHERE s.id = r.id AND r.position > 1;
+
+UPDATE newsletter_subscribers SET email = LOWER(TRIM(email))
+WHERE email <> LOWER(TRIM(email));
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_newsletter_subscribers_email_lower
+  ON newsletter_subscribers (LOWER(email));
+
+COMMIT;
@@ -0,0 +1,39 @@
+-- Recount a campaign's tracking counts
+-- The insert trigger in add_newsletter_tracking.sql only ever adds to open_count,
+-- click_count and unique_click_count. When events are deleted, as when a subscriber
+-- opts out of tracking, the API calls this to recount the affected campaigns from
+-- the events that are left. Recipients with no events left are dropped from
+-- newsletter_event_recipients, so their next open or click counts as unique again.
+
+CREATE OR REPLACE FUNCTION recount_newsletter_events(p_newsletter_ids UUID[])
+RETURNS INTEGER AS $$
+DECLARE
+  updated INTEGER;
+BEGIN
+  DELETE FROM newsletter_event_recipients r
+  WHERE r.newsletter_id = ANY(p_newsletter_ids)
+    AND NOT EXISTS (
+      SELECT 1 FROM newsletter_events e
+      WHERE e.newsletter_id = r.newsletter_id AND e.event_type = r.event_type
+        AND e.email = r.email
+    );
+
+  UPDATE newsletters n SET
+    open_count = (
+      SELECT COUNT(DISTINCT email) FROM newsletter_events e
+      WHERE e.newsletter_id = n.id AND e.event_type = 'open'
+    ),
+    click_count = (
+      SELECT COUNT(*) FROM newsletter_events e
+      WHERE e.newsletter_id = n.id AND e.event_type = 'click'
+    ),
+    unique_click_count = (
+      SELECT COUNT(DISTINCT email) FROM newsletter_events e
+      WHERE e.newsletter_id = n.id AND e.event_type = 'click'
+    )
+  WHERE n.id = ANY(p_newsletter_ids);
+
+  GET DIAGNOSTICS updated = ROW_COUNT;
+  RETURN updated;
+END;
+$$ LANGUAGE plpgsql;
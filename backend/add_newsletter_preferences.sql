@@ -0,0 +1,16 @@
+-- Newsletter preference center
+-- Subscribers pick the blog categories they want to hear about and how often. A campaign
+-- tagged with topics only goes to subscribers following one of them (or following
+-- everything); subscribers on a weekly or monthly frequency are skipped until that long
+-- has passed since the last newsletter they were sent.
+
+ALTER TABLE newsletter_subscribers ADD COLUMN IF NOT EXISTS topics TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE newsletter_subscribers ADD COLUMN IF NOT EXISTS frequency TEXT NOT NULL DEFAULT 'all'
+  CHECK (frequency IN ('all', 'weekly', 'monthly'));
+ALTER TABLE newsletter_subscribers ADD COLUMN IF NOT EXISTS last_newsletter_at TIMESTAMPTZ;
+
+ALTER TABLE newsletters ADD COLUMN IF NOT EXISTS topics TEXT[] NOT NULL DEFAULT '{}';
+
+COMMENT ON COLUMN newsletter_subscribers.topics IS 'Blog category slugs the subscriber follows; empty means all of them';
+COMMENT ON COLUMN newsletter_subscribers.frequency IS 'all, weekly or monthly';
+COMMENT ON COLUMN newsletters.topics IS 'Blog category slugs the campaign is about; empty means it goes to everyone';
@@ -0,0 +1,83 @@
+-- Newsletter open and click tracking
+-- Tracked emails carry a signed pixel and signed redirect links per recipient. Every hit
+-- is stored in newsletter_events; a trigger keeps the campaign's unique open and click
+-- counts current so the stats don't have to scan the events. Subscribers who opt out of
+-- tracking get emails without the pixel and with their links left as they are.
+-- newsletter_event_recipients holds one row per campaign, event type and recipient;
+-- the trigger claims that row to decide whether an event is the recipient's first.
+
+ALTER TABLE newsletter_subscribers ADD COLUMN IF NOT EXISTS tracking_opt_out BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE newsletter_deliveries ADD COLUMN IF NOT EXISTS tracked BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE newsletters ADD COLUMN IF NOT EXISTS tracked_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE newsletters ADD COLUMN IF NOT EXISTS unique_click_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS newsletter_events (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  newsletter_id UUID NOT NULL REFERENCES newsletters(id) ON DELETE CASCADE,
+  email TEXT NOT NULL,
+  event_type TEXT NOT NULL CHECK (event_type IN ('open', 'click')),
+  url TEXT,
+  user_agent TEXT,
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_newsletter_events_recipient ON newsletter_events(newsletter_id, event_type, email);
+
+CREATE TABLE IF NOT EXISTS newsletter_event_recipients (
+  newsletter_id UUID NOT NULL REFERENCES newsletters(id) ON DELETE CASCADE,
+  event_type TEXT NOT NULL,
+  email TEXT NOT NULL,
+  PRIMARY KEY (newsletter_id, event_type, email)
+);
+
+-- Recipients with events recorded before the table existed
+INSERT INTO newsletter_event_recipients (newsletter_id, event_type, email)
+SELECT DISTINCT newsletter_id, event_type, email FROM newsletter_events
+ON CONFLICT DO NOTHING;
+
+-- Clicks per link of each campaign
+CREATE OR REPLACE VIEW newsletter_link_clicks AS
+SELECT newsletter_id, url,
+  COUNT(*) AS clicks,
+  COUNT(DISTINCT email) AS unique_clicks
+FROM newsletter_events
+WHERE event_type = 'click'
+GROUP BY newsletter_id, url;
+
+-- open_count counts recipients who opened, click_count every click and
+-- unique_click_count recipients who clicked. Concurrent first events from one recipient
+-- can't both see no earlier event: only one of them inserts the recipient row, the other
+-- waits on its key and then finds it taken.
+CREATE OR REPLACE FUNCTION count_newsletter_event() RETURNS TRIGGER AS $$
+DECLARE
+  first_event BOOLEAN;
+BEGIN
+  INSERT INTO newsletter_event_recipients (newsletter_id, event_type, email)
+  VALUES (NEW.newsletter_id, NEW.event_type, NEW.email)
+  ON CONFLICT DO NOTHING;
+  first_event := FOUND;
+
+  IF NEW.event_type = 'open' THEN
+    IF first_event THEN
+      UPDATE newsletters SET open_count = open_count + 1 WHERE id = NEW.newsletter_id;
+    END IF;
+  ELSE
+    UPDATE newsletters SET
+      click_count = click_count + 1,
+      unique_click_count = unique_click_count + CASE WHEN first_event THEN 1 ELSE 0 END
+    WHERE id = NEW.newsletter_id;
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS newsletter_events_count ON newsletter_events;
+CREATE TRIGGER newsletter_events_count
+  AFTER INSERT ON newsletter_events
+  FOR EACH ROW EXECUTE FUNCTION count_newsletter_event();
+
+COMMENT ON TABLE newsletter_events IS 'Opens and clicks of tracked newsletter emails';
+COMMENT ON TABLE newsletter_event_recipients IS 'Recipients with at least one open or click of a campaign; decides which events are unique';
+COMMENT ON COLUMN newsletter_subscribers.tracking_opt_out IS 'Send this subscriber newsletters without open and click tracking';
+COMMENT ON COLUMN newsletter_deliveries.tracked IS 'Whether the email sent to this recipient was instrumented';
+COMMENT ON COLUMN newsletters.tracked_count IS 'Recipients sent a tracked email; the denominator of the open and click rates';
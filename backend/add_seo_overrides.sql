@@ -0,0 +1,11 @@
+-- Per-item SEO overrides
+-- GetPost, GetGuide and GetProduct generate title, description, canonical URL, Open
+-- Graph, Twitter and JSON-LD metadata; admins can replace any of it per item.
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS seo_overrides JSONB;
+ALTER TABLE guides ADD COLUMN IF NOT EXISTS seo_overrides JSONB;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS seo_overrides JSONB;
+
+COMMENT ON COLUMN posts.seo_overrides IS 'Admin overrides for generated SEO fields, e.g. {"title": "...", "description": "...", "noindex": true}';
+COMMENT ON COLUMN guides.seo_overrides IS 'Admin overrides for generated SEO fields';
+COMMENT ON COLUMN products.seo_overrides IS 'Admin overrides for generated SEO fields';
@@ -0,0 +1,21 @@
+-- Add rule-based (smart) collections
+-- Manual collections keep their membership in product_collection_items.
+-- Smart collections store a rule set that is evaluated against the catalog
+-- whenever the collection's products are requested.
+
+ALTER TABLE product_collections
+ADD COLUMN IF NOT EXISTS collection_type TEXT NOT NULL DEFAULT 'manual',
+ADD COLUMN IF NOT EXISTS rules JSONB,
+ADD COLUMN IF NOT EXISTS rules_match TEXT NOT NULL DEFAULT 'all';
+
+ALTER TABLE product_collections
+DROP CONSTRAINT IF EXISTS product_collections_type_check;
+ALTER TABLE product_collections
+ADD CONSTRAINT product_collections_type_check CHECK (collection_type IN ('manual', 'smart'));
+
+ALTER TABLE product_collections
+DROP CONSTRAINT IF EXISTS product_collections_rules_match_check;
+ALTER TABLE product_collections
+ADD CONSTRAINT product_collections_rules_match_check CHECK (rules_match IN ('all', 'any'));
+
+COMMENT ON COLUMN product_collections.rules IS 'Smart collection rules, e.g. [{"type": "tag_contains", "value": "oak"}, {"type": "price_below", "amount": 50000}]';
@@ -3,24 +3,49 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
 
 // Config holds all configuration for the application
 type Config struct {
-	SupabaseURL        string
-	SupabaseKey        string
-	ResendAPIKey       string
-	AdminUsername      string
-	AdminPassword      string
-	Port               string
-	FromEmail          string
-	WebsiteURL         string
-	DatabaseURL        string
-	CloudinaryName     string
-	CloudinaryAPIKey   string
-	CloudinaryAPISecret string
+	SupabaseURL            string
+	SupabaseKey            string
+	ResendAPIKey           string
+	AdminUsername          string
+	AdminPassword          string
+	Port                   string
+	FromEmail              string
+	WebsiteURL             string
+	DatabaseURL            string
+	CloudinaryName         string
+	CloudinaryAPIKey       string
+	CloudinaryAPISecret    string
+	ShopOwnerEmail         string
+	LowStockDigestHour     int
+	CommentBlocklist       string
+	BackendURL             string
+	TokenSecret            string
+	BlogAuthorEmail        string
+	CommentDigestHour      int
+	NewsletterWorkers      int
+	NewsletterRate         int
+	NewsletterMaxTries     int
+	ResendWebhookSecret    string
+	NewsletterConfirmHours int
+	NewsletterSingleOptIn  string
+	NewsletterDigestMode   string
+	NewsletterDigestDay    string
+	NewsletterDigestHour   int
+	NewsletterDigestDays   int
+	EmailTransport         string
+	SMTPHost               string
+	SMTPPort               int
+	SMTPUsername           string
+	SMTPPassword           string
+	SMTPTLS                string
+	EmailOutboxDir         string
 }
 
 // Load reads configuration from environment variables
@@ -31,18 +56,42 @@ func Load() *Config {
 	}
 
 	config := &Config{
-		SupabaseURL:         getEnv("SUPABASE_URL", ""),
-		SupabaseKey:         getEnv("SUPABASE_ANON_KEY", ""),
-		ResendAPIKey:        getEnv("RESEND_API_KEY", ""),
-		AdminUsername:       getEnv("ADMIN_USERNAME", "admin"),
-		AdminPassword:       getEnv("ADMIN_PASSWORD", "password"),
-		Port:                getEnv("PORT", "8080"),
-		FromEmail:           getEnv("FROM_EMAIL", "onboarding@resend.dev"),
-		WebsiteURL:          getEnv("WEBSITE_URL", "https://yourdomain.com"),
-		DatabaseURL:         getEnv("DATABASE_URL", ""),
-		CloudinaryName:      getEnv("CLOUDINARY_CLOUD_NAME", ""),
-		CloudinaryAPIKey:    getEnv("CLOUDINARY_API_KEY", ""),
-		CloudinaryAPISecret: getEnv("CLOUDINARY_API_SECRET", ""),
+		SupabaseURL:            getEnv("SUPABASE_URL", ""),
+		SupabaseKey:            getEnv("SUPABASE_ANON_KEY", ""),
+		ResendAPIKey:           getEnv("RESEND_API_KEY", ""),
+		AdminUsername:          getEnv("ADMIN_USERNAME", "admin"),
+		AdminPassword:          getEnv("ADMIN_PASSWORD", "password"),
+		Port:                   getEnv("PORT", "8080"),
+		FromEmail:              getEnv("FROM_EMAIL", "onboarding@resend.dev"),
+		WebsiteURL:             getEnv("WEBSITE_URL", "https://yourdomain.com"),
+		DatabaseURL:            getEnv("DATABASE_URL", ""),
+		CloudinaryName:         getEnv("CLOUDINARY_CLOUD_NAME", ""),
+		CloudinaryAPIKey:       getEnv("CLOUDINARY_API_KEY", ""),
+		CloudinaryAPISecret:    getEnv("CLOUDINARY_API_SECRET", ""),
+		ShopOwnerEmail:         getEnv("SHOP_OWNER_EMAIL", ""),
+		LowStockDigestHour:     getEnvInt("LOW_STOCK_DIGEST_HOUR", 8),
+		CommentBlocklist:       getEnv("COMMENT_BLOCKLIST", ""),
+		BackendURL:             getEnv("BACKEND_URL", "http://localhost:8080"),
+		TokenSecret:            getEnv("TOKEN_SECRET", ""),
+		BlogAuthorEmail:        getEnv("BLOG_AUTHOR_EMAIL", ""),
+		CommentDigestHour:      getEnvInt("COMMENT_DIGEST_HOUR", 18),
+		NewsletterWorkers:      getEnvInt("NEWSLETTER_WORKERS", 2),
+		NewsletterRate:         getEnvInt("NEWSLETTER_RATE_PER_SECOND", 2),
+		NewsletterMaxTries:     getEnvInt("NEWSLETTER_MAX_ATTEMPTS", 5),
+		ResendWebhookSecret:    getEnv("RESEND_WEBHOOK_SECRET", ""),
+		NewsletterConfirmHours: getEnvInt("NEWSLETTER_CONFIRM_HOURS", 48),
+		NewsletterSingleOptIn:  getEnv("NEWSLETTER_SINGLE_OPT_IN_SOURCES", ""),
+		NewsletterDigestMode:   getEnv("NEWSLETTER_DIGEST_MODE", "draft"),
+		NewsletterDigestDay:    getEnv("NEWSLETTER_DIGEST_DAY", "monday"),
+		NewsletterDigestHour:   getEnvInt("NEWSLETTER_DIGEST_HOUR", 9),
+		NewsletterDigestDays:   getEnvInt("NEWSLETTER_DIGEST_DAYS", 7),
+		EmailTransport:         getEnv("EMAIL_TRANSPORT", ""),
+		SMTPHost:               getEnv("SMTP_HOST", ""),
+		SMTPPort:               getEnvInt("SMTP_PORT", 587),
+		SMTPUsername:           getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:           getEnv("SMTP_PASSWORD", ""),
+		SMTPTLS:                getEnv("SMTP_TLS", "starttls"),
+		EmailOutboxDir:         getEnv("EMAIL_OUTBOX_DIR", "outbox"),
 	}
 
 	// Validate required configs
@@ -50,8 +99,16 @@ func Load() *Config {
 		log.Fatal("SUPABASE_URL and SUPABASE_ANON_KEY are required")
 	}
 
-	if config.ResendAPIKey == "" {
-		log.Println("Warning: RESEND_API_KEY not set, email sending will be disabled")
+	if config.TokenSecret == "" {
+		log.Fatal("TOKEN_SECRET is required to sign links in emails")
+	}
+
+	if config.ResendAPIKey == "" && config.EmailTransport == "" {
+		log.Println("Warning: RESEND_API_KEY and EMAIL_TRANSPORT not set, email sending will be disabled")
+	}
+
+	if config.ResendWebhookSecret == "" {
+		log.Println("Warning: RESEND_WEBHOOK_SECRET not set, bounce and complaint webhooks will be rejected")
 	}
 
 	return config
@@ -64,3 +121,14 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getEnvInt gets an integer environment variable with a fallback value
+func getEnvInt(key string, fallback int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+		log.Printf("Warning: %s is not a number, using %d", key, fallback)
+	}
+	return fallback
+}
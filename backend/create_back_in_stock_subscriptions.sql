@@ -0,0 +1,18 @@
+-- Back-in-stock notifications
+-- Shoppers leave their email on a sold-out product or variant; once stock comes
+-- back above zero they are emailed and their subscription is removed.
+
+CREATE TABLE IF NOT EXISTS back_in_stock_subscriptions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  variant_id UUID REFERENCES product_variants(id) ON DELETE CASCADE,
+  email TEXT NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- One subscription per shopper per product/variant
+CREATE UNIQUE INDEX IF NOT EXISTS idx_back_in_stock_unique
+  ON back_in_stock_subscriptions(product_id, COALESCE(variant_id, '00000000-0000-0000-0000-000000000000'::UUID), LOWER(email));
+CREATE INDEX IF NOT EXISTS idx_back_in_stock_product ON back_in_stock_subscriptions(product_id);
+
+COMMENT ON TABLE back_in_stock_subscriptions IS 'Shoppers waiting to be emailed when a sold-out product or variant is restocked';
@@ -0,0 +1,78 @@
+-- Content analytics
+-- Page views and read progress for posts and guides are ingested as raw events
+-- into an append-only table, then rolled up per day, per item by the API.
+
+CREATE TABLE IF NOT EXISTS content_events (
+  id BIGSERIAL PRIMARY KEY,
+  content_type TEXT NOT NULL CHECK (content_type IN ('post', 'guide')),
+  slug TEXT NOT NULL,
+  event_type TEXT NOT NULL CHECK (event_type IN ('page_view', 'read_progress')),
+  progress SMALLINT CHECK (progress BETWEEN 0 AND 100),
+  session_id TEXT,
+  referrer_host TEXT,
+  utm_source TEXT,
+  utm_medium TEXT,
+  utm_campaign TEXT,
+  device TEXT NOT NULL DEFAULT 'unknown' CHECK (device IN ('desktop', 'mobile', 'tablet', 'unknown')),
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_content_events_created ON content_events(created_at);
+CREATE INDEX IF NOT EXISTS idx_content_events_content ON content_events(content_type, slug, created_at);
+
+-- Events are never edited or removed once written
+CREATE OR REPLACE FUNCTION content_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+  RAISE EXCEPTION 'content_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS content_events_append_only ON content_events;
+CREATE TRIGGER content_events_append_only
+  BEFORE UPDATE OR DELETE ON content_events
+  FOR EACH ROW EXECUTE FUNCTION content_events_append_only();
+
+-- Daily totals per post or guide
+CREATE TABLE IF NOT EXISTS content_daily_stats (
+  day DATE NOT NULL,
+  content_type TEXT NOT NULL,
+  slug TEXT NOT NULL,
+  views INTEGER NOT NULL DEFAULT 0,
+  unique_visitors INTEGER NOT NULL DEFAULT 0,
+  reads INTEGER NOT NULL DEFAULT 0,
+  avg_read_depth NUMERIC(5,2) NOT NULL DEFAULT 0,
+  updated_at TIMESTAMPTZ DEFAULT NOW(),
+  PRIMARY KEY (day, content_type, slug)
+);
+
+-- Daily view counts per referrer, UTM parameter and device
+CREATE TABLE IF NOT EXISTS content_daily_breakdowns (
+  day DATE NOT NULL,
+  content_type TEXT NOT NULL,
+  slug TEXT NOT NULL,
+  dimension TEXT NOT NULL CHECK (dimension IN ('referrer', 'utm_source', 'utm_medium', 'utm_campaign', 'device')),
+  value TEXT NOT NULL,
+  views INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (day, content_type, slug, dimension, value)
+);
+
+CREATE INDEX IF NOT EXISTS idx_content_daily_stats_content ON content_daily_stats(content_type, slug, day);
+
+-- Atomic view counter, used through PostgREST when there is no direct connection
+CREATE OR REPLACE FUNCTION increment_content_views(p_content_type TEXT, p_slug TEXT) RETURNS INTEGER AS $$
+DECLARE
+  new_views INTEGER;
+BEGIN
+  IF p_content_type = 'guide' THEN
+    UPDATE guides SET views = COALESCE(views, 0) + 1 WHERE slug = p_slug RETURNING views INTO new_views;
+  ELSE
+    UPDATE posts SET views = COALESCE(views, 0) + 1 WHERE slug = p_slug RETURNING views INTO new_views;
+  END IF;
+  RETURN new_views;
+END;
+$$ LANGUAGE plpgsql;
+
+COMMENT ON TABLE content_events IS 'Append-only page view and read progress events for posts and guides';
+COMMENT ON TABLE content_daily_stats IS 'Daily rollup of content_events per post or guide';
+COMMENT ON TABLE content_daily_breakdowns IS 'Daily rollup of page views by referrer, UTM parameter and device';
+COMMENT ON COLUMN content_daily_stats.reads IS 'Sessions that scrolled through at least 75% of the item';
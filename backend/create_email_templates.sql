@@ -0,0 +1,14 @@
+-- Email template overrides
+-- Emails are rendered from the templates built into the backend. A row here replaces
+-- the subject and content block of one of them (welcome, newsletter, newsletter_digest,
+-- order_confirmation) while keeping the shared layout, header and footer. Deleting the
+-- row restores the built-in template.
+
+CREATE TABLE IF NOT EXISTS email_templates (
+  name TEXT PRIMARY KEY,
+  subject TEXT NOT NULL,
+  body TEXT NOT NULL,
+  updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+COMMENT ON TABLE email_templates IS 'Admin overrides of built-in email templates; subject and body are Go html/template source';
@@ -0,0 +1,31 @@
+-- Inventory ledger and reorder thresholds
+-- Every stock change is recorded as a ledger entry with a reason, and the stock
+-- columns on products and product_variants are only moved by the API together
+-- with a matching entry.
+
+ALTER TABLE products
+ADD COLUMN IF NOT EXISTS reorder_threshold INTEGER CHECK (reorder_threshold >= 0);
+
+ALTER TABLE product_variants
+ADD COLUMN IF NOT EXISTS reorder_threshold INTEGER CHECK (reorder_threshold >= 0);
+
+CREATE TABLE IF NOT EXISTS inventory_ledger (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  variant_id UUID REFERENCES product_variants(id) ON DELETE SET NULL,
+  delta INTEGER NOT NULL,
+  reason TEXT NOT NULL CHECK (reason IN ('sale', 'restock', 'manual_correction', 'refund')),
+  order_id UUID REFERENCES orders(id) ON DELETE SET NULL,
+  note TEXT,
+  stock_before INTEGER NOT NULL,
+  stock_after INTEGER NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_ledger_product ON inventory_ledger(product_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_inventory_ledger_variant ON inventory_ledger(variant_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_inventory_ledger_reason ON inventory_ledger(reason, created_at DESC);
+
+COMMENT ON TABLE inventory_ledger IS 'Append-only record of stock movements (sales, restocks, corrections, refunds)';
+COMMENT ON COLUMN products.reorder_threshold IS 'Stock level at or below which the product counts as low stock (defaults to 5 when null)';
+COMMENT ON COLUMN product_variants.reorder_threshold IS 'Stock level at or below which the variant counts as low stock (defaults to 5 when null)';
@@ -0,0 +1,27 @@
+-- Newsletter delivery queue
+-- Each campaign is expanded into one row per recipient when it starts sending. Workers
+-- claim pending rows, so a restarted server picks up where it stopped, and every email
+-- is sent with the row id as its idempotency key so a retried send is never delivered twice.
+
+CREATE TABLE IF NOT EXISTS newsletter_deliveries (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  newsletter_id UUID NOT NULL REFERENCES newsletters(id) ON DELETE CASCADE,
+  email TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sending', 'sent', 'failed')),
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_error TEXT,
+  provider_message_id TEXT,
+  sent_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ DEFAULT NOW(),
+  updated_at TIMESTAMPTZ DEFAULT NOW(),
+  UNIQUE (newsletter_id, email)
+);
+
+CREATE INDEX IF NOT EXISTS idx_newsletter_deliveries_queue ON newsletter_deliveries(newsletter_id, status, next_attempt_at);
+
+ALTER TABLE newsletters ADD COLUMN IF NOT EXISTS enqueued_at TIMESTAMPTZ;
+
+COMMENT ON TABLE newsletter_deliveries IS 'Per-recipient newsletter send queue and delivery log';
+COMMENT ON COLUMN newsletter_deliveries.provider_message_id IS 'Resend email id, used to match delivery webhooks';
+COMMENT ON COLUMN newsletters.enqueued_at IS 'When the recipient list was frozen into newsletter_deliveries';
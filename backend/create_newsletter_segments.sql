@@ -0,0 +1,23 @@
+-- Newsletter audience segments
+-- A segment is a rule set evaluated against the subscribed list whenever a campaign
+-- using it starts sending, the same way smart collections are evaluated against the
+-- catalog. Rules can look at subscriber fields, topic preferences, open and click
+-- history, and paid orders joined on the customer email.
+
+CREATE TABLE IF NOT EXISTS newsletter_segments (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name TEXT NOT NULL,
+  description TEXT,
+  rules JSONB NOT NULL DEFAULT '[]',
+  rules_match TEXT NOT NULL DEFAULT 'all' CHECK (rules_match IN ('all', 'any')),
+  created_at TIMESTAMPTZ DEFAULT NOW(),
+  updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+ALTER TABLE newsletters ADD COLUMN IF NOT EXISTS segment_id UUID REFERENCES newsletter_segments(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_newsletter_events_engagement ON newsletter_events(event_type, created_at);
+CREATE INDEX IF NOT EXISTS idx_orders_customer_email ON orders(customer_email);
+
+COMMENT ON TABLE newsletter_segments IS 'Saved newsletter audiences, e.g. [{"type": "opened_within_days", "days": 90}, {"type": "has_paid_order"}]';
+COMMENT ON COLUMN newsletters.segment_id IS 'Audience of the campaign; null sends to every subscriber';
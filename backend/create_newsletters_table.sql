@@ -0,0 +1,30 @@
+-- Newsletter campaigns
+-- Campaigns are saved as drafts, optionally scheduled, and sent by the scheduler in
+-- main.go once scheduled_for has passed. Status moves draft -> scheduled -> sending ->
+-- sent, or failed when no email could be delivered.
+
+CREATE TABLE IF NOT EXISTS newsletters (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  subject TEXT NOT NULL,
+  content TEXT NOT NULL,
+  html_content TEXT,
+  status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'scheduled', 'sending', 'sent', 'failed')),
+  scheduled_for TIMESTAMPTZ,
+  started_at TIMESTAMPTZ,
+  sent_at TIMESTAMPTZ,
+  recipient_count INTEGER NOT NULL DEFAULT 0,
+  sent_count INTEGER NOT NULL DEFAULT 0,
+  failed_count INTEGER NOT NULL DEFAULT 0,
+  open_count INTEGER NOT NULL DEFAULT 0,
+  click_count INTEGER NOT NULL DEFAULT 0,
+  last_error TEXT,
+  created_at TIMESTAMPTZ DEFAULT NOW(),
+  updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_newsletters_status ON newsletters(status);
+CREATE INDEX IF NOT EXISTS idx_newsletters_due ON newsletters(scheduled_for) WHERE status = 'scheduled';
+CREATE INDEX IF NOT EXISTS idx_newsletters_sent_at ON newsletters(sent_at DESC);
+
+COMMENT ON TABLE newsletters IS 'Newsletter campaigns: drafts, scheduled sends and delivery results';
+COMMENT ON COLUMN newsletters.scheduled_for IS 'When the scheduler should send a scheduled campaign';
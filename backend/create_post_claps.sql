@@ -0,0 +1,49 @@
+-- Per-reader claps
+-- Each anonymous reader (keyed by a hashed fingerprint or cookie ID) may clap a post
+-- up to a cap. add_claps applies a clap atomically: the reader's row is locked while
+-- their count and the post total move together.
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS claps INTEGER DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS post_claps (
+  post_slug TEXT NOT NULL REFERENCES posts(slug) ON UPDATE CASCADE ON DELETE CASCADE,
+  reader_id TEXT NOT NULL,
+  claps INTEGER NOT NULL DEFAULT 0 CHECK (claps >= 0),
+  created_at TIMESTAMPTZ DEFAULT NOW(),
+  updated_at TIMESTAMPTZ DEFAULT NOW(),
+  PRIMARY KEY (post_slug, reader_id)
+);
+
+CREATE OR REPLACE FUNCTION add_claps(p_slug TEXT, p_reader TEXT, p_count INTEGER, p_max INTEGER)
+RETURNS TABLE (total INTEGER, reader_claps INTEGER, added INTEGER) AS $$
+DECLARE
+  previous INTEGER;
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM posts WHERE slug = p_slug) THEN
+    RETURN;
+  END IF;
+
+  INSERT INTO post_claps (post_slug, reader_id) VALUES (p_slug, p_reader)
+  ON CONFLICT (post_slug, reader_id) DO NOTHING;
+
+  SELECT claps INTO previous FROM post_claps
+  WHERE post_slug = p_slug AND reader_id = p_reader
+  FOR UPDATE;
+
+  reader_claps := LEAST(previous + GREATEST(p_count, 0), p_max);
+  added := reader_claps - previous;
+
+  IF added > 0 THEN
+    UPDATE post_claps SET claps = reader_claps, updated_at = NOW()
+    WHERE post_slug = p_slug AND reader_id = p_reader;
+  END IF;
+
+  UPDATE posts SET claps = COALESCE(claps, 0) + added
+  WHERE slug = p_slug
+  RETURNING claps INTO total;
+
+  RETURN NEXT;
+END;
+$$ LANGUAGE plpgsql;
+
+COMMENT ON TABLE post_claps IS 'How many times each anonymous reader clapped a post (capped by the API)';
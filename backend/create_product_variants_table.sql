@@ -0,0 +1,54 @@
+-- Promote product variants from the products.variants JSON blob to their own table
+-- Each variant gets a stable id that order items can reference, a full SKU built
+-- from the product SKU and the variant's sku_suffix, and its own price and stock.
+
+CREATE TABLE IF NOT EXISTS product_variants (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  type TEXT NOT NULL DEFAULT 'other',
+  sku_suffix TEXT NOT NULL DEFAULT '',
+  sku TEXT UNIQUE,
+  price_adjustment DECIMAL(10,2) NOT NULL DEFAULT 0,
+  stock INTEGER NOT NULL DEFAULT 0 CHECK (stock >= 0),
+  image_index INTEGER,
+  display_order INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ DEFAULT NOW(),
+  updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_variants_product ON product_variants(product_id, display_order);
+
+-- Backfill from the JSON blob, keeping ids that are already UUIDs
+INSERT INTO product_variants (id, product_id, name, type, sku_suffix, sku, price_adjustment, stock, image_index, display_order)
+SELECT
+  CASE
+    WHEN v.value->>'id' ~* '^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$'
+    THEN (v.value->>'id')::UUID
+    ELSE gen_random_uuid()
+  END,
+  p.id,
+  COALESCE(NULLIF(v.value->>'name', ''), 'Default'),
+  COALESCE(NULLIF(v.value->>'type', ''), 'other'),
+  COALESCE(v.value->>'sku_suffix', ''),
+  NULLIF(COALESCE(p.sku, '') || COALESCE(v.value->>'sku_suffix', ''), ''),
+  COALESCE((v.value->>'price_adjustment')::DECIMAL, 0),
+  GREATEST(COALESCE((v.value->>'stock')::INTEGER, 0), 0),
+  (v.value->>'image_index')::INTEGER,
+  v.ordinality - 1
+FROM products p
+CROSS JOIN LATERAL jsonb_array_elements(COALESCE(p.variants, '[]'::JSONB)) WITH ORDINALITY AS v(value, ordinality)
+WHERE NOT EXISTS (SELECT 1 FROM product_variants pv WHERE pv.product_id = p.id);
+-- No ON CONFLICT: variants whose full SKUs collide stop the migration instead of being
+-- dropped. Give them distinct sku_suffix values in the blob and run it again.
+
+-- The blob is no longer written by the API. Only clear it where every variant made it
+-- into product_variants.
+UPDATE products p SET variants = '[]'::JSONB
+WHERE jsonb_typeof(p.variants) = 'array'
+  AND jsonb_array_length(p.variants) > 0
+  AND jsonb_array_length(p.variants) = (SELECT COUNT(*) FROM product_variants pv WHERE pv.product_id = p.id);
+
+COMMENT ON TABLE product_variants IS 'Purchasable options of a product (size, color, material, etc.)';
+COMMENT ON COLUMN product_variants.sku IS 'Full SKU: the product SKU followed by sku_suffix';
+COMMENT ON COLUMN products.variants IS 'Deprecated: variants now live in product_variants';
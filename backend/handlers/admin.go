@@ -6,19 +6,21 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
 // AdminHandler handles admin-related HTTP requests
 type AdminHandler struct {
-	db    *services.DatabaseService
-	email *services.EmailService
+	db       *services.DatabaseService
+	email    *services.EmailService
+	comments *CommentNotifier
 }
 
 // NewAdminHandler creates a new admin handler
-func NewAdminHandler(db *services.DatabaseService, email *services.EmailService) *AdminHandler {
-	return &AdminHandler{db: db, email: email}
+func NewAdminHandler(db *services.DatabaseService, email *services.EmailService, comments *CommentNotifier) *AdminHandler {
+	return &AdminHandler{db: db, email: email, comments: comments}
 }
 
 // AdminPostStats represents post statistics for admin dashboard
@@ -63,6 +65,16 @@ func (h *AdminHandler) GetDashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Comments waiting for moderation
+	_, pendingComments, err := client.From("comments").
+		Select("id", "exact", true).
+		Eq("status", models.CommentStatusPending).
+		Execute()
+	if err != nil {
+		http.Error(w, "Failed to get pending comments count", http.StatusInternalServerError)
+		return
+	}
+
 	// Get newsletter subscribers
 	_, totalSubscribers, err := client.From("newsletter_subscribers").
 		Select("email", "exact", false).
@@ -77,6 +89,7 @@ func (h *AdminHandler) GetDashboard(w http.ResponseWriter, r *http.Request) {
 		"total_posts":       totalPosts,
 		"total_views":       totalViews,
 		"total_comments":    totalComments,
+		"pending_comments":  pendingComments,
 		"total_subscribers": totalSubscribers,
 	}
 
@@ -194,10 +207,11 @@ func (h *AdminHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
 }
 
-// GetAllComments handles GET /admin/comments
+// GetAllComments handles GET /admin/comments?status=pending
 func (h *AdminHandler) GetAllComments(w http.ResponseWriter, r *http.Request) {
 	limitStr := r.URL.Query().Get("limit")
 	offsetStr := r.URL.Query().Get("offset")
+	status := r.URL.Query().Get("status")
 	limit, _ := strconv.Atoi(limitStr)
 	offset, _ := strconv.Atoi(offsetStr)
 	if limit == 0 {
@@ -205,7 +219,11 @@ func (h *AdminHandler) GetAllComments(w http.ResponseWriter, r *http.Request) {
 	}
 
 	client := h.db.GetClient()
-	jsonStr, _, err := client.From("comments").Select("*", "exact", false).
+	query := client.From("comments").Select("*", "exact", false)
+	if status != "" {
+		query = query.Eq("status", status)
+	}
+	jsonStr, _, err := query.
 		Range(offset, offset+limit-1, "").
 		Order("created_at", nil).ExecuteString()
 	if err != nil {
@@ -232,6 +250,65 @@ func (h *AdminHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
 }
 
+// GetCommentRevisions handles GET /admin/comments/{id}/revisions
+func (h *AdminHandler) GetCommentRevisions(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	jsonStr, _, err := h.db.GetClient().From("comment_revisions").
+		Select("*", "exact", false).
+		Eq("comment_id", id).
+		Order("created_at", nil).
+		ExecuteString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(jsonStr))
+}
+
+// ApproveComment handles POST /admin/comments/{id}/approve
+func (h *AdminHandler) ApproveComment(w http.ResponseWriter, r *http.Request) {
+	h.moderateComment(w, chi.URLParam(r, "id"), models.CommentStatusApproved)
+}
+
+// RejectComment handles POST /admin/comments/{id}/reject
+func (h *AdminHandler) RejectComment(w http.ResponseWriter, r *http.Request) {
+	h.moderateComment(w, chi.URLParam(r, "id"), models.CommentStatusRejected)
+}
+
+// MarkCommentSpam handles POST /admin/comments/{id}/spam
+func (h *AdminHandler) MarkCommentSpam(w http.ResponseWriter, r *http.Request) {
+	h.moderateComment(w, chi.URLParam(r, "id"), models.CommentStatusSpam)
+}
+
+func (h *AdminHandler) moderateComment(w http.ResponseWriter, id, status string) {
+	client := h.db.GetClient()
+	bytes, _, err := client.From("comments").
+		Update(map[string]any{"status": status, "moderated_at": time.Now().Format(time.RFC3339)}, "representation", "").
+		Eq("id", id).
+		Execute()
+	if err != nil {
+		http.Error(w, "Failed to update comment", http.StatusInternalServerError)
+		return
+	}
+
+	var updated []models.Comment
+	if err := json.Unmarshal(bytes, &updated); err != nil || len(updated) == 0 {
+		http.Error(w, "comment not found", http.StatusNotFound)
+		return
+	}
+
+	// Replies held for moderation notify the parent commenter once approved
+	if status == models.CommentStatusApproved && updated[0].ParentID != nil {
+		h.comments.NotifyReply(updated[0].ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
 // GetAllSubscribers handles GET /admin/subscribers
 func (h *AdminHandler) GetAllSubscribers(w http.ResponseWriter, r *http.Request) {
 	limitStr := r.URL.Query().Get("limit")
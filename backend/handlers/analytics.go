@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"blog-backend/services"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// AnalyticsHandler handles the admin analytics reports
+type AnalyticsHandler struct {
+	db *services.DatabaseService
+}
+
+// NewAnalyticsHandler creates a new analytics handler
+func NewAnalyticsHandler(db *services.DatabaseService) *AnalyticsHandler {
+	return &AnalyticsHandler{db: db}
+}
+
+// topSellersLimit is how many products and categories the sales report ranks
+const topSellersLimit = 10
+
+// GetSalesAnalytics handles GET /admin/analytics/sales?from=&to=&interval=&format=
+//
+// from and to are dates (2006-01-02) or RFC3339 times; to is exclusive and the range
+// defaults to the last 30 days. interval is day, week or month. format=csv downloads
+// the same report as CSV.
+func (h *AnalyticsHandler) GetSalesAnalytics(w http.ResponseWriter, r *http.Request) {
+	sqlDB := h.db.GetSQLDB()
+	if sqlDB == nil {
+		http.Error(w, "Sales analytics need a direct database connection (DATABASE_URL)", http.StatusServiceUnavailable)
+		return
+	}
+
+	from, to, err := parseAnalyticsRange(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "day"
+	}
+	if interval != "day" && interval != "week" && interval != "month" {
+		http.Error(w, "interval must be day, week or month", http.StatusBadRequest)
+		return
+	}
+
+	report, err := buildSalesReport(sqlDB, from, to, interval)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		writeSalesReportCSV(w, report)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// parseAnalyticsRange resolves the from/to query parameters, defaulting to the last 30 days
+func parseAnalyticsRange(fromParam, toParam string) (time.Time, time.Time, error) {
+	parse := func(value string) (time.Time, error) {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t.UTC(), nil
+		}
+		return time.Parse("2006-01-02", value)
+	}
+
+	to := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	if toParam != "" {
+		t, err := parse(toParam)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("to must be a date (YYYY-MM-DD) or RFC3339 time")
+		}
+		to = t
+	}
+
+	from := to.AddDate(0, 0, -30)
+	if fromParam != "" {
+		t, err := parse(fromParam)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("from must be a date (YYYY-MM-DD) or RFC3339 time")
+		}
+		from = t
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+// buildSalesReport aggregates orders created in [from, to). Only orders with
+// payment_status success count as sales.
+func buildSalesReport(sqlDB *sql.DB, from, to time.Time, interval string) (*models.SalesReport, error) {
+	report := &models.SalesReport{
+		From:     from.Format(time.RFC3339),
+		To:       to.Format(time.RFC3339),
+		Interval: interval,
+	}
+
+	summary := &report.Summary
+	err := sqlDB.QueryRow(`
+		SELECT
+			COUNT(*) FILTER (WHERE payment_status = 'success'),
+			COALESCE(SUM(total) FILTER (WHERE payment_status = 'success'), 0),
+			COUNT(*) FILTER (WHERE payment_status = 'failed'),
+			COUNT(*) FILTER (WHERE payment_status IN ('pending', 'processing')),
+			COUNT(DISTINCT LOWER(customer_email)) FILTER (WHERE payment_status = 'success')
+		FROM orders
+		WHERE created_at >= $1 AND created_at < $2`, from, to).
+		Scan(&summary.Orders, &summary.Revenue, &summary.FailedOrders, &summary.PendingOrders, &summary.Customers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sales summary: %w", err)
+	}
+
+	if summary.Orders > 0 {
+		summary.AverageOrderValue = summary.Revenue / float64(summary.Orders)
+	}
+	if attempts := summary.Orders + summary.FailedOrders; attempts > 0 {
+		summary.ConversionRate = float64(summary.Orders) / float64(attempts)
+	}
+
+	// A repeat customer paid in the range and has more than one paid order up to its end
+	err = sqlDB.QueryRow(`
+		SELECT COUNT(*) FROM (
+			SELECT LOWER(customer_email)
+			FROM orders
+			WHERE payment_status = 'success' AND created_at < $2
+			GROUP BY LOWER(customer_email)
+			HAVING COUNT(*) > 1 AND MAX(created_at) >= $1
+		) repeat_customers`, from, to).Scan(&summary.RepeatCustomers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load repeat customers: %w", err)
+	}
+	if summary.Customers > 0 {
+		summary.RepeatCustomerRate = float64(summary.RepeatCustomers) / float64(summary.Customers)
+	}
+
+	if report.Timeline, err = loadSalesTimeline(sqlDB, from, to, interval); err != nil {
+		return nil, err
+	}
+
+	report.TopProducts, err = loadSalesRanking(sqlDB, `
+		SELECT item->>'product_id', MAX(item->>'name'),
+			SUM((item->>'quantity')::INT),
+			SUM((item->>'price')::NUMERIC * (item->>'quantity')::INT)
+		FROM orders, jsonb_array_elements(orders.items) AS item
+		WHERE orders.payment_status = 'success' AND orders.created_at >= $1 AND orders.created_at < $2
+		GROUP BY item->>'product_id'
+		ORDER BY 4 DESC
+		LIMIT $3`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load top products: %w", err)
+	}
+
+	report.TopCategories, err = loadSalesRanking(sqlDB, `
+		SELECT COALESCE(c.id::TEXT, ''), COALESCE(c.name, NULLIF(p.category, ''), 'Uncategorized'),
+			SUM((item->>'quantity')::INT),
+			SUM((item->>'price')::NUMERIC * (item->>'quantity')::INT)
+		FROM orders
+		CROSS JOIN jsonb_array_elements(orders.items) AS item
+		LEFT JOIN products p ON p.id::TEXT = item->>'product_id'
+		LEFT JOIN product_categories c ON c.id = p.category_id
+		WHERE orders.payment_status = 'success' AND orders.created_at >= $1 AND orders.created_at < $2
+		GROUP BY 1, 2
+		ORDER BY 4 DESC
+		LIMIT $3`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load top categories: %w", err)
+	}
+
+	return report, nil
+}
+
+// loadSalesTimeline returns one bucket per interval in the range, including empty ones
+func loadSalesTimeline(sqlDB *sql.DB, from, to time.Time, interval string) ([]models.SalesBucket, error) {
+	rows, err := sqlDB.Query(`
+		SELECT date_trunc($3, created_at) AS period,
+			COALESCE(SUM(total) FILTER (WHERE payment_status = 'success'), 0),
+			COUNT(*) FILTER (WHERE payment_status = 'success'),
+			COUNT(*) FILTER (WHERE payment_status = 'failed')
+		FROM orders
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY period
+		ORDER BY period`, from, to, interval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sales timeline: %w", err)
+	}
+	defer rows.Close()
+
+	byPeriod := make(map[string]models.SalesBucket)
+	for rows.Next() {
+		var period time.Time
+		var bucket models.SalesBucket
+		if err := rows.Scan(&period, &bucket.Revenue, &bucket.Orders, &bucket.FailedOrders); err != nil {
+			return nil, err
+		}
+		bucket.Period = period.Format("2006-01-02")
+		byPeriod[bucket.Period] = bucket
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	timeline := []models.SalesBucket{}
+	for period := truncateToInterval(from, interval); period.Before(to); period = nextInterval(period, interval) {
+		key := period.Format("2006-01-02")
+		bucket, ok := byPeriod[key]
+		if !ok {
+			bucket = models.SalesBucket{Period: key}
+		}
+		timeline = append(timeline, bucket)
+	}
+	return timeline, nil
+}
+
+func loadSalesRanking(sqlDB *sql.DB, query string, from, to time.Time) ([]models.SalesRankedItem, error) {
+	rows, err := sqlDB.Query(query, from, to, topSellersLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.SalesRankedItem{}
+	for rows.Next() {
+		var item models.SalesRankedItem
+		var id, name sql.NullString
+		if err := rows.Scan(&id, &name, &item.Units, &item.Revenue); err != nil {
+			return nil, err
+		}
+		item.ID = id.String
+		item.Name = name.String
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// truncateToInterval matches Postgres date_trunc for day, week (Monday) and month
+func truncateToInterval(t time.Time, interval string) time.Time {
+	t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7
+		return t.AddDate(0, 0, -offset)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return t
+}
+
+func nextInterval(t time.Time, interval string) time.Time {
+	switch interval {
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// writeSalesReportCSV writes the report as consecutive CSV sections separated by blank lines
+func writeSalesReportCSV(w http.ResponseWriter, report *models.SalesReport) {
+	filename := fmt.Sprintf("sales_%s_%s.csv", report.From[:10], report.To[:10])
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+
+	money := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	rate := func(v float64) string { return strconv.FormatFloat(v, 'f', 4, 64) }
+
+	writer := csv.NewWriter(w)
+	s := report.Summary
+	writer.WriteAll([][]string{
+		{"metric", "value"},
+		{"from", report.From},
+		{"to", report.To},
+		{"revenue", money(s.Revenue)},
+		{"orders", strconv.Itoa(s.Orders)},
+		{"average_order_value", money(s.AverageOrderValue)},
+		{"failed_orders", strconv.Itoa(s.FailedOrders)},
+		{"pending_orders", strconv.Itoa(s.PendingOrders)},
+		{"conversion_rate", rate(s.ConversionRate)},
+		{"customers", strconv.Itoa(s.Customers)},
+		{"repeat_customers", strconv.Itoa(s.RepeatCustomers)},
+		{"repeat_customer_rate", rate(s.RepeatCustomerRate)},
+		{},
+		{report.Interval, "revenue", "orders", "failed_orders"},
+	})
+	for _, b := range report.Timeline {
+		writer.Write([]string{b.Period, money(b.Revenue), strconv.Itoa(b.Orders), strconv.Itoa(b.FailedOrders)})
+	}
+
+	writer.Write([]string{})
+	writer.Write([]string{"product_id", "product", "units", "revenue"})
+	for _, p := range report.TopProducts {
+		writer.Write([]string{p.ID, p.Name, strconv.Itoa(p.Units), money(p.Revenue)})
+	}
+
+	writer.Write([]string{})
+	writer.Write([]string{"category_id", "category", "units", "revenue"})
+	for _, c := range report.TopCategories {
+		writer.Write([]string{c.ID, c.Name, strconv.Itoa(c.Units), money(c.Revenue)})
+	}
+	writer.Flush()
+}
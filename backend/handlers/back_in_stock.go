@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"blog-backend/services"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// BackInStockHandler takes notify-me signups for sold-out items and emails them on restock
+type BackInStockHandler struct {
+	db      *services.DatabaseService
+	email   *services.EmailService
+	shopURL string
+	// mu serializes notification runs so a subscriber is never emailed twice
+	mu sync.Mutex
+}
+
+// NewBackInStockHandler creates a new back-in-stock handler
+func NewBackInStockHandler(db *services.DatabaseService, email *services.EmailService) *BackInStockHandler {
+	shopURL := os.Getenv("SHOP_URL")
+	if shopURL == "" {
+		shopURL = "http://localhost:3001"
+	}
+	return &BackInStockHandler{db: db, email: email, shopURL: shopURL}
+}
+
+// NotifyMe handles POST /products/{slug}/notify-me
+func (h *BackInStockHandler) NotifyMe(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+
+	var req models.BackInStockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	if req.Email == "" || !strings.Contains(req.Email, "@") {
+		http.Error(w, "Valid email is required", http.StatusBadRequest)
+		return
+	}
+
+	client := h.db.GetClient()
+	productBytes, _, err := client.From("products").
+		Select("id,stock", "exact", false).
+		Eq("slug", slug).
+		Eq("active", "true").
+		Single().
+		Execute()
+	if err != nil {
+		http.Error(w, "product not found", http.StatusNotFound)
+		return
+	}
+	var product models.Product
+	if err := json.Unmarshal(productBytes, &product); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	variants, err := loadProductVariants(h.db, []string{product.ID})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Work out the stock of whatever the shopper is waiting for
+	stock := product.Stock
+	if req.VariantID != "" {
+		found := false
+		for _, v := range variants[product.ID] {
+			if v.ID == req.VariantID {
+				stock = v.Stock
+				found = true
+				break
+			}
+		}
+		if !found {
+			http.Error(w, "variant not found", http.StatusNotFound)
+			return
+		}
+	} else if len(variants[product.ID]) > 0 {
+		http.Error(w, "variant_id is required for products with variants", http.StatusBadRequest)
+		return
+	}
+
+	if stock > 0 {
+		http.Error(w, "This item is in stock", http.StatusConflict)
+		return
+	}
+
+	// Signing up twice is not an error
+	query := client.From("back_in_stock_subscriptions").
+		Select("id", "exact", false).
+		Eq("product_id", product.ID).
+		Eq("email", req.Email)
+	if req.VariantID != "" {
+		query = query.Eq("variant_id", req.VariantID)
+	} else {
+		query = query.Is("variant_id", "null")
+	}
+	existingBytes, _, err := query.Execute()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var existing []models.BackInStockSubscription
+	json.Unmarshal(existingBytes, &existing)
+
+	if len(existing) == 0 {
+		subscription := map[string]interface{}{
+			"product_id": product.ID,
+			"email":      req.Email,
+		}
+		if req.VariantID != "" {
+			subscription["variant_id"] = req.VariantID
+		}
+		if _, _, err := client.From("back_in_stock_subscriptions").Insert(subscription, false, "", "minimal", "").Execute(); err != nil {
+			http.Error(w, "Failed to save notification request", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "subscribed",
+		"message": "We'll email you as soon as this item is back in stock.",
+	})
+}
+
+// NotifyRestocked emails everyone waiting on a product, or any of its variants, that
+// now has stock. It runs in the background and is safe to call after any stock change:
+// subscriptions only exist for sold-out items and are removed when they are notified.
+func (h *BackInStockHandler) NotifyRestocked(productID string) {
+	if h == nil {
+		return
+	}
+	go func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if err := h.notifyRestocked(productID); err != nil {
+			log.Printf("[BackInStock] Failed to notify subscribers for product %s: %v", productID, err)
+		}
+	}()
+}
+
+func (h *BackInStockHandler) notifyRestocked(productID string) error {
+	client := h.db.GetClient()
+
+	subscriptionBytes, _, err := client.From("back_in_stock_subscriptions").
+		Select("*", "exact", false).
+		Eq("product_id", productID).
+		Execute()
+	if err != nil {
+		return err
+	}
+	var subscriptions []models.BackInStockSubscription
+	if err := json.Unmarshal(subscriptionBytes, &subscriptions); err != nil {
+		return err
+	}
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	productBytes, _, err := client.From("products").
+		Select("id,slug,name,price,sale_price,images,stock,active", "exact", false).
+		Eq("id", productID).
+		Single().
+		Execute()
+	if err != nil {
+		return err
+	}
+	var product models.Product
+	if err := json.Unmarshal(productBytes, &product); err != nil {
+		return err
+	}
+	if !product.Active {
+		return nil
+	}
+
+	variants, err := loadProductVariants(h.db, []string{productID})
+	if err != nil {
+		return err
+	}
+	// Shoppers who didn't pick a variant want the product in any variant
+	inStock := product.Stock > 0
+	variantsByID := make(map[string]models.ProductVariant)
+	for _, v := range variants[productID] {
+		variantsByID[v.ID] = v
+		if v.Stock > 0 {
+			inStock = true
+		}
+	}
+
+	price := product.Price
+	if product.SalePrice != nil && *product.SalePrice > 0 && *product.SalePrice < product.Price {
+		price = *product.SalePrice
+	}
+	image := ""
+	if len(product.Images) > 0 {
+		image = product.Images[0]
+	}
+
+	// Group waiting shoppers by the product or variant they asked about
+	waiting := make(map[string][]models.BackInStockSubscription)
+	for _, s := range subscriptions {
+		variantID := ""
+		if s.VariantID != nil {
+			variantID = *s.VariantID
+		}
+		waiting[variantID] = append(waiting[variantID], s)
+	}
+
+	for variantID, group := range waiting {
+		item := services.BackInStockItem{
+			Name:  product.Name,
+			Price: price,
+			Image: image,
+			URL:   h.shopURL + "/products/" + product.Slug,
+		}
+		if variantID == "" {
+			if !inStock {
+				continue
+			}
+		} else {
+			variant, ok := variantsByID[variantID]
+			if !ok || variant.Stock <= 0 {
+				continue
+			}
+			item.Variant = variant.Name
+			item.Price = price + variant.PriceAdjustment
+		}
+
+		// Remove the subscriptions before sending, so a failure can't lead to a second
+		// email on the next stock change. The ones that couldn't be emailed are put back.
+		ids := make([]string, len(group))
+		for i, s := range group {
+			ids[i] = s.ID
+		}
+		claimedBytes, _, err := client.From("back_in_stock_subscriptions").
+			Delete("representation", "").
+			In("id", ids).
+			Execute()
+		if err != nil {
+			log.Printf("[BackInStock] Failed to claim subscriptions for %s: %v", product.Name, err)
+			continue
+		}
+		var claimed []models.BackInStockSubscription
+		if err := json.Unmarshal(claimedBytes, &claimed); err != nil {
+			log.Printf("[BackInStock] Failed to read claimed subscriptions for %s: %v", product.Name, err)
+			continue
+		}
+		if len(claimed) == 0 {
+			continue
+		}
+
+		recipients := make([]string, len(claimed))
+		for i, s := range claimed {
+			recipients[i] = s.Email
+		}
+		sent, err := h.email.SendBackInStock(item, recipients)
+		if err != nil {
+			log.Printf("[BackInStock] Failed to email subscribers for %s: %v", product.Name, err)
+		}
+
+		delivered := make(map[string]bool, len(sent))
+		for _, email := range sent {
+			delivered[email] = true
+		}
+		var unsent []models.BackInStockSubscription
+		for _, s := range claimed {
+			if !delivered[s.Email] {
+				unsent = append(unsent, s)
+			}
+		}
+		if len(unsent) == 0 {
+			continue
+		}
+		if _, _, err := client.From("back_in_stock_subscriptions").Insert(unsent, false, "", "minimal", "").Execute(); err != nil {
+			log.Printf("[BackInStock] Failed to restore %d unsent subscriptions for %s: %v", len(unsent), product.Name, err)
+		}
+	}
+	return nil
+}
@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"blog-backend/models"
 	"blog-backend/services"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"sort"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/supabase-community/postgrest-go"
 )
 
 // CategoryHandler handles category-related HTTP requests
@@ -50,23 +55,74 @@ func (h *CategoryHandler) GetCategories(w http.ResponseWriter, r *http.Request)
 	w.Write([]byte(jsonStr))
 }
 
+// GetCategoryTree handles GET /categories/tree
+func (h *CategoryHandler) GetCategoryTree(w http.ResponseWriter, r *http.Request) {
+	categories, err := loadCategories(h.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	counts, err := loadCategoryProductCounts(h.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildCategoryTree(categories, counts))
+}
+
 // GetCategory handles GET /categories/{slug}
 func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
 	slug := chi.URLParam(r, "slug")
 
-	client := h.db.GetClient()
-	jsonStr, _, err := client.From("product_categories").
-		Select("*", "exact", false).
-		Eq("slug", slug).
-		ExecuteString()
-
+	categories, err := loadCategories(h.db)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	var category *models.ProductCategory
+	for i := range categories {
+		if categories[i].Slug == slug {
+			category = &categories[i]
+			break
+		}
+	}
+	if category == nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	byID := indexCategories(categories)
+	paths := categoryPaths(categories)
+
+	detail := models.CategoryDetail{
+		ProductCategory: *category,
+		Breadcrumbs:     []models.CategoryBreadcrumb{},
+		Children:        []models.ProductCategory{},
+	}
+	detail.Path = paths[category.ID]
+
+	for _, ancestor := range categoryAncestry(byID, category.ID) {
+		detail.Breadcrumbs = append(detail.Breadcrumbs, models.CategoryBreadcrumb{
+			ID:   ancestor.ID,
+			Slug: ancestor.Slug,
+			Name: ancestor.Name,
+			Path: paths[ancestor.ID],
+		})
+	}
+
+	for _, c := range categories {
+		if c.ParentID != nil && *c.ParentID == category.ID {
+			c.Path = paths[c.ID]
+			detail.Children = append(detail.Children, c)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(jsonStr))
+	json.NewEncoder(w).Encode(detail)
 }
 
 // GetCategoryProducts handles GET /categories/{slug}/products
@@ -114,3 +170,236 @@ func (h *CategoryHandler) GetCategoryProducts(w http.ResponseWriter, r *http.Req
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(productsStr))
 }
+
+// Category tree helpers
+
+// loadCategories fetches every product category ordered by display_order
+func loadCategories(db *services.DatabaseService) ([]models.ProductCategory, error) {
+	bytes, _, err := db.GetClient().From("product_categories").
+		Select("*", "exact", false).
+		Order("display_order", nil).
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+
+	var categories []models.ProductCategory
+	if err := json.Unmarshal(bytes, &categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// loadCategoryProductCounts returns the number of active products per category ID
+func loadCategoryProductCounts(db *services.DatabaseService) (map[string]int, error) {
+	counts := make(map[string]int)
+	if sqlDB := db.GetSQLDB(); sqlDB != nil {
+		rows, err := sqlDB.Query(`
+			SELECT category_id, COUNT(*) FROM products
+			WHERE active AND category_id IS NOT NULL
+			GROUP BY category_id`)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id string
+			var count int
+			if err := rows.Scan(&id, &count); err != nil {
+				return nil, err
+			}
+			counts[id] = count
+		}
+		return counts, rows.Err()
+	}
+
+	// Without a direct connection count the rows, a page at a time
+	rows, err := selectAll[struct {
+		CategoryID *string `json:"category_id"`
+	}](func() *postgrest.FilterBuilder {
+		return db.GetClient().From("products").
+			Select("category_id", "exact", false).
+			Eq("active", "true").
+			Order("id", &postgrest.OrderOpts{Ascending: true})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		if row.CategoryID != nil {
+			counts[*row.CategoryID]++
+		}
+	}
+	return counts, nil
+}
+
+func indexCategories(categories []models.ProductCategory) map[string]*models.ProductCategory {
+	byID := make(map[string]*models.ProductCategory, len(categories))
+	for i := range categories {
+		byID[categories[i].ID] = &categories[i]
+	}
+	return byID
+}
+
+// categoryAncestry returns the chain of categories from the root down to id (inclusive).
+// A parent cycle in existing data stops the walk rather than looping forever.
+func categoryAncestry(byID map[string]*models.ProductCategory, id string) []*models.ProductCategory {
+	var chain []*models.ProductCategory
+	seen := make(map[string]bool)
+	for current, ok := byID[id]; ok && !seen[current.ID]; {
+		seen[current.ID] = true
+		chain = append([]*models.ProductCategory{current}, chain...)
+		if current.ParentID == nil {
+			break
+		}
+		current, ok = byID[*current.ParentID]
+	}
+	return chain
+}
+
+// categoryPaths computes the slug path of every category from the parent links
+func categoryPaths(categories []models.ProductCategory) map[string]string {
+	byID := indexCategories(categories)
+	paths := make(map[string]string, len(categories))
+	for _, c := range categories {
+		path := ""
+		for _, ancestor := range categoryAncestry(byID, c.ID) {
+			if path != "" {
+				path += "/"
+			}
+			path += ancestor.Slug
+		}
+		paths[c.ID] = path
+	}
+	return paths
+}
+
+// wouldCreateCategoryCycle reports whether making parentID the parent of id would
+// put id among its own ancestors
+func wouldCreateCategoryCycle(byID map[string]*models.ProductCategory, id, parentID string) bool {
+	if id == parentID {
+		return true
+	}
+	for _, ancestor := range categoryAncestry(byID, parentID) {
+		if ancestor.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// buildCategoryTree nests categories under their parents and rolls product counts up the tree
+func buildCategoryTree(categories []models.ProductCategory, counts map[string]int) []*models.CategoryNode {
+	paths := categoryPaths(categories)
+	nodes := make(map[string]*models.CategoryNode, len(categories))
+	for _, c := range categories {
+		c.Path = paths[c.ID]
+		nodes[c.ID] = &models.CategoryNode{
+			ProductCategory: c,
+			ProductCount:    counts[c.ID],
+			Children:        []*models.CategoryNode{},
+		}
+	}
+
+	roots := []*models.CategoryNode{}
+	for _, c := range categories {
+		var parent *models.CategoryNode
+		if c.ParentID != nil {
+			parent = nodes[*c.ParentID]
+		}
+		if parent != nil {
+			parent.Children = append(parent.Children, nodes[c.ID])
+		} else {
+			roots = append(roots, nodes[c.ID])
+		}
+	}
+
+	// Categories caught in a parent cycle, and their descendants, never hang off a root.
+	// Cut each cycle at one of its categories and show that category as a root instead.
+	reached := make(map[string]bool, len(nodes))
+	var reach func(node *models.CategoryNode)
+	reach = func(node *models.CategoryNode) {
+		reached[node.ID] = true
+		for _, child := range node.Children {
+			reach(child)
+		}
+	}
+	for _, root := range roots {
+		reach(root)
+	}
+	for _, c := range categories {
+		if reached[c.ID] {
+			continue
+		}
+		// Walk up until a category repeats; that one is on the cycle
+		node := nodes[c.ID]
+		for seen := map[string]bool{}; !seen[node.ID]; node = nodes[*node.ParentID] {
+			seen[node.ID] = true
+		}
+		log.Printf("[Categories] Category %s is in a parent cycle, showing it as a root", node.Slug)
+		parent := nodes[*node.ParentID]
+		for i, child := range parent.Children {
+			if child.ID == node.ID {
+				parent.Children = append(parent.Children[:i], parent.Children[i+1:]...)
+				break
+			}
+		}
+		roots = append(roots, node)
+		reach(node)
+	}
+
+	sortCategoryNodes(roots)
+	var total func(node *models.CategoryNode) int
+	total = func(node *models.CategoryNode) int {
+		sortCategoryNodes(node.Children)
+		sum := node.ProductCount
+		for _, child := range node.Children {
+			sum += total(child)
+		}
+		node.TotalProductCount = sum
+		return sum
+	}
+	for _, root := range roots {
+		total(root)
+	}
+
+	return roots
+}
+
+// sortCategoryNodes orders sibling categories by display_order, lowest first
+func sortCategoryNodes(nodes []*models.CategoryNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].DisplayOrder < nodes[j].DisplayOrder
+	})
+}
+
+// syncCategoryPaths writes the computed path of each category in the subtree rooted
+// at rootID back to the database when it differs from the stored value
+func syncCategoryPaths(db *services.DatabaseService, categories []models.ProductCategory, rootID string) error {
+	byID := indexCategories(categories)
+	paths := categoryPaths(categories)
+	client := db.GetClient()
+
+	for _, c := range categories {
+		inSubtree := false
+		for _, ancestor := range categoryAncestry(byID, c.ID) {
+			if ancestor.ID == rootID {
+				inSubtree = true
+				break
+			}
+		}
+		if !inSubtree || c.Path == paths[c.ID] {
+			continue
+		}
+
+		_, _, err := client.From("product_categories").
+			Update(map[string]interface{}{"path": paths[c.ID]}, "minimal", "").
+			Eq("id", c.ID).
+			Execute()
+		if err != nil {
+			return fmt.Errorf("failed to update path for category %s: %w", c.Slug, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"blog-backend/middleware"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// MaxClapsPerReader is how many times one reader can clap a single post
+const MaxClapsPerReader = 50
+
+// MaxClapsPerIP is how many times one IP address can clap a single post. Reader IDs
+// are chosen by the client, so this bounds what a script rotating them can add; it
+// leaves room for several readers sharing an address.
+const MaxClapsPerIP = 4 * MaxClapsPerReader
+
+// readerCookie holds the anonymous reader ID for browsers that don't send X-Reader-ID
+const readerCookie = "bd_reader"
+
+// ClapRequest is the optional payload for POST /posts/{slug}/clap
+type ClapRequest struct {
+	Count int `json:"count"` // Claps to add at once, defaults to 1
+}
+
+// clapResult is the outcome of add_claps
+type clapResult struct {
+	Total       int `json:"total"`
+	ReaderClaps int `json:"reader_claps"`
+	Added       int `json:"added"`
+}
+
+// ClapPost handles POST /posts/{slug}/clap
+//
+// Claps are added atomically and capped per reader and per IP address. Readers are
+// identified by the X-Reader-ID header (a fingerprint or ID kept by the frontend),
+// falling back to a cookie that is issued on first clap.
+func (h *PostHandler) ClapPost(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+
+	req := ClapRequest{Count: 1}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Count < 1 || req.Count > MaxClapsPerReader {
+		http.Error(w, fmt.Sprintf("count must be between 1 and %d", MaxClapsPerReader), http.StatusBadRequest)
+		return
+	}
+
+	readerID := clapReaderID(w, r, true)
+	result, err := h.addClaps(slug, readerID, h.clapIPHash(r), req.Count)
+	if err == sql.ErrNoRows {
+		http.Error(w, "post not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"claps":      result.Total,
+		"your_claps": result.ReaderClaps,
+		"added":      result.Added,
+		"max_claps":  MaxClapsPerReader,
+	})
+}
+
+// GetClaps handles GET /posts/{slug}/claps - returns the total and the caller's own claps
+func (h *PostHandler) GetClaps(w http.ResponseWriter, r *http.Request) {
+	slug := chi.URLParam(r, "slug")
+	client := h.db.GetClient()
+
+	bytes, _, err := client.From("posts").Select("claps", "exact", false).Eq("slug", slug).Single().Execute()
+	if err != nil {
+		http.Error(w, "post not found", http.StatusNotFound)
+		return
+	}
+
+	var post struct {
+		Claps *int `json:"claps"`
+	}
+	if err := json.Unmarshal(bytes, &post); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	claps := 0
+	if post.Claps != nil {
+		claps = *post.Claps
+	}
+
+	yourClaps := 0
+	if readerID := clapReaderID(w, r, false); readerID != "" {
+		readerBytes, _, err := client.From("post_claps").
+			Select("claps", "exact", false).
+			Eq("post_slug", slug).
+			Eq("reader_id", readerID).
+			Execute()
+		if err == nil {
+			var rows []struct {
+				Claps int `json:"claps"`
+			}
+			if json.Unmarshal(readerBytes, &rows) == nil && len(rows) > 0 {
+				yourClaps = rows[0].Claps
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"claps":      claps,
+		"your_claps": yourClaps,
+		"max_claps":  MaxClapsPerReader,
+	})
+}
+
+// addClaps runs the add_claps database function, directly when a SQL connection is
+// configured and through PostgREST otherwise. Returns sql.ErrNoRows for unknown posts.
+func (h *PostHandler) addClaps(slug, readerID, ipHash string, count int) (*clapResult, error) {
+	var result clapResult
+
+	if sqlDB := h.db.GetSQLDB(); sqlDB != nil {
+		err := sqlDB.QueryRow(`SELECT total, reader_claps, added FROM add_claps($1, $2, $3, $4, $5, $6)`,
+			slug, readerID, ipHash, count, MaxClapsPerReader, MaxClapsPerIP).
+			Scan(&result.Total, &result.ReaderClaps, &result.Added)
+		if err != nil {
+			return nil, err
+		}
+		return &result, nil
+	}
+
+	body := h.db.GetClient().Rpc("add_claps", "", map[string]any{
+		"p_slug":   slug,
+		"p_reader": readerID,
+		"p_ip":     ipHash,
+		"p_count":  count,
+		"p_max":    MaxClapsPerReader,
+		"p_ip_max": MaxClapsPerIP,
+	})
+	var rows []clapResult
+	if err := json.Unmarshal([]byte(body), &rows); err != nil {
+		return nil, fmt.Errorf("add_claps failed: %s", body)
+	}
+	if len(rows) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &rows[0], nil
+}
+
+// clapReaderID returns the hashed anonymous ID of the reader. With issue set, readers
+// without an ID get a new cookie; otherwise "" is returned for them.
+func clapReaderID(w http.ResponseWriter, r *http.Request, issue bool) string {
+	raw := strings.TrimSpace(r.Header.Get("X-Reader-ID"))
+	if raw == "" {
+		if cookie, err := r.Cookie(readerCookie); err == nil {
+			raw = cookie.Value
+		}
+	}
+
+	if raw == "" {
+		if !issue {
+			return ""
+		}
+		raw = uuid.New().String()
+		http.SetCookie(w, &http.Cookie{
+			Name:     readerCookie,
+			Value:    raw,
+			Path:     "/",
+			MaxAge:   365 * 24 * 60 * 60,
+			HttpOnly: true,
+			Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	// Only a hash is stored so fingerprints can't be read back out of the table
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// clapIPHash returns the hashed IP address of the caller, for the per-IP cap. The hash
+// is keyed with TOKEN_SECRET, since the IPv4 space is small enough to hash in full.
+func (h *PostHandler) clapIPHash(r *http.Request) string {
+	return h.tokens.Hash("clap-ip", middleware.ClientIP(r))
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"blog-backend/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CommentEditWindow is how long after posting a commenter can edit or delete their comment
+const CommentEditWindow = 24 * time.Hour
+
+// commentEditPurpose scopes the signed tokens that authorize comment edits
+const commentEditPurpose = "comment-edit"
+
+// editableComment is the subset of comment columns needed to edit or delete one
+type editableComment struct {
+	ID        string  `json:"id"`
+	PostSlug  string  `json:"post_slug"`
+	Body      string  `json:"body"`
+	Status    string  `json:"status"`
+	DeletedAt *string `json:"deleted_at"`
+}
+
+// UpdateComment handles PUT /posts/{slug}/comments/{id}
+//
+// The edit token from CreateComment goes in the X-Comment-Token header or the token
+// query parameter. The previous body is kept in comment_revisions, and the new body is
+// checked for spam again so an approved comment can't be edited into spam.
+func (h *CommentHandler) UpdateComment(w http.ResponseWriter, r *http.Request) {
+	comment, ok := h.authorizeCommentEdit(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" {
+		http.Error(w, "body is required", http.StatusBadRequest)
+		return
+	}
+
+	status := comment.Status
+	if req.Body != comment.Body {
+		verdict := h.spam.Check(services.SpamCandidate{
+			PostSlug: comment.PostSlug,
+			Body:     req.Body,
+		})
+		switch {
+		case verdict.IsSpam():
+			status = models.CommentStatusSpam
+		case verdict.NeedsReview() && status == models.CommentStatusApproved:
+			status = models.CommentStatusPending
+		}
+
+		if err := h.saveCommentRevision(comment, "edit"); err != nil {
+			http.Error(w, "Failed to save comment", http.StatusInternalServerError)
+			return
+		}
+
+		update := map[string]any{
+			"body":      req.Body,
+			"status":    status,
+			"edited_at": time.Now().Format(time.RFC3339),
+		}
+		if _, _, err := h.db.GetClient().From("comments").Update(update, "minimal", "").Eq("id", comment.ID).Execute(); err != nil {
+			http.Error(w, "Failed to save comment", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "updated", "moderation": publicModerationStatus(status)})
+}
+
+// DeleteComment handles DELETE /posts/{slug}/comments/{id}
+//
+// Takes the same edit token as UpdateComment. Comments with replies are blanked and
+// marked deleted so the conversation under them stays readable.
+func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	comment, ok := h.authorizeCommentEdit(w, r)
+	if !ok {
+		return
+	}
+	client := h.db.GetClient()
+
+	_, replies, err := client.From("comments").Select("id", "exact", true).Eq("parent_id", comment.ID).Execute()
+	if err != nil {
+		http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
+		return
+	}
+
+	if replies == 0 {
+		_, _, err = client.From("comments").Delete("", "").Eq("id", comment.ID).Execute()
+	} else if err = h.saveCommentRevision(comment, "delete"); err == nil {
+		update := map[string]any{
+			"body":        "",
+			"author_name": "",
+			"deleted_at":  time.Now().Format(time.RFC3339),
+		}
+		_, _, err = client.From("comments").Update(update, "minimal", "").Eq("id", comment.ID).Execute()
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+// authorizeCommentEdit checks the edit token against the comment in the URL and loads
+// the comment. It writes the error response and returns false when the edit isn't allowed.
+func (h *CommentHandler) authorizeCommentEdit(w http.ResponseWriter, r *http.Request) (*editableComment, bool) {
+	slug := chi.URLParam(r, "slug")
+	id := chi.URLParam(r, "id")
+
+	token := r.Header.Get("X-Comment-Token")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+
+	commentID, err := h.notifier.tokens.Verify(commentEditPurpose, token)
+	if errors.Is(err, services.ErrExpiredToken) {
+		http.Error(w, "This comment can no longer be changed", http.StatusForbidden)
+		return nil, false
+	}
+	if err != nil || commentID != id {
+		http.Error(w, "Invalid edit token", http.StatusForbidden)
+		return nil, false
+	}
+
+	bytes, _, err := h.db.GetClient().From("comments").
+		Select("id,post_slug,body,status,deleted_at", "exact", false).
+		Eq("id", id).
+		Single().
+		Execute()
+	var comment editableComment
+	if err != nil || json.Unmarshal(bytes, &comment) != nil || comment.PostSlug != slug || comment.DeletedAt != nil {
+		http.Error(w, "comment not found", http.StatusNotFound)
+		return nil, false
+	}
+	return &comment, true
+}
+
+// saveCommentRevision keeps the comment's current body for moderators
+func (h *CommentHandler) saveCommentRevision(comment *editableComment, action string) error {
+	revision := map[string]any{
+		"comment_id": comment.ID,
+		"body":       comment.Body,
+		"status":     comment.Status,
+		"action":     action,
+	}
+	_, _, err := h.db.GetClient().From("comment_revisions").Insert(revision, false, "", "minimal", "").Execute()
+	return err
+}
+
+// SendEditLink emails a commenter the private link for editing their comment. It runs
+// in the background; failures are only logged since the token is also in the response.
+// The link also carries a commenter token, which the site keeps and sends with later
+// comments to show the address is the commenter's own.
+func (n *CommentNotifier) SendEditLink(comment models.Comment, token string) {
+	go func() {
+		postTitle := comment.PostSlug
+		postBytes, _, err := n.db.GetClient().From("posts").Select("title", "exact", false).Eq("slug", comment.PostSlug).Single().Execute()
+		if err == nil {
+			var post models.Post
+			if json.Unmarshal(postBytes, &post) == nil && post.Title != "" {
+				postTitle = post.Title
+			}
+		}
+
+		commenter := n.tokens.Sign(commenterPurpose, comment.AuthorEmail, commenterTokenTTL)
+		err = n.email.SendCommentEditLink(services.CommentEditEmail{
+			To:        comment.AuthorEmail,
+			Name:      comment.AuthorName,
+			PostTitle: postTitle,
+			ManageURL: fmt.Sprintf("%s/blog/%s?edit_comment=%s&token=%s&commenter=%s#comment-%s",
+				n.websiteURL, comment.PostSlug, comment.ID, url.QueryEscape(token), url.QueryEscape(commenter), comment.ID),
+			ExpiresAt: time.Now().Add(CommentEditWindow),
+		})
+		if err != nil {
+			log.Printf("[Comments] Failed to send edit link for %s: %v", comment.ID, err)
+		}
+	}()
+}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"blog-backend/services"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/supabase-community/postgrest-go"
+)
+
+// MaxCommentDepth is how deeply replies can nest; top-level comments have depth 0
+const MaxCommentDepth = 3
+
+// threadUnsubscribePurpose scopes the signed tokens in reply notification emails
+const threadUnsubscribePurpose = "comment-thread-unsubscribe"
+
+// CommentNotifier emails commenters about replies and post authors about new comments
+type CommentNotifier struct {
+	db          *services.DatabaseService
+	email       *services.EmailService
+	tokens      *services.TokenSigner
+	websiteURL  string
+	backendURL  string
+	authorEmail string // Digest recipient for posts without their own author_email
+}
+
+// NewCommentNotifier creates a new comment notifier
+func NewCommentNotifier(db *services.DatabaseService, email *services.EmailService, tokens *services.TokenSigner, websiteURL, backendURL, authorEmail string) *CommentNotifier {
+	return &CommentNotifier{
+		db:          db,
+		email:       email,
+		tokens:      tokens,
+		websiteURL:  strings.TrimSuffix(websiteURL, "/"),
+		backendURL:  strings.TrimSuffix(backendURL, "/"),
+		authorEmail: authorEmail,
+	}
+}
+
+// threadComment is the subset of comment columns used for notifications
+type threadComment struct {
+	ID              string  `json:"id"`
+	PostSlug        string  `json:"post_slug"`
+	AuthorName      string  `json:"author_name"`
+	AuthorEmail     string  `json:"author_email"`
+	Body            string  `json:"body"`
+	Status          string  `json:"status"`
+	ParentID        *string `json:"parent_id"`
+	RootID          *string `json:"root_id"`
+	ReplyNotifiedAt *string `json:"reply_notified_at"`
+}
+
+// NotifyReply emails the author of the comment that the given reply answers. It runs
+// in the background, only for approved replies, and at most once per reply.
+func (n *CommentNotifier) NotifyReply(replyID string) {
+	go func() {
+		if err := n.notifyReply(replyID); err != nil {
+			log.Printf("[Comments] Failed to send reply notification for %s: %v", replyID, err)
+		}
+	}()
+}
+
+func (n *CommentNotifier) notifyReply(replyID string) error {
+	client := n.db.GetClient()
+
+	reply, err := n.loadThreadComment(replyID)
+	if err != nil {
+		return err
+	}
+	if reply.ParentID == nil || reply.Status != models.CommentStatusApproved || reply.ReplyNotifiedAt != nil {
+		return nil
+	}
+
+	parent, err := n.loadThreadComment(*reply.ParentID)
+	if err != nil {
+		return err
+	}
+	recipient := strings.ToLower(strings.TrimSpace(parent.AuthorEmail))
+	if recipient == "" || recipient == strings.ToLower(reply.AuthorEmail) {
+		return nil
+	}
+
+	rootID := parent.ID
+	if parent.RootID != nil {
+		rootID = *parent.RootID
+	}
+
+	_, unsubscribed, err := client.From("comment_thread_unsubscribes").
+		Select("email", "exact", true).
+		Eq("root_comment_id", rootID).
+		Eq("email", recipient).
+		Execute()
+	if err != nil {
+		return err
+	}
+
+	// Claim the reply first so a concurrent approval can't send it twice
+	claimed, _, err := client.From("comments").
+		Update(map[string]any{"reply_notified_at": time.Now().Format(time.RFC3339)}, "representation", "").
+		Eq("id", reply.ID).
+		Is("reply_notified_at", "null").
+		Execute()
+	if err != nil {
+		return err
+	}
+	var claimedRows []map[string]any
+	if json.Unmarshal(claimed, &claimedRows) != nil || len(claimedRows) == 0 || unsubscribed > 0 {
+		return nil
+	}
+
+	postTitle := reply.PostSlug
+	postBytes, _, err := client.From("posts").Select("title", "exact", false).Eq("slug", reply.PostSlug).Single().Execute()
+	if err == nil {
+		var post models.Post
+		if json.Unmarshal(postBytes, &post) == nil && post.Title != "" {
+			postTitle = post.Title
+		}
+	}
+
+	token := n.tokens.Sign(threadUnsubscribePurpose, rootID+"|"+recipient, 0)
+	return n.email.SendCommentReply(services.CommentReplyEmail{
+		To:             recipient,
+		RecipientName:  parent.AuthorName,
+		ReplierName:    reply.AuthorName,
+		ReplyBody:      reply.Body,
+		PostTitle:      postTitle,
+		PostURL:        fmt.Sprintf("%s/blog/%s#comment-%s", n.websiteURL, reply.PostSlug, reply.ID),
+		UnsubscribeURL: fmt.Sprintf("%s/comments/unsubscribe?token=%s", n.backendURL, url.QueryEscape(token)),
+	})
+}
+
+func (n *CommentNotifier) loadThreadComment(id string) (*threadComment, error) {
+	bytes, _, err := n.db.GetClient().From("comments").
+		Select("id,post_slug,author_name,author_email,body,status,parent_id,root_id,reply_notified_at", "exact", false).
+		Eq("id", id).
+		Single().
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+	var comment threadComment
+	if err := json.Unmarshal(bytes, &comment); err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// UnsubscribeThread handles GET and POST /comments/unsubscribe?token=
+//
+// GET is the link in reply emails; POST is the RFC 8058 one-click unsubscribe
+// that mail clients send from the List-Unsubscribe header.
+func (n *CommentNotifier) UnsubscribeThread(w http.ResponseWriter, r *http.Request) {
+	subject, err := n.tokens.Verify(threadUnsubscribePurpose, r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, "This unsubscribe link is invalid", http.StatusBadRequest)
+		return
+	}
+	rootID, email, ok := strings.Cut(subject, "|")
+	if !ok {
+		http.Error(w, "This unsubscribe link is invalid", http.StatusBadRequest)
+		return
+	}
+
+	_, _, err = n.db.GetClient().From("comment_thread_unsubscribes").
+		Insert(map[string]any{"root_comment_id": rootID, "email": email}, true, "root_comment_id,email", "minimal", "").
+		Execute()
+	if err != nil {
+		http.Error(w, "Failed to unsubscribe", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Unsubscribed</title></head>
+<body style="font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; background: #fafafa; color: #000000;">
+	<div style="max-width: 480px; margin: 80px auto; background: #ffffff; padding: 40px; text-align: center;">
+		<h1 style="font-weight: 400; font-size: 22px;">You're unsubscribed</h1>
+		<p style="font-weight: 300; color: #666666;">We won't email you about new replies in this conversation.</p>
+		<a href="%s" style="color: #000000;">Back to Betadomot</a>
+	</div>
+</body>
+</html>`, n.websiteURL)
+}
+
+// StartCommentDigest emails post authors the day's new comments once a day at the given hour
+func (n *CommentNotifier) StartCommentDigest(hour int) {
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			time.Sleep(time.Until(next))
+
+			if err := n.sendCommentDigests(); err != nil {
+				log.Printf("[Comments] Failed to send comment digest: %v", err)
+			}
+		}
+	}()
+	log.Printf("💬 Comment digest scheduled daily at %02d:00", hour)
+}
+
+// sendCommentDigests groups approved comments not yet digested by post author and
+// emails each author, marking the comments once their digest went out
+func (n *CommentNotifier) sendCommentDigests() error {
+	client := n.db.GetClient()
+
+	commentBytes, _, err := client.From("comments").
+		Select("id,post_slug,author_name,body,parent_id", "exact", false).
+		Eq("status", models.CommentStatusApproved).
+		Is("digested_at", "null").
+		Order("created_at", &postgrest.OrderOpts{Ascending: true}).
+		Execute()
+	if err != nil {
+		return err
+	}
+	var comments []threadComment
+	if err := json.Unmarshal(commentBytes, &comments); err != nil {
+		return err
+	}
+	if len(comments) == 0 {
+		return nil
+	}
+
+	slugs := []string{}
+	bySlug := make(map[string][]threadComment)
+	for _, c := range comments {
+		if _, seen := bySlug[c.PostSlug]; !seen {
+			slugs = append(slugs, c.PostSlug)
+		}
+		bySlug[c.PostSlug] = append(bySlug[c.PostSlug], c)
+	}
+
+	postBytes, _, err := client.From("posts").Select("slug,title,author_email", "exact", false).In("slug", slugs).Execute()
+	if err != nil {
+		return err
+	}
+	var posts []struct {
+		Slug        string  `json:"slug"`
+		Title       string  `json:"title"`
+		AuthorEmail *string `json:"author_email"`
+	}
+	if err := json.Unmarshal(postBytes, &posts); err != nil {
+		return err
+	}
+
+	_, pending, _ := client.From("comments").Select("id", "exact", true).Eq("status", models.CommentStatusPending).Execute()
+
+	digests := make(map[string][]services.CommentDigestPost)
+	commentIDs := make(map[string][]string)
+	for _, post := range posts {
+		recipient := n.authorEmail
+		if post.AuthorEmail != nil && *post.AuthorEmail != "" {
+			recipient = *post.AuthorEmail
+		}
+		if recipient == "" {
+			continue
+		}
+
+		digestPost := services.CommentDigestPost{
+			Title: post.Title,
+			URL:   fmt.Sprintf("%s/blog/%s", n.websiteURL, post.Slug),
+		}
+		for _, c := range bySlug[post.Slug] {
+			digestPost.Comments = append(digestPost.Comments, services.CommentDigestEntry{
+				AuthorName: c.AuthorName,
+				Body:       c.Body,
+				IsReply:    c.ParentID != nil,
+			})
+			commentIDs[recipient] = append(commentIDs[recipient], c.ID)
+		}
+		digests[recipient] = append(digests[recipient], digestPost)
+	}
+
+	if len(digests) == 0 {
+		log.Println("[Comments] No digest recipient configured (BLOG_AUTHOR_EMAIL), skipping digest")
+		return nil
+	}
+
+	for recipient, digestPosts := range digests {
+		if err := n.email.SendCommentDigest(recipient, digestPosts, int(pending)); err != nil {
+			log.Printf("[Comments] Failed to send digest to %s: %v", recipient, err)
+			continue
+		}
+		_, _, err := client.From("comments").
+			Update(map[string]any{"digested_at": time.Now().Format(time.RFC3339)}, "minimal", "").
+			In("id", commentIDs[recipient]).
+			Execute()
+		if err != nil {
+			log.Printf("[Comments] Failed to mark digested comments for %s: %v", recipient, err)
+		}
+	}
+	return nil
+}
+
+// buildCommentThreads nests replies under their parents. Comments must be sorted
+// oldest first; replies whose parent isn't in the list are dropped.
+func buildCommentThreads(roots []models.Comment, replies []models.Comment) []models.Comment {
+	children := make(map[string][]models.Comment)
+	for _, reply := range replies {
+		if reply.ParentID != nil {
+			children[*reply.ParentID] = append(children[*reply.ParentID], reply)
+		}
+	}
+
+	var attach func(comment models.Comment, depth int) models.Comment
+	attach = func(comment models.Comment, depth int) models.Comment {
+		// The depth guard keeps bad data from recursing forever
+		if depth >= MaxCommentDepth {
+			return comment
+		}
+		for _, child := range children[comment.ID] {
+			comment.Replies = append(comment.Replies, attach(child, depth+1))
+		}
+		return comment
+	}
+
+	threads := make([]models.Comment, len(roots))
+	for i, root := range roots {
+		threads[i] = attach(root, 0)
+	}
+	return threads
+}
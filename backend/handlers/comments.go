@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"blog-backend/middleware"
 	"blog-backend/models"
 	"blog-backend/services"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/supabase-community/postgrest-go"
@@ -12,34 +17,97 @@ import (
 
 // CommentHandler handles comment-related HTTP requests
 type CommentHandler struct {
-	db *services.DatabaseService
+	db       *services.DatabaseService
+	spam     services.SpamChecker
+	notifier *CommentNotifier
 }
 
 // NewCommentHandler creates a new comment handler
-func NewCommentHandler(db *services.DatabaseService) *CommentHandler {
-	return &CommentHandler{db: db}
+func NewCommentHandler(db *services.DatabaseService, spam services.SpamChecker, notifier *CommentNotifier) *CommentHandler {
+	return &CommentHandler{db: db, spam: spam, notifier: notifier}
 }
 
-// GetComments handles GET /posts/{slug}/comments
+// commentFrequencyWindow is how far back posting frequency is measured
+const commentFrequencyWindow = 10 * time.Minute
+
+// commenterPurpose scopes the signed tokens that prove a commenter owns their email
+// address. The token rides along in the edit link emailed for every comment.
+const commenterPurpose = "commenter"
+
+// commenterTokenTTL is how long a commenter stays recognised without a new email
+const commenterTokenTTL = 365 * 24 * time.Hour
+
+// publicCommentColumns are the comment fields shown to readers
+const publicCommentColumns = "id,post_slug,author_name,body,parent_id,root_id,depth,edited,edited_at,deleted_at,created_at"
+
+// GetComments handles GET /posts/{slug}/comments?limit=20&offset=0
+//
+// Returns a page of top-level threads, oldest first, each with its replies nested
+// under "replies". Only approved comments are public. X-Total-Count holds the
+// number of threads.
 func (h *CommentHandler) GetComments(w http.ResponseWriter, r *http.Request) {
 	slug := chi.URLParam(r, "slug")
 	client := h.db.GetClient()
 
-	jsonStr, _, err := client.From("comments").
-		Select("*", "exact", false).
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	rootBytes, total, err := client.From("comments").
+		Select(publicCommentColumns, "exact", false).
 		Eq("post_slug", slug).
+		Eq("status", models.CommentStatusApproved).
+		Is("parent_id", "null").
 		Order("created_at", &postgrest.OrderOpts{Ascending: true}).
-		ExecuteString()
+		Range(offset, offset+limit-1, "").
+		Execute()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	var roots []models.Comment
+	if err := json.Unmarshal(rootBytes, &roots); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var replies []models.Comment
+	if len(roots) > 0 {
+		rootIDs := make([]string, len(roots))
+		for i, root := range roots {
+			rootIDs[i] = root.ID
+		}
+		replies, err = selectAll[models.Comment](func() *postgrest.FilterBuilder {
+			return client.From("comments").
+				Select(publicCommentColumns, "exact", false).
+				Eq("status", models.CommentStatusApproved).
+				In("root_id", rootIDs).
+				Order("created_at", &postgrest.OrderOpts{Ascending: true}).
+				Order("id", &postgrest.OrderOpts{Ascending: true})
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(jsonStr))
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	json.NewEncoder(w).Encode(buildCommentThreads(roots, replies))
 }
 
 // CreateComment handles POST /posts/{slug}/comments
+//
+// New comments are scored by the spam checker. Spam is stored but never shown,
+// suspicious comments and comments from first-time commenters wait for moderation,
+// and everything else is published straight away. A commenter only counts as known
+// when commenter_token proves author_email is theirs; the address alone is unverified.
 func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
 	slug := chi.URLParam(r, "slug")
 	client := h.db.GetClient()
@@ -67,18 +135,159 @@ func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Replies must answer a visible comment on the same post, within the depth limit
+	depth := 0
+	var parentID, rootID *string
+	if req.ParentID != "" {
+		parentBytes, _, err := client.From("comments").
+			Select("id,post_slug,status,depth,root_id", "exact", false).
+			Eq("id", req.ParentID).
+			Single().
+			Execute()
+		var parent models.Comment
+		if err != nil || json.Unmarshal(parentBytes, &parent) != nil ||
+			parent.PostSlug != slug || parent.Status != models.CommentStatusApproved {
+			http.Error(w, "parent comment not found", http.StatusBadRequest)
+			return
+		}
+		if parent.Depth >= MaxCommentDepth {
+			http.Error(w, fmt.Sprintf("replies can only be nested %d levels deep", MaxCommentDepth), http.StatusBadRequest)
+			return
+		}
+		depth = parent.Depth + 1
+		parentID = &parent.ID
+		rootID = parent.RootID
+		if rootID == nil {
+			rootID = &parent.ID
+		}
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.AuthorEmail))
+	ip := middleware.ClientIP(r)
+
+	verdict := h.spam.Check(services.SpamCandidate{
+		PostSlug:       slug,
+		AuthorName:     req.AuthorName,
+		AuthorEmail:    email,
+		Body:           req.Body,
+		Honeypot:       req.Website,
+		IP:             ip,
+		RecentComments: h.recentCommentCount(email, ip),
+	})
+
+	status := models.CommentStatusApproved
+	switch {
+	case verdict.IsSpam():
+		status = models.CommentStatusSpam
+	case verdict.NeedsReview():
+		status = models.CommentStatusPending
+	case !h.isKnownCommenter(email, req.CommenterToken):
+		status = models.CommentStatusPending
+	}
+
+	reasons := verdict.Reasons
+	if reasons == nil {
+		reasons = []string{}
+	}
+
 	comment := map[string]any{
 		"post_slug":    slug,
 		"author_name":  req.AuthorName,
-		"author_email": req.AuthorEmail,
+		"author_email": email,
 		"body":         req.Body,
+		"status":       status,
+		"spam_score":   verdict.Score,
+		"spam_reasons": reasons,
+		"author_ip":    ip,
+		"parent_id":    parentID,
+		"root_id":      rootID,
+		"depth":        depth,
 	}
 
-	if _, _, err := client.From("comments").Insert(comment, false, "", "minimal", "").Execute(); err != nil {
+	insertedBytes, _, err := client.From("comments").Insert(comment, false, "", "representation", "").Execute()
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	var inserted []models.Comment
+	if err := json.Unmarshal(insertedBytes, &inserted); err != nil || len(inserted) == 0 {
+		http.Error(w, "Failed to create comment", http.StatusInternalServerError)
+		return
+	}
+	created := inserted[0]
+
+	if status == models.CommentStatusApproved && parentID != nil {
+		h.notifier.NotifyReply(created.ID)
+	}
+
+	// The edit token lets the author change or delete the comment for a while
+	editToken := h.notifier.tokens.Sign(commentEditPurpose, created.ID, CommentEditWindow)
+	if email != "" {
+		h.notifier.SendEditLink(created, editToken)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"status": "created"})
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":          "created",
+		"id":              created.ID,
+		"moderation":      publicModerationStatus(status),
+		"edit_token":      editToken,
+		"edit_expires_at": time.Now().Add(CommentEditWindow).Format(time.RFC3339),
+	})
+}
+
+// publicModerationStatus reports spam as pending so spammers can't tell they were caught
+func publicModerationStatus(status string) string {
+	if status == models.CommentStatusSpam {
+		return models.CommentStatusPending
+	}
+	return status
+}
+
+// recentCommentCount returns how many comments the email or IP posted within the frequency window
+func (h *CommentHandler) recentCommentCount(email, ip string) int {
+	client := h.db.GetClient()
+	since := time.Now().Add(-commentFrequencyWindow).Format(time.RFC3339)
+
+	count := 0
+	if email != "" {
+		_, byEmail, err := client.From("comments").Select("id", "exact", true).
+			Eq("author_email", email).Gte("created_at", since).Execute()
+		if err == nil && int(byEmail) > count {
+			count = int(byEmail)
+		}
+	}
+	if ip != "" {
+		_, byIP, err := client.From("comments").Select("id", "exact", true).
+			Eq("author_ip", ip).Gte("created_at", since).Execute()
+		if err == nil && int(byIP) > count {
+			count = int(byIP)
+		}
+	}
+	return count
+}
+
+// isKnownCommenter reports whether the token proves the commenter owns the email and
+// the email already has an approved comment
+func (h *CommentHandler) isKnownCommenter(email, token string) bool {
+	if email == "" || token == "" {
+		return false
+	}
+	subject, err := h.notifier.tokens.Verify(commenterPurpose, token)
+	if err != nil || subject != email {
+		return false
+	}
+	return h.hasApprovedComment(email)
+}
+
+// hasApprovedComment reports whether the email already has an approved comment
+func (h *CommentHandler) hasApprovedComment(email string) bool {
+	_, count, err := h.db.GetClient().From("comments").Select("id", "exact", true).
+		Eq("author_email", email).
+		Eq("status", models.CommentStatusApproved).
+		Limit(1, "").
+		Execute()
+	return err == nil && count > 0
 }
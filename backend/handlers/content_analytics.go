@@ -0,0 +1,444 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"blog-backend/services"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readThreshold is the progress (in percent) at which a session counts as a read
+const readThreshold = 75
+
+// topContentLimit is how many items the content report ranks
+const topContentLimit = 10
+
+// maxEventField bounds the length of free-form event fields
+const maxEventField = 200
+
+// TrackContentEvent handles POST /analytics/events
+//
+// Records a page view or read progress event for a post or guide that exists. Events
+// feed the daily rollups only; the views counter on posts and guides is still bumped by
+// GetPost and GetGuide.
+func (h *AnalyticsHandler) TrackContentEvent(w http.ResponseWriter, r *http.Request) {
+	var event models.ContentEvent
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&event); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if event.ContentType != "post" && event.ContentType != "guide" {
+		http.Error(w, "content_type must be post or guide", http.StatusBadRequest)
+		return
+	}
+	if event.Slug == "" || len(event.Slug) > maxEventField {
+		http.Error(w, "slug is required", http.StatusBadRequest)
+		return
+	}
+
+	row := map[string]interface{}{
+		"content_type":  event.ContentType,
+		"slug":          event.Slug,
+		"event_type":    event.Event,
+		"session_id":    truncateField(event.SessionID),
+		"referrer_host": referrerHost(event.Referrer),
+		"utm_source":    strings.ToLower(truncateField(event.UTMSource)),
+		"utm_medium":    strings.ToLower(truncateField(event.UTMMedium)),
+		"utm_campaign":  strings.ToLower(truncateField(event.UTMCampaign)),
+	}
+
+	switch event.Event {
+	case "page_view":
+	case "read_progress":
+		if event.Progress == nil || *event.Progress < 0 || *event.Progress > 100 {
+			http.Error(w, "progress must be between 0 and 100", http.StatusBadRequest)
+			return
+		}
+		row["progress"] = *event.Progress
+	default:
+		http.Error(w, "event must be page_view or read_progress", http.StatusBadRequest)
+		return
+	}
+
+	device := deviceFromUserAgent(r.UserAgent())
+	if device == "bot" {
+		// Crawlers are acknowledged but not counted
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	row["device"] = device
+
+	if !h.contentExists(event.ContentType, event.Slug) {
+		http.Error(w, "content not found", http.StatusNotFound)
+		return
+	}
+
+	if _, _, err := h.db.GetClient().From("content_events").Insert(row, false, "", "minimal", "").Execute(); err != nil {
+		log.Printf("[Analytics] Failed to record %s event for %s/%s: %v", event.Event, event.ContentType, event.Slug, err)
+		http.Error(w, "Failed to record event", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// GetContentAnalytics handles GET /admin/analytics/content?days=7
+//
+// Without a slug it returns the top content of the period (default: the last 7 days)
+// with site-wide referrer, UTM and device breakdowns. With ?type=post|guide&slug= it
+// returns that item's daily timeline (default: the last 30 days) and its breakdowns.
+// The numbers come from the rollup tables, so today's are as fresh as the last
+// StartContentRollup run.
+func (h *AnalyticsHandler) GetContentAnalytics(w http.ResponseWriter, r *http.Request) {
+	sqlDB := h.db.GetSQLDB()
+	if sqlDB == nil {
+		http.Error(w, "Content analytics need a direct database connection (DATABASE_URL)", http.StatusServiceUnavailable)
+		return
+	}
+
+	contentType := r.URL.Query().Get("type")
+	slug := r.URL.Query().Get("slug")
+	if slug != "" && contentType != "post" && contentType != "guide" {
+		http.Error(w, "type must be post or guide when slug is given", http.StatusBadRequest)
+		return
+	}
+
+	days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+	if days <= 0 {
+		days = 7
+		if slug != "" {
+			days = 30
+		}
+	}
+
+	to := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	from := to.AddDate(0, 0, -days)
+
+	report := models.ContentAnalyticsReport{
+		From: from.Format("2006-01-02"),
+		To:   to.Format("2006-01-02"),
+	}
+
+	var err error
+	if slug != "" {
+		report.Content, report.Timeline, err = loadContentTimeline(sqlDB, contentType, slug, from, to)
+	} else {
+		report.TopContent, err = loadTopContent(sqlDB, contentType, from, to)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if report.Breakdowns, err = loadContentBreakdowns(sqlDB, contentType, slug, from, to); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// StartContentRollup rolls content events up into the daily tables every interval.
+// Each run recomputes yesterday and today so late events are picked up.
+func (h *AnalyticsHandler) StartContentRollup(interval time.Duration) {
+	sqlDB := h.db.GetSQLDB()
+	if sqlDB == nil {
+		log.Println("⚠️  DATABASE_URL not set, content analytics rollups disabled")
+		return
+	}
+
+	go func() {
+		for {
+			to := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+			if err := rollupContentEvents(sqlDB, to.AddDate(0, 0, -2), to); err != nil {
+				log.Printf("[Analytics] Content rollup failed: %v", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+	log.Printf("📈 Content analytics rollup running every %s", interval)
+}
+
+// contentExists reports whether a post or guide with the slug exists
+func (h *AnalyticsHandler) contentExists(contentType, slug string) bool {
+	table := "posts"
+	if contentType == "guide" {
+		table = "guides"
+	}
+	_, count, err := h.db.GetClient().From(table).Select("slug", "exact", true).
+		Eq("slug", slug).
+		Limit(1, "").
+		Execute()
+	return err == nil && count > 0
+}
+
+// rollupContentEvents recomputes the daily stats and breakdowns for whole days in [from, to)
+func rollupContentEvents(sqlDB *sql.DB, from, to time.Time) error {
+	tx, err := sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		WITH views AS (
+			SELECT (created_at AT TIME ZONE 'UTC')::DATE AS day, content_type, slug,
+				COUNT(*) AS views,
+				COUNT(DISTINCT session_id) AS unique_visitors
+			FROM content_events
+			WHERE event_type = 'page_view' AND created_at >= $1 AND created_at < $2
+			GROUP BY 1, 2, 3
+		), sessions AS (
+			SELECT (created_at AT TIME ZONE 'UTC')::DATE AS day, content_type, slug, session_id,
+				MAX(progress) AS depth
+			FROM content_events
+			WHERE event_type = 'read_progress' AND created_at >= $1 AND created_at < $2
+			GROUP BY 1, 2, 3, 4
+		), depth AS (
+			SELECT day, content_type, slug,
+				COUNT(*) FILTER (WHERE depth >= $3) AS reads,
+				AVG(depth) AS avg_read_depth
+			FROM sessions
+			GROUP BY 1, 2, 3
+		)
+		INSERT INTO content_daily_stats (day, content_type, slug, views, unique_visitors, reads, avg_read_depth, updated_at)
+		SELECT COALESCE(v.day, d.day), COALESCE(v.content_type, d.content_type), COALESCE(v.slug, d.slug),
+			COALESCE(v.views, 0), COALESCE(v.unique_visitors, 0), COALESCE(d.reads, 0), COALESCE(d.avg_read_depth, 0), NOW()
+		FROM views v
+		FULL OUTER JOIN depth d ON d.day = v.day AND d.content_type = v.content_type AND d.slug = v.slug
+		ON CONFLICT (day, content_type, slug) DO UPDATE SET
+			views = EXCLUDED.views,
+			unique_visitors = EXCLUDED.unique_visitors,
+			reads = EXCLUDED.reads,
+			avg_read_depth = EXCLUDED.avg_read_depth,
+			updated_at = NOW()`, from, to, readThreshold)
+	if err != nil {
+		return fmt.Errorf("failed to roll up daily stats: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO content_daily_breakdowns (day, content_type, slug, dimension, value, views)
+		SELECT (e.created_at AT TIME ZONE 'UTC')::DATE, e.content_type, e.slug, d.dimension, d.value, COUNT(*)
+		FROM content_events e
+		CROSS JOIN LATERAL (VALUES
+			('referrer', COALESCE(NULLIF(e.referrer_host, ''), 'direct')),
+			('utm_source', e.utm_source),
+			('utm_medium', e.utm_medium),
+			('utm_campaign', e.utm_campaign),
+			('device', e.device)
+		) AS d(dimension, value)
+		WHERE e.event_type = 'page_view' AND e.created_at >= $1 AND e.created_at < $2
+			AND d.value IS NOT NULL AND d.value <> ''
+		GROUP BY 1, 2, 3, 4, 5
+		ON CONFLICT (day, content_type, slug, dimension, value) DO UPDATE SET views = EXCLUDED.views`, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to roll up breakdowns: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func loadTopContent(sqlDB *sql.DB, contentType string, from, to time.Time) ([]models.ContentStats, error) {
+	rows, err := sqlDB.Query(`
+		SELECT s.content_type, s.slug, COALESCE(p.title, g.title, s.slug),
+			SUM(s.views), SUM(s.unique_visitors), SUM(s.reads),
+			COALESCE(SUM(s.avg_read_depth * s.unique_visitors) / NULLIF(SUM(s.unique_visitors), 0), 0)
+		FROM content_daily_stats s
+		LEFT JOIN posts p ON s.content_type = 'post' AND p.slug = s.slug
+		LEFT JOIN guides g ON s.content_type = 'guide' AND g.slug = s.slug
+		WHERE s.day >= $1 AND s.day < $2 AND ($3 = '' OR s.content_type = $3)
+		GROUP BY 1, 2, 3
+		ORDER BY 4 DESC
+		LIMIT $4`, from.Format("2006-01-02"), to.Format("2006-01-02"), contentType, topContentLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load top content: %w", err)
+	}
+	defer rows.Close()
+
+	top := []models.ContentStats{}
+	for rows.Next() {
+		var stats models.ContentStats
+		if err := rows.Scan(&stats.ContentType, &stats.Slug, &stats.Title, &stats.Views, &stats.UniqueVisitors, &stats.Reads, &stats.AvgReadDepth); err != nil {
+			return nil, err
+		}
+		top = append(top, stats)
+	}
+	return top, rows.Err()
+}
+
+// loadContentTimeline returns an item's totals and one entry per day, including days without views
+func loadContentTimeline(sqlDB *sql.DB, contentType, slug string, from, to time.Time) (*models.ContentStats, []models.ContentDay, error) {
+	rows, err := sqlDB.Query(`
+		SELECT day, views, unique_visitors, reads, avg_read_depth
+		FROM content_daily_stats
+		WHERE content_type = $1 AND slug = $2 AND day >= $3 AND day < $4
+		ORDER BY day`, contentType, slug, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load content timeline: %w", err)
+	}
+	defer rows.Close()
+
+	byDay := make(map[string]models.ContentDay)
+	for rows.Next() {
+		var day time.Time
+		var entry models.ContentDay
+		if err := rows.Scan(&day, &entry.Views, &entry.UniqueVisitors, &entry.Reads, &entry.AvgReadDepth); err != nil {
+			return nil, nil, err
+		}
+		entry.Day = day.Format("2006-01-02")
+		byDay[entry.Day] = entry
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	totals := &models.ContentStats{ContentType: contentType, Slug: slug}
+	weightedDepth := 0.0
+	timeline := []models.ContentDay{}
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		key := day.Format("2006-01-02")
+		entry, ok := byDay[key]
+		if !ok {
+			entry = models.ContentDay{Day: key}
+		}
+		totals.Views += entry.Views
+		totals.UniqueVisitors += entry.UniqueVisitors
+		totals.Reads += entry.Reads
+		weightedDepth += entry.AvgReadDepth * float64(entry.UniqueVisitors)
+		timeline = append(timeline, entry)
+	}
+	if totals.UniqueVisitors > 0 {
+		totals.AvgReadDepth = weightedDepth / float64(totals.UniqueVisitors)
+	}
+
+	table := "posts"
+	if contentType == "guide" {
+		table = "guides"
+	}
+	// table is one of two constants, never user input
+	err = sqlDB.QueryRow(fmt.Sprintf(`SELECT title FROM %s WHERE slug = $1`, table), slug).Scan(&totals.Title)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, nil, err
+	}
+
+	return totals, timeline, nil
+}
+
+// loadContentBreakdowns returns the top values of each breakdown dimension, site-wide
+// or for one item when slug is set
+func loadContentBreakdowns(sqlDB *sql.DB, contentType, slug string, from, to time.Time) (map[string][]models.ContentBreakdownItem, error) {
+	rows, err := sqlDB.Query(`
+		SELECT dimension, value, views FROM (
+			SELECT dimension, value, SUM(views) AS views,
+				ROW_NUMBER() OVER (PARTITION BY dimension ORDER BY SUM(views) DESC) AS rank
+			FROM content_daily_breakdowns
+			WHERE day >= $1 AND day < $2
+				AND ($3 = '' OR content_type = $3)
+				AND ($4 = '' OR slug = $4)
+			GROUP BY dimension, value
+		) ranked
+		WHERE rank <= $5
+		ORDER BY dimension, views DESC`, from.Format("2006-01-02"), to.Format("2006-01-02"), contentType, slug, topContentLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load breakdowns: %w", err)
+	}
+	defer rows.Close()
+
+	breakdowns := map[string][]models.ContentBreakdownItem{
+		"referrer":     {},
+		"utm_source":   {},
+		"utm_medium":   {},
+		"utm_campaign": {},
+		"device":       {},
+	}
+	for rows.Next() {
+		var dimension string
+		var item models.ContentBreakdownItem
+		if err := rows.Scan(&dimension, &item.Value, &item.Views); err != nil {
+			return nil, err
+		}
+		breakdowns[dimension] = append(breakdowns[dimension], item)
+	}
+	return breakdowns, rows.Err()
+}
+
+// incrementContentViews atomically bumps the views counter of a post or guide and
+// returns the new value
+func incrementContentViews(db *services.DatabaseService, contentType, slug string) (int, error) {
+	if sqlDB := db.GetSQLDB(); sqlDB != nil {
+		table := "posts"
+		if contentType == "guide" {
+			table = "guides"
+		}
+		var views int
+		err := sqlDB.QueryRow(fmt.Sprintf(`UPDATE %s SET views = COALESCE(views, 0) + 1 WHERE slug = $1 RETURNING views`, table), slug).Scan(&views)
+		return views, err
+	}
+
+	// Without a direct connection use the increment_content_views database function
+	result := db.GetClient().Rpc("increment_content_views", "", map[string]string{
+		"p_content_type": contentType,
+		"p_slug":         slug,
+	})
+	views, err := strconv.Atoi(strings.TrimSpace(result))
+	if err != nil {
+		return 0, fmt.Errorf("increment_content_views failed: %s", result)
+	}
+	return views, nil
+}
+
+// recordContentView bumps the views counter for a post or guide response, keeping the
+// value already in the response when the update fails
+func recordContentView(db *services.DatabaseService, contentType, slug string, item map[string]any) {
+	views, err := incrementContentViews(db, contentType, slug)
+	if err != nil {
+		log.Printf("[Analytics] Failed to increment %s views: %v", contentType, err)
+		return
+	}
+	item["views"] = views
+}
+
+// referrerHost reduces a referrer URL to its host, without a leading www.
+func referrerHost(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+	parsed, err := url.Parse(referrer)
+	if err != nil || parsed.Hostname() == "" {
+		return ""
+	}
+	return truncateField(strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www."))
+}
+
+// deviceFromUserAgent classifies a User-Agent as desktop, mobile, tablet or bot
+func deviceFromUserAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return "unknown"
+	case strings.Contains(ua, "bot") || strings.Contains(ua, "crawler") || strings.Contains(ua, "spider") || strings.Contains(ua, "preview"):
+		return "bot"
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet"):
+		return "tablet"
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone") || strings.Contains(ua, "android"):
+		return "mobile"
+	}
+	return "desktop"
+}
+
+func truncateField(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) > maxEventField {
+		return value[:maxEventField]
+	}
+	return value
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"blog-backend/services"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// EmailOutboxHandler shows the emails kept by the outbox and memory transports, so
+// every email path can be checked locally without sending anything
+type EmailOutboxHandler struct {
+	email *services.EmailService
+}
+
+// NewEmailOutboxHandler creates a new email outbox handler
+func NewEmailOutboxHandler(email *services.EmailService) *EmailOutboxHandler {
+	return &EmailOutboxHandler{email: email}
+}
+
+// capturedEmailSummary is a captured email without its bodies, for listings
+type capturedEmailSummary struct {
+	ID      string    `json:"id"`
+	SentAt  time.Time `json:"sent_at"`
+	From    string    `json:"from"`
+	To      []string  `json:"to"`
+	Subject string    `json:"subject"`
+}
+
+// GetMessages handles GET /admin/email/outbox
+func (h *EmailOutboxHandler) GetMessages(w http.ResponseWriter, r *http.Request) {
+	messages, ok := h.captured(w)
+	if !ok {
+		return
+	}
+
+	summaries := make([]capturedEmailSummary, 0, len(messages))
+	for _, message := range messages {
+		summaries = append(summaries, capturedEmailSummary{
+			ID:      message.ID,
+			SentAt:  message.SentAt,
+			From:    message.From,
+			To:      message.To,
+			Subject: message.Subject,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
+
+// GetMessage handles GET /admin/email/outbox/{id}
+func (h *EmailOutboxHandler) GetMessage(w http.ResponseWriter, r *http.Request) {
+	message, ok := h.message(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(message)
+}
+
+// GetMessageHTML handles GET /admin/email/outbox/{id}/html, showing the email as a
+// mail client would
+func (h *EmailOutboxHandler) GetMessageHTML(w http.ResponseWriter, r *http.Request) {
+	message, ok := h.message(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	if message.HTML == "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(message.Text))
+		return
+	}
+	// The email's own HTML; keep it from running scripts or loading frames in the admin
+	w.Header().Set("Content-Security-Policy", "script-src 'none'; frame-src 'none'")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(message.HTML))
+}
+
+// ClearMessages handles DELETE /admin/email/outbox
+func (h *EmailOutboxHandler) ClearMessages(w http.ResponseWriter, r *http.Request) {
+	capture := h.email.Capture()
+	if capture == nil {
+		http.Error(w, "the email transport doesn't keep messages", http.StatusNotFound)
+		return
+	}
+	if err := capture.Clear(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var outboxPage = template.Must(template.New("outbox").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Email outbox</title>
+	<style>
+		body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; margin: 40px; color: #000; }
+		table { border-collapse: collapse; width: 100%; font-size: 14px; }
+		th, td { text-align: left; padding: 10px 12px; border-bottom: 1px solid #eee; vertical-align: top; }
+		th { font-weight: 500; color: #666; }
+		.muted { color: #999; }
+	</style>
+</head>
+<body>
+	<h1>Email outbox</h1>
+	<p class="muted">{{len .}} message(s) kept by the email transport instead of being sent.</p>
+	<table>
+		<tr><th>Sent</th><th>To</th><th>Subject</th><th></th></tr>
+		{{range .}}
+		<tr>
+			<td class="muted">{{.SentAt.Format "2 Jan 15:04:05"}}</td>
+			<td>{{range $i, $to := .To}}{{if $i}}, {{end}}{{$to}}{{end}}</td>
+			<td><a href="{{.ID}}/html" target="_blank">{{.Subject}}</a></td>
+			<td><a href="{{.ID}}" class="muted">json</a></td>
+		</tr>
+		{{else}}
+		<tr><td colspan="4" class="muted">Nothing yet.</td></tr>
+		{{end}}
+	</table>
+</body>
+</html>`))
+
+// GetOutboxPage handles GET /admin/email/outbox/page, a page listing the captured
+// emails with links to each one
+func (h *EmailOutboxHandler) GetOutboxPage(w http.ResponseWriter, r *http.Request) {
+	messages, ok := h.captured(w)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	outboxPage.Execute(w, messages)
+}
+
+func (h *EmailOutboxHandler) captured(w http.ResponseWriter) ([]services.CapturedEmail, bool) {
+	capture := h.email.Capture()
+	if capture == nil {
+		http.Error(w, "the email transport doesn't keep messages; set EMAIL_TRANSPORT=outbox or memory", http.StatusNotFound)
+		return nil, false
+	}
+	messages, err := capture.Captured()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return messages, true
+}
+
+func (h *EmailOutboxHandler) message(w http.ResponseWriter, id string) (*services.CapturedEmail, bool) {
+	messages, ok := h.captured(w)
+	if !ok {
+		return nil, false
+	}
+	for i := range messages {
+		if messages[i].ID == id {
+			return &messages[i], true
+		}
+	}
+	http.Error(w, "message not found", http.StatusNotFound)
+	return nil, false
+}
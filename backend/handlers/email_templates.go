@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"blog-backend/services"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// EmailTemplateHandler lets the admin edit the subject and content of the built-in
+// email templates. Overrides are stored in email_templates and validated against the
+// template's sample data before they are saved.
+type EmailTemplateHandler struct {
+	db    *services.DatabaseService
+	email *services.EmailService
+}
+
+// NewEmailTemplateHandler creates a new email template handler
+func NewEmailTemplateHandler(db *services.DatabaseService, email *services.EmailService) *EmailTemplateHandler {
+	return &EmailTemplateHandler{db: db, email: email}
+}
+
+// emailTemplateView is a template as the admin edits it: the override when there is one,
+// the built-in source otherwise
+type emailTemplateView struct {
+	services.EmailTemplateInfo
+	Subject        string  `json:"subject"`
+	Body           string  `json:"body"`
+	DefaultSubject string  `json:"default_subject"`
+	DefaultBody    string  `json:"default_body"`
+	Overridden     bool    `json:"overridden"`
+	UpdatedAt      *string `json:"updated_at"`
+}
+
+// GetTemplates handles GET /admin/email/templates
+func (h *EmailTemplateHandler) GetTemplates(w http.ResponseWriter, r *http.Request) {
+	overrides, err := h.loadOverrides()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]emailTemplateView, 0, len(services.EmailTemplateCatalog()))
+	for _, info := range services.EmailTemplateCatalog() {
+		view, err := h.view(info, overrides[info.Name])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		views = append(views, *view)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+// GetTemplate handles GET /admin/email/templates/{name}
+func (h *EmailTemplateHandler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	info, ok := findEmailTemplate(chi.URLParam(r, "name"))
+	if !ok {
+		http.Error(w, "email template not found", http.StatusNotFound)
+		return
+	}
+	overrides, err := h.loadOverrides()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	view, err := h.view(info, overrides[info.Name])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+// UpdateTemplate handles PUT /admin/email/templates/{name}
+//
+// The override is rendered with the template's sample data first; a template that
+// doesn't parse or execute is rejected with the error so it never reaches a customer.
+func (h *EmailTemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	info, ok := findEmailTemplate(chi.URLParam(r, "name"))
+	if !ok {
+		http.Error(w, "email template not found", http.StatusNotFound)
+		return
+	}
+
+	var input models.EmailTemplate
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(input.Subject) == "" || strings.TrimSpace(input.Body) == "" {
+		http.Error(w, "subject and body are required", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.email.Templates().Validate(info.Name, input.Subject, input.Body); err != nil {
+		http.Error(w, "Invalid template: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	row := map[string]any{
+		"name":       info.Name,
+		"subject":    input.Subject,
+		"body":       input.Body,
+		"updated_at": time.Now().Format(time.RFC3339),
+	}
+	if _, _, err := h.db.GetClient().From("email_templates").Insert(row, true, "name", "minimal", "").Execute(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.email.Templates().Invalidate()
+
+	h.GetTemplate(w, r)
+}
+
+// DeleteTemplate handles DELETE /admin/email/templates/{name}, restoring the built-in template
+func (h *EmailTemplateHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	info, ok := findEmailTemplate(chi.URLParam(r, "name"))
+	if !ok {
+		http.Error(w, "email template not found", http.StatusNotFound)
+		return
+	}
+	if _, _, err := h.db.GetClient().From("email_templates").Delete("minimal", "").Eq("name", info.Name).Execute(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.email.Templates().Invalidate()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PreviewTemplate handles POST /admin/email/templates/{name}/preview
+//
+// Renders the posted subject and body with the template's sample data without saving
+// them. An empty body previews the template as it is currently sent.
+func (h *EmailTemplateHandler) PreviewTemplate(w http.ResponseWriter, r *http.Request) {
+	info, ok := findEmailTemplate(chi.URLParam(r, "name"))
+	if !ok {
+		http.Error(w, "email template not found", http.StatusNotFound)
+		return
+	}
+
+	var input models.EmailTemplate
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var rendered *services.RenderedEmail
+	var err error
+	if strings.TrimSpace(input.Body) == "" {
+		rendered, err = h.email.Templates().Preview(info.Name)
+	} else {
+		rendered, err = h.email.Templates().Validate(info.Name, input.Subject, input.Body)
+	}
+	if err != nil {
+		http.Error(w, "Invalid template: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rendered)
+}
+
+func (h *EmailTemplateHandler) loadOverrides() (map[string]models.EmailTemplate, error) {
+	bytes, _, err := h.db.GetClient().From("email_templates").Select("*", "exact", false).Execute()
+	if err != nil {
+		return nil, err
+	}
+	var rows []models.EmailTemplate
+	if err := json.Unmarshal(bytes, &rows); err != nil {
+		return nil, err
+	}
+	overrides := make(map[string]models.EmailTemplate, len(rows))
+	for _, row := range rows {
+		overrides[row.Name] = row
+	}
+	return overrides, nil
+}
+
+func (h *EmailTemplateHandler) view(info services.EmailTemplateInfo, override models.EmailTemplate) (*emailTemplateView, error) {
+	subject, body, err := h.email.Templates().Default(info.Name)
+	if err != nil {
+		return nil, err
+	}
+	view := &emailTemplateView{
+		EmailTemplateInfo: info,
+		Subject:           subject,
+		Body:              body,
+		DefaultSubject:    subject,
+		DefaultBody:       body,
+	}
+	if override.Name != "" {
+		view.Subject = override.Subject
+		view.Body = override.Body
+		view.Overridden = true
+		view.UpdatedAt = &override.UpdatedAt
+	}
+	return view, nil
+}
+
+func findEmailTemplate(name string) (services.EmailTemplateInfo, bool) {
+	for _, info := range services.EmailTemplateCatalog() {
+		if info.Name == name {
+			return info, true
+		}
+	}
+	return services.EmailTemplateInfo{}, false
+}
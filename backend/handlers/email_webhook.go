@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"blog-backend/services"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// EmailWebhookHandler ingests Resend's delivery webhooks
+type EmailWebhookHandler struct {
+	db    *services.DatabaseService
+	email *services.EmailService
+}
+
+// NewEmailWebhookHandler creates a new email webhook handler
+func NewEmailWebhookHandler(db *services.DatabaseService, email *services.EmailService) *EmailWebhookHandler {
+	return &EmailWebhookHandler{db: db, email: email}
+}
+
+// maxWebhookSize bounds a webhook body; Resend's events are a few kilobytes
+const maxWebhookSize = 1 << 20
+
+// HandleWebhook handles POST /email/webhook
+//
+// Records delivered, delivery_delayed, bounced and complained events against the
+// newsletter delivery they belong to. Hard bounces and complaints also take the address
+// off the newsletter list, whichever email they came from.
+func (h *EmailWebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookSize))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.email.VerifyWebhookSignature(body, r.Header); err != nil {
+		log.Printf("[Email] Rejected webhook: %v", err)
+		status := http.StatusUnauthorized
+		if errors.Is(err, services.ErrWebhookNotConfigured) {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, "Invalid signature", status)
+		return
+	}
+
+	var event models.ResendWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "Invalid event data", http.StatusBadRequest)
+		return
+	}
+
+	recipient := ""
+	if len(event.Data.To) > 0 {
+		recipient = strings.ToLower(event.Data.To[0])
+	}
+
+	// Resend retries until it gets a 2xx, so each svix id is only processed once
+	_, _, err = h.db.GetClient().From("email_webhook_events").
+		Insert(map[string]any{
+			"svix_id":    r.Header.Get("svix-id"),
+			"event_type": event.Type,
+			"email_id":   event.Data.EmailID,
+			"recipient":  recipient,
+			"payload":    json.RawMessage(body),
+		}, false, "", "minimal", "").
+		Execute()
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "23505") {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		log.Printf("[Email] Failed to log webhook %s: %v", event.Type, err)
+		http.Error(w, "Failed to record event", http.StatusInternalServerError)
+		return
+	}
+
+	at := event.CreatedAt
+	if at == "" {
+		at = time.Now().Format(time.RFC3339)
+	}
+
+	switch event.Type {
+	case "email.delivered":
+		err = h.updateDelivery(event.Data.EmailID, map[string]any{"delivered_at": at})
+	case "email.delivery_delayed":
+		err = h.updateDelivery(event.Data.EmailID, map[string]any{"delayed_at": at})
+	case "email.bounced":
+		bounceType := ""
+		if event.Data.Bounce != nil {
+			bounceType = event.Data.Bounce.Type
+		}
+		err = h.updateDelivery(event.Data.EmailID, map[string]any{"bounced_at": at, "bounce_type": bounceType})
+		// Transient bounces (full mailbox, greylisting) may still go through next time
+		if err == nil && bounceType == "Permanent" {
+			err = h.suppressSubscribers(event.Data.To, "bounced", "hard bounce: "+event.Data.Bounce.Message)
+		}
+	case "email.complained":
+		err = h.updateDelivery(event.Data.EmailID, map[string]any{"complained_at": at})
+		if err == nil {
+			err = h.suppressSubscribers(event.Data.To, "complained", "marked a newsletter as spam")
+		}
+	default:
+		log.Printf("[Email] Unhandled webhook event: %s", event.Type)
+	}
+
+	if err != nil {
+		log.Printf("[Email] Failed to process webhook %s for %s: %v", event.Type, event.Data.EmailID, err)
+		// Forget the event so Resend's retry gets processed
+		h.db.GetClient().From("email_webhook_events").Delete("minimal", "").Eq("svix_id", r.Header.Get("svix-id")).Execute()
+		http.Error(w, "Failed to process event", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// updateDelivery stamps the newsletter delivery sent as emailID, if it was one, and
+// refreshes its campaign's delivery counts
+func (h *EmailWebhookHandler) updateDelivery(emailID string, update map[string]any) error {
+	if emailID == "" {
+		return nil
+	}
+	update["updated_at"] = time.Now().Format(time.RFC3339)
+
+	bytes, _, err := h.db.GetClient().From("newsletter_deliveries").
+		Update(update, "representation", "").
+		Eq("provider_message_id", emailID).
+		Execute()
+	if err != nil {
+		return err
+	}
+	var deliveries []newsletterDelivery
+	if err := json.Unmarshal(bytes, &deliveries); err != nil {
+		return err
+	}
+	if len(deliveries) == 0 {
+		// Not a newsletter: a welcome, order or notification email
+		return nil
+	}
+	return h.refreshCampaignCounts(deliveries[0].NewsletterID)
+}
+
+// refreshCampaignCounts recounts a campaign's delivered, bounced and complained recipients
+func (h *EmailWebhookHandler) refreshCampaignCounts(newsletterID string) error {
+	client := h.db.GetClient()
+	columns := map[string]string{
+		"delivered_count": "delivered_at",
+		"bounce_count":    "bounced_at",
+		"complaint_count": "complained_at",
+	}
+
+	update := map[string]any{"updated_at": time.Now().Format(time.RFC3339)}
+	for counter, column := range columns {
+		_, count, err := client.From("newsletter_deliveries").
+			Select("id", "exact", true).
+			Eq("newsletter_id", newsletterID).
+			Not(column, "is", "null").
+			Execute()
+		if err != nil {
+			return err
+		}
+		update[counter] = count
+	}
+
+	_, _, err := client.From("newsletters").Update(update, "minimal", "").Eq("id", newsletterID).Execute()
+	return err
+}
+
+// suppressSubscribers moves subscribed addresses to status, which keeps them out of
+// every later campaign
+func (h *EmailWebhookHandler) suppressSubscribers(emails []string, status, reason string) error {
+	for _, email := range emails {
+		// Subscribers are stored lowercased (see add_newsletter_email_lowercase.sql); the
+		// provider echoes the address as sent
+		email = strings.ToLower(strings.TrimSpace(email))
+		bytes, _, err := h.db.GetClient().From("newsletter_subscribers").
+			Update(map[string]any{
+				"status":          status,
+				"status_reason":   reason,
+				"unsubscribed_at": time.Now().Format(time.RFC3339),
+			}, "representation", "").
+			Eq("email", email).
+			Eq("status", "subscribed").
+			Execute()
+		if err != nil {
+			return err
+		}
+		var updated []models.NewsletterSubscriber
+		if json.Unmarshal(bytes, &updated) == nil && len(updated) > 0 {
+			log.Printf("[Email] ⚠️  Subscriber %s is now %s (%s)", email, status, reason)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	"blog-backend/services"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gosimple/slug"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// feedSize is how many entries a feed carries
+const feedSize = 20
+
+// feedSiteName is the title feeds are published under
+const feedSiteName = "Betadomot"
+
+// FeedHandler serves RSS 2.0 and Atom feeds of posts and guides
+type FeedHandler struct {
+	db         *services.DatabaseService
+	websiteURL string
+	backendURL string
+}
+
+// NewFeedHandler creates a new feed handler
+func NewFeedHandler(db *services.DatabaseService, websiteURL, backendURL string) *FeedHandler {
+	return &FeedHandler{
+		db:         db,
+		websiteURL: strings.TrimSuffix(websiteURL, "/"),
+		backendURL: strings.TrimSuffix(backendURL, "/"),
+	}
+}
+
+// feedEntry is a post or guide as it appears in a feed
+type feedEntry struct {
+	Slug          string `json:"slug"`
+	Title         string `json:"title"`
+	Excerpt       string `json:"excerpt"`
+	Description   string `json:"description"` // Guides call their excerpt a description
+	Content       string `json:"content"`
+	Category      string `json:"category"`
+	FeaturedImage string `json:"featured_image"`
+	PublishedAt   string `json:"published_at"`
+	UpdatedAt     string `json:"updated_at"`
+
+	url       string
+	published time.Time
+	updated   time.Time
+}
+
+// feed is a feed before it is written out as RSS or Atom
+type feed struct {
+	Title       string
+	Description string
+	Link        string // Page the feed mirrors
+	SelfURL     string
+	Entries     []feedEntry
+	FullContent bool
+}
+
+// GetPostsFeed handles GET /feeds/posts.xml and /feeds/posts.atom
+//
+// All feeds take ?format=rss|atom to override the extension and ?content=excerpt to
+// leave out the full article body.
+func (h *FeedHandler) GetPostsFeed(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.loadFeedEntries("posts", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.serveFeed(w, r, &feed{
+		Title:       feedSiteName + " - Blog",
+		Description: "The latest posts from " + feedSiteName,
+		Link:        h.websiteURL + "/blog",
+		Entries:     entries,
+	})
+}
+
+// GetGuidesFeed handles GET /feeds/guides.xml and /feeds/guides.atom
+func (h *FeedHandler) GetGuidesFeed(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.loadFeedEntries("guides", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.serveFeed(w, r, &feed{
+		Title:       feedSiteName + " - Guides",
+		Description: "The latest guides from " + feedSiteName,
+		Link:        h.websiteURL + "/guides",
+		Entries:     entries,
+	})
+}
+
+// GetCategoryFeed handles GET /feeds/category/{slug}.xml and /feeds/category/{slug}.atom
+//
+// Posts and guides share free-text categories; the slug matches the slugified name.
+func (h *FeedHandler) GetCategoryFeed(w http.ResponseWriter, r *http.Request) {
+	categorySlug := chi.URLParam(r, "slug")
+
+	posts, err := h.loadFeedEntries("posts", categorySlug)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	guides, err := h.loadFeedEntries("guides", categorySlug)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entries := mergeFeedEntries(posts, guides)
+	if len(entries) == 0 {
+		http.Error(w, "category not found", http.StatusNotFound)
+		return
+	}
+
+	category := entries[0].Category
+	h.serveFeed(w, r, &feed{
+		Title:       fmt.Sprintf("%s - %s", feedSiteName, category),
+		Description: fmt.Sprintf("Posts and guides about %s from %s", category, feedSiteName),
+		Link:        h.websiteURL + "/category/" + categorySlug,
+		Entries:     entries,
+	})
+}
+
+// loadFeedEntries returns the latest published entries of a table, optionally only
+// those whose category slugifies to categorySlug
+func (h *FeedHandler) loadFeedEntries(table, categorySlug string) ([]feedEntry, error) {
+	columns := "slug,title,excerpt,content,category,featured_image,published_at"
+	urlPrefix := h.websiteURL + "/blog/"
+	if table == "guides" {
+		columns = "slug,title,description,content,category,featured_image,published_at,updated_at"
+		urlPrefix = h.websiteURL + "/guides/"
+	}
+
+	// Category feeds filter in Go, so they look further back to still fill a feed
+	limit := feedSize
+	if categorySlug != "" {
+		limit = feedSize * 10
+	}
+
+	bytes, _, err := h.db.GetClient().From(table).
+		Select(columns, "exact", false).
+		Lte("published_at", time.Now().UTC().Format(time.RFC3339)).
+		Order("published_at", &postgrest.OrderOpts{Ascending: false}).
+		Limit(limit, "").
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+	var rows []feedEntry
+	if err := json.Unmarshal(bytes, &rows); err != nil {
+		return nil, err
+	}
+
+	entries := make([]feedEntry, 0, len(rows))
+	for _, entry := range rows {
+		if categorySlug != "" && slug.Make(entry.Category) != categorySlug {
+			continue
+		}
+		if entry.Excerpt == "" {
+			entry.Excerpt = entry.Description
+		}
+		entry.url = urlPrefix + entry.Slug
+		entry.published = parseFeedTime(entry.PublishedAt)
+		entry.updated = parseFeedTime(entry.UpdatedAt)
+		if entry.updated.Before(entry.published) {
+			entry.updated = entry.published
+		}
+		entries = append(entries, entry)
+		if len(entries) == feedSize {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// mergeFeedEntries merges two newest-first lists, keeping the newest feedSize entries
+func mergeFeedEntries(a, b []feedEntry) []feedEntry {
+	merged := make([]feedEntry, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		if len(b) == 0 || (len(a) > 0 && !a[0].published.Before(b[0].published)) {
+			merged, a = append(merged, a[0]), a[1:]
+		} else {
+			merged, b = append(merged, b[0]), b[1:]
+		}
+	}
+	if len(merged) > feedSize {
+		merged = merged[:feedSize]
+	}
+	return merged
+}
+
+func parseFeedTime(value string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// serveFeed renders the feed in the requested format and serves it with ETag and
+// Last-Modified so feed readers can poll with conditional requests
+func (h *FeedHandler) serveFeed(w http.ResponseWriter, r *http.Request, f *feed) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "rss"
+		if strings.HasSuffix(r.URL.Path, ".atom") {
+			format = "atom"
+		}
+	}
+	f.FullContent = r.URL.Query().Get("content") != "excerpt"
+	f.SelfURL = h.backendURL + r.URL.RequestURI()
+
+	var lastModified time.Time
+	for _, entry := range f.Entries {
+		if entry.updated.After(lastModified) {
+			lastModified = entry.updated
+		}
+	}
+
+	var body []byte
+	var err error
+	switch format {
+	case "rss":
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		body, err = renderRSS(f, lastModified)
+	case "atom":
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		body, err = renderAtom(f, lastModified)
+	default:
+		http.Error(w, "format must be rss or atom", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=900")
+
+	// ServeContent answers If-None-Match and If-Modified-Since with 304
+	http.ServeContent(w, r, "", lastModified, bytes.NewReader(body))
+}
+
+type rssDocument struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	ContentNS string     `xml:"xmlns:content,attr"`
+	AtomNS    string     `xml:"xmlns:atom,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	SelfLink      atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate,omitempty"`
+	Category    string        `xml:"category,omitempty"`
+	Description string        `xml:"description"`
+	Content     *cdata        `xml:"content:encoded,omitempty"`
+	Enclosure   *rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type cdata struct {
+	Value string `xml:",cdata"`
+}
+
+func renderRSS(f *feed, lastModified time.Time) ([]byte, error) {
+	doc := rssDocument{
+		Version:   "2.0",
+		ContentNS: "http://purl.org/rss/1.0/modules/content/",
+		AtomNS:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        f.Link,
+			Description: f.Description,
+			Language:    "en",
+			SelfLink:    atomLink{Href: f.SelfURL, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	if !lastModified.IsZero() {
+		doc.Channel.LastBuildDate = lastModified.Format(time.RFC1123Z)
+	}
+
+	for _, entry := range f.Entries {
+		item := rssItem{
+			Title:       entry.Title,
+			Link:        entry.url,
+			GUID:        rssGUID{IsPermaLink: "true", Value: entry.url},
+			Category:    entry.Category,
+			Description: entry.Excerpt,
+		}
+		if !entry.published.IsZero() {
+			item.PubDate = entry.published.Format(time.RFC1123Z)
+		}
+		if f.FullContent && entry.Content != "" {
+			item.Content = &cdata{Value: services.RenderMarkdown(entry.Content)}
+		}
+		if entry.FeaturedImage != "" {
+			item.Enclosure = &rssEnclosure{URL: entry.FeaturedImage, Length: "0", Type: feedImageType(entry.FeaturedImage)}
+		}
+		doc.Channel.Items = append(doc.Channel.Items, item)
+	}
+
+	return marshalFeed(doc)
+}
+
+type atomDocument struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string       `xml:"title"`
+	ID        string       `xml:"id"`
+	Published string       `xml:"published,omitempty"`
+	Updated   string       `xml:"updated"`
+	Links     []atomLink   `xml:"link"`
+	Category  *atomTerm    `xml:"category"`
+	Summary   string       `xml:"summary,omitempty"`
+	Content   *atomContent `xml:"content"`
+}
+
+type atomTerm struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func renderAtom(f *feed, lastModified time.Time) ([]byte, error) {
+	if lastModified.IsZero() {
+		lastModified = time.Now().UTC()
+	}
+	doc := atomDocument{
+		Title:    f.Title,
+		Subtitle: f.Description,
+		ID:       f.Link,
+		Updated:  lastModified.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.Link, Rel: "alternate", Type: "text/html"},
+			{Href: f.SelfURL, Rel: "self", Type: "application/atom+xml"},
+		},
+	}
+
+	for _, entry := range f.Entries {
+		item := atomEntry{
+			Title:   entry.Title,
+			ID:      entry.url,
+			Updated: entry.updated.Format(time.RFC3339),
+			Links:   []atomLink{{Href: entry.url, Rel: "alternate", Type: "text/html"}},
+			Summary: entry.Excerpt,
+		}
+		if !entry.published.IsZero() {
+			item.Published = entry.published.Format(time.RFC3339)
+		}
+		if entry.Category != "" {
+			item.Category = &atomTerm{Term: entry.Category}
+		}
+		if f.FullContent && entry.Content != "" {
+			item.Content = &atomContent{Type: "html", Value: services.RenderMarkdown(entry.Content)}
+		}
+		if entry.FeaturedImage != "" {
+			item.Links = append(item.Links, atomLink{Href: entry.FeaturedImage, Rel: "enclosure", Type: feedImageType(entry.FeaturedImage)})
+		}
+		doc.Entries = append(doc.Entries, item)
+	}
+
+	return marshalFeed(doc)
+}
+
+func marshalFeed(doc any) ([]byte, error) {
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// feedImageType guesses an image's MIME type from its URL, defaulting to JPEG
+func feedImageType(imageURL string) string {
+	if i := strings.IndexAny(imageURL, "?#"); i >= 0 {
+		imageURL = imageURL[:i]
+	}
+	if t := mime.TypeByExtension(strings.ToLower(path.Ext(imageURL))); strings.HasPrefix(t, "image/") {
+		return t
+	}
+	return "image/jpeg"
+}
@@ -15,12 +15,13 @@ import (
 
 // GuideHandler handles guide-related HTTP requests
 type GuideHandler struct {
-	db *services.DatabaseService
+	db  *services.DatabaseService
+	seo *SEOHandler
 }
 
 // NewGuideHandler creates a new guide handler
-func NewGuideHandler(db *services.DatabaseService) *GuideHandler {
-	return &GuideHandler{db: db}
+func NewGuideHandler(db *services.DatabaseService, seo *SEOHandler) *GuideHandler {
+	return &GuideHandler{db: db, seo: seo}
 }
 
 // GetGuides handles GET /guides
@@ -137,7 +138,7 @@ func (h *GuideHandler) CreateGuide(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"slug": uniqueSlug})
 }
 
-// GetGuide handles GET /guides/{slug}
+// GetGuide handles GET /guides/{slug}?seo=true
 func (h *GuideHandler) GetGuide(w http.ResponseWriter, r *http.Request) {
 	slug := chi.URLParam(r, "slug")
 	client := h.db.GetClient()
@@ -154,13 +155,11 @@ func (h *GuideHandler) GetGuide(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Increment view count asynchronously
-	if v, ok := guide["views"].(float64); ok {
-		newVal := int(v) + 1
-		go func() {
-			_, _, _ = client.From("guides").Update(map[string]any{"views": newVal}, "minimal", "").Eq("slug", slug).Execute()
-		}()
-		guide["views"] = newVal
+	// Increment view count atomically
+	recordContentView(h.db, "guide", slug, guide)
+
+	if wantsSEO(r) {
+		guide["seo"] = h.seo.ArticleSEO("guide", guide)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,522 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"blog-backend/services"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/supabase-community/postgrest-go"
+)
+
+// DefaultReorderThreshold applies to products and variants without their own threshold
+const DefaultReorderThreshold = 5
+
+// reservationWindow is how long an unpaid order counts as holding its items
+const reservationWindow = 24 * time.Hour
+
+// InventoryHandler handles stock levels, the inventory ledger and low-stock alerts
+type InventoryHandler struct {
+	db          *services.DatabaseService
+	email       *services.EmailService
+	backInStock *BackInStockHandler
+}
+
+// NewInventoryHandler creates a new inventory handler
+func NewInventoryHandler(db *services.DatabaseService, email *services.EmailService, backInStock *BackInStockHandler) *InventoryHandler {
+	return &InventoryHandler{db: db, email: email, backInStock: backInStock}
+}
+
+// GetInventory handles GET /admin/inventory?days=30&low_stock=true
+func (h *InventoryHandler) GetInventory(w http.ResponseWriter, r *http.Request) {
+	days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+	if days <= 0 {
+		days = 30
+	}
+	lowStockOnly := r.URL.Query().Get("low_stock") == "true"
+
+	items, err := loadInventory(h.db, days)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if lowStockOnly {
+		filtered := []models.InventoryItem{}
+		for _, item := range items {
+			if item.LowStock {
+				filtered = append(filtered, item)
+			}
+		}
+		items = filtered
+	}
+
+	lowStockCount := 0
+	for _, item := range items {
+		if item.LowStock {
+			lowStockCount++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"window_days":     days,
+		"low_stock_count": lowStockCount,
+		"items":           items,
+	})
+}
+
+// GetLedger handles GET /admin/inventory/ledger?product_id=&variant_id=&limit=
+func (h *InventoryHandler) GetLedger(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+
+	query := h.db.GetClient().From("inventory_ledger").Select("*", "exact", false)
+	if productID := r.URL.Query().Get("product_id"); productID != "" {
+		query = query.Eq("product_id", productID)
+	}
+	if variantID := r.URL.Query().Get("variant_id"); variantID != "" {
+		query = query.Eq("variant_id", variantID)
+	}
+
+	jsonStr, _, err := query.Order("created_at", nil).Limit(limit, "").ExecuteString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(jsonStr))
+}
+
+// AdjustStock handles POST /admin/inventory/adjustments
+func (h *InventoryHandler) AdjustStock(w http.ResponseWriter, r *http.Request) {
+	var req models.StockAdjustment
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.ProductID == "" || req.Delta == 0 {
+		http.Error(w, "product_id and a non-zero delta are required", http.StatusBadRequest)
+		return
+	}
+
+	// Sales are only recorded by checkout
+	switch req.Reason {
+	case models.StockReasonRestock, models.StockReasonManualCorrection, models.StockReasonRefund:
+	default:
+		http.Error(w, "reason must be restock, manual_correction or refund", http.StatusBadRequest)
+		return
+	}
+
+	before, after, err := applyStockAdjustment(h.db, req)
+	if err == sql.ErrNoRows {
+		http.Error(w, "product or variant not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if before <= 0 && after > 0 {
+		h.backInStock.NotifyRestocked(req.ProductID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":       "adjusted",
+		"stock_before": before,
+		"stock_after":  after,
+	})
+}
+
+// StartLowStockDigest emails the shop owner the list of low-stock items once a day at the given hour
+func (h *InventoryHandler) StartLowStockDigest(hour int) {
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			time.Sleep(time.Until(next))
+
+			if err := h.sendLowStockDigest(); err != nil {
+				log.Printf("[Inventory] Failed to send low-stock digest: %v", err)
+			}
+		}
+	}()
+	log.Printf("📦 Low-stock digest scheduled daily at %02d:00", hour)
+}
+
+func (h *InventoryHandler) sendLowStockDigest() error {
+	items, err := loadInventory(h.db, 30)
+	if err != nil {
+		return err
+	}
+
+	var lowStock []services.LowStockItem
+	for _, item := range items {
+		if item.LowStock {
+			lowStock = append(lowStock, services.LowStockItem{
+				Name:      item.ProductName,
+				Variant:   item.VariantName,
+				SKU:       item.SKU,
+				Stock:     item.Stock,
+				Threshold: item.ReorderThreshold,
+			})
+		}
+	}
+
+	if len(lowStock) == 0 {
+		log.Println("[Inventory] No low-stock items, skipping digest")
+		return nil
+	}
+	return h.email.SendLowStockDigest(lowStock)
+}
+
+// inventoryKey identifies a product (empty variant) or a variant in the inventory maps
+func inventoryKey(productID, variantID string) string {
+	return productID + "/" + variantID
+}
+
+// loadInventory builds the inventory dashboard rows, with sell-through over the last `days` days
+func loadInventory(db *services.DatabaseService, days int) ([]models.InventoryItem, error) {
+	client := db.GetClient()
+
+	products, err := selectAll[models.Product](func() *postgrest.FilterBuilder {
+		return client.From("products").
+			Select("id,slug,name,sku,stock,reorder_threshold", "exact", false).
+			Order("name", &postgrest.OrderOpts{Ascending: true}).
+			Order("id", &postgrest.OrderOpts{Ascending: true})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	productIDs := make([]string, len(products))
+	for i, p := range products {
+		productIDs[i] = p.ID
+	}
+	variants, err := loadProductVariants(db, productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	reserved, err := loadReservedQuantities(db)
+	if err != nil {
+		return nil, err
+	}
+	sold, err := loadUnitsSold(db, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		return nil, err
+	}
+
+	items := []models.InventoryItem{}
+	add := func(item models.InventoryItem, threshold *int) {
+		key := inventoryKey(item.ProductID, item.VariantID)
+		item.Reserved = reserved[key]
+		item.Available = item.Stock - item.Reserved
+		if item.Available < 0 {
+			item.Available = 0
+		}
+		item.ReorderThreshold = reorderThreshold(threshold)
+		item.LowStock = item.Stock <= item.ReorderThreshold
+		item.UnitsSold = sold[key]
+		if total := item.UnitsSold + item.Stock; total > 0 && item.UnitsSold > 0 {
+			item.SellThroughRate = float64(item.UnitsSold) / float64(total)
+		}
+		items = append(items, item)
+	}
+
+	for _, p := range products {
+		// Products with variants are stocked per variant
+		if len(variants[p.ID]) == 0 {
+			add(models.InventoryItem{
+				ProductID:   p.ID,
+				ProductSlug: p.Slug,
+				ProductName: p.Name,
+				SKU:         p.SKU,
+				Stock:       p.Stock,
+			}, p.ReorderThreshold)
+			continue
+		}
+		for _, v := range variants[p.ID] {
+			add(models.InventoryItem{
+				ProductID:   p.ID,
+				ProductSlug: p.Slug,
+				ProductName: p.Name,
+				VariantID:   v.ID,
+				VariantName: v.Name,
+				SKU:         v.SKU,
+				Stock:       v.Stock,
+			}, v.ReorderThreshold)
+		}
+	}
+
+	// Lowest stock relative to threshold first
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Stock-items[i].ReorderThreshold < items[j].Stock-items[j].ReorderThreshold
+	})
+	return items, nil
+}
+
+// loadReservedQuantities sums the items of recent unpaid orders per product/variant
+func loadReservedQuantities(db *services.DatabaseService) (map[string]int, error) {
+	since := time.Now().Add(-reservationWindow).Format(time.RFC3339)
+	orders, err := selectAll[struct {
+		Items []models.OrderItem `json:"items"`
+	}](func() *postgrest.FilterBuilder {
+		return db.GetClient().From("orders").
+			Select("items", "exact", false).
+			Eq("payment_status", "pending").
+			Gte("created_at", since).
+			Order("id", &postgrest.OrderOpts{Ascending: true})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reserved := make(map[string]int)
+	for _, order := range orders {
+		for _, item := range order.Items {
+			reserved[inventoryKey(item.ProductID, item.VariantID)] += item.Quantity
+		}
+	}
+	return reserved, nil
+}
+
+// loadUnitsSold sums sales net of refunds per product/variant since the given time
+func loadUnitsSold(db *services.DatabaseService, since time.Time) (map[string]int, error) {
+	entries, err := selectAll[models.InventoryLedgerEntry](func() *postgrest.FilterBuilder {
+		return db.GetClient().From("inventory_ledger").
+			Select("product_id,variant_id,delta,reason", "exact", false).
+			In("reason", []string{models.StockReasonSale, models.StockReasonRefund}).
+			Gte("created_at", since.Format(time.RFC3339)).
+			Order("id", &postgrest.OrderOpts{Ascending: true})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sold := make(map[string]int)
+	for _, entry := range entries {
+		variantID := ""
+		if entry.VariantID != nil {
+			variantID = *entry.VariantID
+		}
+		// Sales are negative deltas and refunds positive ones
+		sold[inventoryKey(entry.ProductID, variantID)] -= entry.Delta
+	}
+	return sold, nil
+}
+
+func reorderThreshold(threshold *int) int {
+	if threshold != nil {
+		return *threshold
+	}
+	return DefaultReorderThreshold
+}
+
+// applyStockAdjustment moves the stock of a product, or of a variant when VariantID is
+// set, and records the movement in the inventory ledger. Stock never goes below zero;
+// the ledger stores the delta actually applied. Returns sql.ErrNoRows when the product
+// or variant does not exist, or the variant belongs to another product.
+func applyStockAdjustment(db *services.DatabaseService, adj models.StockAdjustment) (int, int, error) {
+	return moveStock(db, adj, nil)
+}
+
+// maxStockRetries bounds how often the PostgREST fallback retries a stock write that
+// lost a race with another one
+const maxStockRetries = 5
+
+// moveStock applies adj, or sets the stock to level when it isn't nil. The new stock is
+// computed from the stock at the moment of the write, so concurrent sales and
+// adjustments are never lost from the ledger. Setting the stock to its current level
+// records nothing.
+func moveStock(db *services.DatabaseService, adj models.StockAdjustment, level *int) (int, int, error) {
+	table, id, owner := "products", adj.ProductID, "id"
+	if adj.VariantID != "" {
+		table, id, owner = "product_variants", adj.VariantID, "product_id"
+	}
+
+	if sqlDB := db.GetSQLDB(); sqlDB != nil {
+		return moveStockSQL(sqlDB, table, id, owner, adj, level)
+	}
+
+	// Without a direct connection, write only if the stock is still what was read and
+	// read again otherwise
+	client := db.GetClient()
+	for attempt := 0; ; attempt++ {
+		bytes, _, err := client.From(table).Select("stock", "exact", false).
+			Eq("id", id).
+			Eq(owner, adj.ProductID).
+			Execute()
+		if err != nil {
+			return 0, 0, err
+		}
+		var rows []struct {
+			Stock int `json:"stock"`
+		}
+		if err := json.Unmarshal(bytes, &rows); err != nil {
+			return 0, 0, err
+		}
+		if len(rows) == 0 {
+			return 0, 0, sql.ErrNoRows
+		}
+
+		before := rows[0].Stock
+		after := before + adj.Delta
+		if level != nil {
+			after = *level
+		}
+		if after < 0 {
+			after = 0
+		}
+		if level != nil && after == before {
+			return before, after, nil
+		}
+
+		bytes, _, err = client.From(table).
+			Update(map[string]interface{}{"stock": after, "updated_at": time.Now().Format(time.RFC3339)}, "representation", "").
+			Eq("id", id).
+			Eq("stock", strconv.Itoa(before)).
+			Execute()
+		if err != nil {
+			return 0, 0, err
+		}
+		if err := json.Unmarshal(bytes, &rows); err != nil {
+			return 0, 0, err
+		}
+		if len(rows) == 0 {
+			if attempt < maxStockRetries {
+				continue
+			}
+			return 0, 0, fmt.Errorf("stock of %s kept changing, try again", id)
+		}
+
+		entry := map[string]interface{}{
+			"product_id":   adj.ProductID,
+			"delta":        after - before,
+			"reason":       adj.Reason,
+			"note":         adj.Note,
+			"stock_before": before,
+			"stock_after":  after,
+		}
+		if adj.VariantID != "" {
+			entry["variant_id"] = adj.VariantID
+		}
+		if adj.OrderID != "" {
+			entry["order_id"] = adj.OrderID
+		}
+		if _, _, err := client.From("inventory_ledger").Insert(entry, false, "", "minimal", "").Execute(); err != nil {
+			return before, after, fmt.Errorf("stock updated but ledger entry failed: %w", err)
+		}
+		return before, after, nil
+	}
+}
+
+func moveStockSQL(sqlDB *sql.DB, table, id, owner string, adj models.StockAdjustment, level *int) (int, int, error) {
+	tx, err := sqlDB.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	var target interface{}
+	if level != nil {
+		target = *level
+	}
+
+	// table and owner are constants chosen above, never user input
+	var before, after int
+	err = tx.QueryRow(fmt.Sprintf(`
+		UPDATE %[1]s t SET stock = GREATEST(COALESCE($3::INTEGER, t.stock + $1), 0), updated_at = NOW()
+		FROM (SELECT id, stock FROM %[1]s WHERE id = $2 AND %[2]s = $4 FOR UPDATE) old
+		WHERE t.id = old.id
+		RETURNING old.stock, t.stock`, table, owner), adj.Delta, id, target, adj.ProductID).Scan(&before, &after)
+	if err != nil {
+		return 0, 0, err
+	}
+	if level != nil && after == before {
+		return before, after, nil
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO inventory_ledger (product_id, variant_id, delta, reason, order_id, note, stock_before, stock_after)
+		VALUES ($1, NULLIF($2, '')::UUID, $3, $4, NULLIF($5, '')::UUID, $6, $7, $8)`,
+		adj.ProductID, adj.VariantID, after-before, adj.Reason, adj.OrderID, adj.Note, before, after)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return before, after, nil
+}
+
+// lowStockCrossing returns the alert details when an adjustment took an item from above
+// its reorder threshold to at or below it, and nil otherwise
+func lowStockCrossing(db *services.DatabaseService, adj models.StockAdjustment, before, after int) (*services.LowStockItem, error) {
+	client := db.GetClient()
+
+	productBytes, _, err := client.From("products").
+		Select("name,sku,reorder_threshold", "exact", false).
+		Eq("id", adj.ProductID).
+		Single().
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+	var product models.Product
+	if err := json.Unmarshal(productBytes, &product); err != nil {
+		return nil, err
+	}
+
+	item := &services.LowStockItem{Name: product.Name, SKU: product.SKU, Stock: after}
+	threshold := product.ReorderThreshold
+
+	if adj.VariantID != "" {
+		variants, err := loadVariantsByID(db, []string{adj.VariantID})
+		if err != nil {
+			return nil, err
+		}
+		variant, ok := variants[adj.VariantID]
+		if !ok {
+			return nil, nil
+		}
+		item.Variant = variant.Name
+		item.SKU = variant.SKU
+		threshold = variant.ReorderThreshold
+	}
+
+	item.Threshold = reorderThreshold(threshold)
+	if before > item.Threshold && after <= item.Threshold {
+		return item, nil
+	}
+	return nil, nil
+}
+
+// setStockLevel records the move of a product or variant to the target level as a
+// ledger adjustment, taking the delta from the stock at the moment of the write.
+// Nothing is recorded when the level is unchanged.
+func setStockLevel(db *services.DatabaseService, productID, variantID string, target int, reason, note string) error {
+	_, _, err := moveStock(db, models.StockAdjustment{
+		ProductID: productID,
+		VariantID: variantID,
+		Reason:    reason,
+		Note:      note,
+	}, &target)
+	return err
+}
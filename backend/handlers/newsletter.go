@@ -4,28 +4,91 @@ import (
 	"blog-backend/models"
 	"blog-backend/services"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 )
 
+// newsletterConfirmPurpose scopes the signed tokens in subscription confirmation emails
+const newsletterConfirmPurpose = "newsletter-confirm"
+
 // NewsletterHandler handles newsletter-related HTTP requests
 type NewsletterHandler struct {
-	db    *services.DatabaseService
-	email *services.EmailService
+	db         *services.DatabaseService
+	email      *services.EmailService
+	links      *NewsletterLinks
+	websiteURL string
+
+	confirmWindow time.Duration   // How long a confirmation link stays valid
+	singleOptIn   map[string]bool // Sources subscribed without confirmation
 }
 
-// NewNewsletterHandler creates a new newsletter handler
-func NewNewsletterHandler(db *services.DatabaseService, email *services.EmailService) *NewsletterHandler {
-	return &NewsletterHandler{db: db, email: email}
+// NewNewsletterHandler creates a new newsletter handler. singleOptInSources is a
+// comma-separated list of subscribe sources that skip the confirmation email.
+func NewNewsletterHandler(db *services.DatabaseService, email *services.EmailService, links *NewsletterLinks, websiteURL string, confirmWindow time.Duration, singleOptInSources string) *NewsletterHandler {
+	singleOptIn := make(map[string]bool)
+	for _, source := range strings.Split(singleOptInSources, ",") {
+		if source = strings.TrimSpace(source); source != "" {
+			singleOptIn[source] = true
+		}
+	}
+	if confirmWindow <= 0 {
+		confirmWindow = 48 * time.Hour
+	}
+	return &NewsletterHandler{
+		db:            db,
+		email:         email,
+		links:         links,
+		websiteURL:    websiteURL,
+		confirmWindow: confirmWindow,
+		singleOptIn:   singleOptIn,
+	}
 }
 
 // Subscribe handles POST /newsletter/subscribe
+//
+// Sign-ups are pending until the link in the confirmation email is followed. Signing
+// up again while pending sends a fresh confirmation email.
 func (h *NewsletterHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
 	var req models.NewsletterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if req.Source == "" {
+		req.Source = "website"
+	}
+
+	// The source comes from the caller, so public sign-ups always confirm
+	h.subscribe(w, req, true)
+}
+
+// AddSubscriber handles POST /admin/subscribers
+//
+// Subscribers added by the admin, such as an imported list, skip the confirmation
+// email when their source is configured for single opt-in.
+func (h *NewsletterHandler) AddSubscriber(w http.ResponseWriter, r *http.Request) {
+	var req models.NewsletterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Source == "" {
+		req.Source = "admin"
+	}
+
+	h.subscribe(w, req, !h.singleOptIn[req.Source])
+}
+
+// subscribe adds or reactivates a subscriber, pending confirmation when confirm is set
+func (h *NewsletterHandler) subscribe(w http.ResponseWriter, req models.NewsletterRequest, confirm bool) {
+	// Addresses are stored lowercased so webhooks and imports find them whatever the case
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
 
 	// Basic email validation
 	if req.Email == "" || !strings.Contains(req.Email, "@") {
@@ -33,24 +96,23 @@ func (h *NewsletterHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Source == "" {
-		req.Source = "website"
-	}
-
 	client := h.db.GetClient()
 
-	// Check if already subscribed
-	_, count, err := client.From("newsletter_subscribers").
-		Select("email", "exact", false).
+	bytes, _, err := client.From("newsletter_subscribers").
+		Select("email,status,confirmed_at", "exact", false).
 		Eq("email", req.Email).
-		Eq("status", "subscribed").
 		Execute()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	var existing []models.NewsletterSubscriber
+	if err := json.Unmarshal(bytes, &existing); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	if count > 0 {
+	if len(existing) > 0 && existing[0].Status == "subscribed" {
 		// Already subscribed
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{
@@ -60,51 +122,58 @@ func (h *NewsletterHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if previously unsubscribed - reactivate instead of insert
-	_, count, err = client.From("newsletter_subscribers").
-		Select("*", "exact", false).
-		Eq("email", req.Email).
-		Execute()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if len(existing) > 0 && (existing[0].Status == "bounced" || existing[0].Status == "complained") {
+		// Mail to this address bounced or was reported as spam; don't send to it again
+		http.Error(w, "This address can't receive our newsletter", http.StatusUnprocessableEntity)
 		return
 	}
 
-	isNewSubscriber := count == 0
+	now := time.Now().Format(time.RFC3339)
+	row := map[string]any{
+		"status":           "subscribed",
+		"subscribed_at":    now,
+		"unsubscribed_at":  nil,
+		"source":           req.Source,
+		"tracking_opt_out": req.NoTracking,
+	}
+	if confirm {
+		row["status"] = "pending"
+		row["confirmation_sent_at"] = now
+	}
 
-	if count > 0 {
+	if len(existing) > 0 {
 		// Reactivate existing subscriber
-		_, _, err := client.From("newsletter_subscribers").
-			Update(map[string]any{
-				"status":          "subscribed",
-				"subscribed_at":   "now()",
-				"unsubscribed_at": nil,
-				"source":          req.Source,
-			}, "minimal", "").
-			Eq("email", req.Email).
-			Execute()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+		_, _, err = client.From("newsletter_subscribers").Update(row, "minimal", "").Eq("email", req.Email).Execute()
 	} else {
 		// New subscriber
-		subscriber := map[string]any{
-			"email":  req.Email,
-			"source": req.Source,
-			"status": "subscribed",
-		}
+		row["email"] = req.Email
+		_, _, err = client.From("newsletter_subscribers").Insert(row, false, "", "minimal", "").Execute()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-		if _, _, err := client.From("newsletter_subscribers").Insert(subscriber, false, "", "minimal", "").Execute(); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+	if confirm {
+		token := h.links.tokens.Sign(newsletterConfirmPurpose, req.Email, h.confirmWindow)
+		confirmURL := h.links.backendURL + "/newsletter/confirm?token=" + url.QueryEscape(token)
+		if err := h.email.SendSubscriptionConfirmation(req.Email, confirmURL, time.Now().Add(h.confirmWindow)); err != nil {
+			http.Error(w, "Failed to send the confirmation email", http.StatusBadGateway)
 			return
 		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":  "pending",
+			"message": "Almost there! Check your email to confirm your subscription.",
+		})
+		return
 	}
 
 	// Send welcome email for new subscribers only
-	if isNewSubscriber {
+	if len(existing) == 0 {
 		go func() {
-			if err := h.email.SendWelcomeEmail(req.Email); err != nil {
+			if err := h.email.SendWelcomeEmail(req.Email, h.links.For(req.Email)); err != nil {
 				// Error is already logged in the email service
 			}
 		}()
@@ -117,37 +186,229 @@ func (h *NewsletterHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Unsubscribe handles POST /newsletter/unsubscribe
+// Confirm handles GET and POST /newsletter/confirm?token=
+//
+// GET shows a button that POSTs back, so a link scanner opening the confirmation email
+// can't confirm a sign-up on the owner's behalf. Requests asking for JSON confirm
+// straight away.
+func (h *NewsletterHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	email, err := h.links.tokens.Verify(newsletterConfirmPurpose, token)
+	if errors.Is(err, services.ErrExpiredToken) {
+		http.Error(w, "This confirmation link has expired. Please sign up again.", http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, "This confirmation link is invalid", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet && !wantsJSON(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Confirm your subscription</title></head>
+<body style="font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; background: #fafafa; color: #000000;">
+	<form method="post" action="?token=%s" style="max-width: 480px; margin: 80px auto; background: #ffffff; padding: 40px; text-align: center;">
+		<h1 style="font-weight: 400; font-size: 22px;">One last step</h1>
+		<p style="font-weight: 300; color: #666666;">Confirm that %s should get the Betadomot newsletter.</p>
+		<button type="submit" style="background: #000000; color: #ffffff; border: 0; padding: 12px 28px; font-size: 14px; cursor: pointer;">Confirm my subscription</button>
+	</form>
+</body>
+</html>`, html.EscapeString(url.QueryEscape(token)), html.EscapeString(email))
+		return
+	}
+
+	client := h.db.GetClient()
+	bytes, _, err := client.From("newsletter_subscribers").
+		Select("email,status,confirmed_at", "exact", false).
+		Eq("email", email).
+		Execute()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var rows []models.NewsletterSubscriber
+	if err := json.Unmarshal(bytes, &rows); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(rows) == 0 {
+		// Purged after the link expired, or removed by an admin
+		http.Error(w, "This sign-up no longer exists. Please sign up again.", http.StatusGone)
+		return
+	}
+
+	if rows[0].Status == "pending" {
+		now := time.Now().Format(time.RFC3339)
+		bytes, _, err := client.From("newsletter_subscribers").
+			Update(map[string]any{"status": "subscribed", "subscribed_at": now, "confirmed_at": now}, "representation", "").
+			Eq("email", email).
+			Eq("status", "pending").
+			Execute()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var confirmed []models.NewsletterSubscriber
+		if json.Unmarshal(bytes, &confirmed) == nil && len(confirmed) > 0 && rows[0].ConfirmedAt == nil {
+			// Only the first confirmation gets a welcome; resubscribers already had one
+			go h.email.SendWelcomeEmail(email, h.links.For(email))
+		}
+	} else if rows[0].Status != "subscribed" {
+		http.Error(w, "This sign-up was cancelled. Please sign up again.", http.StatusGone)
+		return
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":  "subscribed",
+			"message": "Your subscription is confirmed. Welcome to Betadomot!",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Subscription confirmed</title></head>
+<body style="font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; background: #fafafa; color: #000000;">
+	<div style="max-width: 480px; margin: 80px auto; background: #ffffff; padding: 40px; text-align: center;">
+		<h1 style="font-weight: 400; font-size: 22px;">You're subscribed</h1>
+		<p style="font-weight: 300; color: #666666;">Welcome to Betadomot! <a href="%s" style="color: #000000;">Pick the topics you care about</a>.</p>
+		<a href="%s" style="color: #000000;">Back to Betadomot</a>
+	</div>
+</body>
+</html>`, html.EscapeString(h.links.For(email).PreferencesURL), h.websiteURL)
+}
+
+// StartPendingPurge removes sign-ups whose confirmation link has expired, checking
+// every interval. Returning subscribers who never reconfirmed go back to unsubscribed.
+func (h *NewsletterHandler) StartPendingPurge(interval time.Duration) {
+	go func() {
+		for {
+			if err := h.purgePending(); err != nil {
+				log.Printf("[Newsletter] Failed to purge unconfirmed sign-ups: %v", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+	log.Printf("📭 Unconfirmed newsletter sign-ups purged after %s", h.confirmWindow)
+}
+
+func (h *NewsletterHandler) purgePending() error {
+	client := h.db.GetClient()
+	cutoff := time.Now().Add(-h.confirmWindow).UTC().Format(time.RFC3339)
+
+	bytes, _, err := client.From("newsletter_subscribers").
+		Delete("representation", "").
+		Eq("status", "pending").
+		Is("confirmed_at", "null").
+		Lt("confirmation_sent_at", cutoff).
+		Execute()
+	if err != nil {
+		return err
+	}
+	var purged []models.NewsletterSubscriber
+	if json.Unmarshal(bytes, &purged) == nil && len(purged) > 0 {
+		log.Printf("[Newsletter] Purged %d unconfirmed sign-ups", len(purged))
+	}
+
+	_, _, err = client.From("newsletter_subscribers").
+		Update(map[string]any{"status": "unsubscribed", "unsubscribed_at": time.Now().Format(time.RFC3339)}, "minimal", "").
+		Eq("status", "pending").
+		Lt("confirmation_sent_at", cutoff).
+		Execute()
+	return err
+}
+
+// Unsubscribe handles GET and POST /newsletter/unsubscribe?token=
+//
+// The token comes from the signed link in every newsletter email, so nobody can
+// unsubscribe someone else. GET only shows a confirmation page, because link scanners
+// follow links in emails. POST unsubscribes: from that page, as the RFC 8058 one-click
+// request mail clients send from the List-Unsubscribe header, or as JSON {"token": ...}.
 func (h *NewsletterHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
-	var req models.NewsletterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	token := r.URL.Query().Get("token")
+	if token == "" && r.Method == http.MethodPost && wantsJSON(r) {
+		var req struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		token = req.Token
+	}
+	if token == "" {
+		http.Error(w, "use the unsubscribe link from one of our emails", http.StatusBadRequest)
+		return
+	}
+
+	email, err := h.links.tokens.Verify(newsletterUnsubscribePurpose, token)
+	if err != nil {
+		http.Error(w, "This unsubscribe link is invalid", http.StatusBadRequest)
 		return
 	}
+	links := h.links.For(email)
 
-	if req.Email == "" {
-		http.Error(w, "email is required", http.StatusBadRequest)
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Unsubscribe</title></head>
+<body style="font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; background: #fafafa; color: #000000;">
+	<form method="post" action="%s" style="max-width: 480px; margin: 80px auto; background: #ffffff; padding: 40px; text-align: center;">
+		<h1 style="font-weight: 400; font-size: 22px;">Unsubscribe from the newsletter?</h1>
+		<p style="font-weight: 300; color: #666666;">%s won't get any more newsletters from Betadomot.</p>
+		<input type="hidden" name="confirm" value="true">
+		<button type="submit" style="background: #000000; color: #ffffff; border: 0; padding: 12px 28px; font-size: 14px; cursor: pointer;">Unsubscribe</button>
+		<p style="font-weight: 300; color: #666666; margin-top: 28px;">Getting too many emails? <a href="%s" style="color: #000000;">Choose topics and how often instead</a></p>
+	</form>
+</body>
+</html>`, html.EscapeString(links.UnsubscribeURL), html.EscapeString(email), html.EscapeString(links.PreferencesURL))
 		return
 	}
 
 	client := h.db.GetClient()
-	_, _, err := client.From("newsletter_subscribers").
+	_, _, err = client.From("newsletter_subscribers").
 		Update(map[string]any{
 			"status":          "unsubscribed",
 			"unsubscribed_at": "now()",
 		}, "minimal", "").
-		Eq("email", req.Email).
+		Eq("email", email).
+		Eq("status", "subscribed").
 		Execute()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "unsubscribed",
-		"message": "You've been unsubscribed successfully.",
-	})
+	switch {
+	case wantsJSON(r):
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":  "unsubscribed",
+			"message": "You've been unsubscribed successfully.",
+		})
+	case r.FormValue("confirm") == "true":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Unsubscribed</title></head>
+<body style="font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; background: #fafafa; color: #000000;">
+	<div style="max-width: 480px; margin: 80px auto; background: #ffffff; padding: 40px; text-align: center;">
+		<h1 style="font-weight: 400; font-size: 22px;">You're unsubscribed</h1>
+		<p style="font-weight: 300; color: #666666;">Changed your mind? <a href="%s" style="color: #000000;">Resubscribe from your preferences</a>.</p>
+		<a href="%s" style="color: #000000;">Back to Betadomot</a>
+	</div>
+</body>
+</html>`, html.EscapeString(links.PreferencesURL), h.websiteURL)
+	default:
+		// RFC 8058 one-click: the mail client only needs a 2xx
+		w.WriteHeader(http.StatusOK)
+	}
 }
 
 // GetStats handles GET /newsletter/stats
@@ -4,24 +4,27 @@ import (
 	"blog-backend/models"
 	"blog-backend/services"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
-	"strings"
+	"time"
 )
 
 // NewsletterAdminHandler handles newsletter administration
 type NewsletterAdminHandler struct {
 	db    *services.DatabaseService
 	email *services.EmailService
+	queue *NewsletterQueue
 }
 
 // NewNewsletterAdminHandler creates a new newsletter admin handler
-func NewNewsletterAdminHandler(db *services.DatabaseService, email *services.EmailService) *NewsletterAdminHandler {
-	return &NewsletterAdminHandler{db: db, email: email}
+func NewNewsletterAdminHandler(db *services.DatabaseService, email *services.EmailService, queue *NewsletterQueue) *NewsletterAdminHandler {
+	return &NewsletterAdminHandler{db: db, email: email, queue: queue}
 }
 
 // SendNewsletter handles POST /admin/newsletter/send
+//
+// Saves the newsletter as a campaign and sends it straight away in the background,
+// or sends only a test email when test_email is set.
 func (h *NewsletterAdminHandler) SendNewsletter(w http.ResponseWriter, r *http.Request) {
 	var req models.SendNewsletterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -37,7 +40,7 @@ func (h *NewsletterAdminHandler) SendNewsletter(w http.ResponseWriter, r *http.R
 
 	// If test email is provided, send test email only
 	if req.TestEmail != "" {
-		err := h.email.SendTestNewsletter(req.TestEmail, req.Subject, req.Content, req.HTMLContent)
+		err := h.email.SendTestNewsletter(req.TestEmail, req.Subject, req.Content, req.HTMLContent, h.queue.links.For(req.TestEmail))
 		if err != nil {
 			log.Printf("Failed to send test newsletter: %v", err)
 			http.Error(w, "Failed to send test newsletter: "+err.Error(), http.StatusInternalServerError)
@@ -53,8 +56,18 @@ func (h *NewsletterAdminHandler) SendNewsletter(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	// Get all active subscribers
-	subscribers, err := h.getActiveSubscribers()
+	var segment *models.NewsletterSegment
+	if req.SegmentID != "" {
+		loaded, err := loadSegment(h.db, req.SegmentID)
+		if err != nil {
+			http.Error(w, "Segment not found", http.StatusBadRequest)
+			return
+		}
+		segment = loaded
+	}
+
+	// Get the subscribers this campaign reaches
+	subscribers, err := loadNewsletterRecipients(h.db, req.Topics, segment)
 	if err != nil {
 		log.Printf("Failed to get subscribers: %v", err)
 		http.Error(w, "Failed to get subscribers", http.StatusInternalServerError)
@@ -66,18 +79,38 @@ func (h *NewsletterAdminHandler) SendNewsletter(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	// Send newsletter to all subscribers
-	err = h.email.SendNewsletter(req.Subject, req.Content, req.HTMLContent, subscribers)
-	if err != nil {
-		log.Printf("Failed to send newsletter: %v", err)
-		http.Error(w, "Failed to send newsletter: "+err.Error(), http.StatusInternalServerError)
+	// Save the campaign so it shows up in the history and stats
+	now := time.Now().Format(time.RFC3339)
+	campaign := map[string]interface{}{
+		"subject":      req.Subject,
+		"content":      req.Content,
+		"html_content": req.HTMLContent,
+		"topics":       topicsOrEmpty(req.Topics),
+		"status":       models.NewsletterStatusSending,
+		"started_at":   now,
+	}
+	if segment != nil {
+		campaign["segment_id"] = segment.ID
+	}
+	bytes, _, err := h.db.GetClient().From("newsletters").Insert(campaign, false, "", "representation", "").Execute()
+	var created []models.Newsletter
+	if err == nil {
+		err = json.Unmarshal(bytes, &created)
+	}
+	if err != nil || len(created) == 0 {
+		log.Printf("Failed to save newsletter campaign: %v", err)
+		http.Error(w, "Failed to save newsletter", http.StatusInternalServerError)
 		return
 	}
 
+	h.deliverNewsletter(&created[0])
+
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":          "sent",
-		"message":         "Newsletter sent successfully",
+		"status":          "sending",
+		"message":         "Newsletter is being sent",
+		"id":              created[0].ID,
 		"recipient_count": len(subscribers),
 	})
 }
@@ -91,12 +124,6 @@ func (h *NewsletterAdminHandler) GetNewsletterTemplates(w http.ResponseWriter, r
 			"subject": "Welcome to Our Newsletter! 🎉",
 			"content": "# Welcome to Our Newsletter!\n\nThank you for subscribing to our newsletter. We're excited to share amazing content with you!\n\n## What to Expect\n\n- **Weekly Updates**: Get the latest blog posts delivered to your inbox\n- **Exclusive Content**: Access to subscriber-only content\n- **Tips & Tricks**: Helpful advice and insights\n- **Community**: Join our growing community of readers\n\nWe're thrilled to have you on board!\n\nBest regards,\nThe Team",
 		},
-		{
-			"id":      "weekly",
-			"name":    "Weekly Digest",
-			"subject": "This Week's Highlights 📖",
-			"content": "# This Week's Highlights\n\nHere are the latest posts and updates from our blog:\n\n## Featured Posts\n\n- **New Post**: Transform Your Small Space with These 5 Design Tips\n- **Popular**: The Ultimate Guide to Budget-Friendly Home Decor\n- **Trending**: 10 Ways to Create a Cozy Reading Nook\n\n## Quick Tips\n\n💡 **Tip of the Week**: Use mirrors strategically to make any room feel larger and brighter!\n\n## What's Coming Next\n\nNext week we'll be sharing our guide to choosing the perfect color palette for your home.\n\nThanks for reading!\nThe Team",
-		},
 		{
 			"id":      "announcement",
 			"name":    "Important Announcement",
@@ -123,12 +150,17 @@ func (h *NewsletterAdminHandler) PreviewNewsletter(w http.ResponseWriter, r *htt
 		return
 	}
 
-	// Generate HTML preview using the same template as the email service
-	htmlContent := h.generateNewsletterHTML(req.Subject, req.Content)
+	// Rendered exactly as subscribers will get it, minus their personal links
+	rendered, err := h.email.RenderNewsletter(req.Subject, req.Content)
+	if err != nil {
+		http.Error(w, "Failed to render newsletter: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"html_content": htmlContent,
+		"html_content": rendered.HTML,
+		"text_content": rendered.Text,
 		"subject":      req.Subject,
 		"content":      req.Content,
 	})
@@ -144,12 +176,58 @@ func (h *NewsletterAdminHandler) GetNewsletterStats(w http.ResponseWriter, r *ht
 		return
 	}
 
+	client := h.db.GetClient()
+	_, totalSubscribers, err := client.From("newsletter_subscribers").Select("id", "exact", true).Execute()
+	if err != nil {
+		log.Printf("Failed to count subscribers: %v", err)
+		http.Error(w, "Failed to get subscriber stats", http.StatusInternalServerError)
+		return
+	}
+
+	bytes, _, err := client.From("newsletters").
+		Select("sent_at,sent_count,failed_count,tracked_count,open_count,unique_click_count", "exact", false).
+		Eq("status", models.NewsletterStatusSent).
+		Order("sent_at", nil).
+		Execute()
+	if err != nil {
+		log.Printf("Failed to load sent newsletters: %v", err)
+		http.Error(w, "Failed to get newsletter stats", http.StatusInternalServerError)
+		return
+	}
+	var sent []models.Newsletter
+	if err := json.Unmarshal(bytes, &sent); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var lastSent *string
+	emailsSent, emailsFailed := 0, 0
+	tracked, opened, clicked := 0, 0, 0
+	for _, n := range sent {
+		emailsSent += n.SentCount
+		emailsFailed += n.FailedCount
+		tracked += n.TrackedCount
+		opened += n.OpenCount
+		clicked += n.UniqueClicks
+	}
+	if len(sent) > 0 {
+		lastSent = sent[0].SentAt
+	}
+
+	_, scheduled, _ := client.From("newsletters").Select("id", "exact", true).Eq("status", models.NewsletterStatusScheduled).Execute()
+	_, drafts, _ := client.From("newsletters").Select("id", "exact", true).Eq("status", models.NewsletterStatusDraft).Execute()
+
 	stats := map[string]interface{}{
-		"total_subscribers":  len(subscribers),
+		"total_subscribers":  totalSubscribers,
 		"active_subscribers": len(subscribers),
-		"last_sent":          nil,   // Could be implemented with a newsletters table
-		"total_sent":         0,     // Could be implemented with a newsletters table
-		"open_rate":          "N/A", // Requires email tracking
+		"last_sent":          lastSent,
+		"total_sent":         len(sent),
+		"emails_sent":        emailsSent,
+		"emails_failed":      emailsFailed,
+		"scheduled":          scheduled,
+		"drafts":             drafts,
+		"open_rate":          engagementRate(opened, tracked),
+		"click_rate":         engagementRate(clicked, tracked),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -158,7 +236,12 @@ func (h *NewsletterAdminHandler) GetNewsletterStats(w http.ResponseWriter, r *ht
 
 // getActiveSubscribers retrieves all active newsletter subscribers
 func (h *NewsletterAdminHandler) getActiveSubscribers() ([]string, error) {
-	client := h.db.GetClient()
+	return loadActiveSubscribers(h.db)
+}
+
+// loadActiveSubscribers retrieves the emails of all active newsletter subscribers
+func loadActiveSubscribers(db *services.DatabaseService) ([]string, error) {
+	client := db.GetClient()
 
 	bytes, _, err := client.From("newsletter_subscribers").
 		Select("email", "exact", false).
@@ -180,170 +263,3 @@ func (h *NewsletterAdminHandler) getActiveSubscribers() ([]string, error) {
 
 	return emails, nil
 }
-
-// generateNewsletterHTML generates HTML content for the newsletter preview
-func (h *NewsletterAdminHandler) generateNewsletterHTML(subject, content string) string {
-	// Convert basic markdown to HTML
-	htmlContent := h.formatContentForHTML(content)
-
-	return fmt.Sprintf(`
-	<!DOCTYPE html>
-	<html>
-	<head>
-		<meta charset="utf-8">
-		<meta name="viewport" content="width=device-width, initial-scale=1">
-		<title>%s</title>
-		<style>
-			body { 
-				font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; 
-				line-height: 1.6; 
-				color: #333; 
-				max-width: 600px; 
-				margin: 0 auto; 
-				padding: 0; 
-				background-color: #f5f6fa;
-			}
-			.container { 
-				background: white; 
-				margin: 20px auto; 
-				border-radius: 10px; 
-				overflow: hidden;
-				box-shadow: 0 4px 6px rgba(0,0,0,0.1);
-			}
-			.header { 
-				background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); 
-				padding: 40px 30px; 
-				text-align: center; 
-				color: white; 
-			}
-			.header h1 { 
-				margin: 0; 
-				font-size: 28px; 
-				font-weight: 700; 
-			}
-			.header p { 
-				margin: 10px 0 0 0; 
-				opacity: 0.9; 
-				font-size: 16px; 
-			}
-			.content { 
-				padding: 40px 30px; 
-			}
-			.content h1, .content h2, .content h3 { 
-				color: #2d5a87; 
-				margin-top: 30px; 
-				margin-bottom: 15px; 
-			}
-			.content h1 { font-size: 24px; margin-top: 0; }
-			.content h2 { font-size: 20px; }
-			.content h3 { font-size: 18px; }
-			.content p { 
-				margin-bottom: 15px; 
-				line-height: 1.7; 
-			}
-			.content ul, .content ol { 
-				margin-bottom: 15px; 
-				padding-left: 30px; 
-			}
-			.content li { 
-				margin-bottom: 8px; 
-			}
-			.content strong { 
-				color: #2d5a87; 
-			}
-			.tip-box { 
-				background: #f8f9fa; 
-				padding: 20px; 
-				border-radius: 8px; 
-				border-left: 4px solid #667eea; 
-				margin: 20px 0; 
-			}
-			.footer { 
-				background: #f8f9fa; 
-				padding: 30px; 
-				text-align: center; 
-				color: #666; 
-				font-size: 14px; 
-				border-top: 1px solid #eee; 
-			}
-			.cta-button { 
-				display: inline-block; 
-				background: #667eea; 
-				color: white; 
-				padding: 15px 30px; 
-				text-decoration: none; 
-				border-radius: 25px; 
-				font-weight: 600; 
-				margin: 20px 0; 
-			}
-		</style>
-	</head>
-	<body>
-		<div class="container">
-			<div class="header">
-				<h1>📧 Newsletter</h1>
-				<p>Latest updates from our blog</p>
-			</div>
-			<div class="content">
-				<h1>%s</h1>
-				%s
-				<div class="tip-box">
-					<p style="margin: 0;"><strong>💡 Tip:</strong> Forward this newsletter to friends who might be interested!</p>
-				</div>
-				<div style="text-align: center;">
-					<a href="#" class="cta-button">Visit Our Blog</a>
-				</div>
-			</div>
-			<div class="footer">
-				<p>Thanks for reading! We hope you found this newsletter helpful.</p>
-				<p>You're receiving this because you subscribed to our newsletter.</p>
-				<p><a href="#" style="color: #667eea;">Unsubscribe</a> | <a href="#" style="color: #667eea;">View in Browser</a></p>
-			</div>
-		</div>
-	</body>
-	</html>`, subject, subject, htmlContent)
-}
-
-// formatContentForHTML converts markdown-like content to HTML
-func (h *NewsletterAdminHandler) formatContentForHTML(content string) string {
-	html := content
-
-	// Convert headings
-	html = strings.ReplaceAll(html, "# ", "<h1>")
-	html = strings.ReplaceAll(html, "## ", "<h2>")
-	html = strings.ReplaceAll(html, "### ", "<h3>")
-
-	// Convert bold and italic
-	html = strings.ReplaceAll(html, "**", "<strong>")
-	html = strings.ReplaceAll(html, "*", "<em>")
-
-	// Convert bullet points to list items
-	lines := strings.Split(html, "\n")
-	var result []string
-	inList := false
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "- ") {
-			if !inList {
-				result = append(result, "<ul>")
-				inList = true
-			}
-			result = append(result, "<li>"+strings.TrimPrefix(line, "- ")+"</li>")
-		} else {
-			if inList {
-				result = append(result, "</ul>")
-				inList = false
-			}
-			if line != "" {
-				result = append(result, "<p>"+line+"</p>")
-			}
-		}
-	}
-
-	if inList {
-		result = append(result, "</ul>")
-	}
-
-	return strings.Join(result, "\n")
-}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// GetNewsletters handles GET /admin/newsletters?status=draft
+func (h *NewsletterAdminHandler) GetNewsletters(w http.ResponseWriter, r *http.Request) {
+	query := h.db.GetClient().From("newsletters").Select("*", "exact", false)
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Eq("status", status)
+	}
+
+	jsonStr, _, err := query.Order("created_at", nil).ExecuteString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(jsonStr))
+}
+
+// GetNewsletter handles GET /admin/newsletters/{id}
+func (h *NewsletterAdminHandler) GetNewsletter(w http.ResponseWriter, r *http.Request) {
+	newsletter, err := h.loadNewsletter(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "newsletter not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newsletter)
+}
+
+// CreateNewsletter handles POST /admin/newsletters
+//
+// Saves a draft, or a scheduled campaign when scheduled_for is set.
+func (h *NewsletterAdminHandler) CreateNewsletter(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateNewsletterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	row, err := newsletterRow(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bytes, _, err := h.db.GetClient().From("newsletters").Insert(row, false, "", "representation", "").Execute()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var created []models.Newsletter
+	if err := json.Unmarshal(bytes, &created); err != nil || len(created) == 0 {
+		http.Error(w, "Failed to create newsletter", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created[0])
+}
+
+// UpdateNewsletter handles PUT /admin/newsletters/{id}
+//
+// Only drafts and scheduled campaigns can change. Leaving out scheduled_for turns a
+// scheduled campaign back into a draft.
+func (h *NewsletterAdminHandler) UpdateNewsletter(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req models.CreateNewsletterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	row, err := newsletterRow(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	row["updated_at"] = time.Now().Format(time.RFC3339)
+
+	bytes, _, err := h.db.GetClient().From("newsletters").
+		Update(row, "representation", "").
+		Eq("id", id).
+		In("status", []string{models.NewsletterStatusDraft, models.NewsletterStatusScheduled}).
+		Execute()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var updated []models.Newsletter
+	if err := json.Unmarshal(bytes, &updated); err != nil || len(updated) == 0 {
+		h.writeNotEditable(w, id)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated[0])
+}
+
+// DeleteNewsletter handles DELETE /admin/newsletters/{id}
+//
+// Campaigns that are being sent can't be deleted; sent campaigns can, which also
+// drops them from the stats.
+func (h *NewsletterAdminHandler) DeleteNewsletter(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	bytes, _, err := h.db.GetClient().From("newsletters").
+		Delete("representation", "").
+		Eq("id", id).
+		Neq("status", models.NewsletterStatusSending).
+		Execute()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var deleted []models.Newsletter
+	if err := json.Unmarshal(bytes, &deleted); err != nil || len(deleted) == 0 {
+		h.writeNotEditable(w, id)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+// SendNewsletterNow handles POST /admin/newsletters/{id}/send
+//
+// Sends a draft or scheduled campaign straight away. Delivery runs in the background;
+// poll GET /admin/newsletters/{id}/progress for how far it got.
+func (h *NewsletterAdminHandler) SendNewsletterNow(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	newsletter, err := h.claimNewsletter(id, models.NewsletterStatusDraft, models.NewsletterStatusScheduled)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if newsletter == nil {
+		h.writeNotEditable(w, id)
+		return
+	}
+
+	h.deliverNewsletter(newsletter)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(newsletter)
+}
+
+// StartNewsletterScheduler sends scheduled campaigns once their scheduled_for has
+// passed, checking every interval
+func (h *NewsletterAdminHandler) StartNewsletterScheduler(interval time.Duration) {
+	// A restart mid-send leaves campaigns in sending with no one delivering them
+	h.queue.Resume()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := h.sendDueNewsletters(); err != nil {
+				log.Printf("[Newsletter] Scheduler run failed: %v", err)
+			}
+		}
+	}()
+	log.Printf("📬 Newsletter scheduler checking every %s", interval)
+}
+
+func (h *NewsletterAdminHandler) sendDueNewsletters() error {
+	bytes, _, err := h.db.GetClient().From("newsletters").
+		Select("id", "exact", false).
+		Eq("status", models.NewsletterStatusScheduled).
+		Lte("scheduled_for", time.Now().UTC().Format(time.RFC3339)).
+		Order("scheduled_for", &postgrest.OrderOpts{Ascending: true}).
+		Execute()
+	if err != nil {
+		return err
+	}
+	var due []models.Newsletter
+	if err := json.Unmarshal(bytes, &due); err != nil {
+		return err
+	}
+
+	for _, d := range due {
+		newsletter, err := h.claimNewsletter(d.ID, models.NewsletterStatusScheduled)
+		if err != nil {
+			log.Printf("[Newsletter] Failed to claim campaign %s: %v", d.ID, err)
+			continue
+		}
+		if newsletter != nil {
+			h.deliverNewsletter(newsletter)
+		}
+	}
+	return nil
+}
+
+// claimNewsletter moves a campaign in one of the given statuses to sending and returns
+// it, or nil if it wasn't in one of them. The conditional update means a campaign is
+// only ever claimed once.
+func (h *NewsletterAdminHandler) claimNewsletter(id string, from ...string) (*models.Newsletter, error) {
+	now := time.Now().Format(time.RFC3339)
+	bytes, _, err := h.db.GetClient().From("newsletters").
+		Update(map[string]any{
+			"status":     models.NewsletterStatusSending,
+			"started_at": now,
+			"updated_at": now,
+		}, "representation", "").
+		Eq("id", id).
+		In("status", from).
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+	var claimed []models.Newsletter
+	if err := json.Unmarshal(bytes, &claimed); err != nil {
+		return nil, err
+	}
+	if len(claimed) == 0 {
+		return nil, nil
+	}
+	return &claimed[0], nil
+}
+
+// deliverNewsletter hands a claimed campaign to the delivery queue
+func (h *NewsletterAdminHandler) deliverNewsletter(newsletter *models.Newsletter) {
+	h.queue.Start(newsletter.ID)
+}
+
+func (h *NewsletterAdminHandler) loadNewsletter(id string) (*models.Newsletter, error) {
+	bytes, _, err := h.db.GetClient().From("newsletters").Select("*", "exact", false).Eq("id", id).Single().Execute()
+	if err != nil {
+		return nil, err
+	}
+	var newsletter models.Newsletter
+	if err := json.Unmarshal(bytes, &newsletter); err != nil {
+		return nil, err
+	}
+	return &newsletter, nil
+}
+
+// writeNotEditable explains why a campaign couldn't be changed: it is missing, or it
+// is past the point where the change is allowed
+func (h *NewsletterAdminHandler) writeNotEditable(w http.ResponseWriter, id string) {
+	newsletter, err := h.loadNewsletter(id)
+	if err != nil {
+		http.Error(w, "newsletter not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, fmt.Sprintf("newsletter is %s and can no longer be changed", newsletter.Status), http.StatusConflict)
+}
+
+// topicsOrEmpty keeps a missing topics list from being stored as null
+func topicsOrEmpty(topics []string) []string {
+	if topics == nil {
+		return []string{}
+	}
+	return topics
+}
+
+// newsletterRow validates a create or update request and returns the columns to save
+func newsletterRow(req models.CreateNewsletterRequest) (map[string]any, error) {
+	if strings.TrimSpace(req.Subject) == "" || strings.TrimSpace(req.Content) == "" {
+		return nil, fmt.Errorf("subject and content are required")
+	}
+
+	row := map[string]any{
+		"subject":       req.Subject,
+		"content":       req.Content,
+		"html_content":  req.HTMLContent,
+		"topics":        topicsOrEmpty(req.Topics),
+		"segment_id":    nil,
+		"status":        models.NewsletterStatusDraft,
+		"scheduled_for": nil,
+	}
+	if req.SegmentID != nil && *req.SegmentID != "" {
+		row["segment_id"] = *req.SegmentID
+	}
+	if req.ScheduledFor != nil && *req.ScheduledFor != "" {
+		scheduledFor, err := time.Parse(time.RFC3339, *req.ScheduledFor)
+		if err != nil {
+			return nil, fmt.Errorf("scheduled_for must be an RFC3339 time")
+		}
+		if scheduledFor.Before(time.Now().Add(-time.Minute)) {
+			return nil, fmt.Errorf("scheduled_for must be in the future")
+		}
+		row["status"] = models.NewsletterStatusScheduled
+		row["scheduled_for"] = scheduledFor.UTC().Format(time.RFC3339)
+	}
+	return row, nil
+}
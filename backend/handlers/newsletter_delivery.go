@@ -0,0 +1,561 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"blog-backend/services"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// Newsletter delivery statuses
+const (
+	deliveryPending = "pending"
+	deliverySending = "sending"
+	deliverySent    = "sent"
+	deliveryFailed  = "failed"
+)
+
+const (
+	// deliveryBatchSize is how many queued recipients a campaign run loads at a time
+	deliveryBatchSize = 100
+	// deliveryBaseBackoff is the wait before the first retry; it doubles per attempt
+	deliveryBaseBackoff = 30 * time.Second
+	// deliveryMaxBackoff caps the wait between retries
+	deliveryMaxBackoff = 30 * time.Minute
+)
+
+// newsletterDelivery is one recipient of a campaign in the delivery queue
+type newsletterDelivery struct {
+	ID            string  `json:"id"`
+	NewsletterID  string  `json:"newsletter_id"`
+	Email         string  `json:"email"`
+	Status        string  `json:"status"`
+	Attempts      int     `json:"attempts"`
+	NextAttemptAt string  `json:"next_attempt_at"`
+	LastError     *string `json:"last_error"`
+	Tracked       bool    `json:"tracked"`
+}
+
+// NewsletterQueue delivers campaigns one recipient at a time from the persistent
+// newsletter_deliveries queue, with a worker pool sharing one rate limit
+type NewsletterQueue struct {
+	db          *services.DatabaseService
+	email       *services.EmailService
+	tracker     *NewsletterTracker
+	links       *NewsletterLinks
+	workers     int
+	rate        int // Emails per second across all workers
+	maxAttempts int
+
+	mu      sync.Mutex
+	running map[string]bool // Campaigns being delivered by this process
+}
+
+// NewNewsletterQueue creates a new newsletter delivery queue
+func NewNewsletterQueue(db *services.DatabaseService, email *services.EmailService, tracker *NewsletterTracker, links *NewsletterLinks, workers, rate, maxAttempts int) *NewsletterQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	if rate < 1 {
+		rate = 1
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &NewsletterQueue{
+		db:          db,
+		email:       email,
+		tracker:     tracker,
+		links:       links,
+		workers:     workers,
+		rate:        rate,
+		maxAttempts: maxAttempts,
+		running:     make(map[string]bool),
+	}
+}
+
+// Start delivers a campaign that is in the sending state in the background. Calling it
+// for a campaign that is already being delivered does nothing.
+func (q *NewsletterQueue) Start(newsletterID string) {
+	q.mu.Lock()
+	if q.running[newsletterID] {
+		q.mu.Unlock()
+		return
+	}
+	q.running[newsletterID] = true
+	q.mu.Unlock()
+
+	go func() {
+		defer func() {
+			q.mu.Lock()
+			delete(q.running, newsletterID)
+			q.mu.Unlock()
+		}()
+
+		if err := q.deliver(newsletterID); err != nil {
+			log.Printf("[Newsletter] ❌ Campaign %s failed: %v", newsletterID, err)
+			q.updateNewsletter(newsletterID, map[string]any{
+				"status":     models.NewsletterStatusFailed,
+				"last_error": err.Error(),
+			})
+		}
+	}()
+}
+
+// IsRunning reports whether this process is delivering the campaign
+func (q *NewsletterQueue) IsRunning(newsletterID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.running[newsletterID]
+}
+
+// Resume restarts delivery of campaigns left in the sending state by a previous process.
+// Recipients that were mid-send go back in the queue; their idempotency key keeps them
+// from getting the email twice.
+func (q *NewsletterQueue) Resume() {
+	bytes, _, err := q.db.GetClient().From("newsletters").
+		Select("id", "exact", false).
+		Eq("status", models.NewsletterStatusSending).
+		Execute()
+	if err != nil {
+		log.Printf("[Newsletter] Failed to check for interrupted campaigns: %v", err)
+		return
+	}
+	var interrupted []models.Newsletter
+	if err := json.Unmarshal(bytes, &interrupted); err != nil {
+		log.Printf("[Newsletter] Failed to check for interrupted campaigns: %v", err)
+		return
+	}
+
+	for _, n := range interrupted {
+		_, _, err := q.db.GetClient().From("newsletter_deliveries").
+			Update(map[string]any{"status": deliveryPending}, "minimal", "").
+			Eq("newsletter_id", n.ID).
+			Eq("status", deliverySending).
+			Execute()
+		if err != nil {
+			log.Printf("[Newsletter] Failed to requeue campaign %s: %v", n.ID, err)
+			continue
+		}
+		log.Printf("[Newsletter] Resuming interrupted campaign %s", n.ID)
+		q.Start(n.ID)
+	}
+}
+
+// deliver runs a campaign to completion: it freezes the recipient list into the queue
+// on the first run, then sends until nothing is left to send or retry
+func (q *NewsletterQueue) deliver(newsletterID string) error {
+	client := q.db.GetClient()
+
+	bytes, _, err := client.From("newsletters").Select("*", "exact", false).Eq("id", newsletterID).Single().Execute()
+	if err != nil {
+		return err
+	}
+	var newsletter struct {
+		models.Newsletter
+		EnqueuedAt *string `json:"enqueued_at"`
+	}
+	if err := json.Unmarshal(bytes, &newsletter); err != nil {
+		return err
+	}
+	if newsletter.Status != models.NewsletterStatusSending {
+		return nil
+	}
+
+	if newsletter.EnqueuedAt == nil {
+		if err := q.enqueue(newsletterID, newsletter.Topics, newsletter.SegmentID); err != nil {
+			return err
+		}
+	}
+
+	// Rendered once per campaign; send fills in each recipient's links
+	var rendered *services.RenderedEmail
+	if newsletter.HTMLContent != "" {
+		html := services.InlineCSS(newsletter.HTMLContent)
+		rendered = &services.RenderedEmail{Subject: newsletter.Subject, HTML: html, Text: services.HTMLToText(html)}
+	} else if rendered, err = q.email.RenderNewsletter(newsletter.Subject, newsletter.Content); err != nil {
+		return fmt.Errorf("failed to render campaign: %w", err)
+	}
+
+	log.Printf("[Newsletter] Sending campaign %s: %s", newsletterID, newsletter.Subject)
+
+	limiter := time.NewTicker(time.Second / time.Duration(q.rate))
+	defer limiter.Stop()
+
+	for {
+		batch, err := q.dueDeliveries(newsletterID)
+		if err != nil {
+			return err
+		}
+
+		if len(batch) == 0 {
+			wait, done, err := q.nextRetry(newsletterID)
+			if err != nil {
+				return err
+			}
+			if done {
+				break
+			}
+			time.Sleep(wait)
+			continue
+		}
+
+		jobs := make(chan newsletterDelivery)
+		var wg sync.WaitGroup
+		for i := 0; i < q.workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for delivery := range jobs {
+					<-limiter.C
+					q.send(delivery, newsletter.Subject, rendered.HTML, rendered.Text)
+				}
+			}()
+		}
+		for _, delivery := range batch {
+			jobs <- delivery
+		}
+		close(jobs)
+		wg.Wait()
+	}
+
+	return q.finish(newsletterID)
+}
+
+// enqueue adds a queue row for every subscriber the campaign goes to and freezes the
+// recipient list, so later segment edits don't change who a started campaign reaches.
+// The upsert doesn't carry the status, so rows left by an interrupted enqueue keep it.
+// Subscribers who opted out of tracking are queued untracked.
+func (q *NewsletterQueue) enqueue(newsletterID string, topics []string, segmentID *string) error {
+	client := q.db.GetClient()
+
+	var segment *models.NewsletterSegment
+	if segmentID != nil {
+		loaded, err := loadSegment(q.db, *segmentID)
+		if err != nil {
+			return fmt.Errorf("failed to load segment %s: %w", *segmentID, err)
+		}
+		segment = loaded
+	}
+
+	subscribers, err := loadNewsletterRecipients(q.db, topics, segment)
+	if err != nil {
+		return err
+	}
+	if len(subscribers) == 0 {
+		return fmt.Errorf("no active subscribers in this campaign's segment follow its topics or are due a newsletter")
+	}
+
+	for start := 0; start < len(subscribers); start += 500 {
+		end := start + 500
+		if end > len(subscribers) {
+			end = len(subscribers)
+		}
+		rows := make([]map[string]any, 0, end-start)
+		for _, subscriber := range subscribers[start:end] {
+			rows = append(rows, map[string]any{
+				"newsletter_id": newsletterID,
+				"email":         subscriber.Email,
+				"tracked":       !subscriber.TrackingOptOut,
+			})
+		}
+		if _, _, err := client.From("newsletter_deliveries").Insert(rows, true, "newsletter_id,email", "minimal", "").Execute(); err != nil {
+			return fmt.Errorf("failed to queue recipients: %w", err)
+		}
+	}
+
+	_, total, err := client.From("newsletter_deliveries").Select("id", "exact", true).Eq("newsletter_id", newsletterID).Execute()
+	if err != nil {
+		return err
+	}
+	q.updateNewsletter(newsletterID, map[string]any{
+		"enqueued_at":     time.Now().Format(time.RFC3339),
+		"recipient_count": total,
+	})
+	log.Printf("[Newsletter] Queued %d recipients for campaign %s", total, newsletterID)
+	return nil
+}
+
+// dueDeliveries returns the next batch of pending recipients whose retry time has come
+func (q *NewsletterQueue) dueDeliveries(newsletterID string) ([]newsletterDelivery, error) {
+	bytes, _, err := q.db.GetClient().From("newsletter_deliveries").
+		Select("id,newsletter_id,email,status,attempts,next_attempt_at,tracked", "exact", false).
+		Eq("newsletter_id", newsletterID).
+		Eq("status", deliveryPending).
+		Lte("next_attempt_at", time.Now().UTC().Format(time.RFC3339)).
+		Order("next_attempt_at", &postgrest.OrderOpts{Ascending: true}).
+		Limit(deliveryBatchSize, "").
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+	var batch []newsletterDelivery
+	if err := json.Unmarshal(bytes, &batch); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// nextRetry reports how long until the earliest pending retry, or done when the
+// campaign has no pending recipients left
+func (q *NewsletterQueue) nextRetry(newsletterID string) (time.Duration, bool, error) {
+	bytes, _, err := q.db.GetClient().From("newsletter_deliveries").
+		Select("next_attempt_at", "exact", false).
+		Eq("newsletter_id", newsletterID).
+		Eq("status", deliveryPending).
+		Order("next_attempt_at", &postgrest.OrderOpts{Ascending: true}).
+		Limit(1, "").
+		Execute()
+	if err != nil {
+		return 0, false, err
+	}
+	var pending []newsletterDelivery
+	if err := json.Unmarshal(bytes, &pending); err != nil {
+		return 0, false, err
+	}
+	if len(pending) == 0 {
+		return 0, true, nil
+	}
+
+	wait := time.Until(parseFeedTime(pending[0].NextAttemptAt))
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait, false, nil
+}
+
+// send claims one queued recipient and sends them the campaign. Transient failures go
+// back in the queue with exponential backoff until maxAttempts is reached.
+func (q *NewsletterQueue) send(delivery newsletterDelivery, subject, html, text string) {
+	client := q.db.GetClient()
+	attempts := delivery.Attempts + 1
+
+	// Claiming with a status check keeps two processes from sending the same row
+	bytes, _, err := client.From("newsletter_deliveries").
+		Update(map[string]any{
+			"status":     deliverySending,
+			"attempts":   attempts,
+			"updated_at": time.Now().Format(time.RFC3339),
+		}, "representation", "").
+		Eq("id", delivery.ID).
+		Eq("status", deliveryPending).
+		Execute()
+	var claimed []newsletterDelivery
+	if err != nil || json.Unmarshal(bytes, &claimed) != nil || len(claimed) == 0 {
+		return
+	}
+
+	links := q.links.For(delivery.Email)
+	html = links.Personalize(html)
+	text = links.Personalize(text)
+	if delivery.Tracked {
+		html = q.tracker.Instrument(html, delivery.NewsletterID, delivery.Email)
+	}
+
+	messageID, err := q.email.SendNewsletterMessage(services.NewsletterMessage{
+		To:             delivery.Email,
+		Subject:        subject,
+		HTML:           html,
+		Text:           text,
+		Headers:        links.Headers(),
+		IdempotencyKey: "newsletter-delivery-" + delivery.ID,
+	})
+
+	now := time.Now()
+	update := map[string]any{"updated_at": now.Format(time.RFC3339)}
+	switch {
+	case err == nil:
+		update["status"] = deliverySent
+		update["sent_at"] = now.Format(time.RFC3339)
+		update["provider_message_id"] = messageID
+		update["last_error"] = nil
+	case services.IsTransientEmailError(err) && attempts < q.maxAttempts:
+		backoff := time.Duration(float64(deliveryBaseBackoff) * math.Pow(2, float64(attempts-1)))
+		if backoff > deliveryMaxBackoff {
+			backoff = deliveryMaxBackoff
+		}
+		log.Printf("[Newsletter] Retrying %s in %s after attempt %d: %v", delivery.Email, backoff, attempts, err)
+		update["status"] = deliveryPending
+		update["next_attempt_at"] = now.Add(backoff).UTC().Format(time.RFC3339)
+		update["last_error"] = err.Error()
+	default:
+		log.Printf("[Newsletter] ❌ Giving up on %s after attempt %d: %v", delivery.Email, attempts, err)
+		update["status"] = deliveryFailed
+		update["last_error"] = err.Error()
+	}
+
+	if _, _, err := client.From("newsletter_deliveries").Update(update, "minimal", "").Eq("id", delivery.ID).Execute(); err != nil {
+		log.Printf("[Newsletter] Failed to record delivery to %s: %v", delivery.Email, err)
+	}
+	if update["status"] == deliverySent {
+		// Weekly and monthly subscribers are paced from this
+		client.From("newsletter_subscribers").
+			Update(map[string]any{"last_newsletter_at": now.Format(time.RFC3339)}, "minimal", "").
+			Eq("email", delivery.Email).
+			Execute()
+	}
+}
+
+// finish records the campaign's totals once every recipient is sent or failed
+func (q *NewsletterQueue) finish(newsletterID string) error {
+	progress, err := loadDeliveryProgress(q.db, newsletterID)
+	if err != nil {
+		return err
+	}
+
+	_, tracked, err := q.db.GetClient().From("newsletter_deliveries").
+		Select("id", "exact", true).
+		Eq("newsletter_id", newsletterID).
+		Eq("status", deliverySent).
+		Eq("tracked", "true").
+		Execute()
+	if err != nil {
+		return err
+	}
+
+	update := map[string]any{
+		"sent_count":    progress.Sent,
+		"failed_count":  progress.Failed,
+		"tracked_count": tracked,
+	}
+	if progress.Sent > 0 {
+		update["status"] = models.NewsletterStatusSent
+		update["sent_at"] = time.Now().Format(time.RFC3339)
+		log.Printf("[Newsletter] ✅ Campaign %s sent to %d of %d recipients", newsletterID, progress.Sent, progress.Total)
+	} else {
+		update["status"] = models.NewsletterStatusFailed
+		update["last_error"] = "no email could be delivered"
+		log.Printf("[Newsletter] ❌ Campaign %s could not be delivered to any of %d recipients", newsletterID, progress.Total)
+	}
+	q.updateNewsletter(newsletterID, update)
+	return nil
+}
+
+func (q *NewsletterQueue) updateNewsletter(newsletterID string, update map[string]any) {
+	update["updated_at"] = time.Now().Format(time.RFC3339)
+	if _, _, err := q.db.GetClient().From("newsletters").Update(update, "minimal", "").Eq("id", newsletterID).Execute(); err != nil {
+		log.Printf("[Newsletter] Failed to update campaign %s: %v", newsletterID, err)
+	}
+}
+
+// deliveryProgress counts a campaign's queue rows by status
+type deliveryProgress struct {
+	Total   int `json:"total"`
+	Pending int `json:"pending"`
+	Sending int `json:"sending"`
+	Sent    int `json:"sent"`
+	Failed  int `json:"failed"`
+}
+
+func loadDeliveryProgress(db *services.DatabaseService, newsletterID string) (*deliveryProgress, error) {
+	client := db.GetClient()
+	progress := &deliveryProgress{}
+	counts := map[string]*int{
+		deliveryPending: &progress.Pending,
+		deliverySending: &progress.Sending,
+		deliverySent:    &progress.Sent,
+		deliveryFailed:  &progress.Failed,
+	}
+	for status, count := range counts {
+		_, n, err := client.From("newsletter_deliveries").
+			Select("id", "exact", true).
+			Eq("newsletter_id", newsletterID).
+			Eq("status", status).
+			Execute()
+		if err != nil {
+			return nil, err
+		}
+		*count = int(n)
+		progress.Total += int(n)
+	}
+	return progress, nil
+}
+
+// GetNewsletterProgress handles GET /admin/newsletters/{id}/progress
+func (h *NewsletterAdminHandler) GetNewsletterProgress(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	newsletter, err := h.loadNewsletter(id)
+	if err != nil {
+		http.Error(w, "newsletter not found", http.StatusNotFound)
+		return
+	}
+
+	progress, err := loadDeliveryProgress(h.db, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	percent := 0.0
+	if progress.Total > 0 {
+		percent = float64(progress.Sent+progress.Failed) / float64(progress.Total) * 100
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":       newsletter.ID,
+		"status":   newsletter.Status,
+		"running":  h.queue.IsRunning(id),
+		"progress": progress,
+		"percent":  math.Round(percent*10) / 10,
+	})
+}
+
+// ResumeNewsletter handles POST /admin/newsletters/{id}/resume
+//
+// Restarts delivery of a failed campaign, or of one stuck in sending, for the
+// recipients that haven't been sent it yet. Recipients that failed permanently are
+// retried too.
+func (h *NewsletterAdminHandler) ResumeNewsletter(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	client := h.db.GetClient()
+
+	if h.queue.IsRunning(id) {
+		http.Error(w, "newsletter is already being sent", http.StatusConflict)
+		return
+	}
+
+	bytes, _, err := client.From("newsletters").
+		Update(map[string]any{
+			"status":     models.NewsletterStatusSending,
+			"last_error": nil,
+			"updated_at": time.Now().Format(time.RFC3339),
+		}, "representation", "").
+		Eq("id", id).
+		In("status", []string{models.NewsletterStatusFailed, models.NewsletterStatusSending}).
+		Execute()
+	var resumed []models.Newsletter
+	if err != nil || json.Unmarshal(bytes, &resumed) != nil || len(resumed) == 0 {
+		h.writeNotEditable(w, id)
+		return
+	}
+
+	_, _, err = client.From("newsletter_deliveries").
+		Update(map[string]any{
+			"status":          deliveryPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now().UTC().Format(time.RFC3339),
+		}, "minimal", "").
+		Eq("newsletter_id", id).
+		In("status", []string{deliverySending, deliveryFailed}).
+		Execute()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.queue.Start(id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resumed[0])
+}
@@ -0,0 +1,465 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"blog-backend/services"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/supabase-community/postgrest-go"
+)
+
+// Digest modes
+const (
+	DigestModeOff   = "off"
+	DigestModeDraft = "draft" // Saved as a draft campaign for approval
+	DigestModeSend  = "send"  // Sent to every subscriber straight away
+)
+
+// How many entries each digest section lists
+const (
+	digestContentLimit  = 5
+	digestNewItemsLimit = 6
+	digestFeaturedLimit = 4
+)
+
+// NewsletterDigest generates the weekly newsletter from recently published content
+type NewsletterDigest struct {
+	db         *services.DatabaseService
+	email      *services.EmailService
+	queue      *NewsletterQueue
+	websiteURL string
+	shopURL    string
+	days       int
+	mode       string
+}
+
+// digestContent is a generated digest, ready to be saved as a campaign
+type digestContent struct {
+	Subject     string `json:"subject"`
+	Content     string `json:"content"`
+	HTMLContent string `json:"html_content"`
+	NewItems    int    `json:"new_items"` // Posts, guides and collection additions; zero means nothing to send
+}
+
+// digestEntry is a post or guide row decoded for the digest
+type digestEntry struct {
+	Slug          string `json:"slug"`
+	Title         string `json:"title"`
+	Excerpt       string `json:"excerpt"`
+	Description   string `json:"description"`
+	FeaturedImage string `json:"featured_image"`
+	Views         int    `json:"views"`
+}
+
+// NewNewsletterDigest creates a new digest generator. days is how far back it looks
+// for new content and mode one of off, draft or send.
+func NewNewsletterDigest(db *services.DatabaseService, email *services.EmailService, queue *NewsletterQueue, websiteURL string, days int, mode string) *NewsletterDigest {
+	shopURL := os.Getenv("SHOP_URL")
+	if shopURL == "" {
+		shopURL = "http://localhost:3001"
+	}
+	if days <= 0 {
+		days = 7
+	}
+	return &NewsletterDigest{
+		db:         db,
+		email:      email,
+		queue:      queue,
+		websiteURL: strings.TrimSuffix(websiteURL, "/"),
+		shopURL:    strings.TrimSuffix(shopURL, "/"),
+		days:       days,
+		mode:       mode,
+	}
+}
+
+// Start runs the digest every week on day (e.g. "monday") at hour
+func (d *NewsletterDigest) Start(day string, hour int) {
+	if d.mode != DigestModeDraft && d.mode != DigestModeSend {
+		log.Printf("📰 Newsletter digest disabled")
+		return
+	}
+	weekday, ok := parseWeekday(day)
+	if !ok {
+		log.Printf("[Newsletter] Unknown digest day %q, using Monday", day)
+		weekday = time.Monday
+	}
+
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+			next = next.AddDate(0, 0, (int(weekday)-int(next.Weekday())+7)%7)
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 7)
+			}
+			time.Sleep(time.Until(next))
+
+			if err := d.run(time.Now()); err != nil {
+				log.Printf("[Newsletter] Failed to generate digest: %v", err)
+			}
+		}
+	}()
+	log.Printf("📰 Newsletter digest (%s) scheduled every %s at %02d:00", d.mode, weekday, hour)
+}
+
+// run generates this week's digest and saves it as a draft or sends it. Weeks without
+// new posts, guides or collection additions are skipped. The digest date is unique, so
+// two instances running the schedule only produce one campaign.
+func (d *NewsletterDigest) run(now time.Time) error {
+	digest, err := d.build(d.days, now)
+	if err != nil {
+		return err
+	}
+	if digest.NewItems == 0 {
+		log.Printf("[Newsletter] Nothing new in the last %d days, skipping digest", d.days)
+		return nil
+	}
+
+	status := models.NewsletterStatusDraft
+	if d.mode == DigestModeSend {
+		status = models.NewsletterStatusSending
+	}
+	campaign := map[string]any{
+		"subject":      digest.Subject,
+		"content":      digest.Content,
+		"html_content": digest.HTMLContent,
+		"topics":       []string{},
+		"status":       status,
+		"digest_date":  now.Format("2006-01-02"),
+	}
+	if status == models.NewsletterStatusSending {
+		campaign["started_at"] = now.Format(time.RFC3339)
+	}
+
+	bytes, _, err := d.db.GetClient().From("newsletters").Insert(campaign, false, "", "representation", "").Execute()
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "23505") {
+			log.Printf("[Newsletter] Digest for %s already exists", now.Format("2006-01-02"))
+			return nil
+		}
+		return err
+	}
+	var created []models.Newsletter
+	if err := json.Unmarshal(bytes, &created); err != nil || len(created) == 0 {
+		return fmt.Errorf("failed to read back digest campaign: %v", err)
+	}
+
+	if status == models.NewsletterStatusSending {
+		log.Printf("[Newsletter] 📰 Sending digest %s: %s", created[0].ID, digest.Subject)
+		d.queue.Start(created[0].ID)
+	} else {
+		log.Printf("[Newsletter] 📰 Digest %s saved as a draft for approval: %s", created[0].ID, digest.Subject)
+	}
+	return nil
+}
+
+// build collects the posts and guides published in the last days, most viewed first,
+// the products added to collections in that time, and the featured products
+func (d *NewsletterDigest) build(days int, now time.Time) (*digestContent, error) {
+	since := now.AddDate(0, 0, -days)
+
+	posts, err := d.loadEntries("posts", "slug,title,excerpt,featured_image,views", since, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load posts: %w", err)
+	}
+	guides, err := d.loadEntries("guides", "slug,title,description,featured_image,views", since, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load guides: %w", err)
+	}
+	newItems, err := d.loadNewCollectionItems(since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load collection items: %w", err)
+	}
+	featured, err := d.loadFeaturedProducts(newItems)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load featured products: %w", err)
+	}
+
+	sections := []services.DigestSection{
+		{Title: "New on the blog", Items: d.entryItems(posts, "/blog/")},
+		{Title: "New guides", Items: d.entryItems(guides, "/guides/")},
+		{Title: "Just added to the shop", Items: newItems},
+		{Title: "Featured in the shop", Items: featured},
+	}
+
+	subject := "This week at Betadomot"
+	switch {
+	case len(posts) > 0:
+		subject = fmt.Sprintf("This week: %s", posts[0].Title)
+	case len(guides) > 0:
+		subject = fmt.Sprintf("This week: %s", guides[0].Title)
+	}
+	intro := fmt.Sprintf("Here's what's new on Betadomot since %s.", since.Format("January 2"))
+
+	rendered, err := d.email.RenderDigest(subject, intro, sections)
+	if err != nil {
+		return nil, err
+	}
+
+	return &digestContent{
+		Subject:     subject,
+		Content:     services.DigestMarkdown(intro, sections),
+		HTMLContent: rendered.HTML,
+		NewItems:    len(posts) + len(guides) + len(newItems),
+	}, nil
+}
+
+// loadEntries returns the posts or guides published between since and now, most viewed first
+func (d *NewsletterDigest) loadEntries(table, columns string, since, now time.Time) ([]digestEntry, error) {
+	bytes, _, err := d.db.GetClient().From(table).
+		Select(columns, "exact", false).
+		Gte("published_at", since.UTC().Format(time.RFC3339)).
+		Lte("published_at", now.UTC().Format(time.RFC3339)).
+		Order("views", &postgrest.OrderOpts{Ascending: false}).
+		Limit(digestContentLimit, "").
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+	var entries []digestEntry
+	if err := json.Unmarshal(bytes, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (d *NewsletterDigest) entryItems(entries []digestEntry, path string) []services.DigestItem {
+	items := make([]services.DigestItem, 0, len(entries))
+	for _, entry := range entries {
+		summary := entry.Excerpt
+		if summary == "" {
+			summary = entry.Description
+		}
+		meta := ""
+		if entry.Views > 0 {
+			meta = fmt.Sprintf("%d views", entry.Views)
+		}
+		items = append(items, services.DigestItem{
+			Title:   entry.Title,
+			Summary: summary,
+			URL:     d.websiteURL + path + entry.Slug,
+			Image:   entry.FeaturedImage,
+			Meta:    meta,
+		})
+	}
+	return items
+}
+
+// loadNewCollectionItems returns the active products added to a collection since
+// since, newest first, each listed once
+func (d *NewsletterDigest) loadNewCollectionItems(since time.Time) ([]services.DigestItem, error) {
+	client := d.db.GetClient()
+
+	bytes, _, err := client.From("product_collection_items").
+		Select("collection_id,product_id,added_at", "exact", false).
+		Gte("added_at", since.UTC().Format(time.RFC3339)).
+		Order("added_at", nil).
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		CollectionID string `json:"collection_id"`
+		ProductID    string `json:"product_id"`
+	}
+	if err := json.Unmarshal(bytes, &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	productIDs, collectionIDs := []string{}, []string{}
+	for _, row := range rows {
+		productIDs = append(productIDs, row.ProductID)
+		collectionIDs = append(collectionIDs, row.CollectionID)
+	}
+
+	products, err := d.loadProducts(client.From("products").
+		Select("id,slug,name,price,sale_price,images", "exact", false).
+		In("id", productIDs).
+		Eq("active", "true"))
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, _, err = client.From("product_collections").Select("id,name", "exact", false).In("id", collectionIDs).Execute()
+	if err != nil {
+		return nil, err
+	}
+	var collections []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(bytes, &collections); err != nil {
+		return nil, err
+	}
+	collectionNames := make(map[string]string, len(collections))
+	for _, c := range collections {
+		collectionNames[c.ID] = c.Name
+	}
+
+	byID := make(map[string]models.Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+
+	items := []services.DigestItem{}
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		product, ok := byID[row.ProductID]
+		if !ok || seen[product.ID] {
+			continue
+		}
+		seen[product.ID] = true
+
+		item := d.productItem(product)
+		if name := collectionNames[row.CollectionID]; name != "" {
+			item.Meta = fmt.Sprintf("%s · new in %s", item.Meta, name)
+		}
+		items = append(items, item)
+		if len(items) == digestNewItemsLimit {
+			break
+		}
+	}
+	return items, nil
+}
+
+// loadFeaturedProducts returns the featured products not already listed as new
+func (d *NewsletterDigest) loadFeaturedProducts(newItems []services.DigestItem) ([]services.DigestItem, error) {
+	products, err := d.loadProducts(d.db.GetClient().From("products").
+		Select("id,slug,name,price,sale_price,images", "exact", false).
+		Eq("featured", "true").
+		Eq("active", "true").
+		Order("updated_at", nil).
+		Limit(digestFeaturedLimit+len(newItems), ""))
+	if err != nil {
+		return nil, err
+	}
+
+	listed := make(map[string]bool, len(newItems))
+	for _, item := range newItems {
+		listed[item.URL] = true
+	}
+
+	items := []services.DigestItem{}
+	for _, product := range products {
+		item := d.productItem(product)
+		if listed[item.URL] {
+			continue
+		}
+		items = append(items, item)
+		if len(items) == digestFeaturedLimit {
+			break
+		}
+	}
+	return items, nil
+}
+
+func (d *NewsletterDigest) loadProducts(query *postgrest.FilterBuilder) ([]models.Product, error) {
+	bytes, _, err := query.Execute()
+	if err != nil {
+		return nil, err
+	}
+	var products []models.Product
+	if err := json.Unmarshal(bytes, &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (d *NewsletterDigest) productItem(product models.Product) services.DigestItem {
+	price := product.Price
+	if product.SalePrice != nil && *product.SalePrice > 0 && *product.SalePrice < product.Price {
+		price = *product.SalePrice
+	}
+	image := ""
+	if len(product.Images) > 0 {
+		image = product.Images[0]
+	}
+	return services.DigestItem{
+		Title: product.Name,
+		URL:   d.shopURL + "/products/" + product.Slug,
+		Image: image,
+		Meta:  fmt.Sprintf("₦%.2f", price),
+	}
+}
+
+// PreviewDigest handles GET /admin/newsletter/digest?days=
+//
+// Shows what the digest would contain if it ran now, without saving anything.
+func (d *NewsletterDigest) PreviewDigest(w http.ResponseWriter, r *http.Request) {
+	digest, err := d.build(d.requestDays(r), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(digest)
+}
+
+// CreateDigest handles POST /admin/newsletter/digest?days=
+//
+// Saves a digest as a draft campaign outside the schedule. It doesn't count as the
+// week's scheduled digest.
+func (d *NewsletterDigest) CreateDigest(w http.ResponseWriter, r *http.Request) {
+	days := d.requestDays(r)
+	digest, err := d.build(days, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if digest.NewItems == 0 {
+		http.Error(w, fmt.Sprintf("nothing new was published in the last %d days", days), http.StatusConflict)
+		return
+	}
+
+	bytes, _, err := d.db.GetClient().From("newsletters").Insert(map[string]any{
+		"subject":      digest.Subject,
+		"content":      digest.Content,
+		"html_content": digest.HTMLContent,
+		"topics":       []string{},
+		"status":       models.NewsletterStatusDraft,
+	}, false, "", "representation", "").Execute()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var created []models.Newsletter
+	if err := json.Unmarshal(bytes, &created); err != nil || len(created) == 0 {
+		http.Error(w, "Failed to create digest", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created[0])
+}
+
+// requestDays reads the optional days parameter, falling back to the configured window
+func (d *NewsletterDigest) requestDays(r *http.Request) int {
+	if days, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && days > 0 && days <= 90 {
+		return days
+	}
+	return d.days
+}
+
+// parseWeekday parses an English weekday name such as "monday" or "Mon"
+func parseWeekday(day string) (time.Weekday, bool) {
+	day = strings.ToLower(strings.TrimSpace(day))
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		name := strings.ToLower(weekday.String())
+		if day == name || (len(day) >= 3 && strings.HasPrefix(name, day)) {
+			return weekday, true
+		}
+	}
+	return 0, false
+}
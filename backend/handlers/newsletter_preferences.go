@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"blog-backend/services"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gosimple/slug"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// Purposes of the signed tokens in newsletter subscriber links
+const (
+	newsletterUnsubscribePurpose = "newsletter-unsubscribe"
+	newsletterPreferencesPurpose = "newsletter-preferences"
+)
+
+// frequencySlack lets a weekly or monthly subscriber get a newsletter sent a little
+// before the full period is up, so a digest that goes out every Monday isn't skipped
+// because last week's one finished sending a few seconds later
+const frequencySlack = 12 * time.Hour
+
+// NewsletterLinks signs the unsubscribe and preference center links of subscribers
+type NewsletterLinks struct {
+	tokens     *services.TokenSigner
+	backendURL string
+}
+
+// NewNewsletterLinks creates a new newsletter link signer
+func NewNewsletterLinks(tokens *services.TokenSigner, backendURL string) *NewsletterLinks {
+	return &NewsletterLinks{tokens: tokens, backendURL: strings.TrimSuffix(backendURL, "/")}
+}
+
+// For returns the subscriber's links. They don't expire, so unsubscribing from an old
+// newsletter still works.
+func (l *NewsletterLinks) For(email string) services.SubscriberLinks {
+	return services.SubscriberLinks{
+		UnsubscribeURL: l.backendURL + "/newsletter/unsubscribe?token=" + url.QueryEscape(l.tokens.Sign(newsletterUnsubscribePurpose, email, 0)),
+		PreferencesURL: l.backendURL + "/newsletter/preferences?token=" + url.QueryEscape(l.tokens.Sign(newsletterPreferencesPurpose, email, 0)),
+	}
+}
+
+// wantsJSON reports whether a subscriber page request came from the website rather
+// than a browser following a link from an email
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json") ||
+		strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") ||
+		r.URL.Query().Get("format") == "json"
+}
+
+// GetPreferences handles GET /newsletter/preferences?token=
+//
+// Browsers get the preference center form; requests asking for JSON get the settings
+// and the topics to choose from.
+func (h *NewsletterHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	email, err := h.links.tokens.Verify(newsletterPreferencesPurpose, r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, "This preferences link is invalid", http.StatusBadRequest)
+		return
+	}
+
+	prefs, err := h.loadPreferences(email)
+	if err != nil {
+		http.Error(w, "subscriber not found", http.StatusNotFound)
+		return
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(prefs)
+		return
+	}
+	h.renderPreferences(w, r, prefs, "")
+}
+
+// UpdatePreferences handles POST /newsletter/preferences?token=
+//
+// Accepts the preference center form or the same fields as JSON. Unticking subscribed
+// unsubscribes; ticking it again resubscribes someone who had unsubscribed.
+func (h *NewsletterHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	email, err := h.links.tokens.Verify(newsletterPreferencesPurpose, r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, "This preferences link is invalid", http.StatusBadRequest)
+		return
+	}
+
+	var req models.NewsletterPreferences
+	if wantsJSON(r) {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form", http.StatusBadRequest)
+			return
+		}
+		req.Topics = r.PostForm["topics"]
+		req.Frequency = r.PostForm.Get("frequency")
+		req.NoTracking = r.PostForm.Get("no_tracking") == "true"
+		req.Subscribed = r.PostForm.Get("subscribed") == "true"
+	}
+
+	switch req.Frequency {
+	case "":
+		req.Frequency = models.NewsletterFrequencyAll
+	case models.NewsletterFrequencyAll, models.NewsletterFrequencyWeekly, models.NewsletterFrequencyMonthly:
+	default:
+		http.Error(w, "frequency must be all, weekly or monthly", http.StatusBadRequest)
+		return
+	}
+
+	current, err := h.loadPreferences(email)
+	if err != nil {
+		http.Error(w, "subscriber not found", http.StatusNotFound)
+		return
+	}
+
+	// Only keep topics that exist, so a stale form can't store unknown ones
+	known := make(map[string]bool, len(current.Available))
+	for _, topic := range current.Available {
+		known[topic.Slug] = true
+	}
+	topics := []string{}
+	for _, topic := range req.Topics {
+		if known[topic] {
+			topics = append(topics, topic)
+		}
+	}
+
+	update := map[string]any{
+		"topics":           topics,
+		"frequency":        req.Frequency,
+		"tracking_opt_out": req.NoTracking,
+	}
+	if current.Subscribed && !req.Subscribed {
+		update["status"] = "unsubscribed"
+		update["unsubscribed_at"] = time.Now().Format(time.RFC3339)
+	}
+
+	client := h.db.GetClient()
+	if _, _, err := client.From("newsletter_subscribers").Update(update, "minimal", "").Eq("email", email).Execute(); err != nil {
+		http.Error(w, "Failed to save your preferences", http.StatusInternalServerError)
+		return
+	}
+	if !current.Subscribed && req.Subscribed {
+		// Bounced and complained addresses stay suppressed
+		_, _, err := client.From("newsletter_subscribers").
+			Update(map[string]any{"status": "subscribed", "subscribed_at": "now()", "unsubscribed_at": nil}, "minimal", "").
+			Eq("email", email).
+			Eq("status", "unsubscribed").
+			Execute()
+		if err != nil {
+			http.Error(w, "Failed to save your preferences", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	prefs, err := h.loadPreferences(email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(prefs)
+		return
+	}
+	h.renderPreferences(w, r, prefs, "Your preferences are saved.")
+}
+
+func (h *NewsletterHandler) loadPreferences(email string) (*models.NewsletterPreferences, error) {
+	bytes, _, err := h.db.GetClient().From("newsletter_subscribers").
+		Select("email,status,topics,frequency,tracking_opt_out", "exact", false).
+		Eq("email", email).
+		Single().
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+	var subscriber models.NewsletterSubscriber
+	if err := json.Unmarshal(bytes, &subscriber); err != nil {
+		return nil, err
+	}
+
+	available, err := loadNewsletterTopics(h.db)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs := &models.NewsletterPreferences{
+		Email:      subscriber.Email,
+		Subscribed: subscriber.Status == "subscribed",
+		Topics:     subscriber.Topics,
+		Frequency:  subscriber.Frequency,
+		NoTracking: subscriber.TrackingOptOut,
+		Available:  available,
+	}
+	if prefs.Topics == nil {
+		prefs.Topics = []string{}
+	}
+	if prefs.Frequency == "" {
+		prefs.Frequency = models.NewsletterFrequencyAll
+	}
+	return prefs, nil
+}
+
+var preferencesPage = template.Must(template.New("preferences").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Newsletter preferences</title></head>
+<body style="font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; background: #fafafa; color: #000000;">
+	<form method="post" action="{{.Action}}" style="max-width: 480px; margin: 80px auto; background: #ffffff; padding: 40px;">
+		<h1 style="font-weight: 400; font-size: 22px; margin-top: 0;">Newsletter preferences</h1>
+		<p style="font-weight: 300; color: #666666;">{{.Prefs.Email}}</p>
+		{{if .Notice}}<p style="background: #f0f7f0; padding: 10px 14px;">{{.Notice}}</p>{{end}}
+
+		<h2 style="font-weight: 400; font-size: 16px; margin-top: 28px;">Topics</h2>
+		<p style="font-weight: 300; color: #666666; font-size: 14px;">Leave them all unticked to hear about everything.</p>
+		{{range .Topics}}<label style="display: block; margin: 6px 0;"><input type="checkbox" name="topics" value="{{.Slug}}"{{if .Checked}} checked{{end}}> {{.Name}}</label>
+		{{end}}
+
+		<h2 style="font-weight: 400; font-size: 16px; margin-top: 28px;">How often</h2>
+		{{range .Frequencies}}<label style="display: block; margin: 6px 0;"><input type="radio" name="frequency" value="{{.Value}}"{{if .Checked}} checked{{end}}> {{.Label}}</label>
+		{{end}}
+
+		<h2 style="font-weight: 400; font-size: 16px; margin-top: 28px;">Privacy</h2>
+		<label style="display: block; margin: 6px 0;"><input type="checkbox" name="no_tracking" value="true"{{if .Prefs.NoTracking}} checked{{end}}> Don't record when I open emails or click their links</label>
+
+		<h2 style="font-weight: 400; font-size: 16px; margin-top: 28px;">Subscription</h2>
+		<label style="display: block; margin: 6px 0;"><input type="checkbox" name="subscribed" value="true"{{if .Prefs.Subscribed}} checked{{end}}> Send me the Betadomot newsletter</label>
+
+		<button type="submit" style="margin-top: 28px; background: #000000; color: #ffffff; border: 0; padding: 12px 28px; font-size: 14px; cursor: pointer;">Save preferences</button>
+		<p style="margin-top: 28px;"><a href="{{.WebsiteURL}}" style="color: #000000;">Back to Betadomot</a></p>
+	</form>
+</body>
+</html>`))
+
+func (h *NewsletterHandler) renderPreferences(w http.ResponseWriter, r *http.Request, prefs *models.NewsletterPreferences, notice string) {
+	type option struct {
+		Slug, Name, Value, Label string
+		Checked                  bool
+	}
+
+	selected := make(map[string]bool, len(prefs.Topics))
+	for _, topic := range prefs.Topics {
+		selected[topic] = true
+	}
+	topics := make([]option, 0, len(prefs.Available))
+	for _, topic := range prefs.Available {
+		topics = append(topics, option{Slug: topic.Slug, Name: topic.Name, Checked: selected[topic.Slug]})
+	}
+
+	frequencies := []option{
+		{Value: models.NewsletterFrequencyAll, Label: "Every newsletter"},
+		{Value: models.NewsletterFrequencyWeekly, Label: "At most once a week"},
+		{Value: models.NewsletterFrequencyMonthly, Label: "At most once a month"},
+	}
+	for i := range frequencies {
+		frequencies[i].Checked = frequencies[i].Value == prefs.Frequency
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	preferencesPage.Execute(w, map[string]any{
+		"Action":      "?token=" + url.QueryEscape(r.URL.Query().Get("token")),
+		"Prefs":       prefs,
+		"Notice":      notice,
+		"Topics":      topics,
+		"Frequencies": frequencies,
+		"WebsiteURL":  h.websiteURL,
+	})
+}
+
+// loadNewsletterTopics returns the blog categories used by posts and guides, by name
+func loadNewsletterTopics(db *services.DatabaseService) ([]models.NewsletterTopic, error) {
+	seen := make(map[string]bool)
+	topics := []models.NewsletterTopic{}
+
+	for _, table := range []string{"posts", "guides"} {
+		bytes, _, err := db.GetClient().From(table).Select("category", "exact", false).Execute()
+		if err != nil {
+			return nil, err
+		}
+		var rows []map[string]any
+		if err := json.Unmarshal(bytes, &rows); err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			name := strings.TrimSpace(stringField(row, "category"))
+			topic := slug.Make(name)
+			if topic == "" || seen[topic] {
+				continue
+			}
+			seen[topic] = true
+			topics = append(topics, models.NewsletterTopic{Slug: topic, Name: name})
+		}
+	}
+
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Name < topics[j].Name })
+	return topics, nil
+}
+
+// loadNewsletterRecipients returns the active subscribers a campaign about topics goes
+// to, narrowed down to segment when the campaign has one
+func loadNewsletterRecipients(db *services.DatabaseService, topics []string, segment *models.NewsletterSegment) ([]models.NewsletterSubscriber, error) {
+	subscribers, err := selectAll[models.NewsletterSubscriber](func() *postgrest.FilterBuilder {
+		return db.GetClient().From("newsletter_subscribers").
+			Select("email,source,subscribed_at,topics,frequency,last_newsletter_at,tracking_opt_out", "exact", false).
+			Eq("status", "subscribed").
+			Order("email", &postgrest.OrderOpts{Ascending: true})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var matcher *segmentMatcher
+	if segment != nil {
+		if matcher, err = newSegmentMatcher(db, segment); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	recipients := make([]models.NewsletterSubscriber, 0, len(subscribers))
+	for _, subscriber := range subscribers {
+		if matcher != nil && !matcher.matches(subscriber) {
+			continue
+		}
+		if followsTopics(subscriber, topics) && dueNewsletter(subscriber, now) {
+			recipients = append(recipients, subscriber)
+		}
+	}
+	return recipients, nil
+}
+
+// followsTopics reports whether a subscriber wants a campaign about topics. Campaigns
+// without topics go to everyone, and subscribers without topics get everything.
+func followsTopics(subscriber models.NewsletterSubscriber, topics []string) bool {
+	if len(topics) == 0 || len(subscriber.Topics) == 0 {
+		return true
+	}
+	for _, topic := range topics {
+		for _, followed := range subscriber.Topics {
+			if topic == followed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dueNewsletter reports whether a subscriber's frequency allows another newsletter now
+func dueNewsletter(subscriber models.NewsletterSubscriber, now time.Time) bool {
+	if subscriber.LastNewsletter == nil {
+		return true
+	}
+	last := parseFeedTime(*subscriber.LastNewsletter)
+	switch subscriber.Frequency {
+	case models.NewsletterFrequencyWeekly:
+		return now.Sub(last) >= 7*24*time.Hour-frequencySlack
+	case models.NewsletterFrequencyMonthly:
+		return now.Sub(last.AddDate(0, 1, 0)) >= -frequencySlack
+	default:
+		return true
+	}
+}
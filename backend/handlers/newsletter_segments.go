@@ -0,0 +1,484 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"blog-backend/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// Newsletter segment rule types
+const (
+	SegmentSourceIn             = "source_in"
+	SegmentSubscribedWithinDays = "subscribed_within_days"
+	SegmentSubscribedBeforeDays = "subscribed_before_days"
+	SegmentTopicIn              = "topic_in"
+	SegmentOpenedWithinDays     = "opened_within_days"
+	SegmentClickedWithinDays    = "clicked_within_days"
+	SegmentNotOpenedWithinDays  = "not_opened_within_days"
+	SegmentHasPaidOrder         = "has_paid_order"
+	SegmentBoughtCategoryIn     = "bought_category_in"
+)
+
+// segmentPreviewSample is how many matching addresses a preview lists
+const segmentPreviewSample = 20
+
+// SegmentPreviewInput is the payload for POST /admin/newsletter/segments/preview
+//
+// Either segment_id or rules can be given. Topics narrows the count the same way a
+// campaign's topics would.
+type SegmentPreviewInput struct {
+	SegmentID  string               `json:"segment_id"`
+	Rules      []models.SegmentRule `json:"rules"`
+	RulesMatch string               `json:"rules_match"`
+	Topics     []string             `json:"topics"`
+}
+
+// segmentMatcher holds what a segment's rules need beyond the subscriber row, loaded
+// once per evaluation
+type segmentMatcher struct {
+	segment      *models.NewsletterSegment
+	lastOpen     map[string]time.Time
+	lastClick    map[string]time.Time
+	paidOrders   map[string]bool
+	boughtInRule []map[string]bool // Per rule: emails that bought from its categories
+	now          time.Time
+}
+
+// GetSegments handles GET /admin/newsletter/segments
+func (h *NewsletterAdminHandler) GetSegments(w http.ResponseWriter, r *http.Request) {
+	bytes, _, err := h.db.GetClient().From("newsletter_segments").
+		Select("*", "exact", false).
+		Order("name", &postgrest.OrderOpts{Ascending: true}).
+		Execute()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	segments := []models.NewsletterSegment{}
+	if err := json.Unmarshal(bytes, &segments); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(segments)
+}
+
+// GetSegment handles GET /admin/newsletter/segments/{id}
+func (h *NewsletterAdminHandler) GetSegment(w http.ResponseWriter, r *http.Request) {
+	segment, err := loadSegment(h.db, chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "segment not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(segment)
+}
+
+// CreateSegment handles POST /admin/newsletter/segments
+func (h *NewsletterAdminHandler) CreateSegment(w http.ResponseWriter, r *http.Request) {
+	var segment models.NewsletterSegment
+	if err := json.NewDecoder(r.Body).Decode(&segment); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	row, err := segmentRow(segment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bytes, _, err := h.db.GetClient().From("newsletter_segments").Insert(row, false, "", "representation", "").Execute()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var created []models.NewsletterSegment
+	if err := json.Unmarshal(bytes, &created); err != nil || len(created) == 0 {
+		http.Error(w, "Failed to create segment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created[0])
+}
+
+// UpdateSegment handles PUT /admin/newsletter/segments/{id}
+//
+// Campaigns already being sent keep the recipient list they started with.
+func (h *NewsletterAdminHandler) UpdateSegment(w http.ResponseWriter, r *http.Request) {
+	var segment models.NewsletterSegment
+	if err := json.NewDecoder(r.Body).Decode(&segment); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	row, err := segmentRow(segment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	row["updated_at"] = time.Now().Format(time.RFC3339)
+
+	bytes, _, err := h.db.GetClient().From("newsletter_segments").
+		Update(row, "representation", "").
+		Eq("id", chi.URLParam(r, "id")).
+		Execute()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var updated []models.NewsletterSegment
+	if err := json.Unmarshal(bytes, &updated); err != nil || len(updated) == 0 {
+		http.Error(w, "segment not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated[0])
+}
+
+// DeleteSegment handles DELETE /admin/newsletter/segments/{id}
+//
+// Refuses while a draft or scheduled campaign targets the segment, since dropping it
+// would quietly widen that campaign to every subscriber.
+func (h *NewsletterAdminHandler) DeleteSegment(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	client := h.db.GetClient()
+
+	_, inUse, err := client.From("newsletters").
+		Select("id", "exact", true).
+		Eq("segment_id", id).
+		In("status", []string{models.NewsletterStatusDraft, models.NewsletterStatusScheduled, models.NewsletterStatusSending}).
+		Execute()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if inUse > 0 {
+		http.Error(w, fmt.Sprintf("segment is used by %d unsent campaigns", inUse), http.StatusConflict)
+		return
+	}
+
+	bytes, _, err := client.From("newsletter_segments").Delete("representation", "").Eq("id", id).Execute()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var deleted []models.NewsletterSegment
+	if err := json.Unmarshal(bytes, &deleted); err != nil || len(deleted) == 0 {
+		http.Error(w, "segment not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PreviewSegment handles POST /admin/newsletter/segments/preview
+//
+// Returns how many subscribers a campaign to the segment would reach right now, after
+// topic preferences and frequency caps, plus a sample of their addresses.
+func (h *NewsletterAdminHandler) PreviewSegment(w http.ResponseWriter, r *http.Request) {
+	var input SegmentPreviewInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var segment *models.NewsletterSegment
+	if input.SegmentID != "" {
+		loaded, err := loadSegment(h.db, input.SegmentID)
+		if err != nil {
+			http.Error(w, "segment not found", http.StatusNotFound)
+			return
+		}
+		segment = loaded
+	} else {
+		if err := validateSegmentRules(input.Rules, input.RulesMatch); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		segment = &models.NewsletterSegment{Rules: input.Rules, RulesMatch: input.RulesMatch}
+	}
+
+	recipients, err := loadNewsletterRecipients(h.db, input.Topics, segment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sample := []string{}
+	for _, subscriber := range recipients {
+		if len(sample) == segmentPreviewSample {
+			break
+		}
+		sample = append(sample, subscriber.Email)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":  len(recipients),
+		"sample": sample,
+	})
+}
+
+// validateSegmentRules checks a segment's rules before they are saved or previewed
+func validateSegmentRules(rules []models.SegmentRule, match string) error {
+	if match != "" && match != "all" && match != "any" {
+		return fmt.Errorf("rules_match must be \"all\" or \"any\"")
+	}
+	if len(rules) == 0 {
+		return fmt.Errorf("segments need at least one rule")
+	}
+
+	for i, rule := range rules {
+		switch rule.Type {
+		case SegmentSourceIn, SegmentTopicIn, SegmentBoughtCategoryIn:
+			if len(rule.Values) == 0 {
+				return fmt.Errorf("rule %d: %s needs at least one value", i+1, rule.Type)
+			}
+		case SegmentSubscribedWithinDays, SegmentSubscribedBeforeDays,
+			SegmentOpenedWithinDays, SegmentClickedWithinDays, SegmentNotOpenedWithinDays:
+			if rule.Days <= 0 {
+				return fmt.Errorf("rule %d: %s needs a positive number of days", i+1, rule.Type)
+			}
+		case SegmentHasPaidOrder:
+		default:
+			return fmt.Errorf("rule %d: unknown rule type %q", i+1, rule.Type)
+		}
+	}
+	return nil
+}
+
+// segmentRow validates a create or update request and returns the columns to save
+func segmentRow(segment models.NewsletterSegment) (map[string]any, error) {
+	if strings.TrimSpace(segment.Name) == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if err := validateSegmentRules(segment.Rules, segment.RulesMatch); err != nil {
+		return nil, err
+	}
+	if segment.RulesMatch == "" {
+		segment.RulesMatch = "all"
+	}
+	return map[string]any{
+		"name":        strings.TrimSpace(segment.Name),
+		"description": segment.Description,
+		"rules":       segment.Rules,
+		"rules_match": segment.RulesMatch,
+	}, nil
+}
+
+// loadSegment loads a saved segment by ID
+func loadSegment(db *services.DatabaseService, id string) (*models.NewsletterSegment, error) {
+	bytes, _, err := db.GetClient().From("newsletter_segments").
+		Select("*", "exact", false).
+		Eq("id", id).
+		Single().
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+	var segment models.NewsletterSegment
+	if err := json.Unmarshal(bytes, &segment); err != nil {
+		return nil, err
+	}
+	return &segment, nil
+}
+
+// newSegmentMatcher loads the engagement and order data the segment's rules refer to
+func newSegmentMatcher(db *services.DatabaseService, segment *models.NewsletterSegment) (*segmentMatcher, error) {
+	m := &segmentMatcher{
+		segment:      segment,
+		boughtInRule: make([]map[string]bool, len(segment.Rules)),
+		now:          time.Now(),
+	}
+
+	engagementDays, needsOrders := 0, false
+	for _, rule := range segment.Rules {
+		switch rule.Type {
+		case SegmentOpenedWithinDays, SegmentClickedWithinDays, SegmentNotOpenedWithinDays:
+			if rule.Days > engagementDays {
+				engagementDays = rule.Days
+			}
+		case SegmentHasPaidOrder, SegmentBoughtCategoryIn:
+			needsOrders = true
+		}
+	}
+
+	if engagementDays > 0 {
+		if err := m.loadEngagement(db, engagementDays); err != nil {
+			return nil, err
+		}
+	}
+	if needsOrders {
+		if err := m.loadOrders(db); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// loadEngagement indexes each address's latest open and click within the last days
+func (m *segmentMatcher) loadEngagement(db *services.DatabaseService, days int) error {
+	since := m.now.AddDate(0, 0, -days).Format(time.RFC3339)
+	events, err := selectAll[struct {
+		Email     string `json:"email"`
+		EventType string `json:"event_type"`
+		CreatedAt string `json:"created_at"`
+	}](func() *postgrest.FilterBuilder {
+		return db.GetClient().From("newsletter_events").
+			Select("email,event_type,created_at", "exact", false).
+			Gte("created_at", since).
+			Order("id", &postgrest.OrderOpts{Ascending: true})
+	})
+	if err != nil {
+		return err
+	}
+
+	m.lastOpen = make(map[string]time.Time)
+	m.lastClick = make(map[string]time.Time)
+	for _, event := range events {
+		index := m.lastOpen
+		if event.EventType == newsletterEventClick {
+			index = m.lastClick
+		}
+		email := strings.ToLower(event.Email)
+		if at := parseFeedTime(event.CreatedAt); at.After(index[email]) {
+			index[email] = at
+		}
+	}
+	return nil
+}
+
+// loadOrders indexes which addresses have a paid order and, per bought_category_in
+// rule, which of them bought a product from the rule's categories or their children
+func (m *segmentMatcher) loadOrders(db *services.DatabaseService) error {
+	orders, err := selectAll[struct {
+		CustomerEmail string             `json:"customer_email"`
+		Items         []models.OrderItem `json:"items"`
+	}](func() *postgrest.FilterBuilder {
+		return db.GetClient().From("orders").
+			Select("customer_email,items", "exact", false).
+			Eq("payment_status", "success").
+			Order("id", &postgrest.OrderOpts{Ascending: true})
+	})
+	if err != nil {
+		return err
+	}
+
+	m.paidOrders = make(map[string]bool)
+	for _, order := range orders {
+		m.paidOrders[strings.ToLower(order.CustomerEmail)] = true
+	}
+
+	var products map[string]ruleCandidate
+	for i, rule := range m.segment.Rules {
+		if rule.Type != SegmentBoughtCategoryIn {
+			continue
+		}
+		if products == nil {
+			if products, err = loadOrderedProducts(db); err != nil {
+				return err
+			}
+		}
+
+		// Reuse the smart collection category matching, subcategories included
+		categoryRule := models.CollectionRule{Type: RuleCategoryIn, Values: rule.Values}
+		categoryIDs, err := resolveRuleCategories(db, []models.CollectionRule{categoryRule})
+		if err != nil {
+			return err
+		}
+
+		buyers := make(map[string]bool)
+		for _, order := range orders {
+			for _, item := range order.Items {
+				product, ok := products[item.ProductID]
+				if ok && productMatchesRule(product, categoryRule, categoryIDs, m.now) {
+					buyers[strings.ToLower(order.CustomerEmail)] = true
+					break
+				}
+			}
+		}
+		m.boughtInRule[i] = buyers
+	}
+	return nil
+}
+
+// loadOrderedProducts returns every product, archived ones included, by ID
+func loadOrderedProducts(db *services.DatabaseService) (map[string]ruleCandidate, error) {
+	rows, err := selectAll[ruleCandidate](func() *postgrest.FilterBuilder {
+		return db.GetClient().From("products").
+			Select("id,category,category_id", "exact", false).
+			Order("id", &postgrest.OrderOpts{Ascending: true})
+	})
+	if err != nil {
+		return nil, err
+	}
+	products := make(map[string]ruleCandidate, len(rows))
+	for _, row := range rows {
+		products[row.ID] = row
+	}
+	return products, nil
+}
+
+// matches reports whether a subscriber is in the segment. With match "any" one rule
+// has to hold, otherwise all of them.
+func (m *segmentMatcher) matches(subscriber models.NewsletterSubscriber) bool {
+	matchAny := m.segment.RulesMatch == "any"
+	for i, rule := range m.segment.Rules {
+		ok := m.matchesRule(i, rule, subscriber)
+		if matchAny && ok {
+			return true
+		}
+		if !matchAny && !ok {
+			return false
+		}
+	}
+	return !matchAny
+}
+
+func (m *segmentMatcher) matchesRule(i int, rule models.SegmentRule, subscriber models.NewsletterSubscriber) bool {
+	email := strings.ToLower(subscriber.Email)
+	cutoff := m.now.AddDate(0, 0, -rule.Days)
+
+	switch rule.Type {
+	case SegmentSourceIn:
+		for _, source := range rule.Values {
+			if subscriber.Source == source {
+				return true
+			}
+		}
+		return false
+	case SegmentSubscribedWithinDays:
+		return parseFeedTime(subscriber.SubscribedAt).After(cutoff)
+	case SegmentSubscribedBeforeDays:
+		subscribedAt := parseFeedTime(subscriber.SubscribedAt)
+		return !subscribedAt.IsZero() && subscribedAt.Before(cutoff)
+	case SegmentTopicIn:
+		// Subscribers without topics get everything, so they count as following them all
+		return followsTopics(subscriber, rule.Values)
+	case SegmentOpenedWithinDays:
+		return m.lastOpen[email].After(cutoff)
+	case SegmentClickedWithinDays:
+		return m.lastClick[email].After(cutoff)
+	case SegmentNotOpenedWithinDays:
+		// Untracked subscribers never report opens and land here too
+		return !m.lastOpen[email].After(cutoff)
+	case SegmentHasPaidOrder:
+		return m.paidOrders[email]
+	case SegmentBoughtCategoryIn:
+		return m.boughtInRule[i][email]
+	}
+	return false
+}
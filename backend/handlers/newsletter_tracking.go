@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"blog-backend/services"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lib/pq"
+)
+
+// Purposes of the signed tokens in tracked newsletter emails
+const (
+	newsletterOpenPurpose  = "newsletter-open"
+	newsletterClickPurpose = "newsletter-click"
+	trackingOptOutPurpose  = "newsletter-tracking-opt-out"
+)
+
+// Newsletter event types
+const (
+	newsletterEventOpen  = "open"
+	newsletterEventClick = "click"
+)
+
+// trackingUserAgentLength caps the user agent stored with an event
+const trackingUserAgentLength = 500
+
+// trackingPixel is a transparent 1x1 GIF
+var trackingPixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+var (
+	trackedLink = regexp.MustCompile(`(?i)(href\s*=\s*)"(https?://[^"]+)"`)
+	closingBody = regexp.MustCompile(`(?i)</body>`)
+)
+
+// NewsletterTracker instruments newsletter emails with per-recipient tracking and
+// records the opens and clicks they report
+type NewsletterTracker struct {
+	db         *services.DatabaseService
+	tokens     *services.TokenSigner
+	backendURL string
+	websiteURL string
+}
+
+// NewNewsletterTracker creates a new newsletter tracker
+func NewNewsletterTracker(db *services.DatabaseService, tokens *services.TokenSigner, backendURL, websiteURL string) *NewsletterTracker {
+	return &NewsletterTracker{
+		db:         db,
+		tokens:     tokens,
+		backendURL: strings.TrimSuffix(backendURL, "/"),
+		websiteURL: websiteURL,
+	}
+}
+
+// Instrument rewrites a campaign's HTML for one recipient: links go through the click
+// redirector and a tracking pixel and opt-out link are added at the end. Unsubscribe
+// and preference links are left alone so they work even if the redirector doesn't.
+func (t *NewsletterTracker) Instrument(body, newsletterID, email string) string {
+	subject := newsletterID + "|" + email
+
+	body = trackedLink.ReplaceAllStringFunc(body, func(match string) string {
+		parts := trackedLink.FindStringSubmatch(match)
+		target := html.UnescapeString(parts[2])
+		if strings.Contains(target, "/unsubscribe") || strings.HasPrefix(target, t.backendURL+"/t/") ||
+			strings.HasPrefix(target, t.backendURL+"/newsletter/") {
+			return match
+		}
+		token := t.tokens.Sign(newsletterClickPurpose, subject+"|"+target, 0)
+		return fmt.Sprintf(`%s"%s/t/c/%s"`, parts[1], t.backendURL, token)
+	})
+
+	footer := fmt.Sprintf(`<p style="margin: 20px 0 0 0; color: #999; font-size: 11px; text-align: center;">`+
+		`We count opens and clicks to see what readers enjoy. <a href="%s/newsletter/tracking/opt-out?token=%s" style="color: #999;">Stop tracking me</a></p>`+
+		`<img src="%s/t/o/%s" width="1" height="1" alt="" style="display: block; border: 0; width: 1px; height: 1px;">`,
+		t.backendURL, url.QueryEscape(t.tokens.Sign(trackingOptOutPurpose, email, 0)),
+		t.backendURL, t.tokens.Sign(newsletterOpenPurpose, subject, 0))
+
+	if loc := closingBody.FindAllStringIndex(body, -1); len(loc) > 0 {
+		last := loc[len(loc)-1][0]
+		return body[:last] + footer + body[last:]
+	}
+	return body + footer
+}
+
+// TrackOpen handles GET /t/o/{token}
+//
+// Serves the tracking pixel whatever happens, so a bad token never shows a broken image.
+func (t *NewsletterTracker) TrackOpen(w http.ResponseWriter, r *http.Request) {
+	if subject, err := t.tokens.Verify(newsletterOpenPurpose, chi.URLParam(r, "token")); err == nil {
+		if newsletterID, email, ok := strings.Cut(subject, "|"); ok {
+			t.recordEvent(newsletterID, email, newsletterEventOpen, "", r)
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
+	w.Write(trackingPixel)
+}
+
+// TrackClick handles GET /t/c/{token}
+//
+// The destination is part of the signed token, so the redirector can't be used to send
+// people to arbitrary sites.
+func (t *NewsletterTracker) TrackClick(w http.ResponseWriter, r *http.Request) {
+	subject, err := t.tokens.Verify(newsletterClickPurpose, chi.URLParam(r, "token"))
+	if err != nil {
+		http.Error(w, "link not found", http.StatusNotFound)
+		return
+	}
+	parts := strings.SplitN(subject, "|", 3)
+	if len(parts) != 3 {
+		http.Error(w, "link not found", http.StatusNotFound)
+		return
+	}
+
+	t.recordEvent(parts[0], parts[1], newsletterEventClick, parts[2], r)
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, parts[2], http.StatusFound)
+}
+
+// recordEvent stores an open or click unless the subscriber has opted out of tracking
+// since the email was sent. Failures are only logged; the reader still gets the pixel
+// or the redirect.
+func (t *NewsletterTracker) recordEvent(newsletterID, email, eventType, target string, r *http.Request) {
+	if r.Method == http.MethodHead {
+		return
+	}
+	client := t.db.GetClient()
+
+	_, optedOut, err := client.From("newsletter_subscribers").
+		Select("id", "exact", true).
+		Eq("email", email).
+		Eq("tracking_opt_out", "true").
+		Execute()
+	if err != nil || optedOut > 0 {
+		return
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > trackingUserAgentLength {
+		userAgent = userAgent[:trackingUserAgentLength]
+	}
+	event := map[string]any{
+		"newsletter_id": newsletterID,
+		"email":         email,
+		"event_type":    eventType,
+		"user_agent":    userAgent,
+	}
+	if target != "" {
+		event["url"] = target
+	}
+	if _, _, err := client.From("newsletter_events").Insert(event, false, "", "minimal", "").Execute(); err != nil {
+		log.Printf("[Newsletter] Failed to record %s for campaign %s: %v", eventType, newsletterID, err)
+	}
+}
+
+// OptOut handles GET and POST /newsletter/tracking/opt-out?token=
+//
+// GET shows a button that POSTs back, so a link scanner opening the email can't opt
+// the subscriber out. POST turns off open and click tracking for the subscriber, drops
+// the events already recorded for them and recounts the campaigns they were in.
+func (t *NewsletterTracker) OptOut(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	email, err := t.tokens.Verify(trackingOptOutPurpose, token)
+	if err != nil {
+		http.Error(w, "This link is invalid", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Stop tracking</title></head>
+<body style="font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; background: #fafafa; color: #000000;">
+	<form method="post" action="?token=%s" style="max-width: 480px; margin: 80px auto; background: #ffffff; padding: 40px; text-align: center;">
+		<h1 style="font-weight: 400; font-size: 22px;">Stop tracking opens and clicks?</h1>
+		<p style="font-weight: 300; color: #666666;">%s will keep getting our newsletter, but we won't record when it's opened or its links are clicked.</p>
+		<button type="submit" style="background: #000000; color: #ffffff; border: 0; padding: 12px 28px; font-size: 14px; cursor: pointer;">Stop tracking me</button>
+	</form>
+</body>
+</html>`, html.EscapeString(url.QueryEscape(token)), html.EscapeString(email))
+		return
+	}
+
+	client := t.db.GetClient()
+	_, _, err = client.From("newsletter_subscribers").
+		Update(map[string]any{"tracking_opt_out": true}, "minimal", "").
+		Eq("email", email).
+		Execute()
+	if err != nil {
+		http.Error(w, "Failed to update your preferences", http.StatusInternalServerError)
+		return
+	}
+	if err := t.deleteEvents(email); err != nil {
+		log.Printf("[Newsletter] Failed to delete tracking events of an opted-out subscriber: %v", err)
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":  "tracking_off",
+			"message": "Open and click tracking is turned off.",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Tracking turned off</title></head>
+<body style="font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; background: #fafafa; color: #000000;">
+	<div style="max-width: 480px; margin: 80px auto; background: #ffffff; padding: 40px; text-align: center;">
+		<h1 style="font-weight: 400; font-size: 22px;">Tracking turned off</h1>
+		<p style="font-weight: 300; color: #666666;">You'll keep getting our newsletter, but we won't record when you open it or click its links.</p>
+		<a href="%s" style="color: #000000;">Back to Betadomot</a>
+	</div>
+</body>
+</html>`, t.websiteURL)
+}
+
+// deleteEvents drops a subscriber's opens and clicks, then recounts the campaigns they
+// were in, since the counts kept by the insert trigger only ever go up
+func (t *NewsletterTracker) deleteEvents(email string) error {
+	bytes, _, err := t.db.GetClient().From("newsletter_events").
+		Delete("representation", "").
+		Eq("email", email).
+		Execute()
+	if err != nil {
+		return err
+	}
+	var deleted []struct {
+		NewsletterID string `json:"newsletter_id"`
+	}
+	if err := json.Unmarshal(bytes, &deleted); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	var newsletterIDs []string
+	for _, event := range deleted {
+		if !seen[event.NewsletterID] {
+			seen[event.NewsletterID] = true
+			newsletterIDs = append(newsletterIDs, event.NewsletterID)
+		}
+	}
+	if len(newsletterIDs) == 0 {
+		return nil
+	}
+
+	// Run the recount directly when a SQL connection is configured, through PostgREST otherwise
+	if sqlDB := t.db.GetSQLDB(); sqlDB != nil {
+		_, err := sqlDB.Exec(`SELECT recount_newsletter_events($1::uuid[])`, pq.Array(newsletterIDs))
+		return err
+	}
+	result := t.db.GetClient().Rpc("recount_newsletter_events", "", map[string]any{
+		"p_newsletter_ids": newsletterIDs,
+	})
+	if _, err := strconv.Atoi(strings.TrimSpace(result)); err != nil {
+		return fmt.Errorf("recount_newsletter_events failed: %s", result)
+	}
+	return nil
+}
+
+// GetNewsletterEngagement handles GET /admin/newsletters/{id}/engagement
+func (h *NewsletterAdminHandler) GetNewsletterEngagement(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	client := h.db.GetClient()
+
+	newsletter, err := h.loadNewsletter(id)
+	if err != nil {
+		http.Error(w, "newsletter not found", http.StatusNotFound)
+		return
+	}
+
+	_, totalOpens, err := client.From("newsletter_events").
+		Select("id", "exact", true).
+		Eq("newsletter_id", id).
+		Eq("event_type", newsletterEventOpen).
+		Execute()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bytes, _, err := client.From("newsletter_link_clicks").
+		Select("url,clicks,unique_clicks", "exact", false).
+		Eq("newsletter_id", id).
+		Order("clicks", nil).
+		Execute()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	links := []models.NewsletterLinkStats{}
+	if err := json.Unmarshal(bytes, &links); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	engagement := models.NewsletterEngagement{
+		NewsletterID: id,
+		Sent:         newsletter.SentCount,
+		Tracked:      newsletter.TrackedCount,
+		UniqueOpens:  newsletter.OpenCount,
+		TotalOpens:   int(totalOpens),
+		UniqueClicks: newsletter.UniqueClicks,
+		TotalClicks:  newsletter.ClickCount,
+		OpenRate:     engagementRate(newsletter.OpenCount, newsletter.TrackedCount),
+		ClickRate:    engagementRate(newsletter.UniqueClicks, newsletter.TrackedCount),
+		ClickToOpen:  engagementRate(newsletter.UniqueClicks, newsletter.OpenCount),
+		Links:        links,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(engagement)
+}
+
+// engagementRate returns part as a percentage of total, rounded to one decimal
+func engagementRate(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(total)*1000) / 10
+}
@@ -54,9 +54,31 @@ func (h *OrderHandlerSupabase) InitializePayment(w http.ResponseWriter, r *http.
 		return
 	}
 
-	if req.CustomerEmail == "" || req.Total <= 0 || len(req.Items) == 0 {
+	if req.CustomerEmail == "" || len(req.Items) == 0 {
 		log.Println("[Orders] Invalid request: missing required fields")
-		http.Error(w, "Email, total, and items are required", http.StatusBadRequest)
+		http.Error(w, "Email and items are required", http.StatusBadRequest)
+		return
+	}
+	if req.ShippingCost < 0 || req.Tax < 0 {
+		http.Error(w, "Shipping and tax can't be negative", http.StatusBadRequest)
+		return
+	}
+
+	// Resolve the exact option purchased, make sure it is in stock and price it
+	if err := h.resolveOrderVariants(req.Items); err != nil {
+		log.Printf("[Orders] Invalid order items: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The totals the client sent are only what it displayed; charge what the items cost
+	req.Subtotal = 0
+	for _, item := range req.Items {
+		req.Subtotal += item.Subtotal
+	}
+	req.Total = req.Subtotal + req.ShippingCost + req.Tax
+	if req.Total <= 0 {
+		http.Error(w, "Order total must be more than zero", http.StatusBadRequest)
 		return
 	}
 
@@ -313,6 +335,109 @@ func (h *OrderHandlerSupabase) createOrder(req models.CreateOrderRequest, orderN
 	return orderID, nil
 }
 
+// resolveOrderVariants fills in the variant name and SKU of each item and prices it from
+// the product (its sale price when on sale) plus the variant's adjustment, ignoring the
+// price the client sent. Items whose product or variant is unknown, inactive or out of
+// stock are rejected, as are items that omit a variant for a product that has them.
+func (h *OrderHandlerSupabase) resolveOrderVariants(items []models.OrderItem) error {
+	var variantIDs []string
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return fmt.Errorf("quantity for %s must be at least 1", item.Name)
+		}
+		if item.VariantID != "" {
+			variantIDs = append(variantIDs, item.VariantID)
+		} else if item.ProductID == "" {
+			return fmt.Errorf("%s is no longer available", item.Name)
+		}
+	}
+
+	variants, err := loadVariantsByID(h.DB, variantIDs)
+	if err != nil {
+		return fmt.Errorf("failed to load variants: %w", err)
+	}
+
+	var productIDs []string
+	for i := range items {
+		item := &items[i]
+		if item.VariantID == "" {
+			productIDs = append(productIDs, item.ProductID)
+			continue
+		}
+		variant, ok := variants[item.VariantID]
+		if !ok || (item.ProductID != "" && variant.ProductID != item.ProductID) {
+			return fmt.Errorf("the selected option for %s is no longer available", item.Name)
+		}
+		item.ProductID = variant.ProductID
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	productVariants, err := loadProductVariants(h.DB, productIDs)
+	if err != nil {
+		return fmt.Errorf("failed to load variants: %w", err)
+	}
+	products, err := h.loadOrderProducts(productIDs)
+	if err != nil {
+		return fmt.Errorf("failed to load products: %w", err)
+	}
+
+	for i := range items {
+		item := &items[i]
+		product, ok := products[item.ProductID]
+		if !ok || !product.Active {
+			return fmt.Errorf("%s is no longer available", item.Name)
+		}
+		price := product.Price
+		if product.SalePrice != nil && *product.SalePrice > 0 && *product.SalePrice < product.Price {
+			price = *product.SalePrice
+		}
+
+		if item.VariantID == "" {
+			if len(productVariants[item.ProductID]) > 0 {
+				return fmt.Errorf("please choose an option for %s", item.Name)
+			}
+		} else {
+			variant := variants[item.VariantID]
+			if variant.Stock < item.Quantity {
+				return fmt.Errorf("only %d left of %s (%s)", variant.Stock, item.Name, variant.Name)
+			}
+			item.VariantName = variant.Name
+			item.SKU = variant.SKU
+			price += variant.PriceAdjustment
+		}
+
+		item.Price = price
+		item.Subtotal = price * float64(item.Quantity)
+	}
+	return nil
+}
+
+// loadOrderProducts returns the products being ordered keyed by ID, with what's needed
+// to price them
+func (h *OrderHandlerSupabase) loadOrderProducts(productIDs []string) (map[string]models.Product, error) {
+	byID := make(map[string]models.Product)
+	if len(productIDs) == 0 {
+		return byID, nil
+	}
+
+	bytes, _, err := h.DB.GetClient().From("products").
+		Select("id,name,price,sale_price,active", "exact", false).
+		In("id", productIDs).
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+
+	var products []models.Product
+	if err := json.Unmarshal(bytes, &products); err != nil {
+		return nil, err
+	}
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+	return byID, nil
+}
+
 func (h *OrderHandlerSupabase) updatePaystackReference(orderID, paystackReference string) error {
 	client := h.DB.GetClient()
 	updateData := map[string]interface{}{
@@ -391,8 +516,8 @@ func (h *OrderHandlerSupabase) markOrderAsPaid(orderID, paystackReference string
 		"paid_at":            now,
 	}
 
-	_, _, err = client.From("orders").
-		Update(updateData, "", "").
+	updated, _, err := client.From("orders").
+		Update(updateData, "representation", "").
 		Eq("id", orderID).
 		Eq("payment_status", "pending").
 		Execute()
@@ -401,6 +526,18 @@ func (h *OrderHandlerSupabase) markOrderAsPaid(orderID, paystackReference string
 		return err
 	}
 
+	// Another webhook or verify call got here first; stock and email are already handled
+	var updatedRows []map[string]interface{}
+	if json.Unmarshal(updated, &updatedRows) == nil && len(updatedRows) == 0 {
+		log.Printf("[Orders] Order %s was no longer pending, skipping", orderID)
+		return nil
+	}
+
+	// Take purchased items out of stock
+	if order != nil {
+		h.recordOrderSales(order)
+	}
+
 	// Send order confirmation email ONLY if update was successful
 	if order != nil {
 		if h.EmailService == nil {
@@ -436,12 +573,50 @@ func (h *OrderHandlerSupabase) markOrderAsPaid(orderID, paystackReference string
 	return nil
 }
 
+// recordOrderSales takes each item of a paid order out of stock through the inventory
+// ledger and alerts the shop owner about items that just dropped to their reorder threshold
+func (h *OrderHandlerSupabase) recordOrderSales(order *models.Order) {
+	for _, item := range order.Items {
+		if item.ProductID == "" {
+			continue
+		}
+
+		adj := models.StockAdjustment{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Delta:     -item.Quantity,
+			Reason:    models.StockReasonSale,
+			OrderID:   order.ID,
+		}
+		before, after, err := applyStockAdjustment(h.DB, adj)
+		if err != nil {
+			log.Printf("[Orders] Error updating stock for %s: %v", item.Name, err)
+			continue
+		}
+
+		alert, err := lowStockCrossing(h.DB, adj, before, after)
+		if err != nil {
+			log.Printf("[Orders] Error checking reorder threshold for %s: %v", item.Name, err)
+			continue
+		}
+		if alert != nil && h.EmailService != nil {
+			go func(alert services.LowStockItem) {
+				if err := h.EmailService.SendLowStockAlert(alert); err != nil {
+					log.Printf("[Orders] Failed to send low-stock alert for %s: %v", alert.Name, err)
+				}
+			}(*alert)
+		}
+	}
+}
+
 // convertToEmailItems converts order items to email service format
 func convertToEmailItems(items []models.OrderItem) []services.OrderItem {
 	emailItems := make([]services.OrderItem, len(items))
 	for i, item := range items {
 		emailItems[i] = services.OrderItem{
 			Name:     item.Name,
+			Variant:  item.VariantName,
+			SKU:      item.SKU,
 			Quantity: item.Quantity,
 			Price:    item.Price,
 			Image:    item.Image,
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"github.com/supabase-community/postgrest-go"
+)
+
+// selectPageSize is how many rows selectAll asks for at a time. PostgREST returns at
+// most 1000 rows per request, so a plain select silently drops the rest.
+const selectPageSize = 1000
+
+// selectAll runs the select built by query a page at a time and returns every row.
+// query is called once per page and must order on a unique column so pages don't
+// overlap or skip rows.
+func selectAll[T any](query func() *postgrest.FilterBuilder) ([]T, error) {
+	var rows []T
+	for from := 0; ; from += selectPageSize {
+		bytes, _, err := query().Range(from, from+selectPageSize-1, "").Execute()
+		if err != nil {
+			return nil, err
+		}
+		var page []T
+		if err := json.Unmarshal(bytes, &page); err != nil {
+			return nil, err
+		}
+		rows = append(rows, page...)
+		if len(page) < selectPageSize {
+			return rows, nil
+		}
+	}
+}
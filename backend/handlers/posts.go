@@ -14,12 +14,14 @@ import (
 
 // PostHandler handles post-related HTTP requests
 type PostHandler struct {
-	db *services.DatabaseService
+	db     *services.DatabaseService
+	seo    *SEOHandler
+	tokens *services.TokenSigner
 }
 
 // NewPostHandler creates a new post handler
-func NewPostHandler(db *services.DatabaseService) *PostHandler {
-	return &PostHandler{db: db}
+func NewPostHandler(db *services.DatabaseService, seo *SEOHandler, tokens *services.TokenSigner) *PostHandler {
+	return &PostHandler{db: db, seo: seo, tokens: tokens}
 }
 
 // GetPosts handles GET /posts
@@ -159,7 +161,7 @@ func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"slug": uniqueSlug})
 }
 
-// GetPost handles GET /posts/{slug}
+// GetPost handles GET /posts/{slug}?seo=true
 func (h *PostHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 	slug := chi.URLParam(r, "slug")
 	client := h.db.GetClient()
@@ -176,92 +178,20 @@ func (h *PostHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Increment view count asynchronously
-	if v, ok := post["views"].(float64); ok {
-		newVal := int(v) + 1
-		go func() {
-			_, _, _ = client.From("posts").Update(map[string]any{"views": newVal}, "minimal", "").Eq("slug", slug).Execute()
-		}()
-		post["views"] = newVal
-	}
+	// Increment view count atomically
+	recordContentView(h.db, "post", slug, post)
 
 	// Ensure claps field exists in response
 	if _, ok := post["claps"]; !ok {
 		post["claps"] = 0
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(post)
-}
-
-// ClapPost handles POST /posts/{slug}/clap - increments the claps counter
-func (h *PostHandler) ClapPost(w http.ResponseWriter, r *http.Request) {
-	slug := chi.URLParam(r, "slug")
-	client := h.db.GetClient()
-
-	// Read current claps
-	bytes, _, err := client.From("posts").Select("claps", "exact", false).Eq("slug", slug).Single().Execute()
-	if err != nil {
-		http.Error(w, "post not found", http.StatusNotFound)
-		return
-	}
-
-	var row map[string]any
-	if err := json.Unmarshal(bytes, &row); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	var current int
-	switch v := row["claps"].(type) {
-	case float64:
-		current = int(v)
-	case int:
-		current = v
-	default:
-		current = 0
-	}
-
-	newVal := current + 1
-
-	if _, _, err := client.From("posts").Update(map[string]any{"claps": newVal}, "minimal", "").Eq("slug", slug).Execute(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"claps": newVal})
-}
-
-// GetClaps handles GET /posts/{slug}/claps - returns current claps count
-func (h *PostHandler) GetClaps(w http.ResponseWriter, r *http.Request) {
-	slug := chi.URLParam(r, "slug")
-	client := h.db.GetClient()
-
-	bytes, _, err := client.From("posts").Select("claps", "exact", false).Eq("slug", slug).Single().Execute()
-	if err != nil {
-		http.Error(w, "post not found", http.StatusNotFound)
-		return
-	}
-
-	var row map[string]any
-	if err := json.Unmarshal(bytes, &row); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	var claps int
-	switch v := row["claps"].(type) {
-	case float64:
-		claps = int(v)
-	case int:
-		claps = v
-	default:
-		claps = 0
+	if wantsSEO(r) {
+		post["seo"] = h.seo.ArticleSEO("post", post)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"claps": claps})
+	json.NewEncoder(w).Encode(post)
 }
 
 // SetFeaturedHero handles POST /posts/{slug}/featured-hero - sets a post as the featured hero
@@ -0,0 +1,673 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// productCSVColumns is the column order used by CSV export and expected by CSV import.
+// List columns (images, tags) are pipe-separated; variants is a JSON array.
+var productCSVColumns = []string{
+	"sku", "slug", "name", "description", "price", "sale_price", "images", "category", "tags",
+	"stock", "weight", "dimensions", "featured", "active", "product_type", "editorial_note",
+	"external_link", "availability_status", "variants", "shipping_info", "return_policy",
+	"care_instructions", "reorder_threshold",
+}
+
+// maxImportSize bounds the size of an uploaded import file
+const maxImportSize = 10 << 20
+
+// ProductImportRow is one product in an import or export file
+type ProductImportRow struct {
+	SKU                string                  `json:"sku"`
+	Slug               string                  `json:"slug"`
+	Name               string                  `json:"name"`
+	Description        string                  `json:"description"`
+	Price              float64                 `json:"price"`
+	SalePrice          *float64                `json:"sale_price,omitempty"`
+	Images             []string                `json:"images"`
+	Category           string                  `json:"category"`
+	Tags               []string                `json:"tags"`
+	Stock              int                     `json:"stock"`
+	Weight             float64                 `json:"weight"`
+	Dimensions         string                  `json:"dimensions"`
+	Featured           bool                    `json:"featured"`
+	Active             bool                    `json:"active"`
+	ProductType        string                  `json:"product_type"`
+	EditorialNote      string                  `json:"editorial_note,omitempty"`
+	ExternalLink       string                  `json:"external_link,omitempty"`
+	AvailabilityStatus string                  `json:"availability_status,omitempty"`
+	Variants           []models.ProductVariant `json:"variants,omitempty"`
+	ShippingInfo       string                  `json:"shipping_info,omitempty"`
+	ReturnPolicy       string                  `json:"return_policy,omitempty"`
+	CareInstructions   string                  `json:"care_instructions,omitempty"`
+	ReorderThreshold   *int                    `json:"reorder_threshold,omitempty"`
+
+	// columns are the fields the file gave for this row, nil when it gave them all.
+	// Updating an existing product only writes these.
+	columns map[string]bool
+}
+
+// ProductImportResult reports what happened (or would happen, in a dry run) to one row
+type ProductImportResult struct {
+	Row    int      `json:"row"`
+	SKU    string   `json:"sku"`
+	Slug   string   `json:"slug"`
+	Action string   `json:"action"` // create, update, error
+	Errors []string `json:"errors,omitempty"`
+}
+
+// ImportProducts handles POST /admin/products/import
+//
+// Accepts a multipart upload in the "file" field or a raw request body. The format is
+// taken from ?format=csv|json, then the file extension, then the Content-Type.
+// Pass ?dry_run=true to validate without writing anything.
+func (h *ProductHandler) ImportProducts(w http.ResponseWriter, r *http.Request) {
+	data, filename, err := readImportUpload(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := importFormat(r, filename)
+	dryRun := r.URL.Query().Get("dry_run") == "true" || r.URL.Query().Get("dry_run") == "1"
+
+	var rows []ProductImportRow
+	var results []ProductImportResult
+	switch format {
+	case "csv":
+		rows, results, err = parseProductCSV(data)
+	case "json":
+		rows, results, err = parseProductJSON(data)
+	default:
+		err = fmt.Errorf("unsupported import format, use csv or json")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	existing, err := h.loadProductKeys()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	seenSKUs := make(map[string]int)
+	seenSlugs := make(map[string]int)
+	client := h.db.GetClient()
+	summary := map[string]int{"create": 0, "update": 0, "error": 0}
+
+	for i := range rows {
+		row := &rows[i]
+		result := &results[i]
+
+		if row.Slug == "" && row.Name != "" {
+			row.Slug = generateSlug(row.Name)
+		}
+		result.SKU = row.SKU
+		result.Slug = row.Slug
+
+		result.Errors = append(result.Errors, validateImportRow(*row)...)
+		if row.SKU != "" {
+			if prev, ok := seenSKUs[row.SKU]; ok {
+				result.Errors = append(result.Errors, fmt.Sprintf("duplicate sku, also on row %d", prev))
+			}
+			seenSKUs[row.SKU] = result.Row
+		}
+		if row.Slug != "" {
+			if prev, ok := seenSlugs[row.Slug]; ok {
+				result.Errors = append(result.Errors, fmt.Sprintf("duplicate slug, also on row %d", prev))
+			}
+			seenSlugs[row.Slug] = result.Row
+		}
+
+		// Match on SKU first, falling back to slug
+		id, matched := existing.bySKU[row.SKU]
+		if row.SKU == "" || !matched {
+			id, matched = existing.bySlug[row.Slug]
+		}
+		if matched && row.Slug != "" {
+			if owner, ok := existing.bySlug[row.Slug]; ok && owner != id {
+				result.Errors = append(result.Errors, "slug belongs to a different product")
+			}
+		}
+
+		if len(result.Errors) > 0 {
+			result.Action = "error"
+			summary["error"]++
+			continue
+		}
+
+		if matched {
+			result.Action = "update"
+		} else {
+			result.Action = "create"
+		}
+
+		if !dryRun {
+			productData := importRowData(*row)
+			now := time.Now().Format(time.RFC3339)
+			productData["updated_at"] = now
+
+			if matched {
+				if row.SKU == "" {
+					row.SKU = existing.skuByID[id]
+				}
+				// Columns missing from the file keep their current values
+				if row.columns != nil {
+					for column := range productData {
+						if !row.columns[column] && column != "updated_at" {
+							delete(productData, column)
+						}
+					}
+				}
+				_, _, err = client.From("products").Update(productData, "minimal", "").Eq("id", id).Execute()
+				if err == nil && (row.columns == nil || row.columns["stock"]) {
+					err = setStockLevel(h.db, id, "", row.Stock, models.StockReasonManualCorrection, "Product import")
+				}
+			} else {
+				if row.SKU == "" {
+					row.SKU = generateSKU()
+					productData["sku"] = row.SKU
+					result.SKU = row.SKU
+				}
+				id = uuid.New().String()
+				productData["id"] = id
+				productData["created_at"] = now
+				productData["stock"] = 0
+				_, _, err = client.From("products").Insert(productData, false, "", "", "").Execute()
+				if err == nil {
+					err = setStockLevel(h.db, id, "", row.Stock, models.StockReasonRestock, "Product import")
+				}
+			}
+			// A row without variants leaves the product's existing variants alone
+			if err == nil && row.Variants != nil {
+				err = syncProductVariants(h.db, variantProduct{ID: id, SKU: row.SKU, Price: row.Price}, row.Variants)
+			}
+			if err != nil {
+				result.Action = "error"
+				result.Errors = append(result.Errors, err.Error())
+				summary["error"]++
+				continue
+			}
+			if matched {
+				h.backInStock.NotifyRestocked(id)
+			}
+		}
+		summary[result.Action]++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dry_run": dryRun,
+		"format":  format,
+		"summary": summary,
+		"rows":    results,
+	})
+}
+
+// ExportProducts handles GET /admin/products/export?format=csv|json
+func (h *ProductHandler) ExportProducts(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		http.Error(w, "format must be csv or json", http.StatusBadRequest)
+		return
+	}
+
+	client := h.db.GetClient()
+	products, err := selectAll[models.Product](func() *postgrest.FilterBuilder {
+		return client.From("products").
+			Select("*", "exact", false).
+			Order("created_at", nil).
+			Order("id", nil)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	productIDs := make([]string, len(products))
+	for i, p := range products {
+		productIDs[i] = p.ID
+	}
+	variants, err := loadProductVariants(h.db, productIDs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rows := make([]ProductImportRow, len(products))
+	for i, p := range products {
+		rows[i] = ProductImportRow{
+			SKU:                p.SKU,
+			Slug:               p.Slug,
+			Name:               p.Name,
+			Description:        p.Description,
+			Price:              p.Price,
+			SalePrice:          p.SalePrice,
+			Images:             p.Images,
+			Category:           p.Category,
+			Tags:               p.Tags,
+			Stock:              p.Stock,
+			Weight:             p.Weight,
+			Dimensions:         p.Dimensions,
+			Featured:           p.Featured,
+			Active:             p.Active,
+			ProductType:        p.ProductType,
+			EditorialNote:      p.EditorialNote,
+			ExternalLink:       p.ExternalLink,
+			AvailabilityStatus: p.AvailabilityStatus,
+			Variants:           variants[p.ID],
+			ShippingInfo:       p.ShippingInfo,
+			ReturnPolicy:       p.ReturnPolicy,
+			CareInstructions:   p.CareInstructions,
+			ReorderThreshold:   p.ReorderThreshold,
+		}
+	}
+
+	filename := fmt.Sprintf("products_%s.%s", time.Now().Format("2006-01-02"), format)
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rows)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	writer := csv.NewWriter(w)
+	writer.Write(productCSVColumns)
+	for _, row := range rows {
+		writer.Write(productCSVRecord(row))
+	}
+	writer.Flush()
+}
+
+// productKeys maps the identifying fields of existing products to their IDs
+type productKeys struct {
+	bySKU   map[string]string
+	bySlug  map[string]string
+	skuByID map[string]string
+}
+
+func (h *ProductHandler) loadProductKeys() (*productKeys, error) {
+	rows, err := selectAll[struct {
+		ID   string `json:"id"`
+		SKU  string `json:"sku"`
+		Slug string `json:"slug"`
+	}](func() *postgrest.FilterBuilder {
+		return h.db.GetClient().From("products").
+			Select("id,sku,slug", "exact", false).
+			Order("id", &postgrest.OrderOpts{Ascending: true})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &productKeys{
+		bySKU:   make(map[string]string),
+		bySlug:  make(map[string]string),
+		skuByID: make(map[string]string),
+	}
+	for _, row := range rows {
+		if row.SKU != "" {
+			keys.bySKU[row.SKU] = row.ID
+		}
+		keys.skuByID[row.ID] = row.SKU
+		keys.bySlug[row.Slug] = row.ID
+	}
+	return keys, nil
+}
+
+// readImportUpload returns the uploaded file contents and its name, if any
+func readImportUpload(w http.ResponseWriter, r *http.Request) ([]byte, string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			return nil, "", fmt.Errorf("failed to parse form: %w", err)
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get file from form")
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read file")
+		}
+		return data, header.Filename, nil
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read request body")
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, "", fmt.Errorf("import file is empty")
+	}
+	return data, "", nil
+}
+
+func importFormat(r *http.Request, filename string) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return strings.ToLower(format)
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return "csv"
+	case ".json":
+		return "json"
+	}
+	contentType := r.Header.Get("Content-Type")
+	if strings.Contains(contentType, "json") {
+		return "json"
+	}
+	return "csv"
+}
+
+// parseProductJSON decodes a JSON array of rows. Row numbers start at 1.
+func parseProductJSON(data []byte) ([]ProductImportRow, []ProductImportResult, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON, expected an array of products: %w", err)
+	}
+
+	rows := make([]ProductImportRow, len(raw))
+	results := make([]ProductImportResult, len(raw))
+	for i, item := range raw {
+		results[i].Row = i + 1
+		rows[i].Active = true // Same default as a blank CSV cell
+		if err := json.Unmarshal(item, &rows[i]); err != nil {
+			results[i].Errors = append(results[i].Errors, fmt.Sprintf("invalid product: %v", err))
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(item, &fields); err == nil {
+			rows[i].columns = make(map[string]bool, len(fields))
+			for name := range fields {
+				rows[i].columns[name] = true
+			}
+		}
+	}
+	return rows, results, nil
+}
+
+// parseProductCSV decodes a CSV file with a header row. Unknown columns are ignored,
+// and row numbers match the spreadsheet (the header is row 1).
+func parseProductCSV(data []byte) ([]ProductImportRow, []ProductImportResult, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	given := make(map[string]bool, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+		given[name] = true
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, nil, fmt.Errorf("CSV must have a name column")
+	}
+
+	var rows []ProductImportRow
+	var results []ProductImportResult
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("row %d: %w", line, err)
+		}
+
+		row, errs := productFromCSVRecord(record, columns)
+		row.columns = given
+		rows = append(rows, row)
+		results = append(results, ProductImportResult{Row: line, Errors: errs})
+	}
+	return rows, results, nil
+}
+
+func productFromCSVRecord(record []string, columns map[string]int) (ProductImportRow, []string) {
+	var errs []string
+	get := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	parseFloat := func(name string) float64 {
+		value := get(name)
+		if value == "" {
+			return 0
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %q is not a number", name, value))
+		}
+		return f
+	}
+	parseBool := func(name string, fallback bool) bool {
+		value := strings.ToLower(get(name))
+		switch value {
+		case "":
+			return fallback
+		case "true", "yes", "1", "y":
+			return true
+		case "false", "no", "0", "n":
+			return false
+		}
+		errs = append(errs, fmt.Sprintf("%s: %q is not true or false", name, value))
+		return fallback
+	}
+
+	row := ProductImportRow{
+		SKU:                get("sku"),
+		Slug:               get("slug"),
+		Name:               get("name"),
+		Description:        get("description"),
+		Price:              parseFloat("price"),
+		Images:             splitList(get("images")),
+		Category:           get("category"),
+		Tags:               splitList(get("tags")),
+		Weight:             parseFloat("weight"),
+		Dimensions:         get("dimensions"),
+		Featured:           parseBool("featured", false),
+		Active:             parseBool("active", true),
+		ProductType:        get("product_type"),
+		EditorialNote:      get("editorial_note"),
+		ExternalLink:       get("external_link"),
+		AvailabilityStatus: get("availability_status"),
+		ShippingInfo:       get("shipping_info"),
+		ReturnPolicy:       get("return_policy"),
+		CareInstructions:   get("care_instructions"),
+	}
+
+	if value := get("sale_price"); value != "" {
+		salePrice := parseFloat("sale_price")
+		row.SalePrice = &salePrice
+	}
+	if value := get("stock"); value != "" {
+		stock, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("stock: %q is not a whole number", value))
+		}
+		row.Stock = stock
+	}
+	if value := get("reorder_threshold"); value != "" {
+		threshold, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("reorder_threshold: %q is not a whole number", value))
+		}
+		row.ReorderThreshold = &threshold
+	}
+	if value := get("variants"); value != "" {
+		if err := json.Unmarshal([]byte(value), &row.Variants); err != nil {
+			errs = append(errs, fmt.Sprintf("variants: invalid JSON: %v", err))
+		}
+	}
+
+	return row, errs
+}
+
+func productCSVRecord(row ProductImportRow) []string {
+	salePrice := ""
+	if row.SalePrice != nil {
+		salePrice = strconv.FormatFloat(*row.SalePrice, 'f', -1, 64)
+	}
+	variants := ""
+	if len(row.Variants) > 0 {
+		encoded, _ := json.Marshal(row.Variants)
+		variants = string(encoded)
+	}
+	threshold := ""
+	if row.ReorderThreshold != nil {
+		threshold = strconv.Itoa(*row.ReorderThreshold)
+	}
+
+	return []string{
+		row.SKU,
+		row.Slug,
+		row.Name,
+		row.Description,
+		strconv.FormatFloat(row.Price, 'f', -1, 64),
+		salePrice,
+		strings.Join(row.Images, "|"),
+		row.Category,
+		strings.Join(row.Tags, "|"),
+		strconv.Itoa(row.Stock),
+		strconv.FormatFloat(row.Weight, 'f', -1, 64),
+		row.Dimensions,
+		strconv.FormatBool(row.Featured),
+		strconv.FormatBool(row.Active),
+		row.ProductType,
+		row.EditorialNote,
+		row.ExternalLink,
+		row.AvailabilityStatus,
+		variants,
+		row.ShippingInfo,
+		row.ReturnPolicy,
+		row.CareInstructions,
+		threshold,
+	}
+}
+
+// splitList splits a pipe-separated cell, dropping empty entries
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, "|") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// validateImportRow applies the same rules as CreateProduct plus checks on enums and URLs
+func validateImportRow(row ProductImportRow) []string {
+	var errs []string
+	if row.Name == "" {
+		errs = append(errs, "name is required")
+	}
+	if row.Price <= 0 {
+		errs = append(errs, "price must be greater than zero")
+	}
+	if row.SalePrice != nil && (*row.SalePrice < 0 || *row.SalePrice >= row.Price) {
+		errs = append(errs, "sale_price must be below price")
+	}
+	if row.Stock < 0 {
+		errs = append(errs, "stock cannot be negative")
+	}
+	switch row.ProductType {
+	case "", "editorial", "everyday":
+	default:
+		errs = append(errs, "product_type must be editorial or everyday")
+	}
+	switch row.AvailabilityStatus {
+	case "", "available", "limited", "reference", "sold_out":
+	default:
+		errs = append(errs, "availability_status must be available, limited, reference or sold_out")
+	}
+	for _, image := range row.Images {
+		if u, err := url.Parse(image); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("images: %q is not an http(s) URL", image))
+		}
+	}
+	for i, variant := range row.Variants {
+		if err := validateVariant(variant, row.SKU, row.Variants[:i]); err != nil {
+			errs = append(errs, fmt.Sprintf("variants[%d]: %v", i, err))
+		}
+	}
+	return errs
+}
+
+// importRowData builds the products row written for an import, with the same
+// defaults CreateProduct applies
+func importRowData(row ProductImportRow) map[string]interface{} {
+	availabilityStatus := row.AvailabilityStatus
+	if availabilityStatus == "" {
+		availabilityStatus = "available"
+	}
+	productType := row.ProductType
+	if productType == "" {
+		productType = "everyday"
+	}
+	images := row.Images
+	if images == nil {
+		images = []string{}
+	}
+	tags := row.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	data := map[string]interface{}{
+		"slug":                row.Slug,
+		"name":                row.Name,
+		"description":         row.Description,
+		"price":               row.Price,
+		"sale_price":          row.SalePrice,
+		"images":              images,
+		"category":            row.Category,
+		"tags":                tags,
+		"weight":              row.Weight,
+		"dimensions":          row.Dimensions,
+		"featured":            row.Featured,
+		"active":              row.Active,
+		"product_type":        productType,
+		"editorial_note":      row.EditorialNote,
+		"external_link":       row.ExternalLink,
+		"availability_status": availabilityStatus,
+		"shipping_info":       row.ShippingInfo,
+		"return_policy":       row.ReturnPolicy,
+		"care_instructions":   row.CareInstructions,
+		"reorder_threshold":   row.ReorderThreshold,
+	}
+	if row.SKU != "" {
+		data["sku"] = row.SKU
+	}
+	return data
+}
@@ -0,0 +1,452 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"blog-backend/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// variantProduct holds the product fields variants are derived from
+type variantProduct struct {
+	ID    string  `json:"id"`
+	SKU   string  `json:"sku"`
+	Price float64 `json:"price"`
+	Stock int     `json:"stock"`
+}
+
+// GetProductVariants handles GET /products/{slug}/variants
+func (h *ProductHandler) GetProductVariants(w http.ResponseWriter, r *http.Request) {
+	product, err := h.getVariantProduct(chi.URLParam(r, "slug"))
+	if err != nil {
+		http.Error(w, "product not found", http.StatusNotFound)
+		return
+	}
+
+	variants, err := loadProductVariants(h.db, []string{product.ID})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(withVariantPrices(variants[product.ID], product.Price))
+}
+
+// CreateVariant handles POST /admin/products/{slug}/variants
+func (h *ProductHandler) CreateVariant(w http.ResponseWriter, r *http.Request) {
+	product, err := h.getVariantProduct(chi.URLParam(r, "slug"))
+	if err != nil {
+		http.Error(w, "product not found", http.StatusNotFound)
+		return
+	}
+
+	var variant models.ProductVariant
+	if err := json.NewDecoder(r.Body).Decode(&variant); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	// New variants go to the end of the list
+	existing, err := loadProductVariants(h.db, []string{product.ID})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := validateVariant(variant, product.SKU, existing[product.ID]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	variant.ID = uuid.New().String()
+	variant.ProductID = product.ID
+	row := variantRow(product, variant, len(existing[product.ID]))
+	row["id"] = variant.ID
+	row["product_id"] = product.ID
+
+	client := h.db.GetClient()
+	if _, _, err := client.From("product_variants").Insert(row, false, "", "minimal", "").Execute(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create variant: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := setStockLevel(h.db, product.ID, variant.ID, variant.Stock, models.StockReasonRestock, "Initial stock"); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	sku, _ := row["sku"].(string)
+	json.NewEncoder(w).Encode(map[string]string{"status": "created", "id": variant.ID, "sku": sku})
+}
+
+// UpdateVariant handles PUT /admin/products/{slug}/variants/{variantId}
+func (h *ProductHandler) UpdateVariant(w http.ResponseWriter, r *http.Request) {
+	variantID := chi.URLParam(r, "variantId")
+
+	product, err := h.getVariantProduct(chi.URLParam(r, "slug"))
+	if err != nil {
+		http.Error(w, "product not found", http.StatusNotFound)
+		return
+	}
+
+	var variant models.ProductVariant
+	if err := json.NewDecoder(r.Body).Decode(&variant); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	existing, err := loadProductVariants(h.db, []string{product.ID})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	position := -1
+	var siblings []models.ProductVariant
+	for i, v := range existing[product.ID] {
+		if v.ID == variantID {
+			position = i
+			continue
+		}
+		siblings = append(siblings, v)
+	}
+	if position < 0 {
+		http.Error(w, "variant not found", http.StatusNotFound)
+		return
+	}
+	if err := validateVariant(variant, product.SKU, siblings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client := h.db.GetClient()
+	_, _, err = client.From("product_variants").
+		Update(variantRow(product, variant, position), "minimal", "").
+		Eq("id", variantID).
+		Execute()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := setStockLevel(h.db, product.ID, variantID, variant.Stock, models.StockReasonManualCorrection, "Variant edit"); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.backInStock.NotifyRestocked(product.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
+}
+
+// DeleteVariant handles DELETE /admin/products/{slug}/variants/{variantId}
+func (h *ProductHandler) DeleteVariant(w http.ResponseWriter, r *http.Request) {
+	variantID := chi.URLParam(r, "variantId")
+
+	product, err := h.getVariantProduct(chi.URLParam(r, "slug"))
+	if err != nil {
+		http.Error(w, "product not found", http.StatusNotFound)
+		return
+	}
+
+	client := h.db.GetClient()
+	bytes, _, err := client.From("product_variants").
+		Delete("representation", "").
+		Eq("id", variantID).
+		Eq("product_id", product.ID).
+		Execute()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var deleted []models.ProductVariant
+	if err := json.Unmarshal(bytes, &deleted); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(deleted) == 0 {
+		http.Error(w, "variant not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+// ReorderVariants handles PUT /admin/products/{slug}/variants/order
+func (h *ProductHandler) ReorderVariants(w http.ResponseWriter, r *http.Request) {
+	product, err := h.getVariantProduct(chi.URLParam(r, "slug"))
+	if err != nil {
+		http.Error(w, "product not found", http.StatusNotFound)
+		return
+	}
+
+	var req models.ReorderVariantsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := loadProductVariants(h.db, []string{product.ID})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The new order must name every variant of the product exactly once
+	known := make(map[string]bool, len(existing[product.ID]))
+	for _, v := range existing[product.ID] {
+		known[v.ID] = true
+	}
+	if len(req.VariantIDs) != len(known) {
+		http.Error(w, "variant_ids must list every variant of the product", http.StatusBadRequest)
+		return
+	}
+	for _, id := range req.VariantIDs {
+		if !known[id] {
+			http.Error(w, fmt.Sprintf("unknown or repeated variant %s", id), http.StatusBadRequest)
+			return
+		}
+		delete(known, id)
+	}
+
+	client := h.db.GetClient()
+	for i, id := range req.VariantIDs {
+		_, _, err := client.From("product_variants").
+			Update(map[string]interface{}{"display_order": i}, "minimal", "").
+			Eq("id", id).
+			Execute()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "reordered"})
+}
+
+func (h *ProductHandler) getVariantProduct(slug string) (*variantProduct, error) {
+	bytes, _, err := h.db.GetClient().From("products").
+		Select("id,sku,price,stock", "exact", false).
+		Eq("slug", slug).
+		Single().
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+
+	var product variantProduct
+	if err := json.Unmarshal(bytes, &product); err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// writeProductsWithVariants writes a JSON array of product rows with each product's
+// variants from product_variants in place of the legacy variants column, and with
+// the seo block when includeSEO is set
+func (h *ProductHandler) writeProductsWithVariants(w http.ResponseWriter, productsBytes []byte, includeSEO bool) {
+	var products []map[string]interface{}
+	if err := json.Unmarshal(productsBytes, &products); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ids := make([]string, 0, len(products))
+	for _, p := range products {
+		if id, ok := p["id"].(string); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	variants, err := loadProductVariants(h.db, ids)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, p := range products {
+		id, _ := p["id"].(string)
+		price, _ := p["price"].(float64)
+		p["variants"] = withVariantPrices(variants[id], price)
+		if includeSEO {
+			p["seo"] = h.seo.ProductSEO(p, variants[id])
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(products)
+}
+
+// variantLookupBatch is how many product ids loadProductVariants puts in one request
+const variantLookupBatch = 200
+
+// loadProductVariants returns the variants of the given products keyed by product ID
+func loadProductVariants(db *services.DatabaseService, productIDs []string) (map[string][]models.ProductVariant, error) {
+	byProduct := make(map[string][]models.ProductVariant)
+	if len(productIDs) == 0 {
+		return byProduct, nil
+	}
+
+	// Exports ask for every product; keep each request's id list to a sane URL length
+	for start := 0; start < len(productIDs); start += variantLookupBatch {
+		batch := productIDs[start:min(start+variantLookupBatch, len(productIDs))]
+		variants, err := selectAll[models.ProductVariant](func() *postgrest.FilterBuilder {
+			return db.GetClient().From("product_variants").
+				Select("*", "exact", false).
+				In("product_id", batch).
+				Order("display_order", &postgrest.OrderOpts{Ascending: true}).
+				Order("id", &postgrest.OrderOpts{Ascending: true})
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range variants {
+			byProduct[v.ProductID] = append(byProduct[v.ProductID], v)
+		}
+	}
+	return byProduct, nil
+}
+
+// loadVariantsByID returns the given variants keyed by variant ID
+func loadVariantsByID(db *services.DatabaseService, variantIDs []string) (map[string]models.ProductVariant, error) {
+	byID := make(map[string]models.ProductVariant)
+	if len(variantIDs) == 0 {
+		return byID, nil
+	}
+
+	bytes, _, err := db.GetClient().From("product_variants").
+		Select("*", "exact", false).
+		In("id", variantIDs).
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []models.ProductVariant
+	if err := json.Unmarshal(bytes, &variants); err != nil {
+		return nil, err
+	}
+
+	for _, v := range variants {
+		byID[v.ID] = v
+	}
+	return byID, nil
+}
+
+// withVariantPrices fills in each variant's effective price from the product's base price
+func withVariantPrices(variants []models.ProductVariant, basePrice float64) []models.ProductVariant {
+	priced := make([]models.ProductVariant, len(variants))
+	for i, v := range variants {
+		v.Price = basePrice + v.PriceAdjustment
+		priced[i] = v
+	}
+	return priced
+}
+
+// syncProductVariants makes the product's variants match the given list. Variants
+// with a known ID are updated in place so order items keep pointing at them, new
+// ones are created, and variants missing from the list are deleted.
+func syncProductVariants(db *services.DatabaseService, product variantProduct, variants []models.ProductVariant) error {
+	existing, err := loadProductVariants(db, []string{product.ID})
+	if err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool)
+	for _, v := range existing[product.ID] {
+		keep[v.ID] = false
+	}
+
+	client := db.GetClient()
+	for i, v := range variants {
+		row := variantRow(&product, v, i)
+		if _, ok := keep[v.ID]; ok {
+			keep[v.ID] = true
+			if _, _, err := client.From("product_variants").Update(row, "minimal", "").Eq("id", v.ID).Execute(); err != nil {
+				return fmt.Errorf("failed to update variant %s: %w", v.Name, err)
+			}
+			if err := setStockLevel(db, product.ID, v.ID, v.Stock, models.StockReasonManualCorrection, "Product edit"); err != nil {
+				return fmt.Errorf("failed to update stock of variant %s: %w", v.Name, err)
+			}
+			continue
+		}
+
+		id := uuid.New().String()
+		row["id"] = id
+		row["product_id"] = product.ID
+		if _, _, err := client.From("product_variants").Insert(row, false, "", "minimal", "").Execute(); err != nil {
+			return fmt.Errorf("failed to create variant %s: %w", v.Name, err)
+		}
+		if err := setStockLevel(db, product.ID, id, v.Stock, models.StockReasonRestock, "Initial stock"); err != nil {
+			return fmt.Errorf("failed to set stock of variant %s: %w", v.Name, err)
+		}
+	}
+
+	for id, kept := range keep {
+		if kept {
+			continue
+		}
+		if _, _, err := client.From("product_variants").Delete("", "").Eq("id", id).Execute(); err != nil {
+			return fmt.Errorf("failed to delete variant %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// variantRow builds the product_variants columns for a variant at the given position.
+// Stock is left out: it only changes through the inventory ledger.
+func variantRow(product *variantProduct, v models.ProductVariant, position int) map[string]interface{} {
+	variantType := v.Type
+	if variantType == "" {
+		variantType = "other"
+	}
+
+	// sku is unique, so a variant without one stores NULL rather than ""
+	var sku interface{}
+	if full := product.SKU + v.SKUSuffix; full != "" {
+		sku = full
+	}
+
+	return map[string]interface{}{
+		"name":              v.Name,
+		"type":              variantType,
+		"sku_suffix":        v.SKUSuffix,
+		"sku":               sku,
+		"price_adjustment":  v.PriceAdjustment,
+		"image_index":       v.ImageIndex,
+		"reorder_threshold": v.ReorderThreshold,
+		"display_order":     position,
+		"updated_at":        time.Now().Format(time.RFC3339),
+	}
+}
+
+// validateVariant checks a variant of the product with the given SKU. siblings are the
+// product's other variants, whose full SKUs the variant must not repeat.
+func validateVariant(v models.ProductVariant, productSKU string, siblings []models.ProductVariant) error {
+	if v.Name == "" {
+		return fmt.Errorf("variant name is required")
+	}
+	if v.Stock < 0 {
+		return fmt.Errorf("variant stock cannot be negative")
+	}
+	switch v.Type {
+	case "", "size", "color", "material", "other":
+	default:
+		return fmt.Errorf("variant type must be size, color, material or other")
+	}
+	if productSKU+v.SKUSuffix != "" {
+		for _, sibling := range siblings {
+			if sibling.SKUSuffix == v.SKUSuffix {
+				return fmt.Errorf("variant %s has the same sku_suffix %q as %s", v.Name, v.SKUSuffix, sibling.Name)
+			}
+		}
+	}
+	return nil
+}
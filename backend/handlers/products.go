@@ -16,12 +16,14 @@ import (
 
 // ProductHandler handles product-related HTTP requests
 type ProductHandler struct {
-	db *services.DatabaseService
+	db          *services.DatabaseService
+	backInStock *BackInStockHandler
+	seo         *SEOHandler
 }
 
 // NewProductHandler creates a new product handler
-func NewProductHandler(db *services.DatabaseService) *ProductHandler {
-	return &ProductHandler{db: db}
+func NewProductHandler(db *services.DatabaseService, backInStock *BackInStockHandler, seo *SEOHandler) *ProductHandler {
+	return &ProductHandler{db: db, backInStock: backInStock, seo: seo}
 }
 
 // GetProducts handles GET /products
@@ -58,29 +60,27 @@ func (h *ProductHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	jsonStr, _, err := query.Order("created_at", nil).ExecuteString()
+	productsBytes, _, err := query.Order("created_at", nil).Execute()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(jsonStr))
+	h.writeProductsWithVariants(w, productsBytes, false)
 }
 
-// GetProduct handles GET /products/{slug}
+// GetProduct handles GET /products/{slug}?seo=true
 func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 	slug := chi.URLParam(r, "slug")
 
 	client := h.db.GetClient()
-	jsonStr, _, err := client.From("products").Select("*", "exact", false).Eq("slug", slug).Eq("active", "true").ExecuteString()
+	productsBytes, _, err := client.From("products").Select("*", "exact", false).Eq("slug", slug).Eq("active", "true").Execute()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(jsonStr))
+	h.writeProductsWithVariants(w, productsBytes, wantsSEO(r))
 }
 
 // CreateProduct handles POST /admin/products
@@ -105,6 +105,13 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 		req.SKU = generateSKU()
 	}
 
+	for i, variant := range req.Variants {
+		if err := validateVariant(variant, req.SKU, req.Variants[:i]); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	now := time.Now().Format(time.RFC3339)
 
 	// Set default availability_status if empty
@@ -119,8 +126,9 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 		productType = "everyday"
 	}
 
+	productID := uuid.New().String()
 	product := map[string]interface{}{
-		"id":          uuid.New().String(),
+		"id":          productID,
 		"slug":        slug,
 		"name":        req.Name,
 		"description": req.Description,
@@ -129,7 +137,7 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 		"images":      req.Images,
 		"category":    req.Category,
 		"tags":        req.Tags,
-		"stock":       req.Stock,
+		"stock":       0,
 		"sku":         req.SKU,
 		"weight":      req.Weight,
 		"dimensions":  req.Dimensions,
@@ -142,10 +150,10 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 		"editorial_note":      req.EditorialNote,
 		"external_link":       req.ExternalLink,
 		"availability_status": availabilityStatus,
-		"variants":            req.Variants,
 		"shipping_info":       req.ShippingInfo,
 		"return_policy":       req.ReturnPolicy,
 		"care_instructions":   req.CareInstructions,
+		"reorder_threshold":   req.ReorderThreshold,
 	}
 
 	client := h.db.GetClient()
@@ -157,6 +165,20 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Opening stock goes through the ledger like every other stock movement
+	if err := setStockLevel(h.db, productID, "", req.Stock, models.StockReasonRestock, "Initial stock"); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(req.Variants) > 0 {
+		variantOwner := variantProduct{ID: productID, SKU: req.SKU, Price: req.Price}
+		if err := syncProductVariants(h.db, variantOwner, req.Variants); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "created", "slug": slug})
 }
@@ -177,6 +199,19 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	for i, variant := range req.Variants {
+		if err := validateVariant(variant, req.SKU, req.Variants[:i]); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	existing, err := h.getVariantProduct(slug)
+	if err != nil {
+		http.Error(w, "product not found", http.StatusNotFound)
+		return
+	}
+
 	now := time.Now().Format(time.RFC3339)
 
 	// Set default availability_status if empty
@@ -199,7 +234,6 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		"images":      req.Images,
 		"category":    req.Category,
 		"tags":        req.Tags,
-		"stock":       req.Stock,
 		"sku":         req.SKU,
 		"weight":      req.Weight,
 		"dimensions":  req.Dimensions,
@@ -211,19 +245,42 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		"editorial_note":      req.EditorialNote,
 		"external_link":       req.ExternalLink,
 		"availability_status": availabilityStatus,
-		"variants":            req.Variants,
 		"shipping_info":       req.ShippingInfo,
 		"return_policy":       req.ReturnPolicy,
 		"care_instructions":   req.CareInstructions,
+		"reorder_threshold":   req.ReorderThreshold,
 	}
 
 	client := h.db.GetClient()
-	_, _, err := client.From("products").Update(updateData, "minimal", "").Eq("slug", slug).Execute()
+	_, _, err = client.From("products").Update(updateData, "minimal", "").Eq("slug", slug).Execute()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if err := setStockLevel(h.db, existing.ID, "", req.Stock, models.StockReasonManualCorrection, "Product edit"); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Omitting variants leaves them as they are, but their full SKUs still follow the product SKU
+	variants := req.Variants
+	if variants == nil {
+		current, err := loadProductVariants(h.db, []string{existing.ID})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		variants = current[existing.ID]
+	}
+	variantOwner := variantProduct{ID: existing.ID, SKU: req.SKU, Price: req.Price}
+	if err := syncProductVariants(h.db, variantOwner, variants); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.backInStock.NotifyRestocked(existing.ID)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
 }
@@ -246,14 +303,13 @@ func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 // GetAdminProducts handles GET /admin/products
 func (h *ProductHandler) GetAdminProducts(w http.ResponseWriter, r *http.Request) {
 	client := h.db.GetClient()
-	jsonStr, _, err := client.From("products").Select("*", "exact", false).Order("created_at", nil).ExecuteString()
+	productsBytes, _, err := client.From("products").Select("*", "exact", false).Order("created_at", nil).Execute()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(jsonStr))
+	h.writeProductsWithVariants(w, productsBytes, false)
 }
 
 // Helper functions
@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"blog-backend/services"
+	"encoding/json"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// seoDescriptionLength is roughly what search engines show of a meta description
+const seoDescriptionLength = 160
+
+// seoCurrency is the ISO 4217 code product prices are in
+const seoCurrency = "NGN"
+
+// seoTables maps the item types admins can override to their tables
+var seoTables = map[string]string{
+	"posts":    "posts",
+	"guides":   "guides",
+	"products": "products",
+}
+
+// SEOHandler builds the seo block for posts, guides and products and stores the
+// per-item overrides admins set
+type SEOHandler struct {
+	db         *services.DatabaseService
+	websiteURL string
+	shopURL    string
+}
+
+// NewSEOHandler creates a new SEO handler
+func NewSEOHandler(db *services.DatabaseService, websiteURL string) *SEOHandler {
+	shopURL := os.Getenv("SHOP_URL")
+	if shopURL == "" {
+		shopURL = "http://localhost:3001"
+	}
+	return &SEOHandler{
+		db:         db,
+		websiteURL: strings.TrimSuffix(websiteURL, "/"),
+		shopURL:    strings.TrimSuffix(shopURL, "/"),
+	}
+}
+
+// wantsSEO reports whether the request asked for the seo block with ?seo=true
+func wantsSEO(r *http.Request) bool {
+	value := r.URL.Query().Get("seo")
+	return value == "true" || value == "1"
+}
+
+// UpdateSEOOverrides handles PUT /admin/seo/{type}/{slug} for posts, guides and products
+//
+// The body replaces the item's overrides; send {} to go back to the generated values.
+func (h *SEOHandler) UpdateSEOOverrides(w http.ResponseWriter, r *http.Request) {
+	table, ok := seoTables[chi.URLParam(r, "type")]
+	if !ok {
+		http.Error(w, "type must be posts, guides or products", http.StatusBadRequest)
+		return
+	}
+	slug := chi.URLParam(r, "slug")
+
+	var overrides models.SEOOverrides
+	if err := json.NewDecoder(r.Body).Decode(&overrides); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	bytes, _, err := h.db.GetClient().From(table).
+		Update(map[string]any{"seo_overrides": overrides}, "representation", "").
+		Eq("slug", slug).
+		Execute()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var updated []map[string]any
+	if err := json.Unmarshal(bytes, &updated); err != nil || len(updated) == 0 {
+		http.Error(w, "item not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(overrides)
+}
+
+// ArticleSEO builds the seo block for a post or guide row, with an Article as JSON-LD
+func (h *SEOHandler) ArticleSEO(kind string, item map[string]any) models.SEO {
+	title := stringField(item, "title")
+	summary := stringField(item, "excerpt")
+	canonical := h.websiteURL + "/blog/" + stringField(item, "slug")
+	if kind == "guide" {
+		summary = stringField(item, "description")
+		canonical = h.websiteURL + "/guides/" + stringField(item, "slug")
+	}
+	if summary == "" {
+		summary = stringField(item, "content")
+	}
+	description := seoDescription(summary)
+	image := stringField(item, "featured_image")
+
+	published := stringField(item, "published_at")
+	modified := stringField(item, "updated_at")
+	if modified == "" {
+		modified = published
+	}
+
+	article := map[string]any{
+		"@context":         "https://schema.org",
+		"@type":            "Article",
+		"headline":         title,
+		"description":      description,
+		"mainEntityOfPage": canonical,
+		"author":           map[string]any{"@type": "Organization", "name": feedSiteName, "url": h.websiteURL},
+		"publisher":        map[string]any{"@type": "Organization", "name": feedSiteName, "url": h.websiteURL},
+	}
+	if image != "" {
+		article["image"] = []string{image}
+	}
+	if published != "" {
+		article["datePublished"] = published
+		article["dateModified"] = modified
+	}
+	if category := stringField(item, "category"); category != "" {
+		article["articleSection"] = category
+	}
+	if tags, ok := item["tags"].([]any); ok && len(tags) > 0 {
+		keywords := make([]string, 0, len(tags))
+		for _, tag := range tags {
+			if s, ok := tag.(string); ok && s != "" {
+				keywords = append(keywords, s)
+			}
+		}
+		article["keywords"] = strings.Join(keywords, ", ")
+	}
+
+	seo := buildSEO("article", title, description, canonical, image, article)
+	return applySEOOverrides(seo, item["seo_overrides"])
+}
+
+// ProductSEO builds the seo block for a product row, with a Product and Offer as JSON-LD
+func (h *SEOHandler) ProductSEO(product map[string]any, variants []models.ProductVariant) models.SEO {
+	name := stringField(product, "name")
+	canonical := h.shopURL + "/products/" + stringField(product, "slug")
+	description := seoDescription(stringField(product, "description"))
+
+	var images []string
+	if list, ok := product["images"].([]any); ok {
+		for _, image := range list {
+			if s, ok := image.(string); ok && s != "" {
+				images = append(images, s)
+			}
+		}
+	}
+	image := ""
+	if len(images) > 0 {
+		image = images[0]
+	}
+
+	price, _ := product["price"].(float64)
+	offer := map[string]any{
+		"@type":         "Offer",
+		"url":           canonical,
+		"priceCurrency": seoCurrency,
+		"price":         price,
+		"itemCondition": "https://schema.org/NewCondition",
+		"availability":  schemaAvailability(product, variants),
+	}
+	if salePrice, ok := product["sale_price"].(float64); ok && salePrice > 0 && salePrice < price {
+		offer["price"] = salePrice
+		offer["priceSpecification"] = map[string]any{
+			"@type":         "UnitPriceSpecification",
+			"priceType":     "https://schema.org/StrikethroughPrice",
+			"price":         price,
+			"priceCurrency": seoCurrency,
+		}
+	}
+	if external := stringField(product, "external_link"); external != "" {
+		offer["url"] = external
+	}
+
+	jsonLD := map[string]any{
+		"@context":    "https://schema.org",
+		"@type":       "Product",
+		"name":        name,
+		"description": description,
+		"url":         canonical,
+		"offers":      offer,
+		"brand":       map[string]any{"@type": "Brand", "name": feedSiteName},
+	}
+	if len(images) > 0 {
+		jsonLD["image"] = images
+	}
+	if sku := stringField(product, "sku"); sku != "" {
+		jsonLD["sku"] = sku
+	}
+	if category := stringField(product, "category"); category != "" {
+		jsonLD["category"] = category
+	}
+
+	seo := buildSEO("product", name, description, canonical, image, jsonLD)
+	return applySEOOverrides(seo, product["seo_overrides"])
+}
+
+// schemaAvailability maps a product's availability_status, and for shop products its
+// stock, to a schema.org ItemAvailability
+func schemaAvailability(product map[string]any, variants []models.ProductVariant) string {
+	switch stringField(product, "availability_status") {
+	case "sold_out":
+		return "https://schema.org/SoldOut"
+	case "limited":
+		return "https://schema.org/LimitedAvailability"
+	case "reference":
+		// Reference pieces are shown for inspiration and can't be bought
+		return "https://schema.org/Discontinued"
+	}
+
+	// Editorial products are sold elsewhere, so our stock says nothing about them
+	if stringField(product, "product_type") == "editorial" {
+		return "https://schema.org/InStock"
+	}
+
+	stock, _ := product["stock"].(float64)
+	inStock := stock > 0
+	for _, v := range variants {
+		if v.Stock > 0 {
+			inStock = true
+		}
+	}
+	if !inStock {
+		return "https://schema.org/OutOfStock"
+	}
+	return "https://schema.org/InStock"
+}
+
+func buildSEO(ogType, title, description, canonical, image string, jsonLD map[string]any) models.SEO {
+	fullTitle := title
+	if title != "" {
+		fullTitle = title + " | " + feedSiteName
+	}
+	card := "summary"
+	if image != "" {
+		card = "summary_large_image"
+	}
+	return models.SEO{
+		Title:       fullTitle,
+		Description: description,
+		Canonical:   canonical,
+		OpenGraph: models.OpenGraph{
+			Type:        ogType,
+			Title:       title,
+			Description: description,
+			URL:         canonical,
+			Image:       image,
+			SiteName:    feedSiteName,
+		},
+		Twitter: models.TwitterCard{
+			Card:        card,
+			Title:       title,
+			Description: description,
+			Image:       image,
+		},
+		JSONLD: jsonLD,
+	}
+}
+
+// applySEOOverrides replaces generated fields with the ones an admin set. raw is the
+// seo_overrides column as decoded from the row.
+func applySEOOverrides(seo models.SEO, raw any) models.SEO {
+	if raw == nil {
+		return seo
+	}
+	bytes, err := json.Marshal(raw)
+	if err != nil {
+		return seo
+	}
+	var o models.SEOOverrides
+	if err := json.Unmarshal(bytes, &o); err != nil {
+		return seo
+	}
+
+	if o.Title != "" {
+		seo.Title = o.Title
+		seo.OpenGraph.Title = o.Title
+		seo.Twitter.Title = o.Title
+	}
+	if o.Description != "" {
+		seo.Description = o.Description
+		seo.OpenGraph.Description = o.Description
+		seo.Twitter.Description = o.Description
+		seo.JSONLD["description"] = o.Description
+	}
+	if o.Canonical != "" {
+		// The structured data has to name the same page as the canonical link
+		for _, key := range []string{"url", "mainEntityOfPage"} {
+			if _, ok := seo.JSONLD[key]; ok {
+				seo.JSONLD[key] = o.Canonical
+			}
+		}
+		if offer, ok := seo.JSONLD["offers"].(map[string]any); ok && offer["url"] == seo.Canonical {
+			offer["url"] = o.Canonical
+		}
+		seo.Canonical = o.Canonical
+		seo.OpenGraph.URL = o.Canonical
+	}
+	if o.Image != "" {
+		seo.OpenGraph.Image = o.Image
+		seo.Twitter.Image = o.Image
+		seo.Twitter.Card = "summary_large_image"
+		seo.JSONLD["image"] = []string{o.Image}
+	}
+	if o.OGTitle != "" {
+		seo.OpenGraph.Title = o.OGTitle
+	}
+	if o.OGDescription != "" {
+		seo.OpenGraph.Description = o.OGDescription
+	}
+	if o.TwitterTitle != "" {
+		seo.Twitter.Title = o.TwitterTitle
+	}
+	if o.TwitterDescription != "" {
+		seo.Twitter.Description = o.TwitterDescription
+	}
+	if o.NoIndex {
+		seo.Robots = "noindex, follow"
+	}
+	for key, value := range o.JSONLD {
+		seo.JSONLD[key] = value
+	}
+	return seo
+}
+
+var markdownSyntax = regexp.MustCompile("[#*_>`~]+|!?\\[([^\\]]*)\\]\\([^)]*\\)")
+
+// seoDescription turns markdown into a plain-text description cut at a word boundary
+func seoDescription(text string) string {
+	text = markdownSyntax.ReplaceAllStringFunc(text, func(match string) string {
+		if sub := markdownSyntax.FindStringSubmatch(match); len(sub) > 1 && sub[1] != "" {
+			return sub[1]
+		}
+		return ""
+	})
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= seoDescriptionLength {
+		return text
+	}
+
+	runes := []rune(text)[:seoDescriptionLength]
+	cut := string(runes)
+	if i := strings.LastIndex(cut, " "); i > seoDescriptionLength/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
+
+// stringField reads a string column from a decoded row, treating null as empty
+func stringField(row map[string]any, key string) string {
+	s, _ := row[key].(string)
+	return s
+}
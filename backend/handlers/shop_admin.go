@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"blog-backend/models"
 	"blog-backend/services"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -44,12 +46,25 @@ func (h *ShopAdminHandler) CreateCategory(w http.ResponseWriter, r *http.Request
 		"description": input.Description,
 		"image_url":   input.ImageURL,
 		"is_featured": input.IsFeatured,
+		"path":        input.Slug,
 		"created_at":  time.Now(),
 		"updated_at":  time.Now(),
 	}
 	
 	if input.ParentID != "" {
+		categories, err := loadCategories(h.db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		paths := categoryPaths(categories)
+		parentPath, ok := paths[input.ParentID]
+		if !ok {
+			http.Error(w, "Parent category not found", http.StatusBadRequest)
+			return
+		}
 		data["parent_id"] = input.ParentID
+		data["path"] = parentPath + "/" + input.Slug
 	}
 
 	jsonStr, _, err := client.From("product_categories").
@@ -74,6 +89,19 @@ func (h *ShopAdminHandler) UpdateCategory(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	categories, err := loadCategories(h.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	byID := indexCategories(categories)
+	current, ok := byID[id]
+	if !ok {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
 	client := h.db.GetClient()
 	
 	data := map[string]interface{}{
@@ -86,6 +114,14 @@ func (h *ShopAdminHandler) UpdateCategory(w http.ResponseWriter, r *http.Request
 	}
 	
 	if input.ParentID != "" {
+		if _, ok := byID[input.ParentID]; !ok {
+			http.Error(w, "Parent category not found", http.StatusBadRequest)
+			return
+		}
+		if wouldCreateCategoryCycle(byID, id, input.ParentID) {
+			http.Error(w, "A category cannot be moved under itself or one of its descendants", http.StatusBadRequest)
+			return
+		}
 		data["parent_id"] = input.ParentID
 	}
 
@@ -99,6 +135,17 @@ func (h *ShopAdminHandler) UpdateCategory(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Reparenting or renaming the slug changes the path of the whole subtree
+	current.Slug = input.Slug
+	if input.ParentID != "" {
+		parentID := input.ParentID
+		current.ParentID = &parentID
+	}
+	if err := syncCategoryPaths(h.db, categories, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(jsonStr))
 }
@@ -124,12 +171,39 @@ func (h *ShopAdminHandler) DeleteCategory(w http.ResponseWriter, r *http.Request
 // Collection Management
 
 type CollectionInput struct {
-	Name         string `json:"name"`
-	Slug         string `json:"slug"`
-	Description  string `json:"description"`
-	ImageURL     string `json:"image_url"`
-	IsFeatured   bool   `json:"is_featured"`
-	DisplayOrder int    `json:"display_order"`
+	Name           string                  `json:"name"`
+	Slug           string                  `json:"slug"`
+	Description    string                  `json:"description"`
+	ImageURL       string                  `json:"image_url"`
+	IsFeatured     bool                    `json:"is_featured"`
+	DisplayOrder   int                     `json:"display_order"`
+	CollectionType string                  `json:"collection_type"` // "manual" (default) or "smart"
+	Rules          []models.CollectionRule `json:"rules"`
+	RulesMatch     string                  `json:"rules_match"` // "all" (default) or "any"
+}
+
+// applyCollectionRules validates the smart collection fields of input and adds them to data
+func applyCollectionRules(input CollectionInput, data map[string]interface{}) error {
+	switch input.CollectionType {
+	case "", CollectionTypeManual:
+		data["collection_type"] = CollectionTypeManual
+		data["rules"] = nil
+		data["rules_match"] = "all"
+	case CollectionTypeSmart:
+		if err := validateCollectionRules(input.Rules, input.RulesMatch); err != nil {
+			return err
+		}
+		match := input.RulesMatch
+		if match == "" {
+			match = "all"
+		}
+		data["collection_type"] = CollectionTypeSmart
+		data["rules"] = input.Rules
+		data["rules_match"] = match
+	default:
+		return fmt.Errorf("collection_type must be \"manual\" or \"smart\"")
+	}
+	return nil
 }
 
 func (h *ShopAdminHandler) GetCollections(w http.ResponseWriter, r *http.Request) {
@@ -190,6 +264,11 @@ func (h *ShopAdminHandler) CreateCollection(w http.ResponseWriter, r *http.Reque
 		"updated_at":    time.Now(),
 	}
 
+	if err := applyCollectionRules(input, data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	jsonStr, _, err := client.From("product_collections").
 		Insert(data, false, "", "", "").
 		ExecuteString()
@@ -226,6 +305,11 @@ func (h *ShopAdminHandler) UpdateCollection(w http.ResponseWriter, r *http.Reque
 		"updated_at":    time.Now(),
 	}
 
+	if err := applyCollectionRules(input, data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	jsonStr, _, err := client.From("product_collections").
 		Update(data, "", "").
 		Eq("id", id).
@@ -278,6 +362,29 @@ func (h *ShopAdminHandler) AddProductToCollection(w http.ResponseWriter, r *http
 	println("Adding product to collection:", input.ProductID, "->", collectionID)
 
 	client := h.db.GetClient()
+
+	// Smart collection membership comes from its rules, not from items
+	collectionStr, _, err := client.From("product_collections").
+		Select("collection_type", "exact", false).
+		Eq("id", collectionID).
+		ExecuteString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var collections []map[string]interface{}
+	if err := json.Unmarshal([]byte(collectionStr), &collections); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(collections) == 0 {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	if collections[0]["collection_type"] == CollectionTypeSmart {
+		http.Error(w, "Products cannot be added manually to a smart collection", http.StatusConflict)
+		return
+	}
 	
 	// Check if product already exists in collection
 	existingStr, _, err := client.From("product_collection_items").
@@ -343,9 +450,9 @@ func (h *ShopAdminHandler) GetCollectionProducts(w http.ResponseWriter, r *http.
 
 	client := h.db.GetClient()
 	
-	// First get collection ID
+	// First get the collection
 	collectionStr, _, err := client.From("product_collections").
-		Select("id", "exact", false).
+		Select("id,collection_type,rules,rules_match", "exact", false).
 		Eq("slug", slug).
 		ExecuteString()
 
@@ -354,7 +461,12 @@ func (h *ShopAdminHandler) GetCollectionProducts(w http.ResponseWriter, r *http.
 		return
 	}
 
-	var collections []map[string]interface{}
+	var collections []struct {
+		ID             string                  `json:"id"`
+		CollectionType string                  `json:"collection_type"`
+		Rules          []models.CollectionRule `json:"rules"`
+		RulesMatch     string                  `json:"rules_match"`
+	}
 	if err := json.Unmarshal([]byte(collectionStr), &collections); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -365,12 +477,24 @@ func (h *ShopAdminHandler) GetCollectionProducts(w http.ResponseWriter, r *http.
 		return
 	}
 
-	collectionID := collections[0]["id"].(string)
+	collection := collections[0]
+
+	// Smart collections are evaluated against the catalog at query time
+	if collection.CollectionType == CollectionTypeSmart {
+		products, err := evaluateCollectionRules(h.db, collection.Rules, collection.RulesMatch)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(products)
+		return
+	}
 
 	// Get product IDs from junction table
 	junctionStr, _, err := client.From("product_collection_items").
 		Select("product_id", "exact", false).
-		Eq("collection_id", collectionID).
+		Eq("collection_id", collection.ID).
 		Order("display_order", nil).
 		ExecuteString()
 
@@ -397,17 +521,37 @@ func (h *ShopAdminHandler) GetCollectionProducts(w http.ResponseWriter, r *http.
 		productIDs[i] = record["product_id"].(string)
 	}
 
-	// Fetch products - note: this is simplified, in production you'd want to use IN clause
-	productsStr, _, err := client.From("products").
+	productsBytes, _, err := client.From("products").
 		Select("*", "exact", false).
+		In("id", productIDs).
 		Eq("active", "true").
-		ExecuteString()
+		Execute()
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	var productRows []map[string]interface{}
+	if err := json.Unmarshal(productsBytes, &productRows); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Keep the curated display order of the collection items
+	byID := make(map[string]map[string]interface{}, len(productRows))
+	for _, row := range productRows {
+		if id, ok := row["id"].(string); ok {
+			byID[id] = row
+		}
+	}
+	products := make([]map[string]interface{}, 0, len(productRows))
+	for _, id := range productIDs {
+		if row, ok := byID[id]; ok {
+			products = append(products, row)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(productsStr))
+	json.NewEncoder(w).Encode(products)
 }
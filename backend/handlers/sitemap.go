@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"blog-backend/services"
+	"bytes"
+	"encoding/xml"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// sitemapTTL bounds how long a cached sitemap is served. Writes invalidate it straight
+// away; the TTL picks up posts whose published_at has since passed.
+const sitemapTTL = time.Hour
+
+// sitemapNames are the child sitemaps listed in the index, in order
+var sitemapNames = []string{"posts", "guides", "products", "categories", "collections"}
+
+// SitemapHandler serves the sitemap index and its child sitemaps from a cache that is
+// rebuilt lazily after content changes
+type SitemapHandler struct {
+	db         *services.DatabaseService
+	websiteURL string
+	shopURL    string
+	backendURL string
+
+	mu          sync.Mutex
+	generatedAt time.Time
+	sitemaps    map[string]*renderedSitemap
+}
+
+// renderedSitemap is a cached sitemap document
+type renderedSitemap struct {
+	body    []byte
+	lastmod time.Time
+}
+
+// NewSitemapHandler creates a new sitemap handler
+func NewSitemapHandler(db *services.DatabaseService, websiteURL, backendURL string) *SitemapHandler {
+	shopURL := os.Getenv("SHOP_URL")
+	if shopURL == "" {
+		shopURL = "http://localhost:3001"
+	}
+	return &SitemapHandler{
+		db:         db,
+		websiteURL: strings.TrimSuffix(websiteURL, "/"),
+		shopURL:    strings.TrimSuffix(shopURL, "/"),
+		backendURL: strings.TrimSuffix(backendURL, "/"),
+	}
+}
+
+// GetSitemapIndex handles GET /sitemap.xml. The sitemaps list blog and shop pages from
+// the backend's host, so the blog and shop robots.txt must name this index in a
+// Sitemap: line for search engines to accept them.
+func (h *SitemapHandler) GetSitemapIndex(w http.ResponseWriter, r *http.Request) {
+	h.serveSitemap(w, r, "index")
+}
+
+// GetSitemap handles GET /sitemaps/{name}.xml for posts, guides, products, categories
+// and collections
+func (h *SitemapHandler) GetSitemap(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if name == "index" {
+		// The index lives at /sitemap.xml only
+		http.Error(w, "sitemap not found", http.StatusNotFound)
+		return
+	}
+	h.serveSitemap(w, r, name)
+}
+
+func (h *SitemapHandler) serveSitemap(w http.ResponseWriter, r *http.Request, name string) {
+	sitemaps, err := h.cachedSitemaps()
+	if err != nil {
+		log.Printf("[Sitemap] Failed to generate sitemaps: %v", err)
+		http.Error(w, "Failed to generate sitemap", http.StatusInternalServerError)
+		return
+	}
+
+	sitemap, ok := sitemaps[name]
+	if !ok {
+		http.Error(w, "sitemap not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	http.ServeContent(w, r, "", sitemap.lastmod, bytes.NewReader(sitemap.body))
+}
+
+// Invalidate drops the cached sitemaps so the next request rebuilds them
+func (h *SitemapHandler) Invalidate() {
+	h.mu.Lock()
+	h.sitemaps = nil
+	h.mu.Unlock()
+}
+
+// InvalidateOnWrite is a middleware that invalidates the sitemaps after any successful
+// request that isn't a read
+func (h *SitemapHandler) InvalidateOnWrite(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		if status := ww.Status(); status == 0 || status < 300 {
+			h.Invalidate()
+		}
+	})
+}
+
+// cachedSitemaps returns the cached sitemaps, rebuilding them if they were invalidated
+// or are older than sitemapTTL
+func (h *SitemapHandler) cachedSitemaps() (map[string]*renderedSitemap, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.sitemaps != nil && time.Since(h.generatedAt) < sitemapTTL {
+		return h.sitemaps, nil
+	}
+
+	sitemaps, err := h.buildSitemaps()
+	if err != nil {
+		return nil, err
+	}
+	h.sitemaps = sitemaps
+	h.generatedAt = time.Now()
+	return sitemaps, nil
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	ImageNS string       `xml:"xmlns:image,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string         `xml:"loc"`
+	Lastmod string         `xml:"lastmod,omitempty"`
+	Images  []sitemapImage `xml:"image:image"`
+}
+
+type sitemapImage struct {
+	Loc string `xml:"image:loc"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name           `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapIndexItem `xml:"sitemap"`
+}
+
+type sitemapIndexItem struct {
+	Loc     string `xml:"loc"`
+	Lastmod string `xml:"lastmod,omitempty"`
+}
+
+// sitemapRow holds the columns any of the sitemap tables provide
+type sitemapRow struct {
+	Slug          string   `json:"slug"`
+	FeaturedImage string   `json:"featured_image"`
+	Images        []string `json:"images"`
+	ImageURL      string   `json:"image_url"`
+	PublishedAt   string   `json:"published_at"`
+	UpdatedAt     string   `json:"updated_at"`
+}
+
+// buildSitemaps renders every child sitemap and the index pointing at them
+func (h *SitemapHandler) buildSitemaps() (map[string]*renderedSitemap, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	client := h.db.GetClient()
+
+	queries := map[string]struct {
+		table   string
+		columns string
+		prefix  string
+		filter  func(q *postgrest.FilterBuilder) *postgrest.FilterBuilder
+	}{
+		"posts": {"posts", "slug,featured_image,published_at", h.websiteURL + "/blog/",
+			func(q *postgrest.FilterBuilder) *postgrest.FilterBuilder { return q.Lte("published_at", now) }},
+		"guides": {"guides", "slug,featured_image,published_at,updated_at", h.websiteURL + "/guides/",
+			func(q *postgrest.FilterBuilder) *postgrest.FilterBuilder { return q.Lte("published_at", now) }},
+		"products": {"products", "slug,images,updated_at", h.shopURL + "/products/",
+			func(q *postgrest.FilterBuilder) *postgrest.FilterBuilder { return q.Eq("active", "true") }},
+		"categories":  {"product_categories", "slug,image_url,updated_at", h.shopURL + "/shop/", nil},
+		"collections": {"product_collections", "slug,image_url,updated_at", h.shopURL + "/collections/", nil},
+	}
+
+	sitemaps := make(map[string]*renderedSitemap, len(sitemapNames)+1)
+	index := sitemapIndex{}
+	var indexLastmod time.Time
+
+	for _, name := range sitemapNames {
+		query := queries[name]
+		rows, err := selectAll[sitemapRow](func() *postgrest.FilterBuilder {
+			q := client.From(query.table).Select(query.columns, "exact", false)
+			if query.filter != nil {
+				q = query.filter(q)
+			}
+			return q.Order("id", &postgrest.OrderOpts{Ascending: true})
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		urlSet := sitemapURLSet{ImageNS: "http://www.google.com/schemas/sitemap-image/1.1"}
+		var lastmod time.Time
+		for _, row := range rows {
+			entry := sitemapURL{Loc: query.prefix + row.Slug}
+
+			modified := parseFeedTime(row.UpdatedAt)
+			if published := parseFeedTime(row.PublishedAt); published.After(modified) {
+				modified = published
+			}
+			if !modified.IsZero() {
+				entry.Lastmod = modified.Format(time.RFC3339)
+				if modified.After(lastmod) {
+					lastmod = modified
+				}
+			}
+
+			for _, image := range append([]string{row.FeaturedImage, row.ImageURL}, row.Images...) {
+				if image != "" {
+					entry.Images = append(entry.Images, sitemapImage{Loc: image})
+				}
+			}
+			urlSet.URLs = append(urlSet.URLs, entry)
+		}
+
+		body, err := marshalFeed(urlSet)
+		if err != nil {
+			return nil, err
+		}
+		sitemaps[name] = &renderedSitemap{body: body, lastmod: lastmod}
+
+		item := sitemapIndexItem{Loc: h.backendURL + "/sitemaps/" + name + ".xml"}
+		if !lastmod.IsZero() {
+			item.Lastmod = lastmod.Format(time.RFC3339)
+			if lastmod.After(indexLastmod) {
+				indexLastmod = lastmod
+			}
+		}
+		index.Sitemaps = append(index.Sitemaps, item)
+	}
+
+	body, err := marshalFeed(index)
+	if err != nil {
+		return nil, err
+	}
+	sitemaps["index"] = &renderedSitemap{body: body, lastmod: indexLastmod}
+
+	log.Printf("[Sitemap] Generated %d sitemaps", len(sitemapNames))
+	return sitemaps, nil
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"blog-backend/models"
+	"blog-backend/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/supabase-community/postgrest-go"
+)
+
+// Collection types
+const (
+	CollectionTypeManual = "manual"
+	CollectionTypeSmart  = "smart"
+)
+
+// Smart collection rule types
+const (
+	RuleTagContains       = "tag_contains"
+	RuleCategoryIn        = "category_in"
+	RulePriceBelow        = "price_below"
+	RuleOnSale            = "on_sale"
+	RuleCreatedWithinDays = "created_within_days"
+	RuleProductType       = "product_type"
+)
+
+// ruleCandidate is a product row decoded for rule evaluation
+type ruleCandidate struct {
+	models.Product
+	CategoryID *string `json:"category_id"`
+}
+
+// RulePreviewInput is the payload for POST /admin/collections/preview
+type RulePreviewInput struct {
+	Rules      []models.CollectionRule `json:"rules"`
+	RulesMatch string                  `json:"rules_match"`
+}
+
+// PreviewCollectionRules handles POST /admin/collections/preview
+func (h *ShopAdminHandler) PreviewCollectionRules(w http.ResponseWriter, r *http.Request) {
+	var input RulePreviewInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateCollectionRules(input.Rules, input.RulesMatch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	products, err := evaluateCollectionRules(h.db, input.Rules, input.RulesMatch)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":    len(products),
+		"products": products,
+	})
+}
+
+// validateCollectionRules checks that a smart collection's rule set is well formed
+func validateCollectionRules(rules []models.CollectionRule, match string) error {
+	if match != "" && match != "all" && match != "any" {
+		return fmt.Errorf("rules_match must be \"all\" or \"any\"")
+	}
+	if len(rules) == 0 {
+		return fmt.Errorf("smart collections need at least one rule")
+	}
+
+	for i, rule := range rules {
+		switch rule.Type {
+		case RuleTagContains:
+			if strings.TrimSpace(rule.Value) == "" {
+				return fmt.Errorf("rule %d: tag_contains needs a value", i+1)
+			}
+		case RuleCategoryIn:
+			if len(rule.Values) == 0 {
+				return fmt.Errorf("rule %d: category_in needs at least one category slug", i+1)
+			}
+		case RulePriceBelow:
+			if rule.Amount <= 0 {
+				return fmt.Errorf("rule %d: price_below needs a positive amount", i+1)
+			}
+		case RuleOnSale:
+		case RuleCreatedWithinDays:
+			if rule.Days <= 0 {
+				return fmt.Errorf("rule %d: created_within_days needs a positive number of days", i+1)
+			}
+		case RuleProductType:
+			if rule.Value != "editorial" && rule.Value != "everyday" {
+				return fmt.Errorf("rule %d: product_type must be \"editorial\" or \"everyday\"", i+1)
+			}
+		default:
+			return fmt.Errorf("rule %d: unknown rule type %q", i+1, rule.Type)
+		}
+	}
+	return nil
+}
+
+// evaluateCollectionRules returns the active products matching the rule set, newest first.
+// With match "any" a product needs to satisfy one rule, otherwise all of them.
+func evaluateCollectionRules(db *services.DatabaseService, rules []models.CollectionRule, match string) ([]map[string]interface{}, error) {
+	products, err := selectAll[json.RawMessage](func() *postgrest.FilterBuilder {
+		return db.GetClient().From("products").
+			Select("*", "exact", false).
+			Eq("active", "true").
+			Order("created_at", nil).
+			Order("id", nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode twice: typed rows for evaluation, raw rows so the response keeps every column
+	candidates := make([]ruleCandidate, len(products))
+	rows := make([]map[string]interface{}, len(products))
+	for i, product := range products {
+		if err := json.Unmarshal(product, &candidates[i]); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(product, &rows[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	categoryIDs, err := resolveRuleCategories(db, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	matched := []map[string]interface{}{}
+	for i, candidate := range candidates {
+		if productMatchesRules(candidate, rules, match, categoryIDs, now) {
+			matched = append(matched, rows[i])
+		}
+	}
+	return matched, nil
+}
+
+// resolveRuleCategories expands the category slugs used by category_in rules to the
+// IDs of those categories and all of their descendants
+func resolveRuleCategories(db *services.DatabaseService, rules []models.CollectionRule) (map[string]bool, error) {
+	needed := false
+	for _, rule := range rules {
+		if rule.Type == RuleCategoryIn {
+			needed = true
+			break
+		}
+	}
+	if !needed {
+		return nil, nil
+	}
+
+	categories, err := loadCategories(db)
+	if err != nil {
+		return nil, err
+	}
+	byID := indexCategories(categories)
+
+	slugs := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.Type == RuleCategoryIn {
+			for _, slug := range rule.Values {
+				slugs[slug] = true
+			}
+		}
+	}
+
+	ids := make(map[string]bool)
+	for _, c := range categories {
+		for _, ancestor := range categoryAncestry(byID, c.ID) {
+			if slugs[ancestor.Slug] {
+				ids[c.ID] = true
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+func productMatchesRules(p ruleCandidate, rules []models.CollectionRule, match string, categoryIDs map[string]bool, now time.Time) bool {
+	matchAny := match == "any"
+	for _, rule := range rules {
+		ok := productMatchesRule(p, rule, categoryIDs, now)
+		if matchAny && ok {
+			return true
+		}
+		if !matchAny && !ok {
+			return false
+		}
+	}
+	return !matchAny
+}
+
+func productMatchesRule(p ruleCandidate, rule models.CollectionRule, categoryIDs map[string]bool, now time.Time) bool {
+	onSale := p.SalePrice != nil && *p.SalePrice > 0 && *p.SalePrice < p.Price
+
+	switch rule.Type {
+	case RuleTagContains:
+		needle := strings.ToLower(rule.Value)
+		for _, tag := range p.Tags {
+			if strings.Contains(strings.ToLower(tag), needle) {
+				return true
+			}
+		}
+		return false
+	case RuleCategoryIn:
+		if p.CategoryID != nil && categoryIDs[*p.CategoryID] {
+			return true
+		}
+		// Older products only carry the category slug as text
+		for _, slug := range rule.Values {
+			if p.Category == slug {
+				return true
+			}
+		}
+		return false
+	case RulePriceBelow:
+		price := p.Price
+		if onSale {
+			price = *p.SalePrice
+		}
+		return price < rule.Amount
+	case RuleOnSale:
+		return onSale
+	case RuleCreatedWithinDays:
+		createdAt, err := time.Parse(time.RFC3339, p.CreatedAt)
+		if err != nil {
+			return false
+		}
+		return createdAt.After(now.AddDate(0, 0, -rule.Days))
+	case RuleProductType:
+		return p.ProductType == rule.Value
+	}
+	return false
+}
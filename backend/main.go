@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
@@ -21,20 +22,45 @@ func main() {
 	// Initialize services
 	db := services.NewDatabaseService(cfg)
 	email := services.NewEmailService(cfg)
+	email.Templates().UseOverrides(db)
 	cloudinary := services.NewCloudinaryService(cfg.CloudinaryName, cfg.CloudinaryAPIKey, cfg.CloudinaryAPISecret)
 
 	// Initialize handlers
-	postHandler := handlers.NewPostHandler(db)
-	commentHandler := handlers.NewCommentHandler(db)
-	guideHandler := handlers.NewGuideHandler(db)
-	newsletterHandler := handlers.NewNewsletterHandler(db, email)
-	adminHandler := handlers.NewAdminHandler(db, email)
-	newsletterAdminHandler := handlers.NewNewsletterAdminHandler(db, email)
-	productHandler := handlers.NewProductHandler(db)
+	seoHandler := handlers.NewSEOHandler(db, cfg.WebsiteURL)
+	tokens := services.NewTokenSigner(cfg.TokenSecret)
+	postHandler := handlers.NewPostHandler(db, seoHandler, tokens)
+	commentNotifier := handlers.NewCommentNotifier(db, email, tokens, cfg.WebsiteURL, cfg.BackendURL, cfg.BlogAuthorEmail)
+	commentHandler := handlers.NewCommentHandler(db, services.NewHeuristicSpamChecker(cfg.CommentBlocklist), commentNotifier)
+	guideHandler := handlers.NewGuideHandler(db, seoHandler)
+	newsletterLinks := handlers.NewNewsletterLinks(tokens, cfg.BackendURL)
+	newsletterHandler := handlers.NewNewsletterHandler(db, email, newsletterLinks, cfg.WebsiteURL,
+		time.Duration(cfg.NewsletterConfirmHours)*time.Hour, cfg.NewsletterSingleOptIn)
+	adminHandler := handlers.NewAdminHandler(db, email, commentNotifier)
+	emailWebhookHandler := handlers.NewEmailWebhookHandler(db, email)
+	emailTemplateHandler := handlers.NewEmailTemplateHandler(db, email)
+	emailOutboxHandler := handlers.NewEmailOutboxHandler(email)
+	newsletterTracker := handlers.NewNewsletterTracker(db, tokens, cfg.BackendURL, cfg.WebsiteURL)
+	newsletterQueue := handlers.NewNewsletterQueue(db, email, newsletterTracker, newsletterLinks, cfg.NewsletterWorkers, cfg.NewsletterRate, cfg.NewsletterMaxTries)
+	newsletterAdminHandler := handlers.NewNewsletterAdminHandler(db, email, newsletterQueue)
+	newsletterDigest := handlers.NewNewsletterDigest(db, email, newsletterQueue, cfg.WebsiteURL, cfg.NewsletterDigestDays, cfg.NewsletterDigestMode)
+	backInStockHandler := handlers.NewBackInStockHandler(db, email)
+	productHandler := handlers.NewProductHandler(db, backInStockHandler, seoHandler)
 	orderHandler := handlers.NewOrderHandlerSupabase(db, email)
 	categoryHandler := handlers.NewCategoryHandler(db)
 	shopAdminHandler := handlers.NewShopAdminHandler(db)
 	uploadHandler := handlers.NewUploadHandler(cloudinary)
+	inventoryHandler := handlers.NewInventoryHandler(db, email, backInStockHandler)
+	analyticsHandler := handlers.NewAnalyticsHandler(db)
+	feedHandler := handlers.NewFeedHandler(db, cfg.WebsiteURL, cfg.BackendURL)
+	sitemapHandler := handlers.NewSitemapHandler(db, cfg.WebsiteURL, cfg.BackendURL)
+
+	// Background jobs
+	inventoryHandler.StartLowStockDigest(cfg.LowStockDigestHour)
+	analyticsHandler.StartContentRollup(10 * time.Minute)
+	commentNotifier.StartCommentDigest(cfg.CommentDigestHour)
+	newsletterAdminHandler.StartNewsletterScheduler(time.Minute)
+	newsletterHandler.StartPendingPurge(time.Hour)
+	newsletterDigest.Start(cfg.NewsletterDigestDay, cfg.NewsletterDigestHour)
 
 	// Initialize router
 	r := chi.NewRouter()
@@ -50,10 +76,42 @@ func main() {
 		w.Write([]byte(`{"status": "healthy", "service": "blog-api"}`))
 	})
 
+	// One-click unsubscribe from comment reply emails (public)
+	r.Get("/comments/unsubscribe", commentNotifier.UnsubscribeThread)
+	r.Post("/comments/unsubscribe", commentNotifier.UnsubscribeThread)
+
+	// Resend delivery webhooks (public, verified by signature)
+	r.Post("/email/webhook", emailWebhookHandler.HandleWebhook)
+
+	// Newsletter open and click tracking
+	r.Get("/t/o/{token}", newsletterTracker.TrackOpen)
+	r.Get("/t/c/{token}", newsletterTracker.TrackClick)
+	r.Get("/newsletter/tracking/opt-out", newsletterTracker.OptOut)
+	r.Post("/newsletter/tracking/opt-out", newsletterTracker.OptOut)
+
+	// RSS and Atom feeds (public)
+	r.Route("/feeds", func(r chi.Router) {
+		r.Get("/posts.xml", feedHandler.GetPostsFeed)
+		r.Get("/posts.atom", feedHandler.GetPostsFeed)
+		r.Get("/guides.xml", feedHandler.GetGuidesFeed)
+		r.Get("/guides.atom", feedHandler.GetGuidesFeed)
+		r.Get("/category/{slug}.xml", feedHandler.GetCategoryFeed)
+		r.Get("/category/{slug}.atom", feedHandler.GetCategoryFeed)
+	})
+
+	// Sitemaps (public)
+	r.Get("/sitemap.xml", sitemapHandler.GetSitemapIndex)
+	r.Get("/sitemaps/{name}.xml", sitemapHandler.GetSitemap)
+
+	// Content analytics events (public)
+	r.With(middleware.RateLimit(120, time.Minute)).Post("/analytics/events", analyticsHandler.TrackContentEvent)
+
 	// Product routes (public)
 	r.Route("/products", func(r chi.Router) {
 		r.Get("/", productHandler.GetProducts)
 		r.Get("/{slug}", productHandler.GetProduct)
+		r.Get("/{slug}/variants", productHandler.GetProductVariants)
+		r.Post("/{slug}/notify-me", backInStockHandler.NotifyMe)
 	})
 
 	// Product category routes (public)
@@ -65,6 +123,7 @@ func main() {
 	// Category routes (public) - for full shop
 	r.Route("/categories", func(r chi.Router) {
 		r.Get("/", categoryHandler.GetCategories)
+		r.Get("/tree", categoryHandler.GetCategoryTree)
 		r.Get("/{slug}", categoryHandler.GetCategory)
 		r.Get("/{slug}/products", categoryHandler.GetCategoryProducts)
 	})
@@ -96,26 +155,26 @@ func main() {
 	// Post routes
 	r.Route("/posts", func(r chi.Router) {
 		r.Get("/", postHandler.GetPosts)
-		r.Post("/", postHandler.CreatePost)
+		r.With(sitemapHandler.InvalidateOnWrite).Post("/", postHandler.CreatePost)
 		r.Get("/{slug}", postHandler.GetPost)
 
 		// Clap routes
-		r.Post("/{slug}/clap", postHandler.ClapPost)
+		r.With(middleware.RateLimit(60, time.Minute)).Post("/{slug}/clap", postHandler.ClapPost)
 		r.Get("/{slug}/claps", postHandler.GetClaps)
 
 		// Comment routes
 		r.Route("/{slug}/comments", func(r chi.Router) {
 			r.Get("/", commentHandler.GetComments)
 			r.Post("/", commentHandler.CreateComment)
+			r.Put("/{id}", commentHandler.UpdateComment)
+			r.Delete("/{id}", commentHandler.DeleteComment)
 		})
 	})
 
-
-
 	// Guide routes
 	r.Route("/guides", func(r chi.Router) {
 		r.Get("/", guideHandler.GetGuides)
-		r.Post("/", guideHandler.CreateGuide)
+		r.With(sitemapHandler.InvalidateOnWrite).Post("/", guideHandler.CreateGuide)
 		r.Get("/{slug}", guideHandler.GetGuide)
 		r.Get("/category/{category}", guideHandler.GetGuidesByCategory)
 	})
@@ -129,16 +188,24 @@ func main() {
 
 	// Newsletter routes
 	r.Route("/newsletter", func(r chi.Router) {
-		r.Post("/subscribe", newsletterHandler.Subscribe)
+		r.With(middleware.RateLimit(10, time.Hour)).Post("/subscribe", newsletterHandler.Subscribe)
+		r.Get("/confirm", newsletterHandler.Confirm)
+		r.Post("/confirm", newsletterHandler.Confirm)
+		r.Get("/unsubscribe", newsletterHandler.Unsubscribe)
 		r.Post("/unsubscribe", newsletterHandler.Unsubscribe)
+		r.Get("/preferences", newsletterHandler.GetPreferences)
+		r.Post("/preferences", newsletterHandler.UpdatePreferences)
 		r.Get("/stats", newsletterHandler.GetStats)
 	})
 
 	// Admin routes (protected with basic auth)
 	r.Route("/admin", func(r chi.Router) {
 		r.Use(middleware.BasicAuth(cfg.AdminUsername, cfg.AdminPassword))
+		r.Use(sitemapHandler.InvalidateOnWrite)
 
 		r.Get("/dashboard", adminHandler.GetDashboard)
+		r.Get("/analytics/sales", analyticsHandler.GetSalesAnalytics)
+		r.Get("/analytics/content", analyticsHandler.GetContentAnalytics)
 
 		// Post management
 		r.Get("/posts", adminHandler.GetAllPosts)
@@ -150,9 +217,17 @@ func main() {
 		// Comment management
 		r.Get("/comments", adminHandler.GetAllComments)
 		r.Delete("/comments/{id}", adminHandler.DeleteComment)
+		r.Post("/comments/{id}/approve", adminHandler.ApproveComment)
+		r.Post("/comments/{id}/reject", adminHandler.RejectComment)
+		r.Post("/comments/{id}/spam", adminHandler.MarkCommentSpam)
+		r.Get("/comments/{id}/revisions", adminHandler.GetCommentRevisions)
+
+		// SEO overrides
+		r.Put("/seo/{type}/{slug}", seoHandler.UpdateSEOOverrides)
 
 		// Newsletter management
 		r.Get("/subscribers", adminHandler.GetAllSubscribers)
+		r.Post("/subscribers", newsletterHandler.AddSubscriber)
 		r.Get("/subscribers/export", adminHandler.ExportSubscribers)
 
 		// Newsletter sending
@@ -160,13 +235,59 @@ func main() {
 		r.Get("/newsletter/templates", newsletterAdminHandler.GetNewsletterTemplates)
 		r.Post("/newsletter/preview", newsletterAdminHandler.PreviewNewsletter)
 		r.Get("/newsletter/stats", newsletterAdminHandler.GetNewsletterStats)
+		r.Get("/newsletter/digest", newsletterDigest.PreviewDigest)
+		r.Post("/newsletter/digest", newsletterDigest.CreateDigest)
+		r.Get("/newsletter/segments", newsletterAdminHandler.GetSegments)
+		r.Post("/newsletter/segments", newsletterAdminHandler.CreateSegment)
+		r.Post("/newsletter/segments/preview", newsletterAdminHandler.PreviewSegment)
+		r.Get("/newsletter/segments/{id}", newsletterAdminHandler.GetSegment)
+		r.Put("/newsletter/segments/{id}", newsletterAdminHandler.UpdateSegment)
+		r.Delete("/newsletter/segments/{id}", newsletterAdminHandler.DeleteSegment)
+
+		// Email templates
+		r.Get("/email/templates", emailTemplateHandler.GetTemplates)
+		r.Get("/email/templates/{name}", emailTemplateHandler.GetTemplate)
+		r.Put("/email/templates/{name}", emailTemplateHandler.UpdateTemplate)
+		r.Delete("/email/templates/{name}", emailTemplateHandler.DeleteTemplate)
+		r.Post("/email/templates/{name}/preview", emailTemplateHandler.PreviewTemplate)
+
+		// Emails kept by the outbox and memory transports
+		r.Get("/email/outbox", emailOutboxHandler.GetMessages)
+		r.Delete("/email/outbox", emailOutboxHandler.ClearMessages)
+		r.Get("/email/outbox/page", emailOutboxHandler.GetOutboxPage)
+		r.Get("/email/outbox/{id}", emailOutboxHandler.GetMessage)
+		r.Get("/email/outbox/{id}/html", emailOutboxHandler.GetMessageHTML)
+
+		// Newsletter campaigns
+		r.Get("/newsletters", newsletterAdminHandler.GetNewsletters)
+		r.Post("/newsletters", newsletterAdminHandler.CreateNewsletter)
+		r.Get("/newsletters/{id}", newsletterAdminHandler.GetNewsletter)
+		r.Put("/newsletters/{id}", newsletterAdminHandler.UpdateNewsletter)
+		r.Delete("/newsletters/{id}", newsletterAdminHandler.DeleteNewsletter)
+		r.Post("/newsletters/{id}/send", newsletterAdminHandler.SendNewsletterNow)
+		r.Post("/newsletters/{id}/resume", newsletterAdminHandler.ResumeNewsletter)
+		r.Get("/newsletters/{id}/progress", newsletterAdminHandler.GetNewsletterProgress)
+		r.Get("/newsletters/{id}/engagement", newsletterAdminHandler.GetNewsletterEngagement)
 
 		// Product management
 		r.Get("/products", productHandler.GetAdminProducts)
 		r.Post("/products", productHandler.CreateProduct)
+		r.Post("/products/import", productHandler.ImportProducts)
+		r.Get("/products/export", productHandler.ExportProducts)
 		r.Put("/products/{slug}", productHandler.UpdateProduct)
 		r.Delete("/products/{slug}", productHandler.DeleteProduct)
 
+		// Product variant management
+		r.Post("/products/{slug}/variants", productHandler.CreateVariant)
+		r.Put("/products/{slug}/variants/order", productHandler.ReorderVariants)
+		r.Put("/products/{slug}/variants/{variantId}", productHandler.UpdateVariant)
+		r.Delete("/products/{slug}/variants/{variantId}", productHandler.DeleteVariant)
+
+		// Inventory
+		r.Get("/inventory", inventoryHandler.GetInventory)
+		r.Get("/inventory/ledger", inventoryHandler.GetLedger)
+		r.Post("/inventory/adjustments", inventoryHandler.AdjustStock)
+
 		// Category management
 		r.Post("/categories", shopAdminHandler.CreateCategory)
 		r.Put("/categories/{id}", shopAdminHandler.UpdateCategory)
@@ -174,6 +295,7 @@ func main() {
 
 		// Collection management
 		r.Post("/collections", shopAdminHandler.CreateCollection)
+		r.Post("/collections/preview", shopAdminHandler.PreviewCollectionRules)
 		r.Put("/collections/{id}", shopAdminHandler.UpdateCollection)
 		r.Delete("/collections/{id}", shopAdminHandler.DeleteCollection)
 		r.Post("/collections/{id}/products", shopAdminHandler.AddProductToCollection)
@@ -203,10 +325,14 @@ func main() {
 	log.Printf("   GET  /posts/{slug}")
 	log.Printf("   GET  /posts/{slug}/comments")
 	log.Printf("   POST /posts/{slug}/comments")
+	log.Printf("   PUT  /posts/{slug}/comments/{id}")
+	log.Printf("   DELETE /posts/{slug}/comments/{id}")
 	log.Printf("   GET  /guides")
 	log.Printf("   POST /guides")
 	log.Printf("   GET  /guides/{slug}")
 	log.Printf("   GET  /guides/category/{category}")
+	log.Printf("   GET  /feeds/posts.xml, /feeds/guides.xml, /feeds/category/{slug}.xml (.atom for Atom)")
+	log.Printf("   GET  /sitemap.xml, /sitemaps/{posts,guides,products,categories,collections}.xml")
 	log.Printf("   POST /newsletter/subscribe")
 	log.Printf("   POST /newsletter/unsubscribe")
 	log.Printf("   GET  /newsletter/stats")
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateWindow counts the requests one client made in the current window
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// RateLimit returns a middleware that allows each client IP at most limit requests
+// per window and answers 429 Too Many Requests beyond that
+func RateLimit(limit int, window time.Duration) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+	clients := make(map[string]*rateWindow)
+
+	// Forget clients whose window has passed so the map doesn't grow forever
+	go func() {
+		for range time.Tick(window) {
+			mu.Lock()
+			for ip, w := range clients {
+				if time.Since(w.start) >= window {
+					delete(clients, ip)
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := ClientIP(r)
+			now := time.Now()
+
+			mu.Lock()
+			entry, ok := clients[ip]
+			if !ok || now.Sub(entry.start) >= window {
+				entry = &rateWindow{start: now}
+				clients[ip] = entry
+			}
+			entry.count++
+			allowed := entry.count <= limit
+			retryAfter := entry.start.Add(window).Sub(now)
+			mu.Unlock()
+
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+				http.Error(w, "Too many requests, slow down", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the caller's IP. Behind the hosting proxy it is the rightmost
+// X-Forwarded-For entry, the one the proxy appended; entries to its left come from the
+// client and can be anything.
+func ClientIP(r *http.Request) string {
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(forwarded[len(forwarded)-1], ",")
+		if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
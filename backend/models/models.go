@@ -41,131 +41,347 @@ type CreatePostRequest struct {
 	RelatedProducts       []string `json:"related_products"` // Array of product IDs/slugs
 }
 
+// SEO is the metadata a page needs for search engines and link previews
+type SEO struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Canonical   string         `json:"canonical"`
+	Robots      string         `json:"robots,omitempty"`
+	OpenGraph   OpenGraph      `json:"open_graph"`
+	Twitter     TwitterCard    `json:"twitter"`
+	JSONLD      map[string]any `json:"json_ld"` // schema.org object, ready for a <script type="application/ld+json">
+}
+
+// OpenGraph holds the og: meta tags
+type OpenGraph struct {
+	Type        string `json:"type"` // article, product
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	Image       string `json:"image,omitempty"`
+	SiteName    string `json:"site_name"`
+}
+
+// TwitterCard holds the twitter: meta tags
+type TwitterCard struct {
+	Card        string `json:"card"` // summary or summary_large_image
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Image       string `json:"image,omitempty"`
+}
+
+// SEOOverrides are per-item values an admin set to replace the generated SEO fields.
+// Empty fields keep the generated value.
+type SEOOverrides struct {
+	Title              string         `json:"title,omitempty"`
+	Description        string         `json:"description,omitempty"`
+	Canonical          string         `json:"canonical,omitempty"`
+	Image              string         `json:"image,omitempty"`
+	OGTitle            string         `json:"og_title,omitempty"`
+	OGDescription      string         `json:"og_description,omitempty"`
+	TwitterTitle       string         `json:"twitter_title,omitempty"`
+	TwitterDescription string         `json:"twitter_description,omitempty"`
+	NoIndex            bool           `json:"noindex,omitempty"`
+	JSONLD             map[string]any `json:"json_ld,omitempty"` // Merged over the generated JSON-LD
+}
+
 // Comment represents a blog comment
 type Comment struct {
-	ID          string `json:"id"`
-	PostSlug    string `json:"post_slug"`
-	AuthorName  string `json:"author_name"`
-	AuthorEmail string `json:"author_email"`
-	Body        string `json:"body"`
-	CreatedAt   string `json:"created_at"`
+	ID          string    `json:"id"`
+	PostSlug    string    `json:"post_slug"`
+	AuthorName  string    `json:"author_name"`
+	AuthorEmail string    `json:"author_email"`
+	Body        string    `json:"body"`
+	Status      string    `json:"status,omitempty"` // pending, approved, spam, rejected
+	SpamScore   float64   `json:"spam_score,omitempty"`
+	SpamReasons []string  `json:"spam_reasons,omitempty"`
+	ParentID    *string   `json:"parent_id,omitempty"`
+	RootID      *string   `json:"root_id,omitempty"` // Top-level comment of the thread
+	Depth       int       `json:"depth"`
+	Replies     []Comment `json:"replies,omitempty"`
+	Edited      bool      `json:"edited"`
+	EditedAt    *string   `json:"edited_at,omitempty"`
+	DeletedAt   *string   `json:"deleted_at,omitempty"` // Deleted by its author but kept for its replies
+	CreatedAt   string    `json:"created_at"`
 }
 
+// CommentRevision is a comment body as it was before an author edit or deletion
+type CommentRevision struct {
+	ID        string `json:"id"`
+	CommentID string `json:"comment_id"`
+	Body      string `json:"body"`
+	Status    string `json:"status"`
+	Action    string `json:"action"` // edit, delete
+	CreatedAt string `json:"created_at"`
+}
+
+// UpdateCommentRequest represents the payload for editing a comment
+type UpdateCommentRequest struct {
+	Body string `json:"body"`
+}
+
+// Comment moderation statuses
+const (
+	CommentStatusPending  = "pending"
+	CommentStatusApproved = "approved"
+	CommentStatusSpam     = "spam"
+	CommentStatusRejected = "rejected"
+)
+
 // CreateCommentRequest represents the payload for creating a new comment
 type CreateCommentRequest struct {
 	AuthorName  string `json:"author_name"`
 	AuthorEmail string `json:"author_email"`
 	Body        string `json:"body"`
+	ParentID    string `json:"parent_id,omitempty"` // Comment being replied to
+	Website     string `json:"website,omitempty"`   // Honeypot: hidden in the form, only bots fill it in
+
+	CommenterToken string `json:"commenter_token,omitempty"` // From the link in a comment email; proves author_email is theirs
 }
 
 // NewsletterSubscriber represents a newsletter subscriber
 type NewsletterSubscriber struct {
-	ID             string  `json:"id"`
-	Email          string  `json:"email"`
-	Status         string  `json:"status"`
-	SubscribedAt   string  `json:"subscribed_at"`
-	UnsubscribedAt *string `json:"unsubscribed_at"`
-	Source         string  `json:"source"`
+	ID             string   `json:"id"`
+	Email          string   `json:"email"`
+	Status         string   `json:"status"`
+	SubscribedAt   string   `json:"subscribed_at"`
+	UnsubscribedAt *string  `json:"unsubscribed_at"`
+	Source         string   `json:"source"`
+	TrackingOptOut bool     `json:"tracking_opt_out"`
+	Topics         []string `json:"topics"`    // Blog category slugs; empty means all
+	Frequency      string   `json:"frequency"` // all, weekly or monthly
+	LastNewsletter *string  `json:"last_newsletter_at"`
+	ConfirmedAt    *string  `json:"confirmed_at"`
+}
+
+// Newsletter frequencies a subscriber can choose
+const (
+	NewsletterFrequencyAll     = "all"
+	NewsletterFrequencyWeekly  = "weekly"
+	NewsletterFrequencyMonthly = "monthly"
+)
+
+// NewsletterTopic is a blog category subscribers can follow
+type NewsletterTopic struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// NewsletterPreferences represents a subscriber's settings in the preference center
+type NewsletterPreferences struct {
+	Email      string            `json:"email"`
+	Subscribed bool              `json:"subscribed"`
+	Topics     []string          `json:"topics"`
+	Frequency  string            `json:"frequency"`
+	NoTracking bool              `json:"no_tracking"`
+	Available  []NewsletterTopic `json:"available_topics,omitempty"`
 }
 
 // NewsletterRequest represents the payload for newsletter operations
 type NewsletterRequest struct {
-	Email  string `json:"email"`
-	Source string `json:"source"`
+	Email      string `json:"email"`
+	Source     string `json:"source"`
+	NoTracking bool   `json:"no_tracking"` // Send without open and click tracking
 }
 
 // Newsletter represents a newsletter campaign
 type Newsletter struct {
-	ID             string  `json:"id"`
-	Subject        string  `json:"subject"`
-	Content        string  `json:"content"`
-	HTMLContent    string  `json:"html_content"`
-	Status         string  `json:"status"` // draft, scheduled, sent
-	CreatedAt      string  `json:"created_at"`
-	SentAt         *string `json:"sent_at"`
-	RecipientCount int     `json:"recipient_count"`
-	OpenCount      int     `json:"open_count"`
-	ClickCount     int     `json:"click_count"`
-}
-
-// CreateNewsletterRequest represents the payload for creating a newsletter
+	ID             string   `json:"id"`
+	Subject        string   `json:"subject"`
+	Content        string   `json:"content"`
+	HTMLContent    string   `json:"html_content"`
+	Topics         []string `json:"topics"` // Only subscribers following one of these get it; empty means everyone
+	SegmentID      *string  `json:"segment_id"`
+	Status         string   `json:"status"` // draft, scheduled, sending, sent, failed
+	ScheduledFor   *string  `json:"scheduled_for"`
+	CreatedAt      string   `json:"created_at"`
+	UpdatedAt      string   `json:"updated_at"`
+	StartedAt      *string  `json:"started_at"`
+	SentAt         *string  `json:"sent_at"`
+	RecipientCount int      `json:"recipient_count"`
+	SentCount      int      `json:"sent_count"`
+	FailedCount    int      `json:"failed_count"`
+	TrackedCount   int      `json:"tracked_count"`
+	OpenCount      int      `json:"open_count"` // Recipients who opened
+	ClickCount     int      `json:"click_count"`
+	UniqueClicks   int      `json:"unique_click_count"`
+	DeliveredCount int      `json:"delivered_count"`
+	BounceCount    int      `json:"bounce_count"`
+	ComplaintCount int      `json:"complaint_count"`
+	LastError      *string  `json:"last_error,omitempty"`
+}
+
+// Newsletter campaign statuses
+const (
+	NewsletterStatusDraft     = "draft"
+	NewsletterStatusScheduled = "scheduled"
+	NewsletterStatusSending   = "sending"
+	NewsletterStatusSent      = "sent"
+	NewsletterStatusFailed    = "failed"
+)
+
+// NewsletterLinkStats represents the clicks on one link of a campaign
+type NewsletterLinkStats struct {
+	URL          string `json:"url"`
+	Clicks       int    `json:"clicks"`
+	UniqueClicks int    `json:"unique_clicks"`
+}
+
+// NewsletterEngagement represents the open and click stats of a campaign. Rates are
+// over the recipients who were sent a tracked email.
+type NewsletterEngagement struct {
+	NewsletterID string                `json:"newsletter_id"`
+	Sent         int                   `json:"sent"`
+	Tracked      int                   `json:"tracked"`
+	UniqueOpens  int                   `json:"unique_opens"`
+	TotalOpens   int                   `json:"total_opens"`
+	UniqueClicks int                   `json:"unique_clicks"`
+	TotalClicks  int                   `json:"total_clicks"`
+	OpenRate     float64               `json:"open_rate"`
+	ClickRate    float64               `json:"click_rate"`
+	ClickToOpen  float64               `json:"click_to_open_rate"`
+	Links        []NewsletterLinkStats `json:"links"`
+}
+
+// ResendWebhookEvent is a delivery event Resend posts to POST /email/webhook
+type ResendWebhookEvent struct {
+	Type      string `json:"type"` // email.delivered, email.bounced, email.complained, email.delivery_delayed, ...
+	CreatedAt string `json:"created_at"`
+	Data      struct {
+		EmailID string   `json:"email_id"`
+		To      []string `json:"to"`
+		Subject string   `json:"subject"`
+		Bounce  *struct {
+			Type    string `json:"type"` // Permanent, Transient or Undetermined
+			SubType string `json:"subType"`
+			Message string `json:"message"`
+		} `json:"bounce,omitempty"`
+	} `json:"data"`
+}
+
+// CreateNewsletterRequest represents the payload for creating or updating a newsletter.
+// A campaign with scheduled_for is scheduled; without it, it is saved as a draft.
 type CreateNewsletterRequest struct {
-	Subject      string  `json:"subject"`
-	Content      string  `json:"content"`
-	HTMLContent  string  `json:"html_content"`
-	ScheduledFor *string `json:"scheduled_for"`
+	Subject      string   `json:"subject"`
+	Content      string   `json:"content"`
+	HTMLContent  string   `json:"html_content"`
+	Topics       []string `json:"topics"`
+	SegmentID    *string  `json:"segment_id"`
+	ScheduledFor *string  `json:"scheduled_for"`
 }
 
 // SendNewsletterRequest represents the payload for sending a newsletter
 type SendNewsletterRequest struct {
-	Subject     string `json:"subject"`
-	Content     string `json:"content"`
-	HTMLContent string `json:"html_content"`
-	TestEmail   string `json:"test_email,omitempty"`
+	Subject     string   `json:"subject"`
+	Content     string   `json:"content"`
+	HTMLContent string   `json:"html_content"`
+	Topics      []string `json:"topics"`
+	SegmentID   string   `json:"segment_id,omitempty"`
+	TestEmail   string   `json:"test_email,omitempty"`
+}
+
+// SegmentRule is a single condition of a newsletter segment
+type SegmentRule struct {
+	Type   string   `json:"type"`             // source_in, subscribed_within_days, subscribed_before_days, topic_in, opened_within_days, clicked_within_days, not_opened_within_days, has_paid_order, bought_category_in
+	Values []string `json:"values,omitempty"` // Sources for source_in, topic slugs for topic_in, category slugs for bought_category_in
+	Days   int      `json:"days,omitempty"`   // Window for the *_days rules
+}
+
+// NewsletterSegment is a saved newsletter audience
+type NewsletterSegment struct {
+	ID          string        `json:"id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Rules       []SegmentRule `json:"rules"`
+	RulesMatch  string        `json:"rules_match"` // all or any
+	CreatedAt   string        `json:"created_at"`
+	UpdatedAt   string        `json:"updated_at"`
+}
+
+// EmailTemplate is an admin's override of a built-in email template. Subject and body
+// are html/template source; the body replaces the email's content block inside the
+// shared layout.
+type EmailTemplate struct {
+	Name      string `json:"name"`
+	Subject   string `json:"subject"`
+	Body      string `json:"body"`
+	UpdatedAt string `json:"updated_at"`
 }
 
 // Product represents an e-commerce product
 type Product struct {
-	ID          string   `json:"id"`
-	Slug        string   `json:"slug"`
-	Name        string   `json:"name"`
-	Description string   `json:"description"`
-	Price       float64  `json:"price"`
-	SalePrice   *float64 `json:"sale_price,omitempty"`
-	Images      []string `json:"images"`
-	Category    string   `json:"category"`
-	Tags        []string `json:"tags"`
-	Stock       int      `json:"stock"`
-	SKU         string   `json:"sku"`
-	Weight      float64  `json:"weight"`
-	Dimensions  string   `json:"dimensions"`
-	Featured    bool     `json:"featured"`
-	Active      bool     `json:"active"`
-	CreatedAt   string   `json:"created_at"`
-	UpdatedAt   string   `json:"updated_at"`
-	
+	ID               string   `json:"id"`
+	Slug             string   `json:"slug"`
+	Name             string   `json:"name"`
+	Description      string   `json:"description"`
+	Price            float64  `json:"price"`
+	SalePrice        *float64 `json:"sale_price,omitempty"`
+	Images           []string `json:"images"`
+	Category         string   `json:"category"`
+	Tags             []string `json:"tags"`
+	Stock            int      `json:"stock"`
+	SKU              string   `json:"sku"`
+	Weight           float64  `json:"weight"`
+	Dimensions       string   `json:"dimensions"`
+	Featured         bool     `json:"featured"`
+	Active           bool     `json:"active"`
+	ReorderThreshold *int     `json:"reorder_threshold,omitempty"` // Low-stock level, defaults to 5
+	CreatedAt        string   `json:"created_at"`
+	UpdatedAt        string   `json:"updated_at"`
+
 	// Product Type System
-	ProductType        string           `json:"product_type"` // "editorial" or "everyday"
-	
+	ProductType string `json:"product_type"` // "editorial" or "everyday"
+
 	// Editorial-specific fields
-	EditorialNote      string           `json:"editorial_note,omitempty"`
-	ExternalLink       string           `json:"external_link,omitempty"`
-	AvailabilityStatus string           `json:"availability_status,omitempty"` // available, limited, reference, sold_out
-	
+	EditorialNote      string `json:"editorial_note,omitempty"`
+	ExternalLink       string `json:"external_link,omitempty"`
+	AvailabilityStatus string `json:"availability_status,omitempty"` // available, limited, reference, sold_out
+
 	// Everyday-specific fields
-	Variants           []ProductVariant `json:"variants,omitempty"`
-	ShippingInfo       string           `json:"shipping_info,omitempty"`
-	ReturnPolicy       string           `json:"return_policy,omitempty"`
-	CareInstructions   string           `json:"care_instructions,omitempty"`
+	Variants         []ProductVariant `json:"variants,omitempty"`
+	ShippingInfo     string           `json:"shipping_info,omitempty"`
+	ReturnPolicy     string           `json:"return_policy,omitempty"`
+	CareInstructions string           `json:"care_instructions,omitempty"`
 }
 
 // ProductVariant represents a product variant (size, color, material, etc.)
 type ProductVariant struct {
-	ID              string  `json:"id"`
-	Name            string  `json:"name"`              // e.g., "Small", "Blue", "Oak"
-	Type            string  `json:"type"`              // size, color, material, other
-	PriceAdjustment float64 `json:"price_adjustment"`  // +/- from base price
-	SKUSuffix       string  `json:"sku_suffix"`        // e.g., "-SM", "-BLU"
-	Stock           int     `json:"stock"`
-	ImageIndex      *int    `json:"image_index,omitempty"` // Which product image to show
+	ID               string  `json:"id"`
+	ProductID        string  `json:"product_id,omitempty"`
+	Name             string  `json:"name"`             // e.g., "Small", "Blue", "Oak"
+	Type             string  `json:"type"`             // size, color, material, other
+	PriceAdjustment  float64 `json:"price_adjustment"` // +/- from base price
+	Price            float64 `json:"price,omitempty"`  // Base price plus adjustment, filled in on read
+	SKUSuffix        string  `json:"sku_suffix"`       // e.g., "-SM", "-BLU"
+	SKU              string  `json:"sku,omitempty"`    // Product SKU followed by SKUSuffix
+	Stock            int     `json:"stock"`
+	ImageIndex       *int    `json:"image_index,omitempty"` // Which product image to show
+	DisplayOrder     int     `json:"display_order"`
+	ReorderThreshold *int    `json:"reorder_threshold,omitempty"` // Low-stock level, defaults to 5
+}
+
+// ReorderVariantsRequest represents the payload for reordering a product's variants
+type ReorderVariantsRequest struct {
+	VariantIDs []string `json:"variant_ids"`
 }
 
 // CreateProductRequest represents the payload for creating a new product
 type CreateProductRequest struct {
-	Name        string   `json:"name"`
-	Description string   `json:"description"`
-	Price       float64  `json:"price"`
-	SalePrice   *float64 `json:"sale_price,omitempty"`
-	Images      []string `json:"images"`
-	Category    string   `json:"category"`
-	Tags        []string `json:"tags"`
-	Stock       int      `json:"stock"`
-	SKU         string   `json:"sku"`
-	Weight      float64  `json:"weight"`
-	Dimensions  string   `json:"dimensions"`
-	Featured    bool     `json:"featured"`
-	Active      bool     `json:"active"`
-	
+	Name             string   `json:"name"`
+	Description      string   `json:"description"`
+	Price            float64  `json:"price"`
+	SalePrice        *float64 `json:"sale_price,omitempty"`
+	Images           []string `json:"images"`
+	Category         string   `json:"category"`
+	Tags             []string `json:"tags"`
+	Stock            int      `json:"stock"`
+	SKU              string   `json:"sku"`
+	Weight           float64  `json:"weight"`
+	Dimensions       string   `json:"dimensions"`
+	Featured         bool     `json:"featured"`
+	Active           bool     `json:"active"`
+	ReorderThreshold *int     `json:"reorder_threshold,omitempty"`
+
 	// Product Type System
 	ProductType        string           `json:"product_type"` // "editorial" or "everyday"
 	EditorialNote      string           `json:"editorial_note,omitempty"`
@@ -179,20 +395,21 @@ type CreateProductRequest struct {
 
 // UpdateProductRequest represents the payload for updating a product
 type UpdateProductRequest struct {
-	Name        string   `json:"name"`
-	Description string   `json:"description"`
-	Price       float64  `json:"price"`
-	SalePrice   *float64 `json:"sale_price,omitempty"`
-	Images      []string `json:"images"`
-	Category    string   `json:"category"`
-	Tags        []string `json:"tags"`
-	Stock       int      `json:"stock"`
-	SKU         string   `json:"sku"`
-	Weight      float64  `json:"weight"`
-	Dimensions  string   `json:"dimensions"`
-	Featured    bool     `json:"featured"`
-	Active      bool     `json:"active"`
-	
+	Name             string   `json:"name"`
+	Description      string   `json:"description"`
+	Price            float64  `json:"price"`
+	SalePrice        *float64 `json:"sale_price,omitempty"`
+	Images           []string `json:"images"`
+	Category         string   `json:"category"`
+	Tags             []string `json:"tags"`
+	Stock            int      `json:"stock"`
+	SKU              string   `json:"sku"`
+	Weight           float64  `json:"weight"`
+	Dimensions       string   `json:"dimensions"`
+	Featured         bool     `json:"featured"`
+	Active           bool     `json:"active"`
+	ReorderThreshold *int     `json:"reorder_threshold,omitempty"`
+
 	// Product Type System
 	ProductType        string           `json:"product_type"` // "editorial" or "everyday"
 	EditorialNote      string           `json:"editorial_note,omitempty"`
@@ -234,6 +451,9 @@ type OrderItem struct {
 	ID          string  `json:"id,omitempty"`
 	ProductID   string  `json:"product_id"`
 	ProductSlug string  `json:"product_slug"`
+	VariantID   string  `json:"variant_id,omitempty"`
+	VariantName string  `json:"variant_name,omitempty"`
+	SKU         string  `json:"sku,omitempty"`
 	Name        string  `json:"name"`
 	Price       float64 `json:"price"`
 	Quantity    int     `json:"quantity"`
@@ -275,6 +495,7 @@ type CreateOrderRequest struct {
 type CartItem struct {
 	ProductID   string  `json:"product_id"`
 	ProductSlug string  `json:"product_slug"`
+	VariantID   string  `json:"variant_id,omitempty"`
 	Name        string  `json:"name"`
 	Price       float64 `json:"price"`
 	Image       string  `json:"image"`
@@ -288,6 +509,206 @@ type Cart struct {
 	Total float64    `json:"total"`
 }
 
+// Stock movement reasons recorded in the inventory ledger
+const (
+	StockReasonSale             = "sale"
+	StockReasonRestock          = "restock"
+	StockReasonManualCorrection = "manual_correction"
+	StockReasonRefund           = "refund"
+)
+
+// StockAdjustment is a change to the stock of a product, or of one of its variants
+type StockAdjustment struct {
+	ProductID string `json:"product_id"`
+	VariantID string `json:"variant_id,omitempty"`
+	Delta     int    `json:"delta"`
+	Reason    string `json:"reason"` // sale, restock, manual_correction, refund
+	OrderID   string `json:"order_id,omitempty"`
+	Note      string `json:"note,omitempty"`
+}
+
+// InventoryLedgerEntry is a recorded stock movement
+type InventoryLedgerEntry struct {
+	ID          string  `json:"id"`
+	ProductID   string  `json:"product_id"`
+	VariantID   *string `json:"variant_id"`
+	Delta       int     `json:"delta"`
+	Reason      string  `json:"reason"`
+	OrderID     *string `json:"order_id"`
+	Note        string  `json:"note"`
+	StockBefore int     `json:"stock_before"`
+	StockAfter  int     `json:"stock_after"`
+	CreatedAt   string  `json:"created_at"`
+}
+
+// InventoryItem is one row of the inventory dashboard: a product without variants, or a single variant
+type InventoryItem struct {
+	ProductID        string  `json:"product_id"`
+	ProductSlug      string  `json:"product_slug"`
+	ProductName      string  `json:"product_name"`
+	VariantID        string  `json:"variant_id,omitempty"`
+	VariantName      string  `json:"variant_name,omitempty"`
+	SKU              string  `json:"sku"`
+	Stock            int     `json:"stock"`
+	Reserved         int     `json:"reserved"`  // Units in unpaid orders from the last 24 hours
+	Available        int     `json:"available"` // Stock minus reserved
+	ReorderThreshold int     `json:"reorder_threshold"`
+	LowStock         bool    `json:"low_stock"`
+	UnitsSold        int     `json:"units_sold"`        // Net of refunds, over the report window
+	SellThroughRate  float64 `json:"sell_through_rate"` // Units sold / (units sold + stock)
+}
+
+// SalesReport is the shop sales analytics report for a date range
+type SalesReport struct {
+	From          string            `json:"from"`
+	To            string            `json:"to"`
+	Interval      string            `json:"interval"` // day, week, month
+	Summary       SalesSummary      `json:"summary"`
+	Timeline      []SalesBucket     `json:"timeline"`
+	TopProducts   []SalesRankedItem `json:"top_products"`
+	TopCategories []SalesRankedItem `json:"top_categories"`
+}
+
+// SalesSummary holds the headline numbers of a sales report
+type SalesSummary struct {
+	Revenue            float64 `json:"revenue"`
+	Orders             int     `json:"orders"` // Paid orders
+	AverageOrderValue  float64 `json:"average_order_value"`
+	FailedOrders       int     `json:"failed_orders"`
+	PendingOrders      int     `json:"pending_orders"`
+	ConversionRate     float64 `json:"conversion_rate"` // Paid / (paid + failed)
+	Customers          int     `json:"customers"`       // Distinct paying customers
+	RepeatCustomers    int     `json:"repeat_customers"`
+	RepeatCustomerRate float64 `json:"repeat_customer_rate"` // Repeat / paying customers
+}
+
+// SalesBucket is one interval of the sales timeline
+type SalesBucket struct {
+	Period       string  `json:"period"`
+	Revenue      float64 `json:"revenue"`
+	Orders       int     `json:"orders"`
+	FailedOrders int     `json:"failed_orders"`
+}
+
+// SalesRankedItem is a product or category in the top sellers lists
+type SalesRankedItem struct {
+	ID      string  `json:"id,omitempty"`
+	Name    string  `json:"name"`
+	Units   int     `json:"units"`
+	Revenue float64 `json:"revenue"`
+}
+
+// ContentEvent is a page view or read progress event posted by the blog frontend
+type ContentEvent struct {
+	ContentType string `json:"content_type"` // post, guide
+	Slug        string `json:"slug"`
+	Event       string `json:"event"`              // page_view, read_progress
+	Progress    *int   `json:"progress,omitempty"` // Percent of the item read, for read_progress
+	SessionID   string `json:"session_id,omitempty"`
+	Referrer    string `json:"referrer,omitempty"`
+	UTMSource   string `json:"utm_source,omitempty"`
+	UTMMedium   string `json:"utm_medium,omitempty"`
+	UTMCampaign string `json:"utm_campaign,omitempty"`
+}
+
+// ContentStats are the rolled-up engagement numbers of a post or guide
+type ContentStats struct {
+	ContentType    string  `json:"content_type"`
+	Slug           string  `json:"slug"`
+	Title          string  `json:"title,omitempty"`
+	Views          int     `json:"views"`
+	UniqueVisitors int     `json:"unique_visitors"`
+	Reads          int     `json:"reads"`          // Sessions that read at least 75%
+	AvgReadDepth   float64 `json:"avg_read_depth"` // Average furthest progress per session, in percent
+}
+
+// ContentDay is one day of a post or guide's timeline
+type ContentDay struct {
+	Day            string  `json:"day"`
+	Views          int     `json:"views"`
+	UniqueVisitors int     `json:"unique_visitors"`
+	Reads          int     `json:"reads"`
+	AvgReadDepth   float64 `json:"avg_read_depth"`
+}
+
+// ContentBreakdownItem is the view count for one referrer, UTM value or device
+type ContentBreakdownItem struct {
+	Value string `json:"value"`
+	Views int    `json:"views"`
+}
+
+// ContentAnalyticsReport is the response of GET /admin/analytics/content
+type ContentAnalyticsReport struct {
+	From       string                            `json:"from"`
+	To         string                            `json:"to"`
+	Content    *ContentStats                     `json:"content,omitempty"`  // Set when reporting on one item
+	Timeline   []ContentDay                      `json:"timeline,omitempty"` // Set when reporting on one item
+	TopContent []ContentStats                    `json:"top_content,omitempty"`
+	Breakdowns map[string][]ContentBreakdownItem `json:"breakdowns"`
+}
+
+// BackInStockRequest is the payload for POST /products/{slug}/notify-me
+type BackInStockRequest struct {
+	Email     string `json:"email"`
+	VariantID string `json:"variant_id,omitempty"`
+}
+
+// BackInStockSubscription is a shopper waiting for a product or variant to be restocked
+type BackInStockSubscription struct {
+	ID        string  `json:"id"`
+	ProductID string  `json:"product_id"`
+	VariantID *string `json:"variant_id,omitempty"`
+	Email     string  `json:"email"`
+	CreatedAt string  `json:"created_at"`
+}
+
+// ProductCategory represents a shop category, optionally nested under a parent
+type ProductCategory struct {
+	ID           string  `json:"id"`
+	Slug         string  `json:"slug"`
+	Name         string  `json:"name"`
+	Description  string  `json:"description"`
+	ParentID     *string `json:"parent_id"`
+	ImageURL     string  `json:"image_url"`
+	DisplayOrder int     `json:"display_order"`
+	IsFeatured   bool    `json:"is_featured"`
+	Path         string  `json:"path"` // Slash-separated slugs from the root, e.g. "furniture/chairs"
+	CreatedAt    string  `json:"created_at"`
+	UpdatedAt    string  `json:"updated_at"`
+}
+
+// CategoryNode is a category with its product counts and nested children
+type CategoryNode struct {
+	ProductCategory
+	ProductCount      int             `json:"product_count"`       // Active products directly in this category
+	TotalProductCount int             `json:"total_product_count"` // Including all descendants
+	Children          []*CategoryNode `json:"children"`
+}
+
+// CategoryBreadcrumb is one step on the path from the root to a category
+type CategoryBreadcrumb struct {
+	ID   string `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// CategoryDetail is a category together with its breadcrumb trail and direct children
+type CategoryDetail struct {
+	ProductCategory
+	Breadcrumbs []CategoryBreadcrumb `json:"breadcrumbs"`
+	Children    []ProductCategory    `json:"children"`
+}
+
+// CollectionRule is a single condition of a smart collection
+type CollectionRule struct {
+	Type   string   `json:"type"`             // tag_contains, category_in, price_below, on_sale, created_within_days, product_type
+	Value  string   `json:"value,omitempty"`  // Tag for tag_contains, type for product_type
+	Values []string `json:"values,omitempty"` // Category slugs for category_in
+	Amount float64  `json:"amount,omitempty"` // Threshold for price_below
+	Days   int      `json:"days,omitempty"`   // Window for created_within_days
+}
+
 // BlogCategory represents a simple blog category
 type BlogCategory struct {
 	ID          int    `json:"id"`
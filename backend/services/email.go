@@ -2,61 +2,116 @@ package services
 
 import (
 	"blog-backend/config"
+	"errors"
 	"fmt"
+	"html"
 	"log"
+	"net/textproto"
 	"strings"
 	"time"
-
-	resend "github.com/resend/resend-go/v2"
 )
 
 // EmailService handles all email operations
 type EmailService struct {
-	client     *resend.Client
+	sender     EmailSender
 	fromEmail  string
 	fromName   string
 	websiteURL string
+	ownerEmail string
+	templates  *EmailTemplates
+
+	webhookSecret string
 }
 
 // NewEmailService creates a new email service
 func NewEmailService(cfg *config.Config) *EmailService {
-	var client *resend.Client
-	if cfg.ResendAPIKey != "" {
-		client = resend.NewClient(cfg.ResendAPIKey)
-		log.Println("✅ Email service initialized with Resend")
+	sender, err := NewEmailSender(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up email transport: %v", err)
+	}
+	if sender != nil {
+		log.Printf("✅ Email service initialized with %s", sender.Name())
 	} else {
-		log.Println("⚠️  Email service disabled - no RESEND_API_KEY provided")
+		log.Println("⚠️  Email service disabled - no RESEND_API_KEY or EMAIL_TRANSPORT provided")
+	}
+
+	templates, err := NewEmailTemplates(cfg.WebsiteURL)
+	if err != nil {
+		log.Fatalf("Failed to parse email templates: %v", err)
 	}
 
 	return &EmailService{
-		client:     client,
+		sender:     sender,
 		fromEmail:  cfg.FromEmail,
 		fromName:   "BetaDomot",
 		websiteURL: cfg.WebsiteURL,
+		ownerEmail: cfg.ShopOwnerEmail,
+		templates:  templates,
+
+		webhookSecret: cfg.ResendWebhookSecret,
+	}
+}
+
+// Templates returns the templates emails are rendered from
+func (e *EmailService) Templates() *EmailTemplates {
+	return e.templates
+}
+
+// Placeholders in newsletter HTML that are replaced with each recipient's own links
+const (
+	UnsubscribeURLPlaceholder = "{{unsubscribe_url}}"
+	PreferencesURLPlaceholder = "{{preferences_url}}"
+)
+
+// SubscriberLinks are a newsletter subscriber's signed unsubscribe and preference center links
+type SubscriberLinks struct {
+	UnsubscribeURL string
+	PreferencesURL string
+}
+
+// Personalize fills the link placeholders of a newsletter's HTML
+func (l SubscriberLinks) Personalize(html string) string {
+	return strings.NewReplacer(
+		UnsubscribeURLPlaceholder, l.UnsubscribeURL,
+		PreferencesURLPlaceholder, l.PreferencesURL,
+	).Replace(html)
+}
+
+// Headers returns the List-Unsubscribe headers for RFC 8058 one-click unsubscribe
+func (l SubscriberLinks) Headers() map[string]string {
+	return map[string]string{
+		"List-Unsubscribe":      "<" + l.UnsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
 	}
 }
 
 // SendWelcomeEmail sends a welcome email to new newsletter subscribers
-func (e *EmailService) SendWelcomeEmail(email string) error {
-	if e.client == nil {
+func (e *EmailService) SendWelcomeEmail(email string, links SubscriberLinks) error {
+	if e.sender == nil {
 		log.Printf("Skipping welcome email for %s - email service not configured", email)
 		return nil
 	}
 
+	rendered, err := e.templates.Render(EmailTemplateWelcome, WelcomeEmail{Email: email})
+	if err != nil {
+		log.Printf("Failed to render welcome email for %s: %v", email, err)
+		return err
+	}
+
 	// Format the from field properly
 	fromField := e.fromEmail
 	if e.fromName != "" {
 		fromField = fmt.Sprintf("%s <%s>", e.fromName, e.fromEmail)
 	}
 
-	emailRequest := &resend.SendEmailRequest{
+	emailRequest := &OutgoingEmail{
 		From:    fromField,
 		To:      []string{email},
-		Subject: "Welcome to Betadomot",
-		Html:    e.getWelcomeEmailHTML(),
-		Text:    e.getWelcomeEmailText(), // Add plain text version
+		Subject: rendered.Subject,
+		HTML:    links.Personalize(rendered.HTML),
+		Text:    links.Personalize(rendered.Text),
 		Headers: map[string]string{
-			"List-Unsubscribe":       fmt.Sprintf("<%s/newsletter/unsubscribe>", e.websiteURL),
+			"List-Unsubscribe":       fmt.Sprintf("<%s>", links.UnsubscribeURL),
 			"List-Unsubscribe-Post":  "List-Unsubscribe=One-Click",
 			"X-Entity-Ref-ID":        "welcome-email",
 			"X-Priority":             "3",
@@ -68,106 +123,161 @@ func (e *EmailService) SendWelcomeEmail(email string) error {
 		},
 	}
 
-	response, err := e.client.Emails.Send(emailRequest)
+	id, err := e.sender.Send(emailRequest)
 	if err != nil {
 		log.Printf("Failed to send welcome email to %s: %v", email, err)
 		log.Printf("Email request details: From=%s, To=%s, Subject=%s", emailRequest.From, emailRequest.To, emailRequest.Subject)
 		return err
 	}
 	
-	log.Printf("✅ Welcome email sent to %s (ID: %s)", email, response.Id)
+	log.Printf("✅ Welcome email sent to %s (ID: %s)", email, id)
 	return nil
 }
 
-// SendNewsletter sends a newsletter to all active subscribers
-func (e *EmailService) SendNewsletter(subject, content, htmlContent string, recipients []string) error {
-	if e.client == nil {
-		return fmt.Errorf("email service not configured")
+// SendSubscriptionConfirmation sends a new subscriber the link that confirms their
+// subscription. Nothing else is sent to them until they click it.
+func (e *EmailService) SendSubscriptionConfirmation(email, confirmURL string, expiresAt time.Time) error {
+	if e.sender == nil {
+		log.Printf("[Email] Skipping subscription confirmation for %s - email service not configured", email)
+		return nil
 	}
 
-	if len(recipients) == 0 {
-		return fmt.Errorf("no recipients provided")
+	rendered, err := e.templates.Render(EmailTemplateSubscriptionConfirmation, SubscriptionConfirmationEmail{
+		Email:      email,
+		ConfirmURL: confirmURL,
+		ExpiresAt:  expiresAt,
+	})
+	if err != nil {
+		log.Printf("[Email] ❌ Failed to render subscription confirmation for %s: %v", email, err)
+		return err
 	}
 
-	// Use HTML content if provided, otherwise convert markdown to HTML
-	finalHTMLContent := htmlContent
-	if finalHTMLContent == "" {
-		finalHTMLContent = e.getNewsletterHTML(subject, content)
+	fromField := e.fromEmail
+	if e.fromName != "" {
+		fromField = fmt.Sprintf("%s <%s>", e.fromName, e.fromEmail)
 	}
 
-	log.Printf("📧 Sending newsletter '%s' to %d recipients", subject, len(recipients))
+	id, err := e.sender.Send(&OutgoingEmail{
+		From:    fromField,
+		To:      []string{email},
+		Subject: rendered.Subject,
+		HTML:    rendered.HTML,
+		Text:    rendered.Text,
+	})
+	if err != nil {
+		log.Printf("[Email] ❌ Failed to send subscription confirmation to %s: %v", email, err)
+		return err
+	}
 
-	// Send to all recipients in batches (Resend has rate limits)
-	var errors []string
-	successCount := 0
-	batchSize := 10 // Send in batches of 10 to avoid rate limits
+	log.Printf("[Email] ✅ Subscription confirmation sent to %s (ID: %s)", email, id)
+	return nil
+}
 
-	for i := 0; i < len(recipients); i += batchSize {
-		end := i + batchSize
-		if end > len(recipients) {
-			end = len(recipients)
-		}
+// NewsletterMessage is one newsletter email to one recipient
+type NewsletterMessage struct {
+	To             string
+	Subject        string
+	HTML           string
+	Text           string
+	Headers        map[string]string
+	IdempotencyKey string // Resend drops repeat sends with the same key for 24 hours
+}
 
-		batch := recipients[i:end]
+// SendNewsletterMessage sends a single newsletter email and returns the transport's message id
+func (e *EmailService) SendNewsletterMessage(msg NewsletterMessage) (string, error) {
+	if e.sender == nil {
+		return "", fmt.Errorf("email service not configured")
+	}
 
-		for _, recipient := range batch {
-			emailRequest := &resend.SendEmailRequest{
-				From:    e.fromEmail,
-				To:      []string{recipient},
-				Subject: subject,
-				Html:    finalHTMLContent,
-			}
+	fromField := e.fromEmail
+	if e.fromName != "" {
+		fromField = fmt.Sprintf("%s <%s>", e.fromName, e.fromEmail)
+	}
 
-			_, err := e.client.Emails.Send(emailRequest)
-			if err != nil {
-				errors = append(errors, fmt.Sprintf("%s: %v", recipient, err))
-				log.Printf("❌ Failed to send to %s: %v", recipient, err)
-			} else {
-				successCount++
-				log.Printf("✅ Newsletter sent to %s", recipient)
-			}
+	return e.sender.Send(&OutgoingEmail{
+		From:           fromField,
+		To:             []string{msg.To},
+		Subject:        msg.Subject,
+		HTML:           msg.HTML,
+		Text:           msg.Text,
+		Headers:        msg.Headers,
+		IdempotencyKey: msg.IdempotencyKey,
+	})
+}
 
-			// Small delay to respect rate limits
-			time.Sleep(100 * time.Millisecond)
-		}
+// Capture returns the messages kept by a transport that doesn't deliver, or nil when
+// email goes out for real
+func (e *EmailService) Capture() EmailCapture {
+	capture, _ := e.sender.(EmailCapture)
+	return capture
+}
 
-		// Longer delay between batches
-		if end < len(recipients) {
-			time.Sleep(1 * time.Second)
-		}
+// IsTransientEmailError reports whether a send failed for a reason worth retrying:
+// network errors, rate limiting and server errors. Rejected messages are permanent.
+func IsTransientEmailError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrEmailRejected) {
+		return false
 	}
 
-	log.Printf("📊 Newsletter sending complete: %d successful, %d failed", successCount, len(errors))
+	// SMTP servers answer 4xx for temporary failures and 5xx for permanent ones
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code < 500
+	}
 
-	if len(errors) > 0 && successCount == 0 {
-		return fmt.Errorf("failed to send to all recipients: %s", strings.Join(errors, "; "))
+	message := strings.ToLower(err.Error())
+
+	// The Resend client prefixes errors it got back from the API
+	if !strings.HasPrefix(message, "[error]") {
+		return true
 	}
+	for _, transient := range []string{"too many requests", "rate limit", "internal server error", "service unavailable", "bad gateway", "gateway timeout", "timeout", "unknown error"} {
+		if strings.Contains(message, transient) {
+			return true
+		}
+	}
+	return false
+}
 
-	return nil
+// RenderNewsletter renders a Markdown newsletter campaign. The unsubscribe and
+// preference links are left as placeholders for SubscriberLinks.Personalize.
+func (e *EmailService) RenderNewsletter(subject, content string) (*RenderedEmail, error) {
+	return e.templates.Render(EmailTemplateNewsletter, NewsletterEmail{Subject: subject, Content: content})
 }
 
 // SendTestNewsletter sends a test newsletter to a single email
-func (e *EmailService) SendTestNewsletter(testEmail, subject, content, htmlContent string) error {
-	if e.client == nil {
+func (e *EmailService) SendTestNewsletter(testEmail, subject, content, htmlContent string, links SubscriberLinks) error {
+	if e.sender == nil {
 		return fmt.Errorf("email service not configured")
 	}
 
-	finalHTMLContent := htmlContent
-	if finalHTMLContent == "" {
-		finalHTMLContent = e.getNewsletterHTML(subject, content)
+	var rendered *RenderedEmail
+	if htmlContent != "" {
+		htmlContent = InlineCSS(htmlContent)
+		rendered = &RenderedEmail{HTML: htmlContent, Text: HTMLToText(htmlContent)}
+	} else {
+		var err error
+		if rendered, err = e.RenderNewsletter(subject, content); err != nil {
+			return err
+		}
 	}
 
 	// Add test prefix to subject
 	testSubject := "[TEST] " + subject
 
-	emailRequest := &resend.SendEmailRequest{
+	emailRequest := &OutgoingEmail{
 		From:    e.fromEmail,
 		To:      []string{testEmail},
 		Subject: testSubject,
-		Html:    finalHTMLContent,
+		HTML:    links.Personalize(rendered.HTML),
+		Text:    links.Personalize(rendered.Text),
+		Headers: links.Headers(),
 	}
 
-	_, err := e.client.Emails.Send(emailRequest)
+	_, err := e.sender.Send(emailRequest)
 	if err != nil {
 		log.Printf("Failed to send test newsletter to %s: %v", testEmail, err)
 		return err
@@ -177,216 +287,6 @@ func (e *EmailService) SendTestNewsletter(testEmail, subject, content, htmlConte
 	return nil
 }
 
-// getWelcomeEmailHTML returns the HTML template for welcome emails
-func (e *EmailService) getWelcomeEmailHTML() string {
-	return `
-	<!DOCTYPE html>
-	<html>
-	<head>
-		<meta charset="utf-8">
-		<meta name="viewport" content="width=device-width, initial-scale=1">
-		<title>From our home to yours, welcome 🤎</title>
-		<link href="https://fonts.googleapis.com/css2?family=Inter:wght@300;400;500;600&display=swap" rel="stylesheet">
-		<style>
-			@media only screen and (max-width: 600px) {
-				.container { width: 100% !important; margin: 0 !important; }
-				.content { padding: 30px 20px !important; }
-				.header { padding: 50px 20px 30px 20px !important; }
-				.logo { height: 35px !important; }
-				.greeting { font-size: 18px !important; }
-				.main-text { font-size: 16px !important; }
-				.signature { font-size: 15px !important; }
-			}
-		</style>
-	</head>
-	<body style="font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; margin: 0; padding: 0; background-color: #ffffff; color: #000000; line-height: 1.7; -webkit-font-smoothing: antialiased;">
-		
-		<div class="container" style="max-width: 580px; margin: 0 auto; background: #ffffff;">
-			
-			<!-- Header with Logo -->
-			<div class="header" style="padding: 60px 40px 40px 40px; text-align: center; background: #ffffff;">
-				<div style="margin-bottom: 0;">
-					<!-- Email-optimized logo -->
-					<img src="` + e.websiteURL + `/images/blog/beta-logo-email.png" alt="BetaDomot" class="logo" style="height: 40px; width: auto; display: block; margin: 0 auto;" onerror="this.style.display='none'; this.nextElementSibling.style.display='block';" />
-					
-					<!-- Fallback text logo (hidden by default) -->
-					<div style="display: none; font-family: 'Inter', sans-serif; font-weight: 600; font-size: 24px; color: #000000; letter-spacing: -0.5px;">
-						BetaDomot
-					</div>
-				</div>
-			</div>
-			
-			<!-- Main Content -->
-			<div class="content" style="padding: 0 40px 50px 40px;">
-				
-				<!-- Greeting -->
-				<div style="margin-bottom: 40px;">
-					<p class="greeting" style="font-family: 'Inter', sans-serif; font-weight: 400; font-size: 20px; color: #000000; margin: 0; line-height: 1.6;">
-						Hey there,
-					</p>
-				</div>
-				
-				<!-- Main Message -->
-				<div style="margin-bottom: 40px;">
-					<p class="main-text" style="font-family: 'Inter', sans-serif; font-weight: 400; font-size: 17px; color: #000000; margin: 0 0 24px 0; line-height: 1.7;">
-						Welcome to Betadomot! We're truly glad you're here.
-					</p>
-					
-					<p class="main-text" style="font-family: 'Inter', sans-serif; font-weight: 400; font-size: 17px; color: #000000; margin: 0 0 24px 0; line-height: 1.7;">
-						This isn't just a home platform. It's a growing space created to help people like you live more intentionally, comfortably, and beautifully , one day at a time.
-					</p>
-					
-					<p class="main-text" style="font-family: 'Inter', sans-serif; font-weight: 400; font-size: 17px; color: #000000; margin: 0 0 24px 0; line-height: 1.7;">
-						Over the coming days, we'll be sharing tips, tools, and simple ideas to help make daily life at home a little easier, calmer, and smarter.
-					</p>
-					
-					<p class="main-text" style="font-family: 'Inter', sans-serif; font-weight: 400; font-size: 17px; color: #000000; margin: 0 0 24px 0; line-height: 1.7;">
-						No pressure. No clutter. Just good things for good living.
-					</p>
-					
-					<p class="main-text" style="font-family: 'Inter', sans-serif; font-weight: 400; font-size: 17px; color: #000000; margin: 0; line-height: 1.7;">
-						We're always here if you have any questions or thoughts, just reply to this email, and you'll reach a real human.
-					</p>
-				</div>
-				
-				<!-- Signature -->
-				<div style="margin-bottom: 50px;">
-					<p class="signature" style="font-family: 'Inter', sans-serif; font-weight: 400; font-size: 17px; color: #000000; margin: 0 0 8px 0; line-height: 1.7;">
-						With warmth,
-					</p>
-					<p class="signature" style="font-family: 'Inter', sans-serif; font-weight: 500; font-size: 17px; color: #000000; margin: 0; line-height: 1.7;">
-						The Betadomot Team
-					</p>
-				</div>
-				
-				<!-- Subtle Footer -->
-				<div style="text-align: center; padding-top: 40px; border-top: 1px solid #f5f5f5;">
-					<p style="font-family: 'Inter', sans-serif; font-weight: 300; font-size: 14px; color: #888888; margin: 0; line-height: 1.6;">
-						<a href="` + e.websiteURL + `" style="color: #000000; text-decoration: none;">betadomot.blog</a>
-					</p>
-				</div>
-				
-			</div>
-			
-		</div>
-		
-	</body>
-	</html>`
-}
-
-// getNewsletterHTML returns a professional HTML template for newsletters
-func (e *EmailService) getNewsletterHTML(subject, content string) string {
-	currentDate := time.Now().Format("January 2, 2006")
-
-	return fmt.Sprintf(`
-	<!DOCTYPE html>
-	<html>
-	<head>
-		<meta charset="utf-8">
-		<meta name="viewport" content="width=device-width, initial-scale=1">
-		<title>%s</title>
-		<style>
-			@media only screen and (max-width: 600px) {
-				.container { width: 100%% !important; }
-				.content { padding: 15px !important; }
-			}
-		</style>
-	</head>
-	<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; line-height: 1.6; color: #333; margin: 0; padding: 0; background-color: #f5f6fa;">
-		<div class="container" style="max-width: 600px; margin: 0 auto; background: white;">
-			<!-- Header -->
-			<div style="background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); padding: 40px 30px; text-align: center;">
-				<h1 style="color: white; margin: 0; font-size: 28px; font-weight: 700;">📧 Newsletter</h1>
-				<p style="color: rgba(255,255,255,0.9); margin: 10px 0 0 0; font-size: 16px;">%s</p>
-			</div>
-			
-			<!-- Content -->
-			<div class="content" style="padding: 40px 30px;">
-				<h2 style="color: #2d5a87; margin: 0 0 20px 0; font-size: 24px;">%s</h2>
-				
-				<div style="color: #444; line-height: 1.8; font-size: 16px;">
-					%s
-				</div>
-				
-				<div style="margin: 40px 0; padding: 25px; background: #f8f9fa; border-radius: 10px; border-left: 4px solid #667eea;">
-					<p style="margin: 0; color: #666; font-style: italic;">
-						💡 <strong>Tip:</strong> Forward this newsletter to friends who might be interested in home design!
-					</p>
-				</div>
-				
-				<div style="text-align: center; margin: 30px 0;">
-					<a href="%s/blog" style="background: #667eea; color: white; padding: 15px 30px; text-decoration: none; border-radius: 25px; font-weight: 600; display: inline-block;">Visit Our Blog</a>
-				</div>
-			</div>
-			
-			<!-- Footer -->
-			<div style="background: #f8f9fa; padding: 30px; text-align: center; border-top: 1px solid #eee;">
-				<p style="margin: 0 0 15px 0; color: #666; font-size: 14px;">
-					Thanks for reading! We hope you found this newsletter helpful.
-				</p>
-				<p style="margin: 0 0 15px 0; color: #888; font-size: 12px;">
-					You're receiving this because you subscribed to our newsletter.
-				</p>
-				<p style="margin: 0; color: #999; font-size: 12px;">
-					<a href="%s/newsletter/unsubscribe" style="color: #667eea; text-decoration: none;">Unsubscribe</a> | 
-					<a href="%s" style="color: #667eea; text-decoration: none;">Visit Website</a>
-				</p>
-			</div>
-		</div>
-	</body>
-	</html>`, subject, currentDate, subject, e.formatContentForHTML(content), e.websiteURL, e.websiteURL, e.websiteURL)
-}
-
-// formatContentForHTML converts markdown-like content to HTML
-func (e *EmailService) formatContentForHTML(content string) string {
-	// Simple markdown to HTML conversion
-	html := content
-
-	// Convert headings
-	html = strings.ReplaceAll(html, "# ", "<h1>")
-	html = strings.ReplaceAll(html, "## ", "<h2>")
-	html = strings.ReplaceAll(html, "### ", "<h3>")
-
-	// Convert bold and italic
-	html = strings.ReplaceAll(html, "**", "<strong>")
-	html = strings.ReplaceAll(html, "*", "<em>")
-
-	// Convert line breaks
-	html = strings.ReplaceAll(html, "\n\n", "</p><p>")
-	html = strings.ReplaceAll(html, "\n", "<br>")
-
-	// Convert bullet points
-	html = strings.ReplaceAll(html, "- ", "<li>")
-
-	// Wrap in paragraph tags if not already wrapped
-	if !strings.HasPrefix(html, "<") {
-		html = "<p>" + html + "</p>"
-	}
-
-	return html
-}
-
-// getWelcomeEmailText returns the plain text version of the welcome email
-func (e *EmailService) getWelcomeEmailText() string {
-	return fmt.Sprintf(`Hey there,
-
-Welcome to Betadomot — we're truly glad you're here.
-
-This isn't just a home platform. It's a growing space created to help people like you live more intentionally, comfortably, and beautifully — one day at a time.
-
-Over the coming days, we'll be sharing tips, tools, and simple ideas to help make daily life at home a little easier, calmer, and smarter.
-
-No pressure. No clutter. Just good things for good living.
-
-We're always here if you have any questions or thoughts — just reply to this email, and you'll reach a real human.
-
-With warmth,
-The Betadomot Team
-
----
-%s`, e.websiteURL)
-}
-
 // OrderConfirmationData holds data for order confirmation emails
 type OrderConfirmationData struct {
 	OrderNumber     string
@@ -404,22 +304,35 @@ type OrderConfirmationData struct {
 // OrderItem represents an item in the order
 type OrderItem struct {
 	Name     string  `json:"name"`
+	Variant  string  `json:"variant,omitempty"` // Purchased option, e.g. "Large" or "Oak"
+	SKU      string  `json:"sku,omitempty"`
 	Quantity int     `json:"quantity"`
 	Price    float64 `json:"price"`
 	Image    string  `json:"image"`
 }
 
+// Total is the price of the line: unit price times quantity
+func (i OrderItem) Total() float64 {
+	return i.Price * float64(i.Quantity)
+}
+
 // SendOrderConfirmation sends an order confirmation email
 func (e *EmailService) SendOrderConfirmation(data OrderConfirmationData) error {
 	log.Printf("[Email] SendOrderConfirmation called for %s", data.CustomerEmail)
 	
-	if e.client == nil {
+	if e.sender == nil {
 		log.Printf("[Email] ⚠️  Skipping order confirmation for %s - email service not configured (client is nil)", data.CustomerEmail)
 		return fmt.Errorf("email service not configured")
 	}
 
 	log.Printf("[Email] Email client is configured, preparing email for %s", data.CustomerEmail)
 
+	rendered, err := e.templates.Render(EmailTemplateOrderConfirmation, data)
+	if err != nil {
+		log.Printf("[Email] ❌ Failed to render order confirmation for %s: %v", data.CustomerEmail, err)
+		return err
+	}
+
 	fromField := e.fromEmail
 	if e.fromName != "" {
 		fromField = fmt.Sprintf("%s <%s>", e.fromName, e.fromEmail)
@@ -428,12 +341,12 @@ func (e *EmailService) SendOrderConfirmation(data OrderConfirmationData) error {
 	log.Printf("[Email] From field: %s", fromField)
 	log.Printf("[Email] Order details: %s, Total: %.2f, Items: %d", data.OrderNumber, data.Total, len(data.Items))
 
-	emailRequest := &resend.SendEmailRequest{
+	emailRequest := &OutgoingEmail{
 		From:    fromField,
 		To:      []string{data.CustomerEmail},
-		Subject: fmt.Sprintf("Order confirmed — %s", data.OrderNumber),
-		Html:    e.getOrderConfirmationHTML(data),
-		Text:    e.getOrderConfirmationText(data),
+		Subject: rendered.Subject,
+		HTML:    rendered.HTML,
+		Text:    rendered.Text,
 		Headers: map[string]string{
 			"X-Entity-Ref-ID":   fmt.Sprintf("order-%s", data.OrderNumber),
 			"Reply-To":          e.fromEmail,
@@ -446,291 +359,460 @@ func (e *EmailService) SendOrderConfirmation(data OrderConfirmationData) error {
 	}
 
 	log.Printf("[Email] Sending email via Resend API...")
-	response, err := e.client.Emails.Send(emailRequest)
+	id, err := e.sender.Send(emailRequest)
 	if err != nil {
 		log.Printf("[Email] ❌ Failed to send order confirmation to %s: %v", data.CustomerEmail, err)
 		return err
 	}
 
-	log.Printf("[Email] ✅ Order confirmation sent to %s (ID: %s)", data.CustomerEmail, response.Id)
+	log.Printf("[Email] ✅ Order confirmation sent to %s (ID: %s)", data.CustomerEmail, id)
 	return nil
 }
 
-// getOrderConfirmationHTML returns the HTML template for order confirmation
-func (e *EmailService) getOrderConfirmationHTML(data OrderConfirmationData) string {
-	// Build items HTML
-	itemsHTML := ""
-	for _, item := range data.Items {
-		itemTotal := item.Price * float64(item.Quantity)
-		itemsHTML += fmt.Sprintf(`
+// LowStockItem describes a product or variant at or below its reorder threshold
+type LowStockItem struct {
+	Name      string
+	Variant   string
+	SKU       string
+	Stock     int
+	Threshold int
+}
+
+// SendLowStockAlert tells the shop owner that a sale just pushed an item below its threshold
+func (e *EmailService) SendLowStockAlert(item LowStockItem) error {
+	name := item.Name
+	if item.Variant != "" {
+		name = fmt.Sprintf("%s — %s", item.Name, item.Variant)
+	}
+	subject := fmt.Sprintf("Low stock: %s (%d left)", name, item.Stock)
+	return e.sendLowStockEmail(subject, "An order just took this item below its reorder threshold.", []LowStockItem{item})
+}
+
+// SendLowStockDigest sends the shop owner the daily list of low-stock items
+func (e *EmailService) SendLowStockDigest(items []LowStockItem) error {
+	subject := fmt.Sprintf("Low-stock digest — %d item(s) to reorder", len(items))
+	return e.sendLowStockEmail(subject, "These items are at or below their reorder threshold.", items)
+}
+
+func (e *EmailService) sendLowStockEmail(subject, intro string, items []LowStockItem) error {
+	if e.sender == nil {
+		log.Printf("[Email] Skipping low-stock email - email service not configured")
+		return nil
+	}
+	if e.ownerEmail == "" {
+		log.Printf("[Email] Skipping low-stock email - SHOP_OWNER_EMAIL not set")
+		return nil
+	}
+
+	fromField := e.fromEmail
+	if e.fromName != "" {
+		fromField = fmt.Sprintf("%s <%s>", e.fromName, e.fromEmail)
+	}
+
+	rowsHTML := ""
+	rowsText := ""
+	for _, item := range items {
+		name := item.Name
+		if item.Variant != "" {
+			name = fmt.Sprintf("%s — %s", item.Name, item.Variant)
+		}
+		rowsHTML += fmt.Sprintf(`
 		<tr>
-			<td style="padding: 20px 0; border-bottom: 1px solid #f5f5f5;">
-				<table cellpadding="0" cellspacing="0" border="0" width="100%%">
-					<tr>
-						<td width="80" style="padding-right: 20px;">
-							<img src="%s" alt="%s" style="width: 80px; height: 80px; object-fit: cover; border-radius: 4px; display: block;" />
-						</td>
-						<td style="vertical-align: top;">
-							<p style="font-family: 'Inter', sans-serif; font-weight: 500; font-size: 16px; color: #000000; margin: 0 0 8px 0;">%s</p>
-							<p style="font-family: 'Inter', sans-serif; font-weight: 300; font-size: 14px; color: #666666; margin: 0;">Quantity: %d</p>
-						</td>
-						<td style="text-align: right; vertical-align: top; white-space: nowrap;">
-							<p style="font-family: 'Inter', sans-serif; font-weight: 400; font-size: 16px; color: #000000; margin: 0;">₦%.2f</p>
-						</td>
-					</tr>
-				</table>
-			</td>
-		</tr>`, item.Image, item.Name, item.Name, item.Quantity, itemTotal)
-	}
-
-	// Build shipping address
-	addressHTML := ""
-	if addr, ok := data.ShippingAddress["address"].(string); ok {
-		addressHTML += addr + "<br>"
-	}
-	if city, ok := data.ShippingAddress["city"].(string); ok {
-		addressHTML += city
-	}
-	if state, ok := data.ShippingAddress["state"].(string); ok {
-		addressHTML += ", " + state
-	}
-
-	return fmt.Sprintf(`
+			<td style="padding: 12px 0; border-bottom: 1px solid #f5f5f5; font-size: 15px; color: #000000;">%s<br><span style="font-size: 13px; color: #999999;">%s</span></td>
+			<td style="padding: 12px 0; border-bottom: 1px solid #f5f5f5; font-size: 15px; color: #000000; text-align: right;">%d</td>
+			<td style="padding: 12px 0; border-bottom: 1px solid #f5f5f5; font-size: 15px; color: #666666; text-align: right;">%d</td>
+		</tr>`, name, item.SKU, item.Stock, item.Threshold)
+		rowsText += fmt.Sprintf("- %s [%s]: %d left (threshold %d)\n", name, item.SKU, item.Stock, item.Threshold)
+	}
+
+	html := fmt.Sprintf(`
 	<!DOCTYPE html>
 	<html>
 	<head>
 		<meta charset="utf-8">
 		<meta name="viewport" content="width=device-width, initial-scale=1">
-		<title>Order Confirmed</title>
-		<link href="https://fonts.googleapis.com/css2?family=Inter:wght@300;400;500;600&display=swap" rel="stylesheet">
-		<style>
-			@media only screen and (max-width: 600px) {
-				.container { width: 100%% !important; margin: 0 !important; }
-				.content { padding: 30px 20px !important; }
-				.header { padding: 50px 20px 30px 20px !important; }
+		<title>%s</title>
+	</head>
+	<body style="font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; margin: 0; padding: 0; background-color: #fafafa; color: #000000;">
+		<div style="max-width: 600px; margin: 40px auto; background: #ffffff; padding: 40px;">
+			<h1 style="font-weight: 400; font-size: 24px; margin: 0 0 12px 0;">Low stock</h1>
+			<p style="font-weight: 300; font-size: 15px; color: #666666; margin: 0 0 30px 0;">%s</p>
+			<table cellpadding="0" cellspacing="0" border="0" width="100%%">
+				<tr>
+					<th style="text-align: left; font-size: 12px; font-weight: 500; color: #999999; text-transform: uppercase; padding-bottom: 8px;">Item</th>
+					<th style="text-align: right; font-size: 12px; font-weight: 500; color: #999999; text-transform: uppercase; padding-bottom: 8px;">Stock</th>
+					<th style="text-align: right; font-size: 12px; font-weight: 500; color: #999999; text-transform: uppercase; padding-bottom: 8px;">Threshold</th>
+				</tr>
+				%s
+			</table>
+		</div>
+	</body>
+	</html>`, subject, intro, rowsHTML)
+
+	emailRequest := &OutgoingEmail{
+		From:    fromField,
+		To:      []string{e.ownerEmail},
+		Subject: subject,
+		HTML:    html,
+		Text:    fmt.Sprintf("%s\n\n%s", intro, rowsText),
+		Headers: map[string]string{
+			"X-Entity-Ref-ID": fmt.Sprintf("low-stock-%d", time.Now().Unix()),
+			"X-Mailer":        "Betadomot Shop",
+		},
+	}
+
+	id, err := e.sender.Send(emailRequest)
+	if err != nil {
+		log.Printf("[Email] ❌ Failed to send low-stock email: %v", err)
+		return err
+	}
+
+	log.Printf("[Email] ✅ Low-stock email sent to %s (ID: %s)", e.ownerEmail, id)
+	return nil
+}
+
+// BackInStockItem describes a restocked product or variant for back-in-stock emails
+type BackInStockItem struct {
+	Name    string
+	Variant string
+	Price   float64
+	Image   string
+	URL     string
+}
+
+// SendBackInStock emails shoppers that an item they asked about is available again.
+// Recipients are sent one by one in rate-limited batches; the addresses that were
+// sent successfully are returned so the subscriptions of the rest can be kept.
+func (e *EmailService) SendBackInStock(item BackInStockItem, recipients []string) ([]string, error) {
+	if e.sender == nil {
+		return nil, fmt.Errorf("email service not configured")
+	}
+
+	fromField := e.fromEmail
+	if e.fromName != "" {
+		fromField = fmt.Sprintf("%s <%s>", e.fromName, e.fromEmail)
+	}
+
+	name := item.Name
+	if item.Variant != "" {
+		name = fmt.Sprintf("%s — %s", item.Name, item.Variant)
+	}
+	subject := fmt.Sprintf("Back in stock: %s", name)
+
+	imageHTML := ""
+	if item.Image != "" {
+		imageHTML = fmt.Sprintf(`<img src="%s" alt="%s" style="width: 100%%; height: auto; display: block; margin: 0 0 24px 0;" />`, item.Image, item.Name)
+	}
+
+	html := fmt.Sprintf(`
+	<!DOCTYPE html>
+	<html>
+	<head>
+		<meta charset="utf-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1">
+		<title>%s</title>
+	</head>
+	<body style="font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; margin: 0; padding: 0; background-color: #fafafa; color: #000000;">
+		<div style="max-width: 600px; margin: 40px auto; background: #ffffff; padding: 40px;">
+			<p style="font-size: 12px; font-weight: 500; color: #999999; text-transform: uppercase; letter-spacing: 1px; margin: 0 0 12px 0;">Back in stock</p>
+			<h1 style="font-weight: 400; font-size: 24px; margin: 0 0 24px 0;">%s</h1>
+			%s
+			<p style="font-weight: 300; font-size: 15px; color: #666666; margin: 0 0 30px 0;">Good news — the item you asked about is available again at ₦%.2f. Stock is limited, so it may not last long.</p>
+			<a href="%s" style="display: inline-block; background: #000000; color: #ffffff; text-decoration: none; padding: 14px 28px; font-size: 14px;">Shop now</a>
+			<p style="font-weight: 300; font-size: 13px; color: #999999; margin: 30px 0 0 0;">You're receiving this because you asked to be notified when this item was restocked. We won't email you about it again.</p>
+		</div>
+	</body>
+	</html>`, subject, name, imageHTML, item.Price, item.URL)
+
+	text := fmt.Sprintf(`%s is back in stock
+
+Good news — the item you asked about is available again at ₦%.2f. Stock is limited, so it may not last long.
+
+Shop now: %s
+
+You're receiving this because you asked to be notified when this item was restocked. We won't email you about it again.`, name, item.Price, item.URL)
+
+	log.Printf("[Email] 📧 Sending back-in-stock email for %s to %d recipients", name, len(recipients))
+
+	var sent []string
+	var errors []string
+	batchSize := 10 // Same batching as newsletters to stay within Resend's rate limits
+
+	for i := 0; i < len(recipients); i += batchSize {
+		end := i + batchSize
+		if end > len(recipients) {
+			end = len(recipients)
+		}
+
+		for _, recipient := range recipients[i:end] {
+			_, err := e.sender.Send(&OutgoingEmail{
+				From:    fromField,
+				To:      []string{recipient},
+				Subject: subject,
+				HTML:    html,
+				Text:    text,
+			})
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("%s: %v", recipient, err))
+				log.Printf("[Email] ❌ Failed to send back-in-stock email to %s: %v", recipient, err)
+			} else {
+				sent = append(sent, recipient)
 			}
-		</style>
+
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		if end < len(recipients) {
+			time.Sleep(1 * time.Second)
+		}
+	}
+
+	log.Printf("[Email] 📊 Back-in-stock emails for %s: %d sent, %d failed", name, len(sent), len(errors))
+
+	if len(errors) > 0 && len(sent) == 0 {
+		return nil, fmt.Errorf("failed to send to all recipients: %s", strings.Join(errors, "; "))
+	}
+	return sent, nil
+}
+
+// CommentReplyEmail is the data for a reply notification
+type CommentReplyEmail struct {
+	To             string
+	RecipientName  string
+	ReplierName    string
+	ReplyBody      string
+	PostTitle      string
+	PostURL        string
+	UnsubscribeURL string // One-click unsubscribe from this thread
+}
+
+// SendCommentReply tells a commenter that someone replied to their comment
+func (e *EmailService) SendCommentReply(data CommentReplyEmail) error {
+	if e.sender == nil {
+		log.Printf("[Email] Skipping reply notification for %s - email service not configured", data.To)
+		return nil
+	}
+
+	fromField := e.fromEmail
+	if e.fromName != "" {
+		fromField = fmt.Sprintf("%s <%s>", e.fromName, e.fromEmail)
+	}
+
+	subject := fmt.Sprintf("%s replied to your comment on \"%s\"", data.ReplierName, data.PostTitle)
+	excerpt := commentExcerpt(data.ReplyBody, 600)
+
+	htmlBody := fmt.Sprintf(`
+	<!DOCTYPE html>
+	<html>
+	<head>
+		<meta charset="utf-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1">
+		<title>%s</title>
 	</head>
-	<body style="font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; margin: 0; padding: 0; background-color: #fafafa; color: #000000; -webkit-font-smoothing: antialiased;">
-		
-		<div class="container" style="max-width: 600px; margin: 40px auto; background: #ffffff;">
-			
-			<!-- Header -->
-			<div class="header" style="padding: 60px 40px 40px 40px; text-align: center; background: #ffffff; border-bottom: 1px solid #f5f5f5;">
-				<div style="margin-bottom: 30px;">
-					<svg width="24" height="24" viewBox="0 0 24 24" fill="none" xmlns="http://www.w3.org/2000/svg" style="display: block; margin: 0 auto;">
-						<path d="M20 6L9 17L4 12" stroke="#000000" stroke-width="1.5" stroke-linecap="round" stroke-linejoin="round"/>
-					</svg>
-				</div>
-				<h1 style="font-family: 'Inter', sans-serif; font-weight: 400; font-size: 28px; color: #000000; margin: 0 0 12px 0; letter-spacing: -0.5px;">
-					Order confirmed
-				</h1>
-				<p style="font-family: 'Inter', sans-serif; font-weight: 300; font-size: 16px; color: #666666; margin: 0;">
-					Thank you for your order, %s
-				</p>
-			</div>
-			
-			<!-- Content -->
-			<div class="content" style="padding: 40px;">
-				
-				<!-- Order Number -->
-				<div style="text-align: center; padding: 30px 0; margin-bottom: 40px; border-bottom: 1px solid #f5f5f5;">
-					<p style="font-family: 'Inter', sans-serif; font-weight: 300; font-size: 12px; color: #999999; margin: 0 0 8px 0; text-transform: uppercase; letter-spacing: 1px;">
-						Order number
-					</p>
-					<p style="font-family: 'Inter', sans-serif; font-weight: 500; font-size: 20px; color: #000000; margin: 0;">
-						%s
-					</p>
-				</div>
-				
-				<!-- Order Items -->
-				<div style="margin-bottom: 40px;">
-					<table cellpadding="0" cellspacing="0" border="0" width="100%%">
-						%s
-					</table>
-				</div>
-				
-				<!-- Order Summary -->
-				<div style="margin-bottom: 40px; padding: 30px; background: #fafafa; border-radius: 8px;">
-					<table cellpadding="0" cellspacing="0" border="0" width="100%%">
-						<tr>
-							<td style="padding: 8px 0;">
-								<p style="font-family: 'Inter', sans-serif; font-weight: 300; font-size: 15px; color: #666666; margin: 0;">Subtotal</p>
-							</td>
-							<td style="text-align: right; padding: 8px 0;">
-								<p style="font-family: 'Inter', sans-serif; font-weight: 400; font-size: 15px; color: #000000; margin: 0;">₦%.2f</p>
-							</td>
-						</tr>
-						<tr>
-							<td style="padding: 8px 0;">
-								<p style="font-family: 'Inter', sans-serif; font-weight: 300; font-size: 15px; color: #666666; margin: 0;">Shipping</p>
-							</td>
-							<td style="text-align: right; padding: 8px 0;">
-								<p style="font-family: 'Inter', sans-serif; font-weight: 400; font-size: 15px; color: #000000; margin: 0;">₦%.2f</p>
-							</td>
-						</tr>
-						<tr>
-							<td style="padding: 8px 0;">
-								<p style="font-family: 'Inter', sans-serif; font-weight: 300; font-size: 15px; color: #666666; margin: 0;">Tax</p>
-							</td>
-							<td style="text-align: right; padding: 8px 0;">
-								<p style="font-family: 'Inter', sans-serif; font-weight: 400; font-size: 15px; color: #000000; margin: 0;">₦%.2f</p>
-							</td>
-						</tr>
-						<tr style="border-top: 1px solid #e0e0e0;">
-							<td style="padding: 16px 0 0 0;">
-								<p style="font-family: 'Inter', sans-serif; font-weight: 500; font-size: 17px; color: #000000; margin: 0;">Total</p>
-							</td>
-							<td style="text-align: right; padding: 16px 0 0 0;">
-								<p style="font-family: 'Inter', sans-serif; font-weight: 600; font-size: 17px; color: #000000; margin: 0;">₦%.2f</p>
-							</td>
-						</tr>
-					</table>
-				</div>
-				
-				<!-- Shipping Address -->
-				<div style="margin-bottom: 40px;">
-					<p style="font-family: 'Inter', sans-serif; font-weight: 500; font-size: 14px; color: #000000; margin: 0 0 12px 0; text-transform: uppercase; letter-spacing: 0.5px;">
-						Shipping address
-					</p>
-					<p style="font-family: 'Inter', sans-serif; font-weight: 300; font-size: 15px; color: #666666; margin: 0; line-height: 1.6;">
-						%s
-					</p>
-				</div>
-				
-				<!-- Timeline -->
-				<div style="margin-bottom: 40px; padding: 30px; background: #fafafa; border-radius: 8px;">
-					<p style="font-family: 'Inter', sans-serif; font-weight: 500; font-size: 16px; color: #000000; margin: 0 0 20px 0;">
-						What happens next
-					</p>
-					<table cellpadding="0" cellspacing="0" border="0" width="100%%">
-						<tr>
-							<td width="32" style="padding-right: 16px; padding-bottom: 20px;">
-								<!--[if mso]>
-								<v:roundrect xmlns:v="urn:schemas-microsoft-com:vml" xmlns:w="urn:schemas-microsoft-com:office:word" style="height:32px;width:32px;v-text-anchor:middle;" arcsize="50%%" fillcolor="#000000">
-								<w:anchorlock/>
-								<center style="color:#ffffff;font-family:'Inter',sans-serif;font-size:14px;font-weight:600;">1</center>
-								</v:roundrect>
-								<![endif]-->
-								<!--[if !mso]><!-->
-								<table cellpadding="0" cellspacing="0" border="0" width="32" height="32" style="background: #000000; border-radius: 50%%; mso-hide: all;">
-									<tr>
-										<td align="center" valign="middle" height="32" style="color: #ffffff; font-family: 'Inter', sans-serif; font-size: 14px; font-weight: 600; line-height: 32px; mso-line-height-rule: exactly;">
-											1
-										</td>
-									</tr>
-								</table>
-								<!--<![endif]-->
-							</td>
-							<td style="padding-bottom: 20px; vertical-align: middle;">
-								<p style="font-family: 'Inter', sans-serif; font-weight: 400; font-size: 15px; color: #000000; margin: 0 0 4px 0;">Processing</p>
-								<p style="font-family: 'Inter', sans-serif; font-weight: 300; font-size: 14px; color: #666666; margin: 0;">We're preparing your order</p>
-							</td>
-						</tr>
-						<tr>
-							<td width="32" style="padding-right: 16px; padding-bottom: 20px;">
-								<!--[if mso]>
-								<v:roundrect xmlns:v="urn:schemas-microsoft-com:vml" xmlns:w="urn:schemas-microsoft-com:office:word" style="height:32px;width:32px;v-text-anchor:middle;" arcsize="50%%" fillcolor="#e0e0e0">
-								<w:anchorlock/>
-								<center style="color:#666666;font-family:'Inter',sans-serif;font-size:14px;font-weight:600;">2</center>
-								</v:roundrect>
-								<![endif]-->
-								<!--[if !mso]><!-->
-								<table cellpadding="0" cellspacing="0" border="0" width="32" height="32" style="background: #e0e0e0; border-radius: 50%%; mso-hide: all;">
-									<tr>
-										<td align="center" valign="middle" height="32" style="color: #666666; font-family: 'Inter', sans-serif; font-size: 14px; font-weight: 600; line-height: 32px; mso-line-height-rule: exactly;">
-											2
-										</td>
-									</tr>
-								</table>
-								<!--<![endif]-->
-							</td>
-							<td style="padding-bottom: 20px; vertical-align: middle;">
-								<p style="font-family: 'Inter', sans-serif; font-weight: 400; font-size: 15px; color: #000000; margin: 0 0 4px 0;">Shipping</p>
-								<p style="font-family: 'Inter', sans-serif; font-weight: 300; font-size: 14px; color: #666666; margin: 0;">3–5 business days</p>
-							</td>
-						</tr>
-						<tr>
-							<td width="32" style="padding-right: 16px;">
-								<!--[if mso]>
-								<v:roundrect xmlns:v="urn:schemas-microsoft-com:vml" xmlns:w="urn:schemas-microsoft-com:office:word" style="height:32px;width:32px;v-text-anchor:middle;" arcsize="50%%" fillcolor="#e0e0e0">
-								<w:anchorlock/>
-								<center style="color:#666666;font-family:'Inter',sans-serif;font-size:14px;font-weight:600;">3</center>
-								</v:roundrect>
-								<![endif]-->
-								<!--[if !mso]><!-->
-								<table cellpadding="0" cellspacing="0" border="0" width="32" height="32" style="background: #e0e0e0; border-radius: 50%%; mso-hide: all;">
-									<tr>
-										<td align="center" valign="middle" height="32" style="color: #666666; font-family: 'Inter', sans-serif; font-size: 14px; font-weight: 600; line-height: 32px; mso-line-height-rule: exactly;">
-											3
-										</td>
-									</tr>
-								</table>
-								<!--<![endif]-->
-							</td>
-							<td style="vertical-align: middle;">
-								<p style="font-family: 'Inter', sans-serif; font-weight: 400; font-size: 15px; color: #000000; margin: 0 0 4px 0;">Delivered</p>
-								<p style="font-family: 'Inter', sans-serif; font-weight: 300; font-size: 14px; color: #666666; margin: 0;">Tracking updates via email</p>
-							</td>
-						</tr>
-					</table>
-				</div>
-				
-				<!-- Message -->
-				<div style="text-align: center; margin-bottom: 40px;">
-					<p style="font-family: 'Inter', sans-serif; font-weight: 300; font-size: 15px; color: #666666; margin: 0; line-height: 1.7;">
-						We'll send you shipping updates as your order makes its way to you.
-					</p>
-				</div>
-				
-			</div>
-			
-			<!-- Footer -->
-			<div style="padding: 40px; text-align: center; border-top: 1px solid #f5f5f5; background: #fafafa;">
-				<p style="font-family: 'Inter', sans-serif; font-weight: 300; font-size: 14px; color: #666666; margin: 0 0 12px 0;">
-					Questions about your order?
-				</p>
-				<p style="font-family: 'Inter', sans-serif; font-weight: 400; font-size: 14px; margin: 0;">
-					<a href="mailto:hello@betadomot.blog" style="color: #000000; text-decoration: none; border-bottom: 1px solid #000000;">hello@betadomot.blog</a>
-				</p>
-			</div>
-			
+	<body style="font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; margin: 0; padding: 0; background-color: #fafafa; color: #000000;">
+		<div style="max-width: 600px; margin: 40px auto; background: #ffffff; padding: 40px;">
+			<p style="font-weight: 300; font-size: 15px; color: #666666; margin: 0 0 24px 0;">Hi %s, <strong style="color: #000000; font-weight: 500;">%s</strong> replied to your comment on <em>%s</em>:</p>
+			<blockquote style="margin: 0 0 30px 0; padding: 0 0 0 16px; border-left: 2px solid #000000; font-size: 15px; line-height: 1.6; color: #000000; white-space: pre-line;">%s</blockquote>
+			<a href="%s" style="display: inline-block; background: #000000; color: #ffffff; text-decoration: none; padding: 14px 28px; font-size: 14px;">View the conversation</a>
+			<p style="font-weight: 300; font-size: 13px; color: #999999; margin: 30px 0 0 0;">You're getting this because you commented on Betadomot. <a href="%s" style="color: #999999;">Stop emails about this thread</a>.</p>
 		</div>
-		
 	</body>
-	</html>`, data.CustomerName, data.OrderNumber, itemsHTML, data.Subtotal, data.Shipping, data.Tax, data.Total, addressHTML)
+	</html>`,
+		html.EscapeString(subject), html.EscapeString(data.RecipientName), html.EscapeString(data.ReplierName),
+		html.EscapeString(data.PostTitle), html.EscapeString(excerpt), data.PostURL, data.UnsubscribeURL)
+
+	text := fmt.Sprintf(`Hi %s,
+
+%s replied to your comment on "%s":
+
+%s
+
+View the conversation: %s
+
+Stop emails about this thread: %s`, data.RecipientName, data.ReplierName, data.PostTitle, excerpt, data.PostURL, data.UnsubscribeURL)
+
+	id, err := e.sender.Send(&OutgoingEmail{
+		From:    fromField,
+		To:      []string{data.To},
+		Subject: subject,
+		HTML:    htmlBody,
+		Text:    text,
+		Headers: map[string]string{
+			"List-Unsubscribe":      fmt.Sprintf("<%s>", data.UnsubscribeURL),
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+	if err != nil {
+		log.Printf("[Email] ❌ Failed to send reply notification to %s: %v", data.To, err)
+		return err
+	}
+
+	log.Printf("[Email] ✅ Reply notification sent to %s (ID: %s)", data.To, id)
+	return nil
 }
 
-// getOrderConfirmationText returns plain text version of order confirmation
-func (e *EmailService) getOrderConfirmationText(data OrderConfirmationData) string {
-	itemsList := ""
-	for _, item := range data.Items {
-		itemTotal := item.Price * float64(item.Quantity)
-		itemsList += fmt.Sprintf("- %s (x%d): ₦%.2f\n", item.Name, item.Quantity, itemTotal)
+// CommentEditEmail is the data for the email that carries a commenter's edit link
+type CommentEditEmail struct {
+	To        string
+	Name      string
+	PostTitle string
+	ManageURL string // Page where the comment can be edited or deleted
+	ExpiresAt time.Time
+}
+
+// SendCommentEditLink sends a commenter the private link for editing or deleting their comment
+func (e *EmailService) SendCommentEditLink(data CommentEditEmail) error {
+	if e.sender == nil {
+		log.Printf("[Email] Skipping comment edit link for %s - email service not configured", data.To)
+		return nil
+	}
+
+	fromField := e.fromEmail
+	if e.fromName != "" {
+		fromField = fmt.Sprintf("%s <%s>", e.fromName, e.fromEmail)
 	}
 
-	return fmt.Sprintf(`Order Confirmed
+	subject := fmt.Sprintf("Your comment on \"%s\"", data.PostTitle)
+	expires := data.ExpiresAt.Format("2 Jan 2006 at 15:04 MST")
 
-Thank you for your order, %s!
+	htmlBody := fmt.Sprintf(`
+	<!DOCTYPE html>
+	<html>
+	<head>
+		<meta charset="utf-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1">
+		<title>%s</title>
+	</head>
+	<body style="font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; margin: 0; padding: 0; background-color: #fafafa; color: #000000;">
+		<div style="max-width: 600px; margin: 40px auto; background: #ffffff; padding: 40px;">
+			<p style="font-weight: 300; font-size: 15px; color: #666666; margin: 0 0 24px 0;">Hi %s, thanks for commenting on <em>%s</em>. Spotted a typo or changed your mind? You can edit or delete your comment until %s.</p>
+			<a href="%s" style="display: inline-block; background: #000000; color: #ffffff; text-decoration: none; padding: 14px 28px; font-size: 14px;">Edit your comment</a>
+			<p style="font-weight: 300; font-size: 13px; color: #999999; margin: 30px 0 0 0;">Anyone with this link can change your comment, so please don't forward this email.</p>
+		</div>
+	</body>
+	</html>`,
+		html.EscapeString(subject), html.EscapeString(data.Name), html.EscapeString(data.PostTitle), expires, data.ManageURL)
 
-Order Number: %s
-Order Date: %s
+	text := fmt.Sprintf(`Hi %s,
+
+Thanks for commenting on "%s". Spotted a typo or changed your mind? You can edit or delete your comment until %s:
 
-Items:
 %s
 
-Order Summary:
-Subtotal: ₦%.2f
-Shipping: ₦%.2f
-Tax: ₦%.2f
-Total: ₦%.2f
+Anyone with this link can change your comment, so please don't forward this email.`, data.Name, data.PostTitle, expires, data.ManageURL)
 
-We're preparing your order and will send you shipping updates via email.
+	id, err := e.sender.Send(&OutgoingEmail{
+		From:    fromField,
+		To:      []string{data.To},
+		Subject: subject,
+		HTML:    htmlBody,
+		Text:    text,
+	})
+	if err != nil {
+		log.Printf("[Email] ❌ Failed to send comment edit link to %s: %v", data.To, err)
+		return err
+	}
 
-Expected delivery: 3-5 business days
+	log.Printf("[Email] ✅ Comment edit link sent to %s (ID: %s)", data.To, id)
+	return nil
+}
+
+// CommentDigestPost groups the new comments on one post for the author digest
+type CommentDigestPost struct {
+	Title    string
+	URL      string
+	Comments []CommentDigestEntry
+}
+
+// CommentDigestEntry is one new comment in the author digest
+type CommentDigestEntry struct {
+	AuthorName string
+	Body       string
+	IsReply    bool
+}
 
-Questions? Reply to this email or contact us at hello@betadomot.blog
+// SendCommentDigest sends a post author the new comments on their posts
+func (e *EmailService) SendCommentDigest(to string, posts []CommentDigestPost, pendingCount int) error {
+	if e.sender == nil {
+		log.Printf("[Email] Skipping comment digest for %s - email service not configured", to)
+		return nil
+	}
 
----
-Betadomot`, data.CustomerName, data.OrderNumber, data.OrderDate, itemsList, data.Subtotal, data.Shipping, data.Tax, data.Total)
+	fromField := e.fromEmail
+	if e.fromName != "" {
+		fromField = fmt.Sprintf("%s <%s>", e.fromName, e.fromEmail)
+	}
+
+	total := 0
+	sectionsHTML := ""
+	sectionsText := ""
+	for _, post := range posts {
+		total += len(post.Comments)
+		sectionsHTML += fmt.Sprintf(`
+			<h2 style="font-weight: 400; font-size: 18px; margin: 30px 0 12px 0;"><a href="%s" style="color: #000000; text-decoration: none;">%s</a></h2>`,
+			post.URL, html.EscapeString(post.Title))
+		sectionsText += fmt.Sprintf("\n%s\n%s\n", post.Title, post.URL)
+
+		for _, c := range post.Comments {
+			label := "commented"
+			if c.IsReply {
+				label = "replied"
+			}
+			excerpt := commentExcerpt(c.Body, 300)
+			sectionsHTML += fmt.Sprintf(`
+			<p style="font-size: 15px; line-height: 1.6; margin: 0 0 12px 0; color: #000000;"><strong style="font-weight: 500;">%s</strong> <span style="color: #999999;">%s</span><br>%s</p>`,
+				html.EscapeString(c.AuthorName), label, html.EscapeString(excerpt))
+			sectionsText += fmt.Sprintf("- %s %s: %s\n", c.AuthorName, label, excerpt)
+		}
+	}
+
+	pendingHTML := ""
+	pendingText := ""
+	if pendingCount > 0 {
+		pendingHTML = fmt.Sprintf(`<p style="font-weight: 300; font-size: 15px; color: #666666; margin: 30px 0 0 0;">%d comment(s) are waiting for moderation.</p>`, pendingCount)
+		pendingText = fmt.Sprintf("\n%d comment(s) are waiting for moderation.\n", pendingCount)
+	}
+
+	subject := fmt.Sprintf("%d new comment(s) on your posts", total)
+	htmlBody := fmt.Sprintf(`
+	<!DOCTYPE html>
+	<html>
+	<head>
+		<meta charset="utf-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1">
+		<title>%s</title>
+	</head>
+	<body style="font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; margin: 0; padding: 0; background-color: #fafafa; color: #000000;">
+		<div style="max-width: 600px; margin: 40px auto; background: #ffffff; padding: 40px;">
+			<h1 style="font-weight: 400; font-size: 24px; margin: 0;">New comments</h1>
+			%s
+			%s
+		</div>
+	</body>
+	</html>`, html.EscapeString(subject), sectionsHTML, pendingHTML)
+
+	id, err := e.sender.Send(&OutgoingEmail{
+		From:    fromField,
+		To:      []string{to},
+		Subject: subject,
+		HTML:    htmlBody,
+		Text:    "New comments\n" + sectionsText + pendingText,
+	})
+	if err != nil {
+		log.Printf("[Email] ❌ Failed to send comment digest to %s: %v", to, err)
+		return err
+	}
+
+	log.Printf("[Email] ✅ Comment digest sent to %s (ID: %s)", to, id)
+	return nil
+}
+
+// commentExcerpt shortens a comment body to at most max characters
+func commentExcerpt(body string, max int) string {
+	body = strings.TrimSpace(body)
+	runes := []rune(body)
+	if len(runes) <= max {
+		return body
+	}
+	return strings.TrimSpace(string(runes[:max])) + "…"
 }
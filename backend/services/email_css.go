@@ -0,0 +1,371 @@
+package services
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// InlineCSS moves the rules of an email's <style> blocks into style attributes, since
+// Gmail and Outlook ignore most stylesheets. Selectors made of tags, classes and ids
+// joined by descendant or child combinators are inlined; @media queries and rules with
+// pseudo-classes can't be and stay in the <style> block for the clients that read it.
+// Declarations already in a style attribute win over the stylesheet unless the
+// stylesheet marks them !important.
+func InlineCSS(document string) string {
+	var rules []cssRule
+	document = styleBlock.ReplaceAllStringFunc(document, func(block string) string {
+		m := styleBlock.FindStringSubmatch(block)
+		inlinable, kept := parseStylesheet(m[2], len(rules))
+		rules = append(rules, inlinable...)
+		if strings.TrimSpace(kept) == "" {
+			return ""
+		}
+		return "<style" + m[1] + ">\n" + kept + "</style>"
+	})
+	if len(rules) == 0 {
+		return document
+	}
+
+	var out strings.Builder
+	var stack []cssElement
+	rest := document
+	for {
+		loc := htmlTag.FindStringSubmatchIndex(rest)
+		if loc == nil {
+			out.WriteString(rest)
+			break
+		}
+		out.WriteString(rest[:loc[0]])
+		tag := rest[loc[0]:loc[1]]
+		rest = rest[loc[1]:]
+
+		if strings.HasPrefix(tag, "<!--") {
+			// Comments, including Outlook's conditional comments, are copied as they are
+			if end := strings.Index(tag+rest, "-->"); end >= 0 {
+				full := (tag + rest)[:end+3]
+				out.WriteString(full)
+				rest = (tag + rest)[end+3:]
+				continue
+			}
+			out.WriteString(tag)
+			continue
+		}
+
+		name := strings.ToLower(tag[loc[2]-loc[0] : loc[3]-loc[0]])
+		if strings.HasPrefix(tag, "</") {
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].tag == name {
+					stack = stack[:i]
+					break
+				}
+			}
+			out.WriteString(tag)
+			continue
+		}
+
+		element := newCSSElement(name, tag)
+		out.WriteString(applyRules(tag, element, stack, rules))
+
+		if !voidElements[name] && !strings.HasSuffix(tag, "/>") {
+			stack = append(stack, element)
+		}
+		if name == "script" || name == "style" || name == "title" {
+			// Their contents aren't markup
+			if end := strings.Index(strings.ToLower(rest), "</"+name); end >= 0 {
+				out.WriteString(rest[:end])
+				rest = rest[end:]
+			}
+		}
+	}
+	return out.String()
+}
+
+var (
+	styleBlock = regexp.MustCompile(`(?is)<style([^>]*)>(.*?)</style>`)
+	htmlTag    = regexp.MustCompile(`<!--|</?([a-zA-Z][a-zA-Z0-9]*)(?:\s[^>]*)?/?>`)
+	htmlAttr   = regexp.MustCompile(`([a-zA-Z_:][-a-zA-Z0-9_:.]*)(?:\s*=\s*("[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?`)
+	cssComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+)
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// cssRule is one selector of a stylesheet rule with its declarations
+type cssRule struct {
+	selector     []cssCompound // Rightmost last
+	combinators  []byte        // Between selector parts: ' ' or '>'
+	declarations []cssDeclaration
+	specificity  int
+	order        int
+}
+
+type cssCompound struct {
+	tag     string
+	id      string
+	classes []string
+}
+
+type cssDeclaration struct {
+	property  string
+	value     string
+	important bool
+}
+
+type cssElement struct {
+	tag     string
+	id      string
+	classes map[string]bool
+}
+
+func newCSSElement(name, tag string) cssElement {
+	element := cssElement{tag: name, classes: make(map[string]bool)}
+	for _, attr := range htmlAttr.FindAllStringSubmatch(tag[1+len(name):], -1) {
+		value := strings.Trim(attr[2], `"'`)
+		switch strings.ToLower(attr[1]) {
+		case "class":
+			for _, class := range strings.Fields(value) {
+				element.classes[class] = true
+			}
+		case "id":
+			element.id = value
+		}
+	}
+	return element
+}
+
+// parseStylesheet splits CSS into the rules that can be inlined and the text that has
+// to stay in the stylesheet
+func parseStylesheet(css string, order int) ([]cssRule, string) {
+	css = cssComment.ReplaceAllString(css, "")
+	var rules []cssRule
+	var kept strings.Builder
+
+	for len(strings.TrimSpace(css)) > 0 {
+		css = strings.TrimSpace(css)
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			break
+		}
+		prelude := strings.TrimSpace(css[:open])
+
+		// Find the matching brace, allowing nested blocks in at-rules
+		depth, end := 0, -1
+		for i := open; i < len(css); i++ {
+			if css[i] == '{' {
+				depth++
+			} else if css[i] == '}' {
+				depth--
+				if depth == 0 {
+					end = i
+					break
+				}
+			}
+		}
+		if end < 0 {
+			break
+		}
+		body := css[open+1 : end]
+		css = css[end+1:]
+
+		if strings.HasPrefix(prelude, "@") {
+			kept.WriteString(prelude + " {" + body + "}\n")
+			continue
+		}
+
+		declarations := parseDeclarations(body)
+		var leftover []string
+		for _, selector := range strings.Split(prelude, ",") {
+			selector = strings.TrimSpace(selector)
+			rule, ok := parseSelector(selector)
+			if !ok {
+				leftover = append(leftover, selector)
+				continue
+			}
+			rule.declarations = declarations
+			rule.order = order
+			order++
+			rules = append(rules, rule)
+		}
+		if len(leftover) > 0 {
+			kept.WriteString(strings.Join(leftover, ", ") + " {" + body + "}\n")
+		}
+	}
+	return rules, kept.String()
+}
+
+var (
+	cssCompoundPart = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9]*|\*)?((?:[.#][-_a-zA-Z0-9]+)*)$`)
+	cssSimplePart   = regexp.MustCompile(`[.#][-_a-zA-Z0-9]+`)
+	styleAttr       = regexp.MustCompile(`(?i)\sstyle\s*=\s*("[^"]*"|'[^']*')`)
+)
+
+// parseSelector parses selectors like "td", ".content p" or "table.items > tr"
+func parseSelector(selector string) (cssRule, bool) {
+	var rule cssRule
+	tokens := strings.Fields(strings.ReplaceAll(selector, ">", " > "))
+	combinator := byte(' ')
+	for _, token := range tokens {
+		if token == ">" {
+			combinator = '>'
+			continue
+		}
+		m := cssCompoundPart.FindStringSubmatch(token)
+		if m == nil {
+			return rule, false
+		}
+		compound := cssCompound{tag: strings.ToLower(m[1])}
+		if compound.tag == "*" {
+			compound.tag = ""
+		}
+		if compound.tag != "" {
+			rule.specificity++
+		}
+		for _, part := range cssSimplePart.FindAllString(m[2], -1) {
+			if part[0] == '#' {
+				compound.id = part[1:]
+				rule.specificity += 10000
+			} else {
+				compound.classes = append(compound.classes, part[1:])
+				rule.specificity += 100
+			}
+		}
+		if len(rule.selector) > 0 {
+			rule.combinators = append(rule.combinators, combinator)
+		}
+		rule.selector = append(rule.selector, compound)
+		combinator = ' '
+	}
+	return rule, len(rule.selector) > 0
+}
+
+func parseDeclarations(body string) []cssDeclaration {
+	var declarations []cssDeclaration
+	for _, part := range strings.Split(body, ";") {
+		property, value, ok := strings.Cut(part, ":")
+		if !ok {
+			continue
+		}
+		property = strings.ToLower(strings.TrimSpace(property))
+		value = strings.TrimSpace(value)
+		important := false
+		if i := strings.Index(strings.ToLower(value), "!important"); i >= 0 {
+			important = true
+			value = strings.TrimSpace(value[:i])
+		}
+		if property != "" && value != "" {
+			declarations = append(declarations, cssDeclaration{property: property, value: value, important: important})
+		}
+	}
+	return declarations
+}
+
+func (c cssCompound) matches(e cssElement) bool {
+	if c.tag != "" && c.tag != e.tag {
+		return false
+	}
+	if c.id != "" && c.id != e.id {
+		return false
+	}
+	for _, class := range c.classes {
+		if !e.classes[class] {
+			return false
+		}
+	}
+	return true
+}
+
+// matches checks the rule's selector against an element and its open ancestors,
+// innermost ancestor last
+func (r cssRule) matches(e cssElement, ancestors []cssElement) bool {
+	last := len(r.selector) - 1
+	if !r.selector[last].matches(e) {
+		return false
+	}
+	return matchAncestors(r.selector[:last], r.combinators, ancestors)
+}
+
+func matchAncestors(selector []cssCompound, combinators []byte, ancestors []cssElement) bool {
+	if len(selector) == 0 {
+		return true
+	}
+	last := len(selector) - 1
+	combinator := combinators[last]
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		if selector[last].matches(ancestors[i]) && matchAncestors(selector[:last], combinators[:last], ancestors[:i]) {
+			return true
+		}
+		if combinator == '>' {
+			return false
+		}
+	}
+	return false
+}
+
+// applyRules rewrites a start tag's style attribute with the rules matching it
+func applyRules(tag string, element cssElement, ancestors []cssElement, rules []cssRule) string {
+	var matched []cssRule
+	for _, rule := range rules {
+		if rule.matches(element, ancestors) {
+			matched = append(matched, rule)
+		}
+	}
+	if len(matched) == 0 {
+		return tag
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].specificity != matched[j].specificity {
+			return matched[i].specificity < matched[j].specificity
+		}
+		return matched[i].order < matched[j].order
+	})
+
+	styleLoc := styleAttr.FindStringSubmatchIndex(tag)
+	inline := ""
+	if styleLoc != nil {
+		inline = tag[styleLoc[2]+1 : styleLoc[3]-1]
+	}
+
+	var order []string
+	values := make(map[string]cssDeclaration)
+	set := func(d cssDeclaration, fromAttribute bool) {
+		if current, ok := values[d.property]; ok && current.important && !d.important && fromAttribute {
+			return
+		}
+		if _, ok := values[d.property]; !ok {
+			order = append(order, d.property)
+		}
+		values[d.property] = d
+	}
+	for _, rule := range matched {
+		for _, d := range rule.declarations {
+			if current, ok := values[d.property]; ok && current.important && !d.important {
+				continue
+			}
+			set(d, false)
+		}
+	}
+	for _, d := range parseDeclarations(inline) {
+		set(d, true)
+	}
+
+	parts := make([]string, 0, len(order))
+	for _, property := range order {
+		parts = append(parts, property+": "+strings.ReplaceAll(values[property].value, `"`, "'"))
+	}
+	style := ` style="` + strings.Join(parts, "; ") + `;"`
+
+	if styleLoc != nil {
+		return tag[:styleLoc[0]] + style + tag[styleLoc[1]:]
+	}
+	end := len(tag) - 1
+	if strings.HasSuffix(tag, "/>") {
+		end = len(tag) - 2
+		for end > 0 && tag[end-1] == ' ' {
+			end--
+		}
+	}
+	return tag[:end] + style + tag[end:]
+}
@@ -0,0 +1,97 @@
+package services
+
+import "testing"
+
+func TestInlineCSS(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     string
+	}{
+		{
+			"no stylesheet",
+			`<p class="x">Hi</p>`,
+			`<p class="x">Hi</p>`,
+		},
+		{
+			"tag rule",
+			`<style>p { color: red; margin: 0 }</style><p>Hi</p>`,
+			`<p style="color: red; margin: 0;">Hi</p>`,
+		},
+		{
+			"class and descendant",
+			`<style>.content a { color: #000 }</style><div class="content"><p><a href="/">x</a></p></div><a href="/">y</a>`,
+			`<div class="content"><p><a href="/" style="color: #000;">x</a></p></div><a href="/">y</a>`,
+		},
+		{
+			"child combinator",
+			`<style>div > a { color: red }</style><div><a>x</a><p><a>y</a></p></div>`,
+			`<div><a style="color: red;">x</a><p><a>y</a></p></div>`,
+		},
+		{
+			"compound selector",
+			`<style>a.button { color: #fff } td#main { padding: 4px }</style><a class="button big">x</a><a>y</a><td id="main">z</td>`,
+			`<a class="button big" style="color: #fff;">x</a><a>y</a><td id="main" style="padding: 4px;">z</td>`,
+		},
+		{
+			"specificity beats order",
+			`<style>#a { color: red } .b { color: green } p { color: blue }</style><p id="a" class="b">x</p><p class="b">y</p>`,
+			`<p id="a" class="b" style="color: red;">x</p><p class="b" style="color: green;">y</p>`,
+		},
+		{
+			"later rule wins at equal specificity",
+			`<style>p { color: red } p { color: blue }</style><p>x</p>`,
+			`<p style="color: blue;">x</p>`,
+		},
+		{
+			"selector list",
+			`<style>h1, h2 { margin: 0 }</style><h1>a</h1><h2>b</h2>`,
+			`<h1 style="margin: 0;">a</h1><h2 style="margin: 0;">b</h2>`,
+		},
+		{
+			"style attribute wins",
+			`<style>p { color: red; margin: 0 }</style><p style="color: blue">x</p>`,
+			`<p style="color: blue; margin: 0;">x</p>`,
+		},
+		{
+			"important stylesheet wins over style attribute",
+			`<style>p { color: red !important }</style><p style="color: blue">x</p>`,
+			`<p style="color: red;">x</p>`,
+		},
+		{
+			"media queries and pseudo-classes stay",
+			"<style>p { margin: 0 } a:hover { color: red } @media (max-width: 600px) { p { margin: 4px } }</style><p>x</p>",
+			"<style>\na:hover { color: red }\n@media (max-width: 600px) { p { margin: 4px } }\n</style><p style=\"margin: 0;\">x</p>",
+		},
+		{
+			"comments are copied",
+			`<style>p { color: red }</style><!--[if mso]><p>outlook</p><![endif]--><p>x</p>`,
+			`<!--[if mso]><p>outlook</p><![endif]--><p style="color: red;">x</p>`,
+		},
+		{
+			"void and self-closing elements",
+			`<style>img { border: 0 } br { clear: both } p { color: red }</style><p>a<br/>b<img src="x.png"></p><p>c</p>`,
+			`<p style="color: red;">a<br style="clear: both;"/>b<img src="x.png" style="border: 0;"></p><p style="color: red;">c</p>`,
+		},
+		{
+			"double quotes in values",
+			`<style>p { font-family: "Inter", sans-serif }</style><p>x</p>`,
+			`<p style="font-family: 'Inter', sans-serif;">x</p>`,
+		},
+		{
+			"css comments",
+			`<style>/* p { color: red } */ p { margin: 0 }</style><p>x</p>`,
+			`<p style="margin: 0;">x</p>`,
+		},
+		{
+			"title contents aren't markup",
+			`<style>b { color: red }</style><title>a <b> title</title><b>x</b>`,
+			`<title>a <b> title</title><b style="color: red;">x</b>`,
+		},
+	}
+	for _, test := range tests {
+		if got := InlineCSS(test.document); got != test.want {
+			t.Errorf("%s:\n got: %s\nwant: %s", test.name, got, test.want)
+		}
+	}
+}
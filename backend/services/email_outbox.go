@@ -0,0 +1,162 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OutboxSender writes every email to a directory as an .eml file instead of delivering
+// it. The files open in any mail client, and the admin lists them.
+type OutboxSender struct {
+	dir string
+}
+
+// NewOutboxSender creates an outbox transport, creating its directory if needed
+func NewOutboxSender(dir string) (*OutboxSender, error) {
+	if dir == "" {
+		dir = "outbox"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create email outbox %s: %w", dir, err)
+	}
+	return &OutboxSender{dir: dir}, nil
+}
+
+// Name identifies the transport in logs
+func (s *OutboxSender) Name() string {
+	return "outbox (" + s.dir + ")"
+}
+
+// Send writes the email to the outbox. The file name starts with the time so a
+// directory listing is in sending order.
+func (s *OutboxSender) Send(msg *OutgoingEmail) (string, error) {
+	now := time.Now()
+	_, raw, err := buildMIMEMessage(msg, now)
+	if err != nil {
+		return "", err
+	}
+	id := now.UTC().Format("20060102T150405.000000000") + "-" + newEmailID()
+	if err := os.WriteFile(filepath.Join(s.dir, id+".eml"), raw, 0o644); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Captured reads the emails back from the outbox, newest first
+func (s *OutboxSender) Captured() ([]CapturedEmail, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.eml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+
+	messages := make([]CapturedEmail, 0, len(files))
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		captured, err := parseMIMEMessage(raw)
+		if err != nil {
+			// Files dropped into the outbox by hand may not be ours; skip them
+			continue
+		}
+		captured.ID = strings.TrimSuffix(filepath.Base(file), ".eml")
+		messages = append(messages, *captured)
+	}
+	return messages, nil
+}
+
+// Clear deletes every email in the outbox
+func (s *OutboxSender) Clear() error {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.eml"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseMIMEMessage reads back a message written by buildMIMEMessage
+func parseMIMEMessage(raw []byte) (*CapturedEmail, error) {
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	captured := &CapturedEmail{OutgoingEmail: OutgoingEmail{Headers: make(map[string]string)}}
+	decoder := new(mime.WordDecoder)
+	for name, values := range message.Header {
+		value := strings.Join(values, ", ")
+		switch name {
+		case "From":
+			captured.From = value
+		case "To":
+			for _, to := range strings.Split(value, ",") {
+				captured.To = append(captured.To, strings.TrimSpace(to))
+			}
+		case "Subject":
+			if decoded, err := decoder.DecodeHeader(value); err == nil {
+				value = decoded
+			}
+			captured.Subject = value
+		case "Date":
+			captured.SentAt, _ = mail.ParseDate(value)
+		case "X-Idempotency-Key":
+			captured.IdempotencyKey = value
+		case "Mime-Version", "Content-Type":
+		default:
+			captured.Headers[name] = value
+		}
+	}
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		body, err := io.ReadAll(message.Body)
+		if err != nil {
+			return nil, err
+		}
+		captured.Text = string(body)
+		return captured, nil
+	}
+
+	// multipart.Reader undoes the quoted-printable encoding of each part
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		// Line breaks went out as CRLF
+		body := strings.ReplaceAll(string(content), "\r\n", "\n")
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/html") {
+			captured.HTML = body
+		} else {
+			captured.Text = body
+		}
+	}
+	return captured, nil
+}
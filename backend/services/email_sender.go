@@ -0,0 +1,197 @@
+package services
+
+import (
+	"blog-backend/config"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	resend "github.com/resend/resend-go/v2"
+)
+
+// Email transports, chosen with EMAIL_TRANSPORT
+const (
+	EmailTransportResend = "resend"
+	EmailTransportSMTP   = "smtp"
+	EmailTransportOutbox = "outbox" // Writes .eml files for local development
+	EmailTransportMemory = "memory" // Keeps messages in memory, for tests
+)
+
+// ErrEmailRejected marks sends that failed because of the message itself, such as an
+// invalid address, and are not worth retrying
+var ErrEmailRejected = errors.New("email rejected")
+
+// OutgoingEmail is one email as handed to a transport
+type OutgoingEmail struct {
+	From           string            `json:"from"`
+	To             []string          `json:"to"`
+	Subject        string            `json:"subject"`
+	HTML           string            `json:"html"`
+	Text           string            `json:"text"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	IdempotencyKey string            `json:"idempotency_key,omitempty"` // Lets the transport drop repeat sends of the same message
+}
+
+// EmailSender delivers emails. Send returns the transport's id for the message.
+type EmailSender interface {
+	Send(msg *OutgoingEmail) (string, error)
+	Name() string
+}
+
+// CapturedEmail is a message kept by a transport that doesn't deliver
+type CapturedEmail struct {
+	ID     string    `json:"id"`
+	SentAt time.Time `json:"sent_at"`
+	OutgoingEmail
+}
+
+// EmailCapture is implemented by the transports that keep messages instead of
+// delivering them, so they can be listed in the admin
+type EmailCapture interface {
+	Captured() ([]CapturedEmail, error) // Newest first
+	Clear() error
+}
+
+// NewEmailSender builds the transport configured with EMAIL_TRANSPORT. Without it,
+// Resend is used when RESEND_API_KEY is set and email is disabled otherwise, in which
+// case the returned sender is nil.
+func NewEmailSender(cfg *config.Config) (EmailSender, error) {
+	transport := cfg.EmailTransport
+	if transport == "" {
+		if cfg.ResendAPIKey == "" {
+			return nil, nil
+		}
+		transport = EmailTransportResend
+	}
+
+	switch transport {
+	case EmailTransportResend:
+		if cfg.ResendAPIKey == "" {
+			return nil, fmt.Errorf("EMAIL_TRANSPORT=resend needs RESEND_API_KEY")
+		}
+		return NewResendSender(cfg.ResendAPIKey), nil
+	case EmailTransportSMTP:
+		return NewSMTPSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPTLS)
+	case EmailTransportOutbox:
+		return NewOutboxSender(cfg.EmailOutboxDir)
+	case EmailTransportMemory:
+		return NewMemorySender(), nil
+	}
+	return nil, fmt.Errorf("unknown EMAIL_TRANSPORT %q (use resend, smtp, outbox or memory)", transport)
+}
+
+// ResendSender sends through the Resend API
+type ResendSender struct {
+	client *resend.Client
+}
+
+// NewResendSender creates a Resend transport
+func NewResendSender(apiKey string) *ResendSender {
+	return &ResendSender{client: resend.NewClient(apiKey)}
+}
+
+// Name identifies the transport in logs
+func (s *ResendSender) Name() string {
+	return "Resend"
+}
+
+// Send sends one email and returns Resend's email id
+func (s *ResendSender) Send(msg *OutgoingEmail) (string, error) {
+	params := &resend.SendEmailRequest{
+		From:    msg.From,
+		To:      msg.To,
+		Subject: msg.Subject,
+		Html:    msg.HTML,
+		Text:    msg.Text,
+		Headers: msg.Headers,
+	}
+
+	// Build the request by hand so it can carry a per-message Idempotency-Key header;
+	// Resend drops repeat sends with the same key for 24 hours
+	req, err := s.client.NewRequest(context.Background(), http.MethodPost, "emails", params)
+	if err != nil {
+		return "", err
+	}
+	if msg.IdempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", msg.IdempotencyKey)
+	}
+
+	response := new(resend.SendEmailResponse)
+	if _, err := s.client.Perform(req, response); err != nil {
+		return "", err
+	}
+	return response.Id, nil
+}
+
+// memoryCaptureLimit is how many messages the memory transport keeps
+const memoryCaptureLimit = 500
+
+// MemorySender keeps sent emails in memory instead of delivering them
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []CapturedEmail
+}
+
+// NewMemorySender creates an in-memory transport
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+// Name identifies the transport in logs
+func (s *MemorySender) Name() string {
+	return "memory capture"
+}
+
+// Send records the email. Repeat sends with the same idempotency key are dropped like
+// Resend would.
+func (s *MemorySender) Send(msg *OutgoingEmail) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if msg.IdempotencyKey != "" {
+		for _, captured := range s.messages {
+			if captured.IdempotencyKey == msg.IdempotencyKey {
+				return captured.ID, nil
+			}
+		}
+	}
+
+	captured := CapturedEmail{ID: newEmailID(), SentAt: time.Now(), OutgoingEmail: *msg}
+	s.messages = append(s.messages, captured)
+	if len(s.messages) > memoryCaptureLimit {
+		s.messages = s.messages[len(s.messages)-memoryCaptureLimit:]
+	}
+	return captured.ID, nil
+}
+
+// Captured returns the kept emails, newest first
+func (s *MemorySender) Captured() ([]CapturedEmail, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]CapturedEmail, len(s.messages))
+	copy(messages, s.messages)
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].SentAt.After(messages[j].SentAt) })
+	return messages, nil
+}
+
+// Clear forgets every kept email
+func (s *MemorySender) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+	return nil
+}
+
+// newEmailID returns a random message id for the transports that don't get one from a provider
+func newEmailID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"blog-backend/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newMemoryEmailService(t *testing.T) (*EmailService, *MemorySender) {
+	t.Helper()
+	service := NewEmailService(&config.Config{
+		EmailTransport: EmailTransportMemory,
+		FromEmail:      "hello@example.com",
+		WebsiteURL:     "https://example.com",
+	})
+	memory, ok := service.sender.(*MemorySender)
+	if !ok {
+		t.Fatalf("EMAIL_TRANSPORT=memory built %T, want *MemorySender", service.sender)
+	}
+	return service, memory
+}
+
+func captured(t *testing.T, capture EmailCapture) []CapturedEmail {
+	t.Helper()
+	messages, err := capture.Captured()
+	if err != nil {
+		t.Fatalf("Captured() error = %v", err)
+	}
+	return messages
+}
+
+func TestNewEmailSender(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		want    string // Sender name, empty for no sender
+		wantErr bool
+	}{
+		{"disabled without transport or key", config.Config{}, "", false},
+		{"resend from the API key", config.Config{ResendAPIKey: "re_x"}, "Resend", false},
+		{"resend without a key", config.Config{EmailTransport: EmailTransportResend}, "", true},
+		{"memory", config.Config{EmailTransport: EmailTransportMemory}, "memory capture", false},
+		{"outbox", config.Config{EmailTransport: EmailTransportOutbox}, "outbox (", false},
+		{"smtp", config.Config{EmailTransport: EmailTransportSMTP, SMTPHost: "mail.example.com", SMTPPort: 587}, "SMTP (mail.example.com:587, starttls)", false},
+		{"smtp without a host", config.Config{EmailTransport: EmailTransportSMTP}, "", true},
+		{"smtp with unknown security", config.Config{EmailTransport: EmailTransportSMTP, SMTPHost: "mail.example.com", SMTPTLS: "ssl"}, "", true},
+		{"unknown transport", config.Config{EmailTransport: "pigeon"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cfg.EmailTransport == EmailTransportOutbox {
+				tt.cfg.EmailOutboxDir = t.TempDir()
+			}
+			sender, err := NewEmailSender(&tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewEmailSender() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.want == "" {
+				if sender != nil {
+					t.Fatalf("NewEmailSender() = %s, want no sender", sender.Name())
+				}
+				return
+			}
+			if sender == nil || !strings.HasPrefix(sender.Name(), tt.want) {
+				t.Fatalf("NewEmailSender() = %v, want %q", sender, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemorySender(t *testing.T) {
+	memory := NewMemorySender()
+
+	first, err := memory.Send(&OutgoingEmail{To: []string{"a@example.com"}, Subject: "first", IdempotencyKey: "k1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := memory.Send(&OutgoingEmail{To: []string{"b@example.com"}, Subject: "second"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A repeat send with the same idempotency key is dropped, like Resend would
+	repeat, err := memory.Send(&OutgoingEmail{To: []string{"a@example.com"}, Subject: "first again", IdempotencyKey: "k1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repeat != first {
+		t.Errorf("repeat send id = %q, want the first send's %q", repeat, first)
+	}
+
+	messages := captured(t, memory)
+	if len(messages) != 2 {
+		t.Fatalf("captured %d messages, want 2", len(messages))
+	}
+	if messages[0].Subject != "second" || messages[1].Subject != "first" {
+		t.Errorf("captured subjects = %q, %q; want newest first", messages[0].Subject, messages[1].Subject)
+	}
+
+	if err := memory.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if messages := captured(t, memory); len(messages) != 0 {
+		t.Errorf("captured %d messages after Clear, want 0", len(messages))
+	}
+}
+
+func TestMemorySenderLimit(t *testing.T) {
+	memory := NewMemorySender()
+	for i := 0; i < memoryCaptureLimit+10; i++ {
+		memory.Send(&OutgoingEmail{Subject: "x"})
+	}
+	if messages := captured(t, memory); len(messages) != memoryCaptureLimit {
+		t.Errorf("captured %d messages, want the limit of %d", len(messages), memoryCaptureLimit)
+	}
+}
+
+func TestEmailServiceSubscriptionConfirmation(t *testing.T) {
+	service, memory := newMemoryEmailService(t)
+
+	expires := time.Date(2026, 3, 4, 15, 30, 0, 0, time.UTC)
+	if err := service.SendSubscriptionConfirmation("reader@example.com", "https://example.com/confirm?token=abc", expires); err != nil {
+		t.Fatalf("SendSubscriptionConfirmation() error = %v", err)
+	}
+
+	messages := captured(t, service.Capture())
+	if len(messages) != 1 {
+		t.Fatalf("captured %d messages, want 1", len(messages))
+	}
+	msg := messages[0]
+	if msg.From != "BetaDomot <hello@example.com>" {
+		t.Errorf("From = %q", msg.From)
+	}
+	if len(msg.To) != 1 || msg.To[0] != "reader@example.com" {
+		t.Errorf("To = %v", msg.To)
+	}
+	if msg.Subject != "Confirm your Betadomot subscription" {
+		t.Errorf("Subject = %q", msg.Subject)
+	}
+	for _, part := range []struct{ name, body string }{{"HTML", msg.HTML}, {"Text", msg.Text}} {
+		if !strings.Contains(part.body, "https://example.com/confirm?token=abc") {
+			t.Errorf("%s part is missing the confirmation link:\n%s", part.name, part.body)
+		}
+		if !strings.Contains(part.body, "4 Mar 2026 at 15:30 UTC") {
+			t.Errorf("%s part is missing the expiry:\n%s", part.name, part.body)
+		}
+	}
+	if memory != service.Capture() {
+		t.Errorf("Capture() isn't the memory transport")
+	}
+}
+
+func TestEmailServiceWelcomeEmail(t *testing.T) {
+	service, _ := newMemoryEmailService(t)
+
+	links := SubscriberLinks{
+		UnsubscribeURL: "https://example.com/unsubscribe?token=u",
+		PreferencesURL: "https://example.com/preferences?token=p",
+	}
+	if err := service.SendWelcomeEmail("reader@example.com", links); err != nil {
+		t.Fatalf("SendWelcomeEmail() error = %v", err)
+	}
+
+	msg := captured(t, service.Capture())[0]
+	if got := msg.Headers["List-Unsubscribe"]; got != "<https://example.com/unsubscribe?token=u>" {
+		t.Errorf("List-Unsubscribe = %q", got)
+	}
+	if got := msg.Headers["List-Unsubscribe-Post"]; got != "List-Unsubscribe=One-Click" {
+		t.Errorf("List-Unsubscribe-Post = %q", got)
+	}
+	for _, placeholder := range []string{UnsubscribeURLPlaceholder, PreferencesURLPlaceholder} {
+		if strings.Contains(msg.HTML, placeholder) || strings.Contains(msg.Text, placeholder) {
+			t.Errorf("welcome email still contains %s", placeholder)
+		}
+	}
+}
+
+func TestEmailServiceNewsletterMessage(t *testing.T) {
+	service, _ := newMemoryEmailService(t)
+
+	msg := NewsletterMessage{
+		To:             "reader@example.com",
+		Subject:        "Issue 1",
+		HTML:           "<p>Hi</p>",
+		Text:           "Hi",
+		Headers:        map[string]string{"X-Campaign": "1"},
+		IdempotencyKey: "newsletter-1-reader",
+	}
+	first, err := service.SendNewsletterMessage(msg)
+	if err != nil {
+		t.Fatalf("SendNewsletterMessage() error = %v", err)
+	}
+	// A retried delivery must not reach the reader twice
+	second, err := service.SendNewsletterMessage(msg)
+	if err != nil {
+		t.Fatalf("SendNewsletterMessage() retry error = %v", err)
+	}
+	if first != second {
+		t.Errorf("retry id = %q, want %q", second, first)
+	}
+
+	messages := captured(t, service.Capture())
+	if len(messages) != 1 {
+		t.Fatalf("captured %d messages, want 1", len(messages))
+	}
+	if messages[0].Headers["X-Campaign"] != "1" || messages[0].IdempotencyKey != "newsletter-1-reader" {
+		t.Errorf("captured %+v", messages[0])
+	}
+}
+
+func TestEmailServiceBackInStock(t *testing.T) {
+	service, _ := newMemoryEmailService(t)
+
+	item := BackInStockItem{Name: "Lamp", Variant: "Green", Price: 49, URL: "https://shop.example.com/products/lamp"}
+	sent, err := service.SendBackInStock(item, []string{"a@example.com", "b@example.com"})
+	if err != nil {
+		t.Fatalf("SendBackInStock() error = %v", err)
+	}
+	if len(sent) != 2 {
+		t.Errorf("sent = %v, want both recipients", sent)
+	}
+
+	messages := captured(t, service.Capture())
+	if len(messages) != 2 {
+		t.Fatalf("captured %d messages, want 2", len(messages))
+	}
+	for _, msg := range messages {
+		if msg.Subject != "Back in stock: Lamp — Green" {
+			t.Errorf("Subject = %q", msg.Subject)
+		}
+		if len(msg.To) != 1 {
+			t.Errorf("To = %v, want one recipient per email", msg.To)
+		}
+	}
+}
+
+func TestEmailServiceWithoutTransport(t *testing.T) {
+	service := NewEmailService(&config.Config{WebsiteURL: "https://example.com"})
+	if service.Capture() != nil {
+		t.Errorf("Capture() without a transport should be nil")
+	}
+	if _, err := service.SendNewsletterMessage(NewsletterMessage{To: "reader@example.com"}); err == nil {
+		t.Errorf("SendNewsletterMessage() without a transport should fail")
+	}
+}
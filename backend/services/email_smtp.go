@@ -0,0 +1,219 @@
+package services
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP connection security, chosen with SMTP_TLS
+const (
+	SMTPTLSStartTLS = "starttls" // Upgrade a plain connection; refuse servers that can't
+	SMTPTLSImplicit = "tls"      // TLS from the first byte, usually port 465
+	SMTPTLSNone     = "none"     // Plain text, only for local catchers such as Mailpit
+)
+
+// smtpTimeout bounds a whole SMTP conversation
+const smtpTimeout = 30 * time.Second
+
+// SMTPSender sends through any SMTP server
+type SMTPSender struct {
+	host     string
+	port     int
+	username string
+	password string
+	security string
+}
+
+// NewSMTPSender creates an SMTP transport
+func NewSMTPSender(host string, port int, username, password, security string) (*SMTPSender, error) {
+	if host == "" {
+		return nil, fmt.Errorf("EMAIL_TRANSPORT=smtp needs SMTP_HOST")
+	}
+	if security == "" {
+		security = SMTPTLSStartTLS
+	}
+	switch security {
+	case SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone:
+	default:
+		return nil, fmt.Errorf("unknown SMTP_TLS %q (use starttls, tls or none)", security)
+	}
+	return &SMTPSender{host: host, port: port, username: username, password: password, security: security}, nil
+}
+
+// Name identifies the transport in logs
+func (s *SMTPSender) Name() string {
+	return fmt.Sprintf("SMTP (%s:%d, %s)", s.host, s.port, s.security)
+}
+
+// Send delivers one email and returns its Message-ID
+func (s *SMTPSender) Send(msg *OutgoingEmail) (string, error) {
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid from address %q: %v", ErrEmailRejected, msg.From, err)
+	}
+	recipients := make([]string, 0, len(msg.To))
+	for _, to := range msg.To {
+		address, err := mail.ParseAddress(to)
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid recipient %q: %v", ErrEmailRejected, to, err)
+		}
+		recipients = append(recipients, address.Address)
+	}
+	messageID, raw, err := buildMIMEMessage(msg, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	addr := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	tlsConfig := &tls.Config{ServerName: s.host}
+	var conn net.Conn
+	if s.security == SMTPTLSImplicit {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: smtpTimeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, smtpTimeout)
+	}
+	if err != nil {
+		return "", err
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return "", err
+	}
+	defer client.Close()
+
+	if s.security == SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return "", fmt.Errorf("SMTP server %s doesn't offer STARTTLS", s.host)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return "", err
+		}
+	}
+	if s.username != "" {
+		// PlainAuth itself refuses to send the password over an unencrypted
+		// connection to anything but localhost
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return "", err
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return "", err
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return "", err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	client.Quit()
+
+	return messageID, nil
+}
+
+// Headers buildMIMEMessage writes itself; the same names in OutgoingEmail.Headers are ignored
+var mimeOwnHeaders = map[string]bool{
+	"From": true, "To": true, "Subject": true, "Date": true, "Message-Id": true,
+	"Mime-Version": true, "Content-Type": true, "Content-Transfer-Encoding": true,
+	"Return-Path": true, // Set by the receiving server from the envelope
+}
+
+// buildMIMEMessage renders an email as an RFC 5322 message with text and HTML
+// alternatives, returning its Message-ID and the raw bytes
+func buildMIMEMessage(msg *OutgoingEmail, now time.Time) (string, []byte, error) {
+	messageID := msg.Headers["Message-ID"]
+	if messageID == "" {
+		domain := "localhost"
+		if from, err := mail.ParseAddress(msg.From); err == nil {
+			if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+				domain = from.Address[at+1:]
+			}
+		}
+		messageID = fmt.Sprintf("<%s@%s>", newEmailID(), domain)
+	}
+
+	var out bytes.Buffer
+	writeHeader := func(name, value string) {
+		// Header values must not carry line breaks of their own
+		value = strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+		fmt.Fprintf(&out, "%s: %s\r\n", name, value)
+	}
+	writeHeader("From", msg.From)
+	writeHeader("To", strings.Join(msg.To, ", "))
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	writeHeader("Date", now.Format(time.RFC1123Z))
+	writeHeader("Message-ID", messageID)
+	writeHeader("MIME-Version", "1.0")
+	if msg.IdempotencyKey != "" {
+		writeHeader("X-Idempotency-Key", msg.IdempotencyKey)
+	}
+
+	names := make([]string, 0, len(msg.Headers))
+	for name := range msg.Headers {
+		if !mimeOwnHeaders[textproto.CanonicalMIMEHeaderKey(name)] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeHeader(name, msg.Headers[name])
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	writeHeader("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	out.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		if part.content == "" {
+			continue
+		}
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return "", nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return "", nil, err
+	}
+	out.Write(body.Bytes())
+
+	return messageID, out.Bytes(), nil
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMIMEMessage(t *testing.T) {
+	now := time.Date(2026, 3, 4, 15, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		msg       OutgoingEmail
+		messageID string   // Exact Message-ID, or empty to only check the domain
+		idDomain  string   // Domain of a generated Message-ID
+		contains  []string // Raw header lines and fragments the message must have
+		excludes  []string // ...and must not have
+		parts     int      // Number of MIME parts
+	}{
+		{
+			name: "text and HTML alternatives",
+			msg: OutgoingEmail{
+				From:    "BetaDomot <hello@example.com>",
+				To:      []string{"a@example.com", "b@example.com"},
+				Subject: "Hello",
+				Text:    "Hi there",
+				HTML:    "<p>Hi there</p>",
+			},
+			idDomain: "example.com",
+			contains: []string{
+				"From: BetaDomot <hello@example.com>\r\n",
+				"To: a@example.com, b@example.com\r\n",
+				"Subject: Hello\r\n",
+				"Date: Wed, 04 Mar 2026 15:30:00 +0000\r\n",
+				"MIME-Version: 1.0\r\n",
+				"Content-Type: multipart/alternative; boundary=",
+				"Content-Type: text/plain; charset=utf-8",
+				"Content-Type: text/html; charset=utf-8",
+				"Content-Transfer-Encoding: quoted-printable",
+			},
+			excludes: []string{"X-Idempotency-Key"},
+			parts:    2,
+		},
+		{
+			name:     "text only",
+			msg:      OutgoingEmail{From: "hello@example.com", To: []string{"a@example.com"}, Subject: "Plain", Text: "Just text"},
+			idDomain: "example.com",
+			excludes: []string{"text/html"},
+			parts:    1,
+		},
+		{
+			name:     "UTF-8 subject is encoded",
+			msg:      OutgoingEmail{From: "hello@example.com", To: []string{"a@example.com"}, Subject: "Back in stock: Lamp — Green", Text: "x"},
+			idDomain: "example.com",
+			contains: []string{"Subject: =?utf-8?q?"},
+			excludes: []string{"Subject: Back in stock: Lamp — Green"},
+			parts:    1,
+		},
+		{
+			name: "line breaks in headers are stripped",
+			msg: OutgoingEmail{
+				From:    "hello@example.com",
+				To:      []string{"a@example.com\r\nBcc: victim@example.com"},
+				Subject: "Hi\r\nBcc: victim@example.com",
+				Text:    "x",
+				Headers: map[string]string{"Reply-To": "x@example.com\nBcc: victim@example.com"},
+			},
+			idDomain: "example.com",
+			contains: []string{"Reply-To: x@example.com Bcc: victim@example.com\r\n"},
+			excludes: []string{"\r\nBcc:", "\nBcc:"},
+			parts:    1,
+		},
+		{
+			name: "custom headers in name order, own headers ignored",
+			msg: OutgoingEmail{
+				From:    "hello@example.com",
+				To:      []string{"a@example.com"},
+				Subject: "Hi",
+				Text:    "x",
+				Headers: map[string]string{
+					"X-Mailer":     "Betadomot",
+					"Importance":   "Normal",
+					"Content-Type": "text/evil",
+					"return-path":  "bounce@example.com",
+					"subject":      "Overridden",
+				},
+			},
+			idDomain: "example.com",
+			contains: []string{"Importance: Normal\r\nX-Mailer: Betadomot\r\n"},
+			excludes: []string{"text/evil", "bounce@example.com", "Overridden"},
+			parts:    1,
+		},
+		{
+			name: "given Message-ID and idempotency key",
+			msg: OutgoingEmail{
+				From:           "hello@example.com",
+				To:             []string{"a@example.com"},
+				Subject:        "Hi",
+				Text:           "x",
+				Headers:        map[string]string{"Message-ID": "<fixed@example.org>"},
+				IdempotencyKey: "newsletter-1-a",
+			},
+			messageID: "<fixed@example.org>",
+			contains:  []string{"Message-ID: <fixed@example.org>\r\n", "X-Idempotency-Key: newsletter-1-a\r\n"},
+			parts:     1,
+		},
+		{
+			name:     "unparseable From falls back to localhost",
+			msg:      OutgoingEmail{From: "not an address", To: []string{"a@example.com"}, Subject: "Hi", Text: "x"},
+			idDomain: "localhost",
+			parts:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messageID, raw, err := buildMIMEMessage(&tt.msg, now)
+			if err != nil {
+				t.Fatalf("buildMIMEMessage() error = %v", err)
+			}
+			message := string(raw)
+
+			if tt.messageID != "" && messageID != tt.messageID {
+				t.Errorf("Message-ID = %q, want %q", messageID, tt.messageID)
+			}
+			if tt.idDomain != "" && !strings.HasSuffix(messageID, "@"+tt.idDomain+">") {
+				t.Errorf("Message-ID = %q, want one at %s", messageID, tt.idDomain)
+			}
+			if !strings.Contains(message, "Message-ID: "+messageID+"\r\n") {
+				t.Errorf("message doesn't carry its Message-ID %s", messageID)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(message, want) {
+					t.Errorf("message is missing %q:\n%s", want, message)
+				}
+			}
+			for _, unwanted := range tt.excludes {
+				if strings.Contains(message, unwanted) {
+					t.Errorf("message contains %q:\n%s", unwanted, message)
+				}
+			}
+			if got := strings.Count(message, "Content-Transfer-Encoding: quoted-printable"); got != tt.parts {
+				t.Errorf("message has %d parts, want %d", got, tt.parts)
+			}
+
+			// The outbox reads messages back; the bodies must survive the round trip
+			parsed, err := parseMIMEMessage(raw)
+			if err != nil {
+				t.Fatalf("parseMIMEMessage() error = %v", err)
+			}
+			if parsed.Text != tt.msg.Text || parsed.HTML != tt.msg.HTML {
+				t.Errorf("round trip bodies = %q, %q; want %q, %q", parsed.Text, parsed.HTML, tt.msg.Text, tt.msg.HTML)
+			}
+			if !strings.ContainsAny(tt.msg.Subject, "\r\n") && parsed.Subject != tt.msg.Subject {
+				t.Errorf("round trip subject = %q, want %q", parsed.Subject, tt.msg.Subject)
+			}
+			if parsed.IdempotencyKey != tt.msg.IdempotencyKey {
+				t.Errorf("round trip idempotency key = %q, want %q", parsed.IdempotencyKey, tt.msg.IdempotencyKey)
+			}
+		})
+	}
+}
+
+func TestBuildMIMEMessageLongLines(t *testing.T) {
+	// Quoted-printable keeps lines within the 76 characters SMTP servers accept
+	msg := OutgoingEmail{From: "hello@example.com", To: []string{"a@example.com"}, Subject: "Hi", HTML: strings.Repeat("<p>word</p>", 200)}
+	_, raw, err := buildMIMEMessage(&msg, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		if len(line) > 998 {
+			t.Fatalf("line of %d characters exceeds the SMTP limit", len(line))
+		}
+	}
+	parsed, err := parseMIMEMessage(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.HTML != msg.HTML {
+		t.Errorf("long HTML didn't survive the round trip")
+	}
+}
+
+func TestSMTPSenderRejectsInvalidAddresses(t *testing.T) {
+	sender, err := NewSMTPSender("mail.invalid", 587, "", "", SMTPTLSNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []OutgoingEmail{
+		{From: "not an address", To: []string{"a@example.com"}},
+		{From: "hello@example.com", To: []string{"a@example.com", "nope"}},
+	}
+	for _, msg := range tests {
+		// Checked before dialing, so this never touches the network
+		_, err := sender.Send(&msg)
+		if !errors.Is(err, ErrEmailRejected) {
+			t.Errorf("Send(%v) error = %v, want ErrEmailRejected", msg, err)
+		}
+		if IsTransientEmailError(err) {
+			t.Errorf("Send(%v) error counted as transient", msg)
+		}
+	}
+}
+
+func TestIsTransientEmailError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"no error", nil, false},
+		{"rejected message", fmt.Errorf("%w: invalid recipient", ErrEmailRejected), false},
+		{"SMTP 421 service not available", &textproto.Error{Code: 421, Msg: "try again later"}, true},
+		{"SMTP 451 local error", fmt.Errorf("sending: %w", &textproto.Error{Code: 451, Msg: "temporary failure"}), true},
+		{"SMTP 550 mailbox unavailable", &textproto.Error{Code: 550, Msg: "no such user"}, false},
+		{"SMTP 554 rejected", &textproto.Error{Code: 554, Msg: "spam"}, false},
+		{"network error", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"Resend rate limit", errors.New("[ERROR]: Too many requests"), true},
+		{"Resend server error", errors.New("[ERROR]: Internal server error"), true},
+		{"Resend validation error", errors.New("[ERROR]: The to field is invalid"), false},
+		{"Resend forbidden sender", errors.New("[ERROR]: The example.com domain is not verified"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransientEmailError(tt.err); got != tt.want {
+				t.Errorf("IsTransientEmailError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
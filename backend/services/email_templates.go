@@ -0,0 +1,378 @@
+package services
+
+import (
+	"blog-backend/models"
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed templates/email/*.html
+var emailTemplateFiles embed.FS
+
+// Built-in email templates. Each lives in templates/email/<name>.html and defines a
+// "subject", a "content" block rendered inside the shared layout and optionally a
+// "preheader", the preview line inbox lists show after the subject.
+const (
+	EmailTemplateSubscriptionConfirmation = "subscription_confirmation"
+	EmailTemplateWelcome                  = "welcome"
+	EmailTemplateNewsletter               = "newsletter"
+	EmailTemplateNewsletterDigest         = "newsletter_digest"
+	EmailTemplateOrderConfirmation        = "order_confirmation"
+)
+
+// EmailTemplateInfo describes a built-in email template for the admin
+type EmailTemplateInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Newsletter  bool   `json:"newsletter"` // Footer carries the subscriber's unsubscribe and preference links
+	sample      func() interface{}
+}
+
+var emailTemplateCatalog = []EmailTemplateInfo{
+	{
+		Name:        EmailTemplateSubscriptionConfirmation,
+		Description: "Sent on newsletter sign-up with the link that confirms it. Data: .Email, .ConfirmURL, .ExpiresAt",
+		sample: func() interface{} {
+			return SubscriptionConfirmationEmail{
+				Email:      "reader@example.com",
+				ConfirmURL: "https://betadomot.blog/newsletter/confirm?token=sample",
+				ExpiresAt:  time.Date(2026, 1, 4, 9, 30, 0, 0, time.UTC),
+			}
+		},
+	},
+	{
+		Name:        EmailTemplateWelcome,
+		Description: "Sent when a subscriber confirms their newsletter subscription",
+		Newsletter:  true,
+		sample:      func() interface{} { return WelcomeEmail{Email: "reader@example.com"} },
+	},
+	{
+		Name:        EmailTemplateNewsletter,
+		Description: "Newsletter campaigns written in Markdown. Data: .Subject, .Content",
+		Newsletter:  true,
+		sample: func() interface{} {
+			return NewsletterEmail{Subject: "Five small changes for a calmer home", Content: "Hello!\n\nThis week we look at **lighting**, *texture* and [storage](https://betadomot.blog/blog).\n\n- Declutter one surface\n- Add a plant"}
+		},
+	},
+	{
+		Name:        EmailTemplateNewsletterDigest,
+		Description: "The weekly digest of new posts, guides and products. Data: .Subject, .Intro, .Sections",
+		Newsletter:  true,
+		sample: func() interface{} {
+			return DigestEmail{Subject: "This week at Betadomot", Intro: "Here's what's new this week.", Sections: []DigestSection{
+				{Title: "New on the blog", Items: []DigestItem{{Title: "Five small changes for a calmer home", URL: "https://betadomot.blog/blog/calmer-home", Meta: "120 views"}}},
+			}}
+		},
+	},
+	{
+		Name:        EmailTemplateOrderConfirmation,
+		Description: "Sent to customers once their payment is confirmed. Data: .OrderNumber, .CustomerName, .Items, .Subtotal, .Shipping, .Tax, .Total, .ShippingAddress, .OrderDate",
+		sample: func() interface{} {
+			return OrderConfirmationData{
+				OrderNumber:     "BD-10042",
+				CustomerName:    "Ada",
+				CustomerEmail:   "ada@example.com",
+				Items:           []OrderItem{{Name: "Linen throw", Variant: "Sand", Quantity: 2, Price: 15000}},
+				Subtotal:        30000,
+				Shipping:        2500,
+				Total:           32500,
+				ShippingAddress: map[string]interface{}{"address": "12 Admiralty Way", "city": "Lekki", "state": "Lagos"},
+				OrderDate:       "2 Jan 2026",
+			}
+		},
+	},
+}
+
+// EmailTemplateCatalog lists the built-in email templates
+func EmailTemplateCatalog() []EmailTemplateInfo {
+	return emailTemplateCatalog
+}
+
+func emailTemplateInfo(name string) (EmailTemplateInfo, bool) {
+	for _, info := range emailTemplateCatalog {
+		if info.Name == name {
+			return info, true
+		}
+	}
+	return EmailTemplateInfo{}, false
+}
+
+// SubscriptionConfirmationEmail is the data of the double opt-in confirmation email
+type SubscriptionConfirmationEmail struct {
+	Email      string
+	ConfirmURL string
+	ExpiresAt  time.Time
+}
+
+// WelcomeEmail is the data of the welcome email
+type WelcomeEmail struct {
+	Email string
+}
+
+// NewsletterEmail is the data of a Markdown newsletter campaign
+type NewsletterEmail struct {
+	Subject string
+	Content string // Markdown
+}
+
+// DigestEmail is the data of the weekly newsletter digest
+type DigestEmail struct {
+	Subject  string
+	Intro    string
+	Sections []DigestSection
+}
+
+// RenderedEmail is an email ready to send: the subject, the HTML with its CSS inlined
+// and the plain-text alternative
+type RenderedEmail struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// emailPage is what the shared layout is executed with
+type emailPage struct {
+	Subject    string
+	Preheader  string
+	Newsletter bool
+	Data       interface{}
+}
+
+type emailLink struct {
+	URL   string
+	Label string
+}
+
+// EmailTemplates renders emails from the built-in templates, replacing the subject and
+// content of any template an admin has overridden in the email_templates table
+type EmailTemplates struct {
+	websiteURL string
+	defaults   map[string]*template.Template // Parsed, never executed, so they can be cloned
+
+	mu        sync.RWMutex
+	db        *DatabaseService
+	templates map[string]*template.Template // Defaults with overrides applied, ready to execute
+}
+
+// NewEmailTemplates parses the built-in templates
+func NewEmailTemplates(websiteURL string) (*EmailTemplates, error) {
+	base, err := template.New("email").Funcs(template.FuncMap{
+		"site":     func() string { return websiteURL },
+		"markdown": func(source string) template.HTML { return template.HTML(RenderMarkdown(source)) },
+		"money":    func(amount float64) string { return fmt.Sprintf("₦%.2f", amount) },
+		"link":     func(url, label string) emailLink { return emailLink{URL: url, Label: label} },
+		// Left as placeholders for SubscriberLinks.Personalize; html/template would
+		// percent-encode them inside a plain href
+		"unsubscribeHref": func() template.HTMLAttr { return template.HTMLAttr(`href="` + UnsubscribeURLPlaceholder + `"`) },
+		"preferencesHref": func() template.HTMLAttr { return template.HTMLAttr(`href="` + PreferencesURLPlaceholder + `"`) },
+	}).ParseFS(emailTemplateFiles, "templates/email/layout.html", "templates/email/partials.html")
+	if err != nil {
+		return nil, err
+	}
+
+	defaults := make(map[string]*template.Template)
+	for _, info := range emailTemplateCatalog {
+		t, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if t, err = t.ParseFS(emailTemplateFiles, "templates/email/"+info.Name+".html"); err != nil {
+			return nil, fmt.Errorf("email template %s: %w", info.Name, err)
+		}
+		defaults[info.Name] = t
+	}
+
+	return &EmailTemplates{
+		websiteURL: websiteURL,
+		defaults:   defaults,
+		templates:  make(map[string]*template.Template),
+	}, nil
+}
+
+// UseOverrides makes the templates read admin overrides from the database
+func (t *EmailTemplates) UseOverrides(db *DatabaseService) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.db = db
+	t.templates = make(map[string]*template.Template)
+}
+
+// Invalidate drops the cached templates so overrides are read again on the next render
+func (t *EmailTemplates) Invalidate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.templates = make(map[string]*template.Template)
+}
+
+// Render renders a built-in email, or its override, with the given data
+func (t *EmailTemplates) Render(name string, data interface{}) (*RenderedEmail, error) {
+	tmpl, err := t.template(name)
+	if err != nil {
+		return nil, err
+	}
+	return t.execute(name, tmpl, data)
+}
+
+// Validate renders an override against the template's sample data without saving it,
+// so a broken template is rejected before any email is sent with it
+func (t *EmailTemplates) Validate(name, subject, body string) (*RenderedEmail, error) {
+	info, ok := emailTemplateInfo(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+	tmpl, err := t.withOverride(name, &models.EmailTemplate{Name: name, Subject: subject, Body: body})
+	if err != nil {
+		return nil, err
+	}
+	return t.execute(name, tmpl, info.sample())
+}
+
+// Preview renders a template with its sample data
+func (t *EmailTemplates) Preview(name string) (*RenderedEmail, error) {
+	info, ok := emailTemplateInfo(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+	return t.Render(name, info.sample())
+}
+
+// Default returns the source of a built-in template's subject and content blocks
+func (t *EmailTemplates) Default(name string) (subject, body string, err error) {
+	source, err := emailTemplateFiles.ReadFile("templates/email/" + name + ".html")
+	if err != nil {
+		return "", "", fmt.Errorf("unknown email template %q", name)
+	}
+	return templateBlock(string(source), "subject"), templateBlock(string(source), "content"), nil
+}
+
+// templateBlock cuts the source of a {{define}} block out of a template file
+func templateBlock(source, name string) string {
+	start := strings.Index(source, `{{define "`+name+`"}}`)
+	if start < 0 {
+		return ""
+	}
+	source = source[start+len(`{{define "`+name+`"}}`):]
+	// Blocks in the built-in files end with the {{end}} that closes the line
+	depth := 0
+	for i := 0; i < len(source); i++ {
+		if !strings.HasPrefix(source[i:], "{{") {
+			continue
+		}
+		action := strings.TrimSpace(strings.Trim(source[i:i+strings.Index(source[i:], "}}")+2], "{}-"))
+		switch {
+		case strings.HasPrefix(action, "if ") || strings.HasPrefix(action, "range ") || strings.HasPrefix(action, "with ") || strings.HasPrefix(action, "block "):
+			depth++
+		case action == "end":
+			if depth == 0 {
+				return strings.TrimSpace(source[:i])
+			}
+			depth--
+		}
+	}
+	return strings.TrimSpace(source)
+}
+
+func (t *EmailTemplates) template(name string) (*template.Template, error) {
+	t.mu.RLock()
+	tmpl, ok := t.templates[name]
+	db := t.db
+	t.mu.RUnlock()
+	if ok {
+		return tmpl, nil
+	}
+
+	var override *models.EmailTemplate
+	if db != nil {
+		override = loadEmailTemplateOverride(db, name)
+	}
+	tmpl, err := t.withOverride(name, override)
+	if err != nil && override != nil {
+		// Validate keeps broken overrides out; if one gets in anyway, fall back to the default
+		log.Printf("[Email] ⚠️  Ignoring override of %s template: %v", name, err)
+		tmpl, err = t.withOverride(name, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	t.templates[name] = tmpl
+	t.mu.Unlock()
+	return tmpl, nil
+}
+
+// withOverride clones a built-in template and replaces its subject and content blocks
+func (t *EmailTemplates) withOverride(name string, override *models.EmailTemplate) (*template.Template, error) {
+	def, ok := t.defaults[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+	tmpl, err := def.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if override == nil {
+		return tmpl, nil
+	}
+	if _, err := tmpl.New("override").Parse(`{{define "subject"}}` + override.Subject + `{{end}}{{define "content"}}` + override.Body + `{{end}}`); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func (t *EmailTemplates) execute(name string, tmpl *template.Template, data interface{}) (*RenderedEmail, error) {
+	info, _ := emailTemplateInfo(name)
+	page := emailPage{Newsletter: info.Newsletter, Data: data}
+
+	subject, err := executeBlock(tmpl, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+	page.Subject = subject
+	if tmpl.Lookup("preheader") != nil {
+		if page.Preheader, err = executeBlock(tmpl, "preheader", data); err != nil {
+			return nil, err
+		}
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&body, "layout", page); err != nil {
+		return nil, err
+	}
+	document := InlineCSS(body.String())
+	return &RenderedEmail{Subject: subject, HTML: document, Text: HTMLToText(document)}, nil
+}
+
+// executeBlock renders a one-line block such as the subject to plain text
+func executeBlock(tmpl *template.Template, name string, data interface{}) (string, error) {
+	var out bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&out, name, data); err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(out.String())), " "), nil
+}
+
+// loadEmailTemplateOverride reads an admin's override of a template, if there is one
+func loadEmailTemplateOverride(db *DatabaseService, name string) *models.EmailTemplate {
+	data, _, err := db.GetClient().From("email_templates").
+		Select("name,subject,body,updated_at", "", false).
+		Eq("name", name).
+		Execute()
+	if err != nil {
+		log.Printf("[Email] ⚠️  Failed to load %s template override: %v", name, err)
+		return nil
+	}
+	var overrides []models.EmailTemplate
+	if err := json.Unmarshal(data, &overrides); err != nil || len(overrides) == 0 {
+		return nil
+	}
+	return &overrides[0]
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	textSkipped    = regexp.MustCompile(`(?is)<!--.*?-->|<(head|style|script|title)\b[^>]*>.*?</(head|style|script|title)>`)
+	textHidden     = regexp.MustCompile(`(?is)<(div|span)\b[^>]*display:\s*none[^>]*>.*?</(div|span)>`)
+	textLink       = regexp.MustCompile(`(?is)<a\b[^>]*?href\s*=\s*("[^"]*"|'[^']*')[^>]*>(.*?)</a>`)
+	textBreak      = regexp.MustCompile(`(?i)<br\s*/?>`)
+	textListItem   = regexp.MustCompile(`(?i)<li\b[^>]*>`)
+	textCell       = regexp.MustCompile(`(?i)</t[dh]>`)
+	textListEnd    = regexp.MustCompile(`(?i)</li>`)
+	textBlock      = regexp.MustCompile(`(?i)</?(p|div|h[1-6]|ul|ol|tr|table|blockquote|pre|hr|section)\b[^>]*>`)
+	textTag        = regexp.MustCompile(`<[^>]*>`)
+	textSpaces     = regexp.MustCompile(`\s+`)
+	textBlankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// HTMLToText derives the plain-text part of an email from its HTML, so every email
+// goes out as multipart without keeping a second copy of its wording. Blocks become
+// paragraphs, list items become dashes and links keep their address in brackets.
+func HTMLToText(document string) string {
+	text := textSkipped.ReplaceAllString(document, "")
+	text = textHidden.ReplaceAllString(text, "")
+	text = textSpaces.ReplaceAllString(text, " ")
+	text = textLink.ReplaceAllStringFunc(text, func(link string) string {
+		m := textLink.FindStringSubmatch(link)
+		href := html.UnescapeString(strings.Trim(m[1], `"'`))
+		label := strings.TrimSpace(textTag.ReplaceAllString(m[2], ""))
+		switch {
+		case label == "" || strings.HasPrefix(href, "#"):
+			return label
+		case strings.HasPrefix(href, "mailto:") && strings.TrimPrefix(href, "mailto:") == html.UnescapeString(label):
+			return label
+		case href == html.UnescapeString(label):
+			return href
+		}
+		return label + " (" + href + ")"
+	})
+	text = textBreak.ReplaceAllString(text, "\n")
+	text = textListItem.ReplaceAllString(text, "\n- ")
+	text = textListEnd.ReplaceAllString(text, "")
+	text = textCell.ReplaceAllString(text, " ")
+	text = textBlock.ReplaceAllString(text, "\n\n")
+	text = textTag.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(strings.Join(strings.Fields(line), " "))
+	}
+	text = strings.Join(lines, "\n")
+	text = textBlankLines.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text) + "\n"
+}
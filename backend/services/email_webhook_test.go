@@ -0,0 +1,178 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signWebhook signs a payload the way Resend does, returning a "v1,{signature}" value
+func signWebhook(key []byte, id, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(payload)
+	return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	key := []byte("current-webhook-signing-key")
+	oldKey := []byte("previous-webhook-signing-key")
+	secret := "whsec_" + base64.StdEncoding.EncodeToString(key)
+
+	payload := []byte(`{"type":"email.bounced","data":{"to":["reader@example.com"]}}`)
+	id := "msg_2a"
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-webhookTolerance-time.Minute).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(webhookTolerance+time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		secret    string
+		id        string
+		timestamp string
+		signature string
+		payload   []byte // Body received, defaults to the signed payload
+		want      error
+	}{
+		{
+			name:      "valid signature",
+			secret:    secret,
+			id:        id,
+			timestamp: now,
+			signature: signWebhook(key, id, now, payload),
+		},
+		{
+			name:      "rotation, current key among several",
+			secret:    secret,
+			id:        id,
+			timestamp: now,
+			signature: signWebhook(oldKey, id, now, payload) + " " + signWebhook(key, id, now, payload),
+		},
+		{
+			name:      "rotation, only the old key",
+			secret:    secret,
+			id:        id,
+			timestamp: now,
+			signature: signWebhook(oldKey, id, now, payload),
+			want:      ErrWebhookSignature,
+		},
+		{
+			name:      "unknown signature versions are skipped",
+			secret:    secret,
+			id:        id,
+			timestamp: now,
+			signature: "v2," + strings.TrimPrefix(signWebhook(key, id, now, payload), "v1,") + " garbage " + signWebhook(key, id, now, payload),
+		},
+		{
+			name:      "only unknown signature versions",
+			secret:    secret,
+			id:        id,
+			timestamp: now,
+			signature: "v2," + strings.TrimPrefix(signWebhook(key, id, now, payload), "v1,"),
+			want:      ErrWebhookSignature,
+		},
+		{
+			name:      "tampered body",
+			secret:    secret,
+			id:        id,
+			timestamp: now,
+			signature: signWebhook(key, id, now, payload),
+			payload:   []byte(`{"type":"email.bounced","data":{"to":["someone@example.com"]}}`),
+			want:      ErrWebhookSignature,
+		},
+		{
+			name:      "signature for another message id",
+			secret:    secret,
+			id:        "msg_other",
+			timestamp: now,
+			signature: signWebhook(key, id, now, payload),
+			want:      ErrWebhookSignature,
+		},
+		{
+			name:      "stale timestamp",
+			secret:    secret,
+			id:        id,
+			timestamp: stale,
+			signature: signWebhook(key, id, stale, payload),
+			want:      ErrWebhookTimestamp,
+		},
+		{
+			name:      "future timestamp",
+			secret:    secret,
+			id:        id,
+			timestamp: future,
+			signature: signWebhook(key, id, future, payload),
+			want:      ErrWebhookTimestamp,
+		},
+		{
+			name:      "unparseable timestamp",
+			secret:    secret,
+			id:        id,
+			timestamp: "yesterday",
+			signature: signWebhook(key, id, "yesterday", payload),
+			want:      ErrWebhookTimestamp,
+		},
+		{
+			name:      "missing headers",
+			secret:    secret,
+			signature: signWebhook(key, "", "", payload),
+			want:      ErrWebhookSignature,
+		},
+		{
+			name:      "missing signature",
+			secret:    secret,
+			id:        id,
+			timestamp: now,
+			want:      ErrWebhookSignature,
+		},
+		{
+			name:      "missing secret",
+			id:        id,
+			timestamp: now,
+			signature: signWebhook(key, id, now, payload),
+			want:      ErrWebhookNotConfigured,
+		},
+		{
+			name:      "secret that isn't base64",
+			secret:    "whsec_not base64!",
+			id:        id,
+			timestamp: now,
+			signature: signWebhook(key, id, now, payload),
+			want:      ErrWebhookNotConfigured,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &EmailService{webhookSecret: tt.secret}
+			header := http.Header{}
+			if tt.id != "" {
+				header.Set("svix-id", tt.id)
+			}
+			if tt.timestamp != "" {
+				header.Set("svix-timestamp", tt.timestamp)
+			}
+			if tt.signature != "" {
+				header.Set("svix-signature", tt.signature)
+			}
+			body := payload
+			if tt.payload != nil {
+				body = tt.payload
+			}
+
+			err := service.VerifyWebhookSignature(body, header)
+			if tt.want == nil && err != nil {
+				t.Fatalf("VerifyWebhookSignature() error = %v, want nil", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("VerifyWebhookSignature() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,1110 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// RenderMarkdown renders CommonMark to HTML for emails. It covers the block structure
+// (headings, paragraphs, block quotes, nested lists, code blocks, thematic breaks and
+// link reference definitions) and the inlines (emphasis, code spans, links, images,
+// autolinks, entities, escapes and hard breaks).
+//
+// The output is safe to embed: raw HTML in the source is escaped rather than passed
+// through, and links and images only keep http, https, mailto, tel and relative URLs.
+func RenderMarkdown(source string) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\r", "\n")
+	source = strings.ReplaceAll(source, "\x00", "�")
+
+	lines := strings.Split(strings.TrimSuffix(source, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = expandTabs(line)
+	}
+
+	p := &mdParser{refs: make(map[string]mdLinkRef)}
+	blocks := p.parseBlocks(lines)
+
+	var out strings.Builder
+	p.renderBlocks(&out, blocks, false)
+	return out.String()
+}
+
+// Markdown block kinds
+const (
+	mdParagraph = iota
+	mdHeading
+	mdCode
+	mdQuote
+	mdList
+	mdRule
+)
+
+type mdBlock struct {
+	kind     int
+	loose    bool       // Separated from a sibling by a blank line
+	level    int        // Heading level
+	text     string     // Paragraph and heading inline source, code block contents
+	info     string     // Fenced code info string
+	children []*mdBlock // Block quote contents
+	items    [][]*mdBlock
+	ordered  bool
+	start    int
+	tight    bool
+}
+
+type mdLinkRef struct {
+	dest  string
+	title string
+}
+
+type mdParser struct {
+	refs map[string]mdLinkRef
+}
+
+var (
+	mdATXHeading    = regexp.MustCompile(`^(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	mdFenceOpen     = regexp.MustCompile("^(`{3,}|~{3,})[ \t]*([^`]*)$")
+	mdBulletMarker  = regexp.MustCompile(`^([-+*])( +|$)`)
+	mdOrderedMarker = regexp.MustCompile(`^(\d{1,9})([.)])( +|$)`)
+	mdSetextLine    = regexp.MustCompile(`^(=+|-+)[ \t]*$`)
+	mdEntity        = regexp.MustCompile(`^&(?:#[xX][0-9a-fA-F]{1,6}|#[0-9]{1,7}|[a-zA-Z][a-zA-Z0-9]{1,31});`)
+	mdAutolink      = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9+.-]{1,31}:[^<>\x00-\x20]*)>`)
+	mdEmailAutolink = regexp.MustCompile(`^<([a-zA-Z0-9.!#$%&'*+/=?^_` + "`" + `{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*)>`)
+)
+
+// expandTabs replaces the tabs in a line's indentation, block quote markers and list
+// markers with spaces up to the next multiple of four columns. Tabs in the text itself,
+// as in code, are kept.
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	column := 0
+	for i, r := range line {
+		if r == '\t' {
+			spaces := 4 - column%4
+			b.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+			continue
+		}
+		if !strings.ContainsRune(" >-+*.)0123456789", r) {
+			b.WriteString(line[i:])
+			break
+		}
+		b.WriteRune(r)
+		column++
+	}
+	return b.String()
+}
+
+// mdLazy marks a lazy continuation line handed to a nested parse, so it continues the
+// paragraph before it instead of starting a block of its own. NUL can't otherwise
+// occur: RenderMarkdown replaces it.
+const mdLazy = "\x00"
+
+func isBlankLine(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func leadingSpaces(line string) int {
+	n := 0
+	for n < len(line) && line[n] == ' ' {
+		n++
+	}
+	return n
+}
+
+// stripIndent removes up to n leading spaces
+func stripIndent(line string, n int) string {
+	i := 0
+	for i < n && i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return line[i:]
+}
+
+func isThematicBreak(line string) bool {
+	if leadingSpaces(line) > 3 {
+		return false
+	}
+	var marker rune
+	count := 0
+	for _, r := range strings.TrimSpace(line) {
+		switch {
+		case r == ' ':
+		case (r == '-' || r == '*' || r == '_') && (marker == 0 || marker == r):
+			marker = r
+			count++
+		default:
+			return false
+		}
+	}
+	return count >= 3
+}
+
+// listMarker parses a list item marker at the start of line, returning the content
+// indent of the item (the column its continuation lines line up with)
+func listMarker(line string) (ordered bool, delimiter byte, start, contentIndent int, content string, ok bool) {
+	indent := leadingSpaces(line)
+	if indent > 3 {
+		return false, 0, 0, 0, "", false
+	}
+	rest := line[indent:]
+
+	var markerWidth, spaces int
+	if m := mdBulletMarker.FindStringSubmatch(rest); m != nil {
+		delimiter = m[1][0]
+		markerWidth, spaces = 1, len(m[2])
+	} else if m := mdOrderedMarker.FindStringSubmatch(rest); m != nil {
+		ordered = true
+		delimiter = m[2][0]
+		start, _ = strconv.Atoi(m[1])
+		markerWidth, spaces = len(m[1])+1, len(m[3])
+	} else {
+		return false, 0, 0, 0, "", false
+	}
+
+	content = rest[markerWidth+spaces:]
+	switch {
+	case content == "":
+		spaces = 1
+	case spaces > 4:
+		// Indented code inside the item: only one space belongs to the marker
+		content = strings.Repeat(" ", spaces-1) + content
+		spaces = 1
+	}
+	return ordered, delimiter, start, indent + markerWidth + spaces, content, true
+}
+
+// startsBlock reports whether line would interrupt a paragraph
+func startsBlock(line string) bool {
+	if leadingSpaces(line) > 3 {
+		return false
+	}
+	trimmed := strings.TrimLeft(line, " ")
+	if isThematicBreak(line) || mdATXHeading.MatchString(trimmed) || mdFenceOpen.MatchString(trimmed) || strings.HasPrefix(trimmed, ">") {
+		return true
+	}
+	// Only non-empty bullet items and ordered items starting at 1 interrupt a paragraph
+	if ordered, _, start, _, content, ok := listMarker(line); ok && strings.TrimSpace(content) != "" {
+		return !ordered || start == 1
+	}
+	return false
+}
+
+func (p *mdParser) parseBlocks(lines []string) []*mdBlock {
+	var blocks []*mdBlock
+	blank := false // A blank line came before the next block
+	add := func(block *mdBlock) {
+		block.loose = blank && len(blocks) > 0
+		blocks = append(blocks, block)
+		blank = false
+	}
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if isBlankLine(line) {
+			blank = true
+			i++
+			continue
+		}
+		indent := leadingSpaces(line)
+		trimmed := line[indent:]
+
+		// Indented code block
+		if indent >= 4 {
+			var code []string
+			for i < len(lines) && (isBlankLine(lines[i]) || leadingSpaces(lines[i]) >= 4) {
+				code = append(code, stripIndent(lines[i], 4))
+				i++
+			}
+			trailing := 0
+			for len(code) > 0 && isBlankLine(code[len(code)-1]) {
+				code = code[:len(code)-1]
+				trailing++
+			}
+			add(&mdBlock{kind: mdCode, text: strings.Join(code, "\n") + "\n"})
+			blank = trailing > 0
+			continue
+		}
+
+		// Fenced code block
+		if m := mdFenceOpen.FindStringSubmatch(trimmed); m != nil {
+			fence := m[1]
+			var code []string
+			i++
+			for i < len(lines) {
+				closing := strings.TrimSpace(lines[i])
+				if leadingSpaces(lines[i]) <= 3 && strings.HasPrefix(closing, fence) && strings.Trim(closing, fence[:1]) == "" {
+					i++
+					break
+				}
+				code = append(code, stripIndent(lines[i], indent))
+				i++
+			}
+			text := strings.Join(code, "\n")
+			if len(code) > 0 {
+				text += "\n"
+			}
+			info := strings.Fields(unescapeMarkdown(m[2]))
+			block := &mdBlock{kind: mdCode, text: text}
+			if len(info) > 0 {
+				block.info = info[0]
+			}
+			add(block)
+			continue
+		}
+
+		if m := mdATXHeading.FindStringSubmatch(trimmed); m != nil {
+			text := strings.TrimSpace(m[2])
+			if strings.Trim(text, "#") == "" {
+				// Only a closing sequence, as in "### ###"
+				text = ""
+			}
+			add(&mdBlock{kind: mdHeading, level: len(m[1]), text: text})
+			i++
+			continue
+		}
+
+		if isThematicBreak(line) {
+			add(&mdBlock{kind: mdRule})
+			i++
+			continue
+		}
+
+		// Block quote, with lazy continuation of its paragraphs
+		if strings.HasPrefix(trimmed, ">") {
+			var quoted []string
+			lazy := false // The last line was a lazy continuation, so a paragraph is open
+			for i < len(lines) {
+				current := lines[i]
+				currentTrimmed := strings.TrimLeft(current, " ")
+				if leadingSpaces(current) <= 3 && strings.HasPrefix(currentTrimmed, ">") {
+					content := currentTrimmed[1:]
+					if strings.HasPrefix(content, " ") {
+						content = content[1:]
+					}
+					quoted = append(quoted, content)
+					lazy = false
+					i++
+					continue
+				}
+				if isBlankLine(current) || startsBlock(current) || !(lazy || endsInParagraph(quoted)) {
+					break
+				}
+				quoted = append(quoted, mdLazy+strings.TrimLeft(current, " "+mdLazy))
+				lazy = true
+				i++
+			}
+			add(&mdBlock{kind: mdQuote, children: p.parseBlocks(quoted)})
+			continue
+		}
+
+		if ordered, delimiter, start, _, _, ok := listMarker(line); ok {
+			list, next := p.parseList(lines, i, ordered, delimiter)
+			list.start = start
+			add(list)
+			i = next
+			continue
+		}
+
+		// Paragraph, possibly turned into a heading by a setext underline
+		var para []string
+		for i < len(lines) && !isBlankLine(lines[i]) {
+			if strings.HasPrefix(lines[i], mdLazy) {
+				para = append(para, strings.TrimLeft(lines[i], mdLazy+" "))
+				i++
+				continue
+			}
+			if len(para) > 0 {
+				if m := mdSetextLine.FindStringSubmatch(strings.TrimLeft(lines[i], " ")); m != nil && leadingSpaces(lines[i]) <= 3 {
+					level := 2
+					if m[1][0] == '=' {
+						level = 1
+					}
+					add(&mdBlock{kind: mdHeading, level: level, text: strings.TrimSpace(strings.Join(para, "\n"))})
+					para = nil
+					i++
+					break
+				}
+				if startsBlock(lines[i]) {
+					break
+				}
+			}
+			para = append(para, strings.TrimLeft(lines[i], " "))
+			i++
+		}
+		if len(para) == 0 {
+			continue
+		}
+
+		para = p.extractReferences(para)
+		if len(para) > 0 {
+			add(&mdBlock{kind: mdParagraph, text: strings.TrimRight(strings.Join(para, "\n"), " ")})
+		} else if blank && len(blocks) > 0 {
+			// Only link reference definitions; the blank line before them still counts
+			blocks[len(blocks)-1].loose = true
+		}
+	}
+	return blocks
+}
+
+// parseList collects the items of a list starting at lines[i] and returns it along
+// with the index of the first line after it. Blank lines after the last item are left
+// for the caller, which needs them to tell whether its own blocks are separated.
+func (p *mdParser) parseList(lines []string, i int, ordered bool, delimiter byte) (*mdBlock, int) {
+	list := &mdBlock{kind: mdList, ordered: ordered, tight: true}
+
+	for i < len(lines) {
+		if isBlankLine(lines[i]) {
+			// Blank lines between items make the list loose
+			next := i
+			for next < len(lines) && isBlankLine(lines[next]) {
+				next++
+			}
+			if next == len(lines) || !continuesList(lines[next], ordered, delimiter) {
+				break
+			}
+			list.tight = false
+			i = next
+		}
+		if !continuesList(lines[i], ordered, delimiter) {
+			break
+		}
+		_, _, _, contentIndent, content, _ := listMarker(lines[i])
+
+		item := []string{content}
+		lazy := false
+		i++
+		for i < len(lines) {
+			line := lines[i]
+			if isBlankLine(line) {
+				// An item can only start with one blank line
+				if len(item) == 1 && isBlankLine(item[0]) {
+					break
+				}
+				item = append(item, "")
+				lazy = false
+				i++
+				continue
+			}
+			if leadingSpaces(line) >= contentIndent {
+				item = append(item, stripIndent(line, contentIndent))
+				lazy = false
+				i++
+				continue
+			}
+			if _, _, _, _, _, ok := listMarker(line); ok {
+				break
+			}
+			// Lazy continuation of the item's last paragraph
+			if !startsBlock(line) && (lazy || endsInParagraph(item)) {
+				item = append(item, mdLazy+strings.TrimLeft(line, " "+mdLazy))
+				lazy = true
+				i++
+				continue
+			}
+			break
+		}
+
+		// Hand trailing blank lines back; the marker line itself wasn't one
+		trailing := 0
+		for len(item) > trailing+1 && isBlankLine(item[len(item)-1-trailing]) {
+			trailing++
+		}
+		item = item[:len(item)-trailing]
+		if len(item) == 1 && isBlankLine(item[0]) {
+			item = nil
+		}
+		i -= trailing
+
+		// Blank lines between the item's own blocks make the whole list loose
+		children := p.parseBlocks(item)
+		for _, child := range children {
+			if child.loose {
+				list.tight = false
+			}
+		}
+		list.items = append(list.items, children)
+	}
+	return list, i
+}
+
+// endsInParagraph reports whether lines, parsed, end in a paragraph that a lazy
+// continuation line could continue
+func endsInParagraph(lines []string) bool {
+	if len(lines) == 0 || isBlankLine(lines[len(lines)-1]) {
+		return false
+	}
+	blocks := (&mdParser{refs: make(map[string]mdLinkRef)}).parseBlocks(lines)
+	for len(blocks) > 0 {
+		last := blocks[len(blocks)-1]
+		switch last.kind {
+		case mdParagraph:
+			return true
+		case mdQuote:
+			blocks = last.children
+		case mdList:
+			blocks = last.items[len(last.items)-1]
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// continuesList reports whether line starts another item of a list with the given
+// marker type
+func continuesList(line string, ordered bool, delimiter byte) bool {
+	itemOrdered, itemDelimiter, _, _, _, ok := listMarker(line)
+	return ok && itemOrdered == ordered && itemDelimiter == delimiter && !isThematicBreak(line)
+}
+
+// extractReferences removes link reference definitions from the start of a paragraph
+func (p *mdParser) extractReferences(lines []string) []string {
+	text := strings.Join(lines, "\n")
+	for strings.HasPrefix(text, "[") {
+		label, rest, ok := scanLinkLabel(text)
+		if !ok || !strings.HasPrefix(rest, ":") {
+			break
+		}
+		rest = strings.TrimLeft(rest[1:], " \t")
+		rest = strings.TrimPrefix(rest, "\n")
+		rest = strings.TrimLeft(rest, " \t")
+
+		dest, afterDest, ok := scanLinkDestination(rest)
+		if !ok || (dest == "" && !strings.HasPrefix(rest, "<>")) {
+			break
+		}
+		title, remaining := "", afterDest
+		// A title has to be separated from the destination by whitespace
+		if spaced := strings.TrimLeft(afterDest, " \t\n"); spaced != afterDest {
+			if t, after, ok := scanLinkTitle(spaced); ok && restOfLineBlank(after) {
+				title, remaining = t, after
+			}
+		}
+		if !restOfLineBlank(remaining) {
+			break
+		}
+		lineEnd := strings.IndexByte(remaining, '\n')
+		if lineEnd < 0 {
+			lineEnd = len(remaining)
+		}
+		afterTitle := remaining
+
+		key := normalizeLabel(label)
+		if _, exists := p.refs[key]; !exists {
+			p.refs[key] = mdLinkRef{dest: dest, title: title}
+		}
+		text = strings.TrimPrefix(afterTitle[lineEnd:], "\n")
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+func restOfLineBlank(s string) bool {
+	if end := strings.IndexByte(s, '\n'); end >= 0 {
+		s = s[:end]
+	}
+	return strings.TrimSpace(s) == ""
+}
+
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+func (p *mdParser) renderBlocks(out *strings.Builder, blocks []*mdBlock, tight bool) {
+	for i, block := range blocks {
+		switch block.kind {
+		case mdParagraph:
+			// Paragraphs of tight list items go without <p>
+			if tight {
+				out.WriteString(p.renderInline(block.text))
+				if i < len(blocks)-1 {
+					out.WriteString("\n")
+				}
+				continue
+			}
+			fmt.Fprintf(out, "<p>%s</p>\n", p.renderInline(block.text))
+		case mdHeading:
+			fmt.Fprintf(out, "<h%d>%s</h%d>\n", block.level, p.renderInline(block.text), block.level)
+		case mdCode:
+			if block.info != "" {
+				fmt.Fprintf(out, "<pre><code class=\"language-%s\">%s</code></pre>\n", html.EscapeString(block.info), html.EscapeString(block.text))
+			} else {
+				fmt.Fprintf(out, "<pre><code>%s</code></pre>\n", html.EscapeString(block.text))
+			}
+		case mdQuote:
+			out.WriteString("<blockquote>\n")
+			p.renderBlocks(out, block.children, false)
+			out.WriteString("</blockquote>\n")
+		case mdRule:
+			out.WriteString("<hr />\n")
+		case mdList:
+			tag := "ul"
+			if block.ordered {
+				tag = "ol"
+				if block.start != 1 {
+					fmt.Fprintf(out, "<ol start=\"%d\">\n", block.start)
+				} else {
+					out.WriteString("<ol>\n")
+				}
+			} else {
+				out.WriteString("<ul>\n")
+			}
+			for _, item := range block.items {
+				out.WriteString("<li>")
+				if len(item) > 0 && (!block.tight || item[0].kind != mdParagraph) {
+					out.WriteString("\n")
+				}
+				p.renderBlocks(out, item, block.tight)
+				out.WriteString("</li>\n")
+			}
+			fmt.Fprintf(out, "</%s>\n", tag)
+		}
+	}
+}
+
+// inlineNode is a piece of a paragraph being parsed: rendered HTML, or a run of
+// emphasis delimiters or a bracket still waiting to be matched
+type inlineNode struct {
+	html      string
+	delim     byte // '*' or '_' for emphasis runs, '[' or '!' for link openers
+	count     int
+	origCount int
+	canOpen   bool
+	canClose  bool
+	active    bool
+}
+
+func (n *inlineNode) render() string {
+	switch n.delim {
+	case '*', '_':
+		return strings.Repeat(string(n.delim), n.count)
+	case '[':
+		return "["
+	case '!':
+		return "!["
+	}
+	return n.html
+}
+
+func renderNodes(nodes []*inlineNode) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		b.WriteString(n.render())
+	}
+	return b.String()
+}
+
+func (p *mdParser) renderInline(text string) string {
+	var nodes []*inlineNode
+	var pending strings.Builder
+	flush := func() {
+		if pending.Len() > 0 {
+			nodes = append(nodes, &inlineNode{html: pending.String()})
+			pending.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && text[i+1] == '\n':
+			flush()
+			nodes = append(nodes, &inlineNode{html: "<br />\n"})
+			i += 2
+			continue
+		case c == '\\' && i+1 < len(text) && isASCIIPunct(text[i+1]):
+			pending.WriteString(html.EscapeString(text[i+1 : i+2]))
+			i += 2
+			continue
+		case c == '\n':
+			// Two or more trailing spaces make a hard break
+			content := pending.String()
+			trimmed := strings.TrimRight(content, " ")
+			hard := len(content)-len(trimmed) >= 2
+			pending.Reset()
+			pending.WriteString(trimmed)
+			flush()
+			if hard {
+				nodes = append(nodes, &inlineNode{html: "<br />\n"})
+			} else {
+				nodes = append(nodes, &inlineNode{html: "\n"})
+			}
+			i++
+			for i < len(text) && text[i] == ' ' {
+				i++
+			}
+			continue
+		case c == '`':
+			run := countRun(text, i, '`')
+			if end := findBacktickRun(text, i+run, run); end >= 0 {
+				code := strings.ReplaceAll(text[i+run:end], "\n", " ")
+				if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+					code = code[1 : len(code)-1]
+				}
+				flush()
+				nodes = append(nodes, &inlineNode{html: "<code>" + html.EscapeString(code) + "</code>"})
+				i = end + run
+				continue
+			}
+			pending.WriteString(text[i : i+run])
+			i += run
+			continue
+		case c == '<':
+			if m := mdAutolink.FindStringSubmatch(text[i:]); m != nil {
+				flush()
+				nodes = append(nodes, &inlineNode{html: renderLink(m[1], "", html.EscapeString(m[1]))})
+				i += len(m[0])
+				continue
+			}
+			if m := mdEmailAutolink.FindStringSubmatch(text[i:]); m != nil {
+				flush()
+				nodes = append(nodes, &inlineNode{html: renderLink("mailto:"+m[1], "", html.EscapeString(m[1]))})
+				i += len(m[0])
+				continue
+			}
+			// Raw HTML is shown as text
+			pending.WriteString("&lt;")
+			i++
+			continue
+		case c == '&':
+			if m := mdEntity.FindString(text[i:]); m != "" && html.UnescapeString(m) != m {
+				pending.WriteString(html.EscapeString(html.UnescapeString(m)))
+				i += len(m)
+				continue
+			}
+			pending.WriteString("&amp;")
+			i++
+			continue
+		case c == '*' || c == '_':
+			run := countRun(text, i, c)
+			before, _ := utf8.DecodeLastRuneInString(text[:i])
+			after, _ := utf8.DecodeRuneInString(text[i+run:])
+			if i == 0 {
+				before = '\n'
+			}
+			if i+run >= len(text) {
+				after = '\n'
+			}
+			left := !isMarkdownSpace(after) && (!isMarkdownPunct(after) || isMarkdownSpace(before) || isMarkdownPunct(before))
+			right := !isMarkdownSpace(before) && (!isMarkdownPunct(before) || isMarkdownSpace(after) || isMarkdownPunct(after))
+			node := &inlineNode{delim: c, count: run, origCount: run, active: true}
+			if c == '*' {
+				node.canOpen, node.canClose = left, right
+			} else {
+				node.canOpen = left && (!right || isMarkdownPunct(before))
+				node.canClose = right && (!left || isMarkdownPunct(after))
+			}
+			flush()
+			nodes = append(nodes, node)
+			i += run
+			continue
+		case c == '!' && i+1 < len(text) && text[i+1] == '[':
+			flush()
+			nodes = append(nodes, &inlineNode{delim: '!', active: true})
+			i += 2
+			continue
+		case c == '[':
+			flush()
+			nodes = append(nodes, &inlineNode{delim: '[', active: true})
+			i++
+			continue
+		case c == ']':
+			flush()
+			if consumed, ok := p.closeBracket(&nodes, text[i+1:]); ok {
+				i += 1 + consumed
+				continue
+			}
+			pending.WriteString("]")
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(text[i:])
+		pending.WriteString(html.EscapeString(string(r)))
+		i += size
+	}
+	flush()
+
+	processEmphasis(&nodes, 0)
+	return renderNodes(nodes)
+}
+
+// closeBracket tries to turn the latest [ or ![ opener and what follows it into a link
+// or image. rest is the text after the ]; it returns how much of it was consumed.
+func (p *mdParser) closeBracket(nodes *[]*inlineNode, rest string) (int, bool) {
+	list := *nodes
+	opener := -1
+	for j := len(list) - 1; j >= 0; j-- {
+		if list[j].delim == '[' || list[j].delim == '!' {
+			opener = j
+			break
+		}
+	}
+	if opener < 0 {
+		return 0, false
+	}
+	if !list[opener].active {
+		list[opener].html, list[opener].delim = list[opener].render(), 0
+		return 0, false
+	}
+
+	var dest, title string
+	consumed := 0
+	found := false
+
+	if strings.HasPrefix(rest, "(") {
+		inner := strings.TrimLeft(rest[1:], " \t\n")
+		d, after, ok := scanLinkDestination(inner)
+		if ok {
+			afterSpace := strings.TrimLeft(after, " \t\n")
+			t, afterTitle, titleOK := "", afterSpace, true
+			if afterSpace != after && len(afterSpace) > 0 && strings.ContainsRune(`"'(`, rune(afterSpace[0])) {
+				t, afterTitle, titleOK = scanLinkTitle(afterSpace)
+			}
+			afterTitle = strings.TrimLeft(afterTitle, " \t\n")
+			if titleOK && strings.HasPrefix(afterTitle, ")") {
+				dest, title, found = d, t, true
+				consumed = len(rest) - len(afterTitle) + 1
+			}
+		}
+	}
+
+	if !found {
+		// Full, collapsed and shortcut reference links
+		label := ""
+		if strings.HasPrefix(rest, "[") {
+			if l, after, ok := scanLinkLabel(rest); ok {
+				label = l
+				consumed = len(rest) - len(after)
+			}
+		}
+		if label == "" {
+			label = plainText(list[opener+1:])
+			if strings.HasPrefix(rest, "[]") {
+				consumed = 2
+			} else {
+				consumed = 0
+			}
+		}
+		if ref, ok := p.refs[normalizeLabel(label)]; ok {
+			dest, title, found = ref.dest, ref.title, true
+		}
+	}
+
+	if !found {
+		list[opener].html, list[opener].delim = list[opener].render(), 0
+		return 0, false
+	}
+
+	isImage := list[opener].delim == '!'
+	inner := list[opener+1:]
+	processEmphasis(&inner, 0)
+
+	var linkHTML string
+	if isImage {
+		linkHTML = renderImage(dest, title, plainText(inner))
+	} else {
+		linkHTML = renderLink(dest, title, renderNodes(inner))
+		// Links can't contain other links
+		for _, n := range list[:opener] {
+			if n.delim == '[' {
+				n.active = false
+			}
+		}
+	}
+
+	*nodes = append(list[:opener], &inlineNode{html: linkHTML})
+	return consumed, true
+}
+
+// processEmphasis matches the emphasis delimiter runs in nodes[bottom:] following the
+// CommonMark algorithm, including the rule of three
+func processEmphasis(nodes *[]*inlineNode, bottom int) {
+	list := *nodes
+	for closer := bottom; closer < len(list); {
+		c := list[closer]
+		if (c.delim != '*' && c.delim != '_') || !c.canClose || c.count == 0 {
+			closer++
+			continue
+		}
+
+		opener := -1
+		for j := closer - 1; j >= bottom; j-- {
+			o := list[j]
+			if o.delim != c.delim || !o.canOpen || o.count == 0 {
+				continue
+			}
+			if (o.canClose || c.canOpen) && (o.origCount+c.origCount)%3 == 0 && !(o.origCount%3 == 0 && c.origCount%3 == 0) {
+				continue
+			}
+			opener = j
+			break
+		}
+		if opener < 0 {
+			closer++
+			continue
+		}
+
+		o := list[opener]
+		use, tag := 1, "em"
+		if o.count >= 2 && c.count >= 2 {
+			use, tag = 2, "strong"
+		}
+		o.count -= use
+		c.count -= use
+
+		// Everything between the two runs becomes one node, so they end up adjacent
+		wrapped := &inlineNode{html: "<" + tag + ">" + renderNodes(list[opener+1:closer]) + "</" + tag + ">"}
+		rebuilt := append([]*inlineNode{}, list[:opener+1]...)
+		rebuilt = append(rebuilt, wrapped)
+		list = append(rebuilt, list[closer:]...)
+		closer = opener + 2
+
+		if o.count == 0 {
+			list = append(list[:opener], list[opener+1:]...)
+			closer--
+		}
+		if c.count == 0 {
+			list = append(list[:closer], list[closer+1:]...)
+		}
+		// A closer with delimiters left is looked at again
+	}
+	*nodes = list
+}
+
+// plainText returns the text of rendered nodes without tags, for image alt text and
+// shortcut reference labels
+func plainText(nodes []*inlineNode) string {
+	var b strings.Builder
+	inTag := false
+	for _, r := range renderNodes(nodes) {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>' && inTag:
+			inTag = false
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return html.UnescapeString(b.String())
+}
+
+func renderLink(dest, title, content string) string {
+	href, ok := safeMarkdownURL(dest)
+	if !ok {
+		return content
+	}
+	attrs := fmt.Sprintf(` href="%s"`, html.EscapeString(href))
+	if title != "" {
+		attrs += fmt.Sprintf(` title="%s"`, html.EscapeString(title))
+	}
+	return "<a" + attrs + ">" + content + "</a>"
+}
+
+func renderImage(src, title, alt string) string {
+	url, ok := safeMarkdownURL(src)
+	if !ok {
+		return html.EscapeString(alt)
+	}
+	attrs := fmt.Sprintf(` src="%s" alt="%s"`, html.EscapeString(url), html.EscapeString(alt))
+	if title != "" {
+		attrs += fmt.Sprintf(` title="%s"`, html.EscapeString(title))
+	}
+	return "<img" + attrs + " />"
+}
+
+var mdURLScheme = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*):`)
+
+// safeMarkdownURL percent-encodes a link destination and reports whether its scheme is
+// allowed in emails. Encoding comes first so that what's checked is what a mail client
+// parses: browsers drop tabs, newlines and leading control characters from URLs, which
+// would otherwise let "java\tscript:" through.
+func safeMarkdownURL(raw string) (string, bool) {
+	encoded := encodeMarkdownURL(strings.TrimSpace(raw))
+	m := mdURLScheme.FindStringSubmatch(encoded)
+	if m == nil {
+		return encoded, true // Relative
+	}
+	switch strings.ToLower(m[1]) {
+	case "http", "https", "mailto", "tel":
+		return encoded, true
+	}
+	return "", false
+}
+
+// encodeMarkdownURL percent-encodes the characters that aren't allowed in a URL as
+// written, keeping escapes that are already there
+func encodeMarkdownURL(raw string) string {
+	const keep = ";/?:@&=+$,-_.!~*'()#"
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '%' && len(raw)-i >= 3 && isHexDigit(raw[i+1]) && isHexDigit(raw[i+2]):
+			b.WriteByte(c)
+		case c < 0x80 && (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte(keep, c) >= 0):
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// scanLinkLabel reads a [label] at the start of s
+func scanLinkLabel(s string) (label, rest string, ok bool) {
+	if !strings.HasPrefix(s, "[") {
+		return "", s, false
+	}
+	for i := 1; i < len(s) && i <= 1000; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			return "", s, false
+		case ']':
+			label = s[1:i]
+			if strings.TrimSpace(label) == "" {
+				return "", s, false
+			}
+			return label, s[i+1:], true
+		}
+	}
+	return "", s, false
+}
+
+// scanLinkDestination reads a link destination: <...> or a run without spaces and
+// with balanced parentheses
+func scanLinkDestination(s string) (dest, rest string, ok bool) {
+	if strings.HasPrefix(s, "<") {
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '\n', '<':
+				return "", s, false
+			case '>':
+				return unescapeMarkdown(s[1:i]), s[i+1:], true
+			}
+		}
+		return "", s, false
+	}
+
+	depth := 0
+	i := 0
+	for ; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			i++
+			continue
+		}
+		if c <= ' ' {
+			break
+		}
+		if c == '(' {
+			depth++
+		}
+		if c == ')' {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+	}
+	if depth != 0 {
+		return "", s, false
+	}
+	return unescapeMarkdown(s[:i]), s[i:], true
+}
+
+// scanLinkTitle reads a "title", 'title' or (title)
+func scanLinkTitle(s string) (title, rest string, ok bool) {
+	if s == "" {
+		return "", s, false
+	}
+	closing := s[0]
+	switch closing {
+	case '"', '\'':
+	case '(':
+		closing = ')'
+	default:
+		return "", s, false
+	}
+	for i := 1; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == closing {
+			return unescapeMarkdown(s[1:i]), s[i+1:], true
+		}
+	}
+	return "", s, false
+}
+
+// unescapeMarkdown resolves backslash escapes and entities in link destinations and titles
+func unescapeMarkdown(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			b.WriteByte(s[i+1])
+			i++
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return html.UnescapeString(b.String())
+}
+
+func countRun(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// findBacktickRun finds the next run of exactly n backticks at or after i
+func findBacktickRun(s string, i, n int) int {
+	for i < len(s) {
+		if s[i] != '`' {
+			i++
+			continue
+		}
+		run := countRun(s, i, '`')
+		if run == n {
+			return i
+		}
+		i += run
+	}
+	return -1
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isMarkdownSpace(r rune) bool {
+	return r == '\n' || unicode.IsSpace(r)
+}
+
+func isMarkdownPunct(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
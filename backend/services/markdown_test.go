@@ -0,0 +1,309 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+// markdownSpecExamples are examples from the CommonMark spec (0.31.2), numbered as
+// there. Examples with raw HTML are left out; RenderMarkdown escapes it, which is
+// covered by TestRenderMarkdownSanitizes.
+var markdownSpecExamples = []struct {
+	example  int
+	markdown string
+	html     string
+}{
+	// Tabs
+	{1, "\tfoo\tbaz\t\tbim\n", "<pre><code>foo\tbaz\t\tbim\n</code></pre>\n"},
+	{2, "  \tfoo\tbaz\t\tbim\n", "<pre><code>foo\tbaz\t\tbim\n</code></pre>\n"},
+	{3, "    a\ta\n    ὐ\ta\n", "<pre><code>a\ta\nὐ\ta\n</code></pre>\n"},
+	{4, "  - foo\n\n\tbar\n", "<ul>\n<li>\n<p>foo</p>\n<p>bar</p>\n</li>\n</ul>\n"},
+	{5, "- foo\n\n\t\tbar\n", "<ul>\n<li>\n<p>foo</p>\n<pre><code>  bar\n</code></pre>\n</li>\n</ul>\n"},
+	{6, ">\t\tfoo\n", "<blockquote>\n<pre><code>  foo\n</code></pre>\n</blockquote>\n"},
+	{8, "    foo\n\tbar\n", "<pre><code>foo\nbar\n</code></pre>\n"},
+	{9, " - foo\n   - bar\n\t - baz\n", "<ul>\n<li>foo\n<ul>\n<li>bar\n<ul>\n<li>baz</li>\n</ul>\n</li>\n</ul>\n</li>\n</ul>\n"},
+	{11, "*\t*\t*\t\n", "<hr />\n"},
+
+	// Backslash escapes
+	{12, "\\!\\\"\\#\\$\\%\\&\\'\\(\\)\\*\\+\\,\\-\\.\\/\\:\\;\\<\\=\\>\\?\\@\\[\\\\\\]\\^\\_\\`\\{\\|\\}\\~\n",
+		"<p>!&quot;#$%&amp;'()*+,-./:;&lt;=&gt;?@[\\]^_`{|}~</p>\n"},
+	{14, "\\*not emphasized*\n\\<br/> not a tag\n\\[not a link](/foo)\n\\`not code`\n1\\. not a list\n\\* not a list\n\\# not a heading\n\\[foo]: /url \"not a reference\"\n\\&ouml; not a character entity\n",
+		"<p>*not emphasized*\n&lt;br/&gt; not a tag\n[not a link](/foo)\n`not code`\n1. not a list\n* not a list\n# not a heading\n[foo]: /url &quot;not a reference&quot;\n&amp;ouml; not a character entity</p>\n"},
+	{15, "\\\\*emphasis*\n", "<p>\\<em>emphasis</em></p>\n"},
+	{16, "foo\\\nbar\n", "<p>foo<br />\nbar</p>\n"},
+	{17, "`` \\[\\` ``\n", "<p><code>\\[\\`</code></p>\n"},
+	{18, "    \\[\\]\n", "<pre><code>\\[\\]\n</code></pre>\n"},
+
+	// Entity and numeric character references
+	{25, "&nbsp; &amp; &copy; &AElig; &Dcaron;\n&frac34; &HilbertSpace; &DifferentialD;\n&ClockwiseContourIntegral; &ngE;\n",
+		"<p>\u00a0 &amp; © Æ Ď\n¾ ℋ ⅆ\n∲ ≧̸</p>\n"},
+	{26, "&#35; &#1234; &#992; &#0;\n", "<p># Ӓ Ϡ �</p>\n"},
+	{28, "&nbsp &x; &#; &#x;\n&#87654321;\n&#abcdef0;\n&ThisIsNotDefined; &hi?;\n",
+		"<p>&amp;nbsp &amp;x; &amp;#; &amp;#x;\n&amp;#87654321;\n&amp;#abcdef0;\n&amp;ThisIsNotDefined; &amp;hi?;</p>\n"},
+	{37, "*foo*\n&#42;foo&#42;\n", "<p><em>foo</em>\n*foo*</p>\n"},
+
+	// Thematic breaks
+	{43, "***\n---\n___\n", "<hr />\n<hr />\n<hr />\n"},
+	{44, "+++\n", "<p>+++</p>\n"},
+	{47, "--\n**\n__\n", "<p>--\n**\n__</p>\n"},
+	{48, " ***\n  ***\n   ***\n", "<hr />\n<hr />\n<hr />\n"},
+	{49, "    ***\n", "<pre><code>***\n</code></pre>\n"},
+	{52, " - - -\n", "<hr />\n"},
+	{57, "- foo\n***\n- bar\n", "<ul>\n<li>foo</li>\n</ul>\n<hr />\n<ul>\n<li>bar</li>\n</ul>\n"},
+	{58, "Foo\n***\nbar\n", "<p>Foo</p>\n<hr />\n<p>bar</p>\n"},
+	{59, "Foo\n---\nbar\n", "<h2>Foo</h2>\n<p>bar</p>\n"},
+	{61, "- Foo\n- * * *\n", "<ul>\n<li>Foo</li>\n<li>\n<hr />\n</li>\n</ul>\n"},
+
+	// ATX headings
+	{62, "# foo\n## foo\n### foo\n#### foo\n##### foo\n###### foo\n",
+		"<h1>foo</h1>\n<h2>foo</h2>\n<h3>foo</h3>\n<h4>foo</h4>\n<h5>foo</h5>\n<h6>foo</h6>\n"},
+	{63, "####### foo\n", "<p>####### foo</p>\n"},
+	{64, "#5 bolt\n\n#hashtag\n", "<p>#5 bolt</p>\n<p>#hashtag</p>\n"},
+	{66, "# foo *bar* \\*baz\\*\n", "<h1>foo <em>bar</em> *baz*</h1>\n"},
+	{71, "## foo ##\n  ###   bar    ###\n", "<h2>foo</h2>\n<h3>bar</h3>\n"},
+	{73, "### foo ###     \n", "<h3>foo</h3>\n"},
+	{74, "### foo ### b\n", "<h3>foo ### b</h3>\n"},
+	{75, "# foo#\n", "<h1>foo#</h1>\n"},
+	{78, "Foo bar\n# baz\nBar foo\n", "<p>Foo bar</p>\n<h1>baz</h1>\n<p>Bar foo</p>\n"},
+	{79, "## \n#\n### ###\n", "<h2></h2>\n<h1></h1>\n<h3></h3>\n"},
+
+	// Setext headings
+	{80, "Foo *bar*\n=========\n\nFoo *bar*\n---------\n", "<h1>Foo <em>bar</em></h1>\n<h2>Foo <em>bar</em></h2>\n"},
+	{81, "Foo *bar\nbaz*\n====\n", "<h1>Foo <em>bar\nbaz</em></h1>\n"},
+	{93, "> Foo\n---\n", "<blockquote>\n<p>Foo</p>\n</blockquote>\n<hr />\n"},
+	{97, "---\n---\n", "<hr />\n<hr />\n"},
+	{102, "\\> foo\n------\n", "<h2>&gt; foo</h2>\n"},
+
+	// Indented code blocks
+	{107, "    a simple\n      indented code block\n", "<pre><code>a simple\n  indented code block\n</code></pre>\n"},
+	{110, "    <a/>\n    *hi*\n\n    - one\n", "<pre><code>&lt;a/&gt;\n*hi*\n\n- one\n</code></pre>\n"},
+	{113, "Foo\n    bar\n", "<p>Foo\nbar</p>\n"},
+	{114, "    foo\nbar\n", "<pre><code>foo\n</code></pre>\n<p>bar</p>\n"},
+
+	// Fenced code blocks
+	{119, "```\n<\n >\n```\n", "<pre><code>&lt;\n &gt;\n</code></pre>\n"},
+	{120, "~~~\n<\n >\n~~~\n", "<pre><code>&lt;\n &gt;\n</code></pre>\n"},
+	{122, "```\naaa\n~~~\n```\n", "<pre><code>aaa\n~~~\n</code></pre>\n"},
+	{126, "```\n", "<pre><code></code></pre>\n"},
+	{128, "> ```\n> aaa\n\nbbb\n", "<blockquote>\n<pre><code>aaa\n</code></pre>\n</blockquote>\n<p>bbb</p>\n"},
+	{131, " ```\n aaa\naaa\n```\n", "<pre><code>aaa\naaa\n</code></pre>\n"},
+	{142, "```ruby\ndef foo(x)\n  return 3\nend\n```\n", "<pre><code class=\"language-ruby\">def foo(x)\n  return 3\nend\n</code></pre>\n"},
+	{145, "``` aa ```\nfoo\n", "<p><code>aa</code>\nfoo</p>\n"},
+
+	// Link reference definitions
+	{192, "[foo]: /url \"title\"\n\n[foo]\n", "<p><a href=\"/url\" title=\"title\">foo</a></p>\n"},
+	{193, "   [foo]: \n      /url  \n           'the title'  \n\n[foo]\n", "<p><a href=\"/url\" title=\"the title\">foo</a></p>\n"},
+	{200, "[foo]: /url 'title\n\nwith blank line'\n\n[foo]\n", "<p>[foo]: /url 'title</p>\n<p>with blank line'</p>\n<p>[foo]</p>\n"},
+	{204, "[foo]: /url\\bar\\*baz \"foo\\\"bar\\baz\"\n\n[foo]\n", "<p><a href=\"/url%5Cbar*baz\" title=\"foo&quot;bar\\baz\">foo</a></p>\n"},
+	{206, "[foo]: first\n[foo]: second\n\n[foo]\n", "<p><a href=\"first\">foo</a></p>\n"},
+	{207, "[FOO]: /url\n\n[Foo]\n", "<p><a href=\"/url\">Foo</a></p>\n"},
+
+	// Paragraphs
+	{219, "aaa\n\nbbb\n", "<p>aaa</p>\n<p>bbb</p>\n"},
+	{222, "  aaa\n bbb\n", "<p>aaa\nbbb</p>\n"},
+	{225, "aaa     \nbbb     \n", "<p>aaa<br />\nbbb</p>\n"},
+
+	// Block quotes
+	{228, "> # Foo\n> bar\n> baz\n", "<blockquote>\n<h1>Foo</h1>\n<p>bar\nbaz</p>\n</blockquote>\n"},
+	{231, "    > # Foo\n    > bar\n    > baz\n", "<pre><code>&gt; # Foo\n&gt; bar\n&gt; baz\n</code></pre>\n"},
+	{232, "> # Foo\n> bar\nbaz\n", "<blockquote>\n<h1>Foo</h1>\n<p>bar\nbaz</p>\n</blockquote>\n"},
+	{234, "> foo\n---\n", "<blockquote>\n<p>foo</p>\n</blockquote>\n<hr />\n"},
+	{235, "> - foo\n- bar\n", "<blockquote>\n<ul>\n<li>foo</li>\n</ul>\n</blockquote>\n<ul>\n<li>bar</li>\n</ul>\n"},
+	{236, ">     foo\n    bar\n", "<blockquote>\n<pre><code>foo\n</code></pre>\n</blockquote>\n<pre><code>bar\n</code></pre>\n"},
+	{237, "> ```\nfoo\n```\n", "<blockquote>\n<pre><code></code></pre>\n</blockquote>\n<p>foo</p>\n<pre><code></code></pre>\n"},
+	{238, "> foo\n    - bar\n", "<blockquote>\n<p>foo\n- bar</p>\n</blockquote>\n"},
+	{239, ">\n", "<blockquote>\n</blockquote>\n"},
+	{241, "> foo\n\n> bar\n", "<blockquote>\n<p>foo</p>\n</blockquote>\n<blockquote>\n<p>bar</p>\n</blockquote>\n"},
+	{243, "> foo\n>\n> bar\n", "<blockquote>\n<p>foo</p>\n<p>bar</p>\n</blockquote>\n"},
+	{245, "foo\n> bar\n", "<p>foo</p>\n<blockquote>\n<p>bar</p>\n</blockquote>\n"},
+	{248, "> bar\nbaz\n", "<blockquote>\n<p>bar\nbaz</p>\n</blockquote>\n"},
+	{249, "> bar\n\nbaz\n", "<blockquote>\n<p>bar</p>\n</blockquote>\n<p>baz</p>\n"},
+	{250, "> > > foo\nbar\n", "<blockquote>\n<blockquote>\n<blockquote>\n<p>foo\nbar</p>\n</blockquote>\n</blockquote>\n</blockquote>\n"},
+	{251, ">>> foo\n> bar\n>>baz\n", "<blockquote>\n<blockquote>\n<blockquote>\n<p>foo\nbar\nbaz</p>\n</blockquote>\n</blockquote>\n</blockquote>\n"},
+
+	// List items
+	{253, "A paragraph\nwith two lines.\n\n    indented code\n\n> A block quote.\n",
+		"<p>A paragraph\nwith two lines.</p>\n<pre><code>indented code\n</code></pre>\n<blockquote>\n<p>A block quote.</p>\n</blockquote>\n"},
+	{254, "1.  A paragraph\n    with two lines.\n\n        indented code\n\n    > A block quote.\n",
+		"<ol>\n<li>\n<p>A paragraph\nwith two lines.</p>\n<pre><code>indented code\n</code></pre>\n<blockquote>\n<p>A block quote.</p>\n</blockquote>\n</li>\n</ol>\n"},
+	{255, "- one\n\n two\n", "<ul>\n<li>one</li>\n</ul>\n<p>two</p>\n"},
+	{256, "- one\n\n  two\n", "<ul>\n<li>\n<p>one</p>\n<p>two</p>\n</li>\n</ul>\n"},
+	{261, "-one\n\n2.two\n", "<p>-one</p>\n<p>2.two</p>\n"},
+	{265, "123456789. ok\n", "<ol start=\"123456789\">\n<li>ok</li>\n</ol>\n"},
+	{266, "1234567890. not ok\n", "<p>1234567890. not ok</p>\n"},
+	{267, "0. ok\n", "<ol start=\"0\">\n<li>ok</li>\n</ol>\n"},
+	{269, "-1. not ok\n", "<p>-1. not ok</p>\n"},
+	{278, "-\n  foo\n-\n  ```\n  bar\n  ```\n-\n      baz\n",
+		"<ul>\n<li>foo</li>\n<li>\n<pre><code>bar\n</code></pre>\n</li>\n<li>\n<pre><code>baz\n</code></pre>\n</li>\n</ul>\n"},
+	{280, "-\n\n  foo\n", "<ul>\n<li></li>\n</ul>\n<p>foo</p>\n"},
+	{290, "  1.  A paragraph\nwith two lines.\n\n          indented code\n\n      > A block quote.\n",
+		"<ol>\n<li>\n<p>A paragraph\nwith two lines.</p>\n<pre><code>indented code\n</code></pre>\n<blockquote>\n<p>A block quote.</p>\n</blockquote>\n</li>\n</ol>\n"},
+	{292, "> 1. > Blockquote\ncontinued here.\n", "<blockquote>\n<ol>\n<li>\n<blockquote>\n<p>Blockquote\ncontinued here.</p>\n</blockquote>\n</li>\n</ol>\n</blockquote>\n"},
+	{294, "- foo\n  - bar\n    - baz\n      - boo\n", "<ul>\n<li>foo\n<ul>\n<li>bar\n<ul>\n<li>baz\n<ul>\n<li>boo</li>\n</ul>\n</li>\n</ul>\n</li>\n</ul>\n</li>\n</ul>\n"},
+	{295, "- foo\n - bar\n  - baz\n   - boo\n", "<ul>\n<li>foo</li>\n<li>bar</li>\n<li>baz</li>\n<li>boo</li>\n</ul>\n"},
+	{298, "- - foo\n", "<ul>\n<li>\n<ul>\n<li>foo</li>\n</ul>\n</li>\n</ul>\n"},
+	{300, "- # Foo\n- Bar\n  ---\n  baz\n", "<ul>\n<li>\n<h1>Foo</h1>\n</li>\n<li>\n<h2>Bar</h2>\nbaz</li>\n</ul>\n"},
+
+	// Lists
+	{301, "- foo\n- bar\n+ baz\n", "<ul>\n<li>foo</li>\n<li>bar</li>\n</ul>\n<ul>\n<li>baz</li>\n</ul>\n"},
+	{302, "1. foo\n2. bar\n3) baz\n", "<ol>\n<li>foo</li>\n<li>bar</li>\n</ol>\n<ol start=\"3\">\n<li>baz</li>\n</ol>\n"},
+	{303, "Foo\n- bar\n- baz\n", "<p>Foo</p>\n<ul>\n<li>bar</li>\n<li>baz</li>\n</ul>\n"},
+	{304, "The number of windows in my house is\n14.  The number of doors is 6.\n", "<p>The number of windows in my house is\n14.  The number of doors is 6.</p>\n"},
+	{306, "- foo\n\n- bar\n\n\n- baz\n", "<ul>\n<li>\n<p>foo</p>\n</li>\n<li>\n<p>bar</p>\n</li>\n<li>\n<p>baz</p>\n</li>\n</ul>\n"},
+	{307, "- foo\n  - bar\n    - baz\n\n\n      bim\n", "<ul>\n<li>foo\n<ul>\n<li>bar\n<ul>\n<li>\n<p>baz</p>\n<p>bim</p>\n</li>\n</ul>\n</li>\n</ul>\n</li>\n</ul>\n"},
+	{312, "- a\n - b\n  - c\n   - d\n    - e\n", "<ul>\n<li>a</li>\n<li>b</li>\n<li>c</li>\n<li>d\n- e</li>\n</ul>\n"},
+	{313, "1. a\n\n  2. b\n\n    3. c\n", "<ol>\n<li>\n<p>a</p>\n</li>\n<li>\n<p>b</p>\n</li>\n</ol>\n<pre><code>3. c\n</code></pre>\n"},
+	{314, "- a\n- b\n\n- c\n", "<ul>\n<li>\n<p>a</p>\n</li>\n<li>\n<p>b</p>\n</li>\n<li>\n<p>c</p>\n</li>\n</ul>\n"},
+	{315, "* a\n*\n\n* c\n", "<ul>\n<li>\n<p>a</p>\n</li>\n<li></li>\n<li>\n<p>c</p>\n</li>\n</ul>\n"},
+	{316, "- a\n- b\n\n  c\n- d\n", "<ul>\n<li>\n<p>a</p>\n</li>\n<li>\n<p>b</p>\n<p>c</p>\n</li>\n<li>\n<p>d</p>\n</li>\n</ul>\n"},
+	{317, "- a\n- b\n\n  [ref]: /url\n- d\n", "<ul>\n<li>\n<p>a</p>\n</li>\n<li>\n<p>b</p>\n</li>\n<li>\n<p>d</p>\n</li>\n</ul>\n"},
+	{318, "- a\n- ```\n  b\n\n\n  ```\n- c\n", "<ul>\n<li>a</li>\n<li>\n<pre><code>b\n\n\n</code></pre>\n</li>\n<li>c</li>\n</ul>\n"},
+	{319, "- a\n  - b\n\n    c\n- d\n", "<ul>\n<li>a\n<ul>\n<li>\n<p>b</p>\n<p>c</p>\n</li>\n</ul>\n</li>\n<li>d</li>\n</ul>\n"},
+	{320, "* a\n  > b\n  >\n* c\n", "<ul>\n<li>a\n<blockquote>\n<p>b</p>\n</blockquote>\n</li>\n<li>c</li>\n</ul>\n"},
+	{321, "- a\n  > b\n  ```\n  c\n  ```\n- d\n", "<ul>\n<li>a\n<blockquote>\n<p>b</p>\n</blockquote>\n<pre><code>c\n</code></pre>\n</li>\n<li>d</li>\n</ul>\n"},
+	{322, "- a\n", "<ul>\n<li>a</li>\n</ul>\n"},
+	{323, "- a\n  - b\n", "<ul>\n<li>a\n<ul>\n<li>b</li>\n</ul>\n</li>\n</ul>\n"},
+	{324, "1. ```\n   foo\n   ```\n\n   bar\n", "<ol>\n<li>\n<pre><code>foo\n</code></pre>\n<p>bar</p>\n</li>\n</ol>\n"},
+	{325, "* foo\n  * bar\n\n  baz\n", "<ul>\n<li>\n<p>foo</p>\n<ul>\n<li>bar</li>\n</ul>\n<p>baz</p>\n</li>\n</ul>\n"},
+	{326, "- a\n  - b\n  - c\n\n- d\n  - e\n  - f\n", "<ul>\n<li>\n<p>a</p>\n<ul>\n<li>b</li>\n<li>c</li>\n</ul>\n</li>\n<li>\n<p>d</p>\n<ul>\n<li>e</li>\n<li>f</li>\n</ul>\n</li>\n</ul>\n"},
+
+	// Code spans
+	{328, "`foo`\n", "<p><code>foo</code></p>\n"},
+	{329, "`` foo ` bar ``\n", "<p><code>foo ` bar</code></p>\n"},
+	{330, "` `` `\n", "<p><code>``</code></p>\n"},
+	{331, "`  ``  `\n", "<p><code> `` </code></p>\n"},
+	{335, "``\nfoo\nbar  \nbaz\n``\n", "<p><code>foo bar   baz</code></p>\n"},
+	{338, "`foo\\`bar`\n", "<p><code>foo\\</code>bar`</p>\n"},
+	{341, "*foo`*`\n", "<p>*foo<code>*</code></p>\n"},
+	{342, "[not a `link](/foo`)\n", "<p>[not a <code>link](/foo</code>)</p>\n"},
+	{348, "```foo``\n", "<p>```foo``</p>\n"},
+	{349, "`foo\n", "<p>`foo</p>\n"},
+
+	// Emphasis and strong emphasis
+	{350, "*foo bar*\n", "<p><em>foo bar</em></p>\n"},
+	{351, "a * foo bar*\n", "<p>a * foo bar*</p>\n"},
+	{352, "a*\"foo\"*\n", "<p>a*&quot;foo&quot;*</p>\n"},
+	{355, "foo*bar*\n", "<p>foo<em>bar</em></p>\n"},
+	{357, "_foo bar_\n", "<p><em>foo bar</em></p>\n"},
+	{361, "foo_bar_\n", "<p>foo_bar_</p>\n"},
+	{365, "foo-_(bar)_\n", "<p>foo-<em>(bar)</em></p>\n"},
+	{366, "_foo*\n", "<p>_foo*</p>\n"},
+	{378, "**foo bar**\n", "<p><strong>foo bar</strong></p>\n"},
+	{384, "foo__bar__\n", "<p>foo__bar__</p>\n"},
+	{387, "__foo, __bar__, baz__\n", "<p><strong>foo, <strong>bar</strong>, baz</strong></p>\n"},
+	{403, "*foo [bar](/url)*\n", "<p><em>foo <a href=\"/url\">bar</a></em></p>\n"},
+	{406, "*foo**bar**baz*\n", "<p><em>foo<strong>bar</strong>baz</em></p>\n"},
+	{407, "*foo**bar*\n", "<p><em>foo**bar</em></p>\n"},
+	{411, "foo***bar***baz\n", "<p>foo<em><strong>bar</strong></em>baz</p>\n"},
+	{412, "foo******bar*********baz\n", "<p>foo<strong><strong><strong>bar</strong></strong></strong>***baz</p>\n"},
+	{413, "*foo **bar *baz* bim** bop*\n", "<p><em>foo <strong>bar <em>baz</em> bim</strong> bop</em></p>\n"},
+	{418, "**foo*bar*baz**\n", "<p><strong>foo<em>bar</em>baz</strong></p>\n"},
+	{446, "*foo**\n", "<p><em>foo</em>*</p>\n"},
+	{447, "**foo*\n", "<p>*<em>foo</em></p>\n"},
+	{465, "*[bar*](/url)\n", "<p>*<a href=\"/url\">bar*</a></p>\n"},
+	{467, "*a `*`*\n", "<p><em>a <code>*</code></em></p>\n"},
+
+	// Links
+	{482, "[link](/uri \"title\")\n", "<p><a href=\"/uri\" title=\"title\">link</a></p>\n"},
+	{483, "[link](/uri)\n", "<p><a href=\"/uri\">link</a></p>\n"},
+	{485, "[link]()\n", "<p><a href=\"\">link</a></p>\n"},
+	{486, "[link](<>)\n", "<p><a href=\"\">link</a></p>\n"},
+	{488, "[link](/my uri)\n", "<p>[link](/my uri)</p>\n"},
+	{494, "[link](\\(foo\\))\n", "<p><a href=\"(foo)\">link</a></p>\n"},
+	{495, "[link](foo(and(bar)))\n", "<p><a href=\"foo(and(bar))\">link</a></p>\n"},
+	{499, "[link](foo\\)\\:)\n", "<p><a href=\"foo):\">link</a></p>\n"},
+	{500, "[link](#fragment)\n\n[link](https://example.com#fragment)\n\n[link](https://example.com?foo=3#frag)\n",
+		"<p><a href=\"#fragment\">link</a></p>\n<p><a href=\"https://example.com#fragment\">link</a></p>\n<p><a href=\"https://example.com?foo=3#frag\">link</a></p>\n"},
+	{505, "[link](/url \"title\")\n[link](/url 'title')\n[link](/url (title))\n",
+		"<p><a href=\"/url\" title=\"title\">link</a>\n<a href=\"/url\" title=\"title\">link</a>\n<a href=\"/url\" title=\"title\">link</a></p>\n"},
+	{512, "[link [foo [bar]]](/uri)\n", "<p><a href=\"/uri\">link [foo [bar]]</a></p>\n"},
+	{513, "[link] bar](/uri)\n", "<p>[link] bar](/uri)</p>\n"},
+	{518, "[link *foo **bar** `#`*](/uri)\n", "<p><a href=\"/uri\">link <em>foo <strong>bar</strong> <code>#</code></em></a></p>\n"},
+	{520, "[foo [bar](/uri)](/uri)\n", "<p>[foo <a href=\"/uri\">bar</a>](/uri)</p>\n"},
+	{521, "[foo *[bar [baz](/uri)](/uri)*](/uri)\n", "<p>[foo <em>[bar <a href=\"/uri\">baz</a>](/uri)</em>](/uri)</p>\n"},
+	{523, "*[foo*](/uri)\n", "<p>*<a href=\"/uri\">foo*</a></p>\n"},
+	{524, "[foo *bar](baz*)\n", "<p><a href=\"baz*\">foo *bar</a></p>\n"},
+	{528, "[foo][bar]\n\n[bar]: /url \"title\"\n", "<p><a href=\"/url\" title=\"title\">foo</a></p>\n"},
+	{540, "[foo][BaR]\n\n[bar]: /url \"title\"\n", "<p><a href=\"/url\" title=\"title\">foo</a></p>\n"},
+	{553, "[foo][]\n\n[foo]: /url \"title\"\n", "<p><a href=\"/url\" title=\"title\">foo</a></p>\n"},
+	{562, "[foo]\n\n[foo]: /url \"title\"\n", "<p><a href=\"/url\" title=\"title\">foo</a></p>\n"},
+	{568, "\\[foo]\n\n[foo]: /url \"title\"\n", "<p>[foo]</p>\n"},
+
+	// Images
+	{572, "![foo](/url \"title\")\n", "<p><img src=\"/url\" alt=\"foo\" title=\"title\" /></p>\n"},
+	{573, "![foo *bar*]\n\n[foo *bar*]: train.jpg \"train & tracks\"\n", "<p><img src=\"train.jpg\" alt=\"foo bar\" title=\"train &amp; tracks\" /></p>\n"},
+	{578, "![foo](train.jpg)\n", "<p><img src=\"train.jpg\" alt=\"foo\" /></p>\n"},
+	{580, "![](/url)\n", "<p><img src=\"/url\" alt=\"\" /></p>\n"},
+
+	// Autolinks
+	{593, "<http://foo.bar.baz>\n", "<p><a href=\"http://foo.bar.baz\">http://foo.bar.baz</a></p>\n"},
+	{600, "<MAILTO:FOO@BAR.BAZ>\n", "<p><a href=\"MAILTO:FOO@BAR.BAZ\">MAILTO:FOO@BAR.BAZ</a></p>\n"},
+	{603, "<http://foo.bar/baz bim>\n", "<p>&lt;http://foo.bar/baz bim&gt;</p>\n"},
+	{605, "<foo@bar.example.com>\n", "<p><a href=\"mailto:foo@bar.example.com\">foo@bar.example.com</a></p>\n"},
+	{607, "<foo\\+@bar.example.com>\n", "<p>&lt;foo+@bar.example.com&gt;</p>\n"},
+	{608, "<>\n", "<p>&lt;&gt;</p>\n"},
+	{612, "http://example.com\n", "<p>http://example.com</p>\n"},
+
+	// Hard and soft line breaks
+	{633, "foo  \nbaz\n", "<p>foo<br />\nbaz</p>\n"},
+	{634, "foo\\\nbaz\n", "<p>foo<br />\nbaz</p>\n"},
+	{636, "foo       \n     bar\n", "<p>foo<br />\nbar</p>\n"},
+	{638, "*foo  \nbar*\n", "<p><em>foo<br />\nbar</em></p>\n"},
+	{640, "`code  \nspan`\n", "<p><code>code   span</code></p>\n"},
+	{644, "foo\\\n", "<p>foo\\</p>\n"},
+	{645, "foo  \n", "<p>foo</p>\n"},
+	{646, "### foo\\\n", "<h3>foo\\</h3>\n"},
+	{648, "foo\nbaz\n", "<p>foo\nbaz</p>\n"},
+	{649, "foo \n baz\n", "<p>foo\nbaz</p>\n"},
+
+	// Textual content
+	{650, "hello $.;'there\n", "<p>hello $.;'there</p>\n"},
+	{651, "Foo χρῆν\n", "<p>Foo χρῆν</p>\n"},
+	{652, "Multiple     spaces\n", "<p>Multiple     spaces</p>\n"},
+}
+
+// specEscaping turns the escapes html.EscapeString writes into the ones the spec's
+// reference output uses
+var specEscaping = strings.NewReplacer("&#34;", "&quot;", "&#39;", "'")
+
+func TestRenderMarkdownSpec(t *testing.T) {
+	for _, example := range markdownSpecExamples {
+		got := specEscaping.Replace(RenderMarkdown(example.markdown))
+		if got != example.html {
+			t.Errorf("example %d: RenderMarkdown(%q)\n got: %q\nwant: %q", example.example, example.markdown, got, example.html)
+		}
+	}
+}
+
+func TestRenderMarkdownSanitizes(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		html     string
+	}{
+		{"script block", "<script>alert(1)</script>\n", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"inline tag with handler", "Hi <img src=x onerror=alert(1)> there\n", "<p>Hi &lt;img src=x onerror=alert(1)&gt; there</p>\n"},
+		{"html comment", "<!-- hidden -->\n", "<p>&lt;!-- hidden --&gt;</p>\n"},
+		{"javascript link", "[click](javascript:alert(1))\n", "<p>click</p>\n"},
+		{"uppercase scheme", "[click](JavaScript:alert(1))\n", "<p>click</p>\n"},
+		{"entity in scheme", "[click](javascript&#58;alert(1))\n", "<p>click</p>\n"},
+		{"tab in scheme", "[click](java&#9;script:alert(1))\n", "<p><a href=\"java%09script:alert(1)\">click</a></p>\n"},
+		{"control character prefix", "[click](<&#1;javascript:alert(1)>)\n", "<p><a href=\"%01javascript:alert(1)\">click</a></p>\n"},
+		{"vbscript link", "[click](vbscript:msgbox)\n", "<p>click</p>\n"},
+		{"data link", "[click](data:text/html;base64,PHNjcmlwdD4=)\n", "<p>click</p>\n"},
+		{"javascript autolink", "<javascript:alert(1)>\n", "<p>javascript:alert(1)</p>\n"},
+		{"javascript reference", "[click][x]\n\n[x]: javascript:alert(1)\n", "<p>click</p>\n"},
+		{"javascript image", "![alt](javascript:alert(1))\n", "<p>alt</p>\n"},
+		{"quote in destination", "[click](/a\"onmouseover=\"alert(1))\n", "<p><a href=\"/a%22onmouseover=%22alert(1)\">click</a></p>\n"},
+		{"escape at the end of a destination", "[a](/a%20) [b](/b%2)\n", "<p><a href=\"/a%20\">a</a> <a href=\"/b%252\">b</a></p>\n"},
+		{"quote in title", "[click](/a \"x&quot; onmouseover=&quot;alert(1)\")\n", "<p><a href=\"/a\" title=\"x&#34; onmouseover=&#34;alert(1)\">click</a></p>\n"},
+		{"allowed schemes", "[a](https://x.test) [b](mailto:a@x.test) [c](tel:+1) [d](/path)\n",
+			"<p><a href=\"https://x.test\">a</a> <a href=\"mailto:a@x.test\">b</a> <a href=\"tel:+1\">c</a> <a href=\"/path\">d</a></p>\n"},
+		{"html in code", "`<b>`\n\n    <i>\n", "<p><code>&lt;b&gt;</code></p>\n<pre><code>&lt;i&gt;\n</code></pre>\n"},
+	}
+	for _, test := range tests {
+		if got := RenderMarkdown(test.markdown); got != test.html {
+			t.Errorf("%s: RenderMarkdown(%q)\n got: %q\nwant: %q", test.name, test.markdown, got, test.html)
+		}
+	}
+}
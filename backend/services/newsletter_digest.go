@@ -0,0 +1,51 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DigestItem is one entry of a newsletter digest: a post, guide or product
+type DigestItem struct {
+	Title   string
+	Summary string
+	URL     string
+	Image   string
+	Meta    string // Short line under the title, e.g. a view count or price
+}
+
+// DigestSection is a titled group of digest entries
+type DigestSection struct {
+	Title string
+	Items []DigestItem
+}
+
+// RenderDigest renders a digest with the newsletter digest template
+func (e *EmailService) RenderDigest(subject, intro string, sections []DigestSection) (*RenderedEmail, error) {
+	return e.templates.Render(EmailTemplateNewsletterDigest, DigestEmail{Subject: subject, Intro: intro, Sections: sections})
+}
+
+// DigestMarkdown renders a digest as the markdown-like text newsletters keep as content,
+// which also serves as the plain-text version
+func DigestMarkdown(intro string, sections []DigestSection) string {
+	var text strings.Builder
+	text.WriteString(intro + "\n")
+
+	for _, section := range sections {
+		if len(section.Items) == 0 {
+			continue
+		}
+		fmt.Fprintf(&text, "\n## %s\n\n", section.Title)
+		for _, item := range section.Items {
+			line := "- **" + item.Title + "**"
+			if item.Meta != "" {
+				line += " (" + item.Meta + ")"
+			}
+			if item.Summary != "" {
+				line += ": " + item.Summary
+			}
+			fmt.Fprintf(&text, "%s\n  %s\n", line, item.URL)
+		}
+	}
+	return text.String()
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Spam score thresholds. Scores at or above SpamThreshold are treated as spam, scores
+// at or above ReviewThreshold are held for moderation.
+const (
+	SpamThreshold   = 1.0
+	ReviewThreshold = 0.4
+)
+
+// SpamCandidate is a comment being checked, with the context a checker may need
+type SpamCandidate struct {
+	PostSlug    string
+	AuthorName  string
+	AuthorEmail string
+	Body        string
+	Honeypot    string // Value of the hidden form field; real readers leave it empty
+	IP          string
+	// RecentComments is how many comments the same email or IP posted in the last few minutes
+	RecentComments int
+}
+
+// SpamVerdict is a checker's score for a comment and the reasons behind it
+type SpamVerdict struct {
+	Score   float64
+	Reasons []string
+}
+
+// IsSpam reports whether the verdict is over the spam threshold
+func (v SpamVerdict) IsSpam() bool {
+	return v.Score >= SpamThreshold
+}
+
+// NeedsReview reports whether the verdict should be held for a moderator
+func (v SpamVerdict) NeedsReview() bool {
+	return v.Score >= ReviewThreshold
+}
+
+// SpamChecker scores comments. Implementations can call out to a hosted service;
+// HeuristicSpamChecker is the local default.
+type SpamChecker interface {
+	Check(candidate SpamCandidate) SpamVerdict
+}
+
+// HeuristicSpamChecker scores comments with local rules: links, blocklisted words,
+// posting frequency and the honeypot field
+type HeuristicSpamChecker struct {
+	MaxLinks       int      // Links allowed before each extra one adds to the score
+	Blocklist      []string // Lower-case words or phrases that mark spam
+	MaxRecentPosts int      // Comments allowed in the frequency window
+}
+
+var linkPattern = regexp.MustCompile(`(?i)(https?://|www\.)\S+|<a\s`)
+
+// NewHeuristicSpamChecker creates the default spam checker. blocklist is a
+// comma-separated list of words or phrases.
+func NewHeuristicSpamChecker(blocklist string) *HeuristicSpamChecker {
+	var words []string
+	for _, word := range strings.Split(blocklist, ",") {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			words = append(words, word)
+		}
+	}
+	return &HeuristicSpamChecker{
+		MaxLinks:       2,
+		Blocklist:      words,
+		MaxRecentPosts: 3,
+	}
+}
+
+// Check scores a comment
+func (c *HeuristicSpamChecker) Check(candidate SpamCandidate) SpamVerdict {
+	var verdict SpamVerdict
+
+	if strings.TrimSpace(candidate.Honeypot) != "" {
+		verdict.Score += SpamThreshold
+		verdict.Reasons = append(verdict.Reasons, "honeypot field filled in")
+	}
+
+	text := candidate.AuthorName + " " + candidate.Body
+	if links := len(linkPattern.FindAllString(text, -1)); links > c.MaxLinks {
+		verdict.Score += 0.4 * float64(links-c.MaxLinks)
+		verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("%d links", links))
+	}
+
+	lower := strings.ToLower(text)
+	for _, word := range c.Blocklist {
+		if strings.Contains(lower, word) {
+			verdict.Score += 0.6
+			verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("blocklisted word %q", word))
+		}
+	}
+
+	if candidate.RecentComments >= c.MaxRecentPosts {
+		verdict.Score += 0.6
+		verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("%d comments in a few minutes", candidate.RecentComments))
+	}
+
+	return verdict
+}